@@ -0,0 +1,175 @@
+package mp3
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EncodeFromAiff encodes an AIFF or AIFF-C stream into mp3 format, like EncodeFromWav does
+// for WAV. The sample rate and channels are taken from the COMM chunk. 16, 24 and 32-bit
+// big-endian PCM are supported, and the AIFF-C compression types sowt (little-endian PCM),
+// fl32 (32-bit float) and ulaw/alaw (G.711). The samples of the SSND chunk are read up to
+// the number of sample frames of the COMM chunk.
+func EncodeFromAiff(aiffStream io.Reader, writer io.Writer, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	return EncodeFromAiffContext(context.Background(), aiffStream, writer, config, opts)
+}
+
+// EncodeFromAiffContext is EncodeFromAiff that stops with the error of ctx when ctx is done,
+// see EncodeFromWavContext.
+func EncodeFromAiffContext(ctx context.Context, aiffStream io.Reader, writer io.Writer, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	in, err := readAiffInput(aiffStream)
+	if err != nil {
+		return nil, err
+	}
+	if in.numChannels > 2 {
+		return nil, fmt.Errorf("unsupported channel count: %d", in.numChannels)
+	}
+	return encodeWavInput(ctx, in, writer, config, opts)
+}
+
+// readAiffInput reads the header of an AIFF or AIFF-C stream up to the start of the samples.
+func readAiffInput(r io.Reader) (*wavInput, error) {
+	var (
+		formHeader  [12]byte
+		chunkHeader [8]byte
+		in          *wavInput
+		frames      int64
+		sampleSize  int
+		compression = "NONE"
+	)
+
+	if _, err := io.ReadFull(r, formHeader[:]); err != nil {
+		return nil, fmt.Errorf("read FORM header failed: %w", err)
+	}
+	formType := string(formHeader[8:12])
+	if string(formHeader[0:4]) != "FORM" || (formType != "AIFF" && formType != "AIFC") {
+		return nil, errors.New("invalid AIFF header: missing FORM/AIFF")
+	}
+
+	for {
+		if _, err := io.ReadFull(r, chunkHeader[:]); err != nil {
+			return nil, fmt.Errorf("read chunk header failed: %w", err)
+		}
+		chunkID := string(chunkHeader[0:4])
+		chunkSize := int64(binary.BigEndian.Uint32(chunkHeader[4:8]))
+
+		if chunkID == "COMM" {
+			if chunkSize < 18 || (formType == "AIFC" && chunkSize < 22) {
+				return nil, fmt.Errorf("invalid COMM chunk size: %d", chunkSize)
+			}
+			// Only the format and the compression type are used, skip its name
+			var comm [22]byte
+			n := min(chunkSize, int64(len(comm)))
+			if _, err := io.ReadFull(r, comm[:n]); err != nil {
+				return nil, fmt.Errorf("read COMM chunk failed: %w", err)
+			}
+			if _, err := io.CopyN(io.Discard, r, chunkSize-n+chunkSize%2); err != nil {
+				return nil, fmt.Errorf("read COMM chunk failed: %w", err)
+			}
+			in = &wavInput{
+				numChannels: int(binary.BigEndian.Uint16(comm[0:2])),
+				sampleRate:  extendedToInt(comm[8:18]),
+			}
+			frames = int64(binary.BigEndian.Uint32(comm[2:6]))
+			sampleSize = int(binary.BigEndian.Uint16(comm[6:8]))
+			if formType == "AIFC" {
+				compression = string(comm[18:22])
+			}
+		} else if chunkID == "SSND" {
+			if in == nil {
+				return nil, errors.New("SSND chunk found before COMM chunk")
+			}
+			var ssnd [8]byte
+			if _, err := io.ReadFull(r, ssnd[:]); err != nil {
+				return nil, fmt.Errorf("read SSND chunk failed: %w", err)
+			}
+			// The samples start after offset bytes of alignment
+			offset := int64(binary.BigEndian.Uint32(ssnd[0:4]))
+			if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+				return nil, fmt.Errorf("read SSND chunk failed: %w", err)
+			}
+			break
+		} else {
+			// Skip other chunks, odd sized chunks are followed by a pad byte
+			if _, err := io.CopyN(io.Discard, r, chunkSize+chunkSize%2); err != nil {
+				return nil, fmt.Errorf("skip chunk %s failed: %w", chunkID, err)
+			}
+		}
+	}
+
+	var err error
+	bytesPerFrame := int64(in.numChannels * ((sampleSize + 7) / 8))
+	in.pcmSize = frames * bytesPerFrame
+	in.pcm = io.LimitReader(r, in.pcmSize)
+	switch compression {
+	case "NONE", "twos":
+		if in.format, err = wavSampleFormat(sampleSize); err == nil {
+			in.pcm = newByteSwapReader(in.pcm, in.format.BytesPerSample())
+		}
+	case "sowt":
+		in.format, err = wavSampleFormat(sampleSize)
+	case "fl32", "FL32":
+		in.format = F32
+		in.pcm = newByteSwapReader(in.pcm, 4)
+	case "ulaw", "ULAW", "alaw", "ALAW":
+		in.format = S16LE
+		in.pcm = newG711Reader(in.pcm, compression == "alaw" || compression == "ALAW")
+		in.pcmSize = frames * int64(in.numChannels) * 2
+	default:
+		err = fmt.Errorf("unsupported AIFF-C compression: %q (only NONE, sowt, fl32 and G.711 supported)", compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// extendedToInt converts the 80-bit IEEE 754 extended float of an AIFF sample rate to an int.
+func extendedToInt(b []byte) int {
+	exp := int(binary.BigEndian.Uint16(b[0:2]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+	shift := 16383 + 63 - exp
+	if mantissa == 0 || shift < 0 || shift > 63 {
+		return 0
+	}
+	return int(math.Round(float64(mantissa) / float64(uint64(1)<<shift)))
+}
+
+// byteSwapReader reverses the byte order of the samples read from r, e.g. big-endian AIFF
+// samples to little-endian.
+type byteSwapReader struct {
+	r    io.Reader
+	size int // bytes per sample
+}
+
+func newByteSwapReader(r io.Reader, size int) *byteSwapReader {
+	return &byteSwapReader{r: r, size: size}
+}
+
+func (s *byteSwapReader) Read(p []byte) (int, error) {
+	n := len(p) / s.size * s.size
+	if n == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	n, err := s.r.Read(p[:n])
+	// Complete the last sample, a truncated one at the end of the stream is dropped
+	if rest := n % s.size; rest != 0 && err == nil {
+		var m int
+		m, err = io.ReadFull(s.r, p[n:n+s.size-rest])
+		n += m
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+	}
+	n -= n % s.size
+	for i := 0; i < n; i += s.size {
+		for a, b := i, i+s.size-1; a < b; a, b = a+1, b-1 {
+			p[a], p[b] = p[b], p[a]
+		}
+	}
+	return n, err
+}
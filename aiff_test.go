@@ -0,0 +1,94 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// generateAiffFile returns an AIFF file, or AIFF-C if compression is set, of the samples.
+func generateAiffFile(compression string, sampleRate, numChannels, bitsPerSample int, samples []byte) []byte {
+	frames := len(samples) / (numChannels * bitsPerSample / 8)
+	comm := binary.BigEndian.AppendUint16(nil, uint16(numChannels))
+	comm = binary.BigEndian.AppendUint32(comm, uint32(frames))
+	comm = binary.BigEndian.AppendUint16(comm, uint16(bitsPerSample))
+	// The sample rate is an 80-bit extended float
+	n := bits.Len(uint(sampleRate))
+	comm = binary.BigEndian.AppendUint16(comm, uint16(16383+n-1))
+	comm = binary.BigEndian.AppendUint64(comm, uint64(sampleRate)<<(64-n))
+
+	formType := "AIFF"
+	if compression != "" {
+		formType = "AIFC"
+		comm = append(comm, compression...)
+		comm = append(comm, 0, 0) // empty name, padded
+	}
+	var b bytes.Buffer
+	b.WriteString("FORM\x00\x00\x00\x00" + formType)
+	b.WriteString("COMM")
+	binary.Write(&b, binary.BigEndian, uint32(len(comm)))
+	b.Write(comm)
+	b.WriteString("SSND")
+	binary.Write(&b, binary.BigEndian, uint32(8+len(samples)))
+	b.Write(make([]byte, 8)) // offset and block size
+	b.Write(samples)
+	out := b.Bytes()
+	binary.BigEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
+
+func TestEncodeFromAiff(t *testing.T) {
+	requireNative(t)
+	pcm := generateSineWave(440, 44100, 2, 44100)
+	var want mp3.SeekableBuffer
+	wantResult, err := mp3.EncodeFromWav(bytes.NewReader(append(mp3.GenerateWavHeader(len(pcm), 44100, 2, 16), pcm...)), &want, nil, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	be16 := make([]byte, 0, len(pcm))
+	be24 := make([]byte, 0, len(pcm)/2*3)
+	fl32 := make([]byte, 0, len(pcm)*2)
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := int16(binary.LittleEndian.Uint16(pcm[i:]))
+		be16 = append(be16, pcm[i+1], pcm[i])
+		be24 = append(be24, pcm[i+1], pcm[i], 0)
+		fl32 = binary.BigEndian.AppendUint32(fl32, math.Float32bits(float32(v)/32768))
+	}
+
+	testCases := []struct {
+		name  string
+		aiff  []byte
+		exact bool // output equals the 16-bit WAV encoding
+	}{
+		{"AIFF 16-bit", generateAiffFile("", 44100, 2, 16, be16), true},
+		{"AIFF 24-bit", generateAiffFile("", 44100, 2, 24, be24), true},
+		{"AIFF-C sowt", generateAiffFile("sowt", 44100, 2, 16, pcm), true},
+		{"AIFF-C fl32", generateAiffFile("fl32", 44100, 2, 32, fl32), false},
+	}
+	for _, tc := range testCases {
+		var out mp3.SeekableBuffer
+		result, err := mp3.EncodeFromAiff(bytes.NewReader(tc.aiff), &out, nil, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromAiff(%s) failed: %v", tc.name, err)
+		}
+		if result.Config.SampleRate != 44100 || result.Config.NumChannels != 2 || result.Frames != wantResult.Frames {
+			t.Errorf("%s: %d Hz, %d channels, %d frames", tc.name, result.Config.SampleRate, result.Config.NumChannels, result.Frames)
+		}
+		if tc.exact && !bytes.Equal(out.Bytes(), want.Bytes()) {
+			t.Errorf("%s: output differs from the WAV encoding", tc.name)
+		}
+		t.Logf("✓ %s: %d frames", tc.name, result.Frames)
+	}
+
+	if _, err := mp3.EncodeFromAiff(bytes.NewReader(generateAiffFile("ima4", 44100, 2, 16, pcm)), &mp3.SeekableBuffer{}, nil, nil); err == nil {
+		t.Error("Expected an error for IMA ADPCM")
+	}
+	if _, err := mp3.EncodeFromAiff(bytes.NewReader(mp3.GenerateWavHeader(len(pcm), 44100, 2, 16)), &mp3.SeekableBuffer{}, nil, nil); err == nil {
+		t.Error("Expected an error for a WAV stream")
+	}
+}
@@ -0,0 +1,115 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EncodeAlbum encodes consecutive WAV tracks, e.g. of a live album, into one mp3 output each,
+// without the gap that Flush leaves at the end of a track: a player that plays the outputs
+// back to back, or their concatenation, plays the audio continuously.
+// All tracks must have the sample rate and channel count of the first one, which override
+// the values in config. Xing/LAME tags are written if all outputs implement io.WriteSeeker.
+// ReplayGain analysis is not supported, FindReplayGain, Tags and WriteID3v1
+// are ignored.
+// opts may be nil to use the default buffering.
+func EncodeAlbum(tracks []io.Reader, outputs []io.Writer, config *EncoderConfig, opts *WavOptions) ([]*EncodeResult, error) {
+	if len(tracks) == 0 {
+		return nil, errors.New("no tracks")
+	}
+	if len(outputs) != len(tracks) {
+		return nil, fmt.Errorf("%d outputs for %d tracks", len(outputs), len(tracks))
+	}
+	config = populateEncConfig(config)
+	config.FindReplayGain = false
+	config.Tags = nil
+	config.WriteID3v1 = false
+
+	writers := make([]io.Writer, len(outputs))
+	copy(writers, outputs)
+	for _, w := range outputs {
+		if _, ok := w.(io.WriteSeeker); !ok {
+			// Hide the Seek method, so the encoder does not write tags that can not be updated
+			for i := range writers {
+				writers[i] = struct{ io.Writer }{outputs[i]}
+			}
+			break
+		}
+	}
+
+	var (
+		out       *wavOutput
+		inBuf     = make([]byte, opts.chunkSize())
+		results   = make([]*EncodeResult, 0, len(tracks))
+		albumRate int
+		albumCh   int
+	)
+	defer func() {
+		if out != nil {
+			out.close()
+		}
+	}()
+
+	for i, track := range tracks {
+		in, err := readWavInput(track)
+		if err != nil {
+			return results, fmt.Errorf("track %d: %w", i+1, err)
+		}
+		sampleRate, numChannels := in.sampleRate, in.numChannels
+
+		if out == nil {
+			if numChannels > 2 {
+				return nil, fmt.Errorf("track 1: unsupported channel count: %d", numChannels)
+			}
+			out, err = newWavOutput(writers[0], config, sampleRate, numChannels, len(inBuf))
+			if err != nil {
+				return nil, err
+			}
+			if err := out.encoder.SetNoGapTotal(len(tracks)); err != nil {
+				return nil, err
+			}
+			albumRate, albumCh = sampleRate, numChannels
+		} else {
+			if sampleRate != albumRate || numChannels != albumCh {
+				return results, fmt.Errorf("track %d: %d Hz %d channels differ from the first track (%d Hz %d channels)",
+					i+1, sampleRate, numChannels, albumRate, albumCh)
+			}
+			if err := out.encoder.NextTrack(); err != nil {
+				return results, err
+			}
+			out.writer = writers[i]
+			out.seeker, _ = writers[i].(io.WriteSeeker)
+			out.totalBytes = 0
+		}
+
+		out.format = in.format
+		pcm := in.pcm
+		for {
+			n, err := pcm.Read(inBuf)
+			if n > 0 {
+				if encErr := out.encode(inBuf[:n]); encErr != nil {
+					return results, encErr
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return results, err
+			}
+		}
+
+		// The last track flushes the encoder delay
+		flush := out.encoder.FlushNoGap
+		if i == len(tracks)-1 {
+			flush = out.encoder.Flush
+		}
+		result, err := out.finishWith(flush)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
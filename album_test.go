@@ -0,0 +1,76 @@
+package mp3_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	mp3 "github.com/lizc2003/audio-mp3"
+)
+
+func TestEncodeAlbum(t *testing.T) {
+	requireNative(t)
+	const trackSamples = 30000 // not a multiple of the frame length
+	pcm := generateWavFile(44100, 2, 3*trackSamples)[mp3.WavHeaderSize:]
+	config := &mp3.EncoderConfig{Bitrate: 128}
+
+	var (
+		tracks  []io.Reader
+		outputs []io.Writer
+		buffers []*mp3.SeekableBuffer
+		wavs    [][]byte
+	)
+	for i := range 3 {
+		part := pcm[i*trackSamples*4 : (i+1)*trackSamples*4]
+		wav := append(mp3.GenerateWavHeader(len(part), 44100, 2, 16), part...)
+		wavs = append(wavs, wav)
+		tracks = append(tracks, bytes.NewReader(wav))
+		buf := &mp3.SeekableBuffer{}
+		buffers = append(buffers, buf)
+		outputs = append(outputs, buf)
+	}
+
+	results, err := mp3.EncodeAlbum(tracks, outputs, config, nil)
+	if err != nil {
+		t.Fatalf("EncodeAlbum failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	albumFrames, separateFrames := 0, 0
+	for i, buf := range buffers {
+		data := buf.Bytes()
+		if int64(len(data)) != results[i].TotalBytes {
+			t.Errorf("track %d: TotalBytes = %d, wrote %d", i+1, results[i].TotalBytes, len(data))
+		}
+		// Each track starts with its own Xing/Info tag and decodes on its own
+		if !bytes.Contains(data[:200], []byte("Info")) && !bytes.Contains(data[:200], []byte("Xing")) {
+			t.Errorf("track %d: no Xing/Info tag", i+1)
+		}
+		if decoded := decodeAll(t, data); len(decoded) == 0 {
+			t.Errorf("track %d: no audio decoded", i+1)
+		}
+		albumFrames += results[i].Frames
+
+		var separate mp3.SeekableBuffer
+		result, err := mp3.EncodeFromWav(bytes.NewReader(wavs[i]), &separate, config, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		separateFrames += result.Frames
+	}
+	// Separately encoded tracks each flush the encoder delay and pad the last frame
+	if albumFrames >= separateFrames {
+		t.Errorf("album has %d frames, separate tracks %d", albumFrames, separateFrames)
+	}
+
+	if _, err := mp3.EncodeAlbum(tracks[:2], outputs[:1], config, nil); err == nil {
+		t.Error("EncodeAlbum with missing output succeeded")
+	}
+	mono := bytes.NewReader(generateWavFile(44100, 1, 1000))
+	if _, err := mp3.EncodeAlbum([]io.Reader{bytes.NewReader(wavs[0]), mono}, outputs[:2], config, nil); err == nil {
+		t.Error("EncodeAlbum with mixed channel counts succeeded")
+	}
+	t.Logf("✓ EncodeAlbum: %d frames gapless, %d separately", albumFrames, separateFrames)
+}
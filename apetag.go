@@ -0,0 +1,173 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	ID3v1TagSize     = 128
+	APEv2FooterSize  = 32
+	lyrics3v1MaxSize = 5100
+)
+
+// TagKind identifies a metadata block found around the audio data.
+type TagKind int
+
+const (
+	TagID3v1 TagKind = iota + 1
+	TagAPEv2
+	TagLyrics3v1
+	TagLyrics3v2
+)
+
+func (k TagKind) String() string {
+	switch k {
+	case TagID3v1:
+		return "ID3v1"
+	case TagAPEv2:
+		return "APEv2"
+	case TagLyrics3v1:
+		return "Lyrics3v1"
+	case TagLyrics3v2:
+		return "Lyrics3v2"
+	default:
+		return "unknown"
+	}
+}
+
+// TagLocation describes where a tag is stored in a stream.
+type TagLocation struct {
+	Kind   TagKind
+	Offset int64
+	Size   int64
+}
+
+// FindTrailingTags detects ID3v1, APEv2 and Lyrics3 tags at the end of a stream of the given size.
+// The returned tags are ordered by offset. The audio data ends at the offset of the first tag.
+func FindTrailingTags(r io.ReaderAt, size int64) ([]TagLocation, error) {
+	var tags []TagLocation
+	end := size
+
+	for {
+		tag, err := findTrailingTag(r, end, len(tags) == 0)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			break
+		}
+		tags = append([]TagLocation{*tag}, tags...)
+		end = tag.Offset
+	}
+	return tags, nil
+}
+
+// StripTrailingTags copies the stream to w without its trailing tags.
+// Tags whose kind is listed in preserve are copied after the audio data in their original order.
+// It returns the number of bytes written.
+func StripTrailingTags(r io.ReaderAt, size int64, w io.Writer, preserve ...TagKind) (int64, error) {
+	tags, err := FindTrailingTags(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	audioEnd := size
+	if len(tags) > 0 {
+		audioEnd = tags[0].Offset
+	}
+	written, err := io.Copy(w, io.NewSectionReader(r, 0, audioEnd))
+	if err != nil {
+		return written, err
+	}
+
+	for _, tag := range tags {
+		if !containsTagKind(preserve, tag.Kind) {
+			continue
+		}
+		n, err := io.Copy(w, io.NewSectionReader(r, tag.Offset, tag.Size))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// findTrailingTag returns the tag ending at end, or nil if none is found.
+// ID3v1 is only accepted as the last block of the stream.
+func findTrailingTag(r io.ReaderAt, end int64, allowID3v1 bool) (*TagLocation, error) {
+	if allowID3v1 && end >= ID3v1TagSize {
+		var buf [3]byte
+		if _, err := r.ReadAt(buf[:], end-ID3v1TagSize); err != nil {
+			return nil, err
+		}
+		if string(buf[:]) == "TAG" {
+			return &TagLocation{Kind: TagID3v1, Offset: end - ID3v1TagSize, Size: ID3v1TagSize}, nil
+		}
+	}
+
+	if end >= APEv2FooterSize {
+		var footer [APEv2FooterSize]byte
+		if _, err := r.ReadAt(footer[:], end-APEv2FooterSize); err != nil {
+			return nil, err
+		}
+		if string(footer[0:8]) == "APETAGEX" {
+			tagSize := int64(binary.LittleEndian.Uint32(footer[12:16]))
+			flags := binary.LittleEndian.Uint32(footer[20:24])
+			if flags&(1<<31) != 0 {
+				tagSize += APEv2FooterSize // header
+			}
+			if tagSize < APEv2FooterSize || tagSize > end {
+				return nil, fmt.Errorf("invalid APEv2 tag size: %d", tagSize)
+			}
+			return &TagLocation{Kind: TagAPEv2, Offset: end - tagSize, Size: tagSize}, nil
+		}
+	}
+
+	if end >= 15 {
+		var buf [15]byte
+		if _, err := r.ReadAt(buf[:], end-15); err != nil {
+			return nil, err
+		}
+		if string(buf[6:]) == "LYRICS200" {
+			n, err := strconv.Atoi(string(buf[:6]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Lyrics3v2 size: %q", buf[:6])
+			}
+			tagSize := int64(n) + 15
+			if tagSize > end {
+				return nil, fmt.Errorf("invalid Lyrics3v2 tag size: %d", tagSize)
+			}
+			return &TagLocation{Kind: TagLyrics3v2, Offset: end - tagSize, Size: tagSize}, nil
+		}
+		if string(buf[6:]) == "LYRICSEND" {
+			// Lyrics3v1 has no size field, search backwards for the start marker
+			start := max(end-lyrics3v1MaxSize-20, 0)
+			data := make([]byte, end-start)
+			if _, err := r.ReadAt(data, start); err != nil {
+				return nil, err
+			}
+			idx := bytes.LastIndex(data, []byte("LYRICSBEGIN"))
+			if idx < 0 {
+				return nil, nil
+			}
+			offset := start + int64(idx)
+			return &TagLocation{Kind: TagLyrics3v1, Offset: offset, Size: end - offset}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func containsTagKind(kinds []TagKind, kind TagKind) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
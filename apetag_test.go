@@ -0,0 +1,101 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestFindTrailingTags tests detection of APEv2, Lyrics3v2 and ID3v1 tags
+func TestFindTrailingTags(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 256)
+	ape := makeAPEv2Tag([]byte("item-data"))
+	lyrics := makeLyrics3v2Tag("some lyrics")
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+
+	var stream []byte
+	stream = append(stream, audio...)
+	stream = append(stream, ape...)
+	stream = append(stream, lyrics...)
+	stream = append(stream, id3v1...)
+
+	tags, err := mp3.FindTrailingTags(bytes.NewReader(stream), int64(len(stream)))
+	if err != nil {
+		t.Fatalf("FindTrailingTags failed: %v", err)
+	}
+
+	want := []mp3.TagLocation{
+		{Kind: mp3.TagAPEv2, Offset: int64(len(audio)), Size: int64(len(ape))},
+		{Kind: mp3.TagLyrics3v2, Offset: int64(len(audio) + len(ape)), Size: int64(len(lyrics))},
+		{Kind: mp3.TagID3v1, Offset: int64(len(audio) + len(ape) + len(lyrics)), Size: 128},
+	}
+	if len(tags) != len(want) {
+		t.Fatalf("Tag count mismatch: got %v, want %v", tags, want)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("Tag %d mismatch: got %+v, want %+v", i, tags[i], want[i])
+		}
+	}
+
+	t.Run("Strip", func(t *testing.T) {
+		var out bytes.Buffer
+		if _, err := mp3.StripTrailingTags(bytes.NewReader(stream), int64(len(stream)), &out); err != nil {
+			t.Fatalf("StripTrailingTags failed: %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), audio) {
+			t.Errorf("Stripped stream length: got %d, want %d", out.Len(), len(audio))
+		}
+	})
+
+	t.Run("Preserve", func(t *testing.T) {
+		var out bytes.Buffer
+		if _, err := mp3.StripTrailingTags(bytes.NewReader(stream), int64(len(stream)), &out, mp3.TagID3v1); err != nil {
+			t.Fatalf("StripTrailingTags failed: %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), append(append([]byte{}, audio...), id3v1...)) {
+			t.Errorf("Preserved stream length: got %d, want %d", out.Len(), len(audio)+len(id3v1))
+		}
+	})
+
+	t.Run("NoTags", func(t *testing.T) {
+		tags, err := mp3.FindTrailingTags(bytes.NewReader(audio), int64(len(audio)))
+		if err != nil {
+			t.Fatalf("FindTrailingTags failed: %v", err)
+		}
+		if len(tags) != 0 {
+			t.Errorf("Expected no tags, got %v", tags)
+		}
+	})
+
+	t.Logf("✓ Found %d trailing tags", len(tags))
+}
+
+// makeAPEv2Tag builds an APEv2 tag with header and footer
+func makeAPEv2Tag(items []byte) []byte {
+	block := func(isHeader bool) []byte {
+		b := make([]byte, 32)
+		copy(b[0:8], "APETAGEX")
+		binary.LittleEndian.PutUint32(b[8:12], 2000)
+		binary.LittleEndian.PutUint32(b[12:16], uint32(len(items)+32))
+		binary.LittleEndian.PutUint32(b[16:20], 1)
+		flags := uint32(1 << 31)
+		if isHeader {
+			flags |= 1 << 29
+		}
+		binary.LittleEndian.PutUint32(b[20:24], flags)
+		return b
+	}
+	tag := block(true)
+	tag = append(tag, items...)
+	return append(tag, block(false)...)
+}
+
+// makeLyrics3v2Tag builds a Lyrics3v2 tag
+func makeLyrics3v2Tag(lyrics string) []byte {
+	body := "LYRICSBEGIN" + "LYR" + fmt.Sprintf("%05d", len(lyrics)) + lyrics
+	return []byte(body + fmt.Sprintf("%06d", len(body)) + "LYRICS200")
+}
@@ -0,0 +1,122 @@
+package mp3
+
+import (
+	"sync"
+)
+
+const (
+	EstimateFrames = 10
+)
+
+// DecoderBackend is a cgo-free mp3 decoder implementation.
+// It is used by Decoder in builds without cgo or with the purego build tag,
+// where mpg123 is not available. NewGoDecoderBackend creates the built-in one.
+type DecoderBackend interface {
+	// Decode feeds a chunk of the mp3 stream and writes decoded interleaved PCM to out.
+	// It returns the number of bytes written to out.
+	Decode(in, out []byte) (n int, err error)
+
+	// Format returns the output format, valid once Decode has produced data.
+	Format() (sampleRate int, numChannels int, sampleBitDepth int)
+
+	Close()
+}
+
+// EncoderBackend is a cgo-free mp3 encoder implementation.
+// It is used by Encoder in builds without cgo or with the purego build tag,
+// where LAME is not available. NewGoEncoderBackend creates the built-in one.
+type EncoderBackend interface {
+	// Encode encodes complete interleaved 16-bit sample frames and writes mp3 data to out.
+	Encode(in, out []byte) (n int, err error)
+
+	// Flush writes the remaining buffered mp3 data to out.
+	Flush(out []byte) (n int, err error)
+
+	// FrameNum returns the number of frames encoded so far.
+	FrameNum() int
+
+	// FrameLength returns the number of samples per channel in a frame.
+	FrameLength() int
+
+	Close()
+}
+
+// Backend identifies the implementation behind Encoder and Decoder.
+type Backend string
+
+const (
+	// BackendNative is LAME and mpg123 linked through cgo.
+	BackendNative Backend = "native"
+	// BackendGo uses the backends registered with RegisterEncoderBackend and RegisterDecoderBackend,
+	// or the built-in Go encoder and decoder.
+	BackendGo Backend = "go"
+)
+
+var (
+	backendMu             sync.RWMutex
+	decoderBackendFactory func() (DecoderBackend, error)
+	encoderBackendFactory func(c *EncoderConfig) (EncoderBackend, error)
+)
+
+// ActiveBackend reports which implementation this build uses.
+func ActiveBackend() Backend {
+	return activeBackend
+}
+
+// RegisterDecoderBackend sets the factory used by NewDecoder in cgo-free builds.
+// nil restores the built-in Go decoder, see NewGoDecoderBackend.
+// It has no effect when the package is built with mpg123.
+func RegisterDecoderBackend(factory func() (DecoderBackend, error)) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	decoderBackendFactory = factory
+}
+
+func newDecoderBackend() (DecoderBackend, error) {
+	backendMu.RLock()
+	factory := decoderBackendFactory
+	backendMu.RUnlock()
+	if factory == nil {
+		return NewGoDecoderBackend()
+	}
+	return factory()
+}
+
+// RegisterEncoderBackend sets the factory used by NewEncoder in cgo-free builds.
+// The factory receives the config with defaults applied. nil restores the built-in
+// Go encoder, see NewGoEncoderBackend.
+// It has no effect when the package is built with LAME.
+func RegisterEncoderBackend(factory func(c *EncoderConfig) (EncoderBackend, error)) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	encoderBackendFactory = factory
+}
+
+func newEncoderBackend(c *EncoderConfig) (EncoderBackend, error) {
+	backendMu.RLock()
+	factory := encoderBackendFactory
+	backendMu.RUnlock()
+	if factory == nil {
+		return NewGoEncoderBackend(c)
+	}
+	return factory(c)
+}
+
+// CapabilityReport describes what the libraries in this build support, see Capabilities.
+type CapabilityReport struct {
+	Backend Backend
+
+	// DecoderEngine is the optimized mpg123 decoder selected for this CPU, e.g. "AVX" or "NEON".
+	DecoderEngine string
+	// DecoderEngines lists the mpg123 decoders supported by this CPU.
+	DecoderEngines []string
+	// DecoderFeatures lists the enabled mpg123 build features, e.g. "layer3" or "ntom".
+	DecoderFeatures []string
+	// OutputEncodings lists the PCM encodings the decoder can output, e.g. "s16" or "f32".
+	OutputEncodings []string
+	// SampleRates lists the native MPEG sample rates that can be decoded.
+	SampleRates []int
+
+	// EncoderFeatures is the LAME compile-time feature string, its content is not specified.
+	EncoderFeatures string
+}
@@ -0,0 +1,153 @@
+package mp3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchJob is one file of a BatchTranscoder run. Input files ending in .wav are encoded
+// to mp3, files ending in .mp3 decoded to WAV, the extension is case-insensitive.
+type BatchJob struct {
+	Input  string
+	Output string
+}
+
+// BatchResult is the outcome of a BatchJob.
+type BatchResult struct {
+	Job BatchJob
+
+	// Encode is the result of a WAV to mp3 job, nil for mp3 to WAV jobs or on error
+	Encode *EncodeResult
+	// Samples and SampleRate describe the output of an mp3 to WAV job
+	Samples    int64
+	SampleRate int
+
+	Elapsed time.Duration // conversion time
+	Err     error         // nil on success
+}
+
+// BatchTranscoder converts many files with parallel workers, e.g. a podcast archive or the
+// audio of a dataset. Each file is converted with EncodeFile or DecodeFile, so outputs are
+// only replaced by complete files. The zero value is ready to use.
+type BatchTranscoder struct {
+	// Workers is the number of files converted in parallel. Default is runtime.NumCPU().
+	Workers int
+
+	// Config is the encoder config of WAV to mp3 jobs, nil uses the defaults.
+	Config *EncoderConfig
+
+	// Options controls the buffering of the conversions, nil uses the defaults.
+	// Its Progress callback is called by several workers at once.
+	Options *WavOptions
+
+	// OnResult is called when a file is done, e.g. to print a log line. The calls are
+	// serialized, but come from the worker goroutines.
+	OnResult func(r *BatchResult)
+}
+
+// Run converts the jobs and returns their results in the order of jobs. The error joins the
+// errors of the failed jobs, each prefixed with the input path. When ctx is done, files
+// not started yet fail with the error of ctx; files being converted are finished.
+func (b *BatchTranscoder) Run(ctx context.Context, jobs []BatchJob) ([]*BatchResult, error) {
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(jobs))
+
+	results := make([]*BatchResult, len(jobs))
+	next := make(chan int)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex // serializes OnResult
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				r := b.convert(ctx, jobs[i])
+				results[i] = r
+				if b.OnResult != nil {
+					mu.Lock()
+					b.OnResult(r)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Job.Input, r.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// RunDir converts the .wav and .mp3 files in the tree of inDir into the same tree under
+// outDir, creating directories as needed: a.wav becomes a.mp3 and b.mp3 becomes b.wav.
+// Other files are ignored. See Run for the results.
+func (b *BatchTranscoder) RunDir(ctx context.Context, inDir, outDir string) ([]*BatchResult, error) {
+	var jobs []BatchJob
+	err := filepath.WalkDir(inDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".wav" && ext != ".mp3" {
+			return nil
+		}
+		rel, err := filepath.Rel(inDir, path)
+		if err != nil {
+			return err
+		}
+		out := strings.TrimSuffix(rel, filepath.Ext(rel)) + ".mp3"
+		if ext == ".mp3" {
+			out = strings.TrimSuffix(rel, filepath.Ext(rel)) + ".wav"
+		}
+		jobs = append(jobs, BatchJob{Input: path, Output: filepath.Join(outDir, out)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Run(ctx, jobs)
+}
+
+// convert runs one job.
+func (b *BatchTranscoder) convert(ctx context.Context, job BatchJob) *BatchResult {
+	r := &BatchResult{Job: job}
+	if r.Err = ctx.Err(); r.Err != nil {
+		return r
+	}
+	start := time.Now()
+	defer func() { r.Elapsed = time.Since(start) }()
+
+	if r.Err = os.MkdirAll(filepath.Dir(job.Output), 0o755); r.Err != nil {
+		return r
+	}
+	switch strings.ToLower(filepath.Ext(job.Input)) {
+	case ".wav":
+		r.Encode, r.Err = EncodeFile(job.Input, job.Output, b.Config, b.Options)
+	case ".mp3":
+		_, r.Samples, r.SampleRate, r.Err = DecodeFile(job.Input, job.Output, b.Options)
+	default:
+		r.Err = errors.New("unknown input type, want .wav or .mp3")
+	}
+	return r
+}
@@ -0,0 +1,70 @@
+package mp3_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestBatchTranscoder(t *testing.T) {
+	requireNative(t)
+	inDir, outDir := t.TempDir(), t.TempDir()
+	write := func(name string, data []byte) {
+		path := filepath.Join(inDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.wav", generateWavFile(22050, 1, 22050))
+	write("sub/b.WAV", generateWavFile(44100, 2, 22050))
+	write("notes.txt", []byte("skipped"))
+	write("broken.wav", []byte("RIFF...."))
+
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1})
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	mp3Data, err := encoder.EncodeAll(generateSineWave(440, 22050, 1, 22050))
+	encoder.Close()
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	write("sub/c.mp3", mp3Data)
+
+	calls := 0
+	b := &mp3.BatchTranscoder{Workers: 2, OnResult: func(r *mp3.BatchResult) { calls++ }}
+	results, err := b.RunDir(context.Background(), inDir, outDir)
+	if len(results) != 4 || calls != 4 {
+		t.Fatalf("%d results, %d OnResult calls, want 4", len(results), calls)
+	}
+	if err == nil || len(err.(interface{ Unwrap() []error }).Unwrap()) != 1 {
+		t.Errorf("Batch error = %v, want the broken file only", err)
+	}
+	for _, r := range results {
+		broken := filepath.Base(r.Job.Input) == "broken.wav"
+		if (r.Err != nil) != broken {
+			t.Errorf("%s: %v", r.Job.Input, r.Err)
+		}
+	}
+	for _, name := range []string{"a.mp3", "sub/b.mp3", "sub/c.wav"} {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err != nil {
+			t.Errorf("Output missing: %v", err)
+		}
+	}
+
+	// Cancelled runs do not start files
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = b.Run(ctx, []mp3.BatchJob{{Input: filepath.Join(inDir, "a.wav"), Output: filepath.Join(outDir, "x.mp3")}})
+	if !errors.Is(err, context.Canceled) || results[0].Err == nil {
+		t.Errorf("Cancelled run error = %v", err)
+	}
+	t.Logf("✓ BatchTranscoder")
+}
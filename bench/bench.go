@@ -0,0 +1,160 @@
+// Package bench measures encoding and decoding throughput on the current machine,
+// reported as realtime factor (xRT: seconds of audio processed per second of wall time).
+package bench
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+const defaultAudioDuration = 10 * time.Second
+
+// Config is one benchmark case.
+type Config struct {
+	Name    string
+	Encoder mp3.EncoderConfig
+
+	// AudioDuration is the length of the generated test signal. Default is 10 seconds.
+	AudioDuration time.Duration
+
+	// Runs is the number of times the case is repeated; the fastest run is reported. Default is 1.
+	Runs int
+}
+
+// Result is the measurement of one Config.
+type Result struct {
+	Name          string
+	AudioDuration time.Duration
+	EncodeTime    time.Duration
+	DecodeTime    time.Duration
+	EncodeXRT     float64
+	DecodeXRT     float64
+	InputBytes    int // PCM bytes encoded
+	OutputBytes   int // mp3 bytes produced
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: encode %.1fx realtime, decode %.1fx realtime (%v audio, %d -> %d bytes)",
+		r.Name, r.EncodeXRT, r.DecodeXRT, r.AudioDuration, r.InputBytes, r.OutputBytes)
+}
+
+// Run measures each config in turn.
+func Run(configs []Config) ([]Result, error) {
+	results := make([]Result, 0, len(configs))
+	for _, c := range configs {
+		r, err := RunOne(c)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// RunOne encodes a generated signal with c.Encoder, decodes the result and reports the throughput.
+func RunOne(c Config) (Result, error) {
+	duration := c.AudioDuration
+	if duration <= 0 {
+		duration = defaultAudioDuration
+	}
+	runs := max(c.Runs, 1)
+	config := c.Encoder
+	if config.SampleRate == 0 {
+		config.SampleRate = 44100
+	}
+	if config.NumChannels == 0 {
+		config.NumChannels = 2
+	}
+
+	pcm := generateSignal(config.SampleRate, config.NumChannels, duration)
+	result := Result{
+		Name:          c.Name,
+		AudioDuration: duration,
+		InputBytes:    len(pcm),
+	}
+
+	var mp3Data []byte
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		data, err := encode(&config, pcm)
+		if err != nil {
+			return result, err
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < result.EncodeTime {
+			result.EncodeTime = elapsed
+		}
+		mp3Data = data
+	}
+	result.OutputBytes = len(mp3Data)
+
+	for i := 0; i < runs; i++ {
+		start := time.Now()
+		if err := decode(mp3Data); err != nil {
+			return result, err
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < result.DecodeTime {
+			result.DecodeTime = elapsed
+		}
+	}
+
+	result.EncodeXRT = duration.Seconds() / max(result.EncodeTime.Seconds(), 1e-9)
+	result.DecodeXRT = duration.Seconds() / max(result.DecodeTime.Seconds(), 1e-9)
+	return result, nil
+}
+
+func encode(config *mp3.EncoderConfig, pcm []byte) ([]byte, error) {
+	encoder, err := mp3.NewEncoder(config)
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+
+	// Feed 20ms chunks like a streaming service would
+	chunk := config.SampleRate / 50 * config.NumChannels * mp3.SampleBitDepth / 8
+	var out []byte
+	for offset := 0; offset < len(pcm); offset += chunk {
+		out, err = encoder.EncodeAppend(out, pcm[offset:min(offset+chunk, len(pcm))])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return encoder.FlushAppend(out)
+}
+
+func decode(data []byte) error {
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	pcmBuf := make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+	for offset := 0; offset < len(data); offset += 4096 {
+		if _, err := decoder.Decode(data[offset:min(offset+4096, len(data))], pcmBuf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generateSignal returns 16-bit PCM of a tone mixed with noise, so the encoder has
+// realistic work to do (pure tones or silence encode unrealistically fast).
+func generateSignal(sampleRate, numChannels int, duration time.Duration) []byte {
+	numSamples := int(duration.Seconds() * float64(sampleRate))
+	rng := rand.New(rand.NewSource(1))
+	pcm := make([]byte, numSamples*numChannels*2)
+	for i := 0; i < numSamples; i++ {
+		tone := math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate)) * 0.5
+		for ch := 0; ch < numChannels; ch++ {
+			v := int16((tone + (rng.Float64()-0.5)*0.2) * 32767)
+			offset := (i*numChannels + ch) * 2
+			pcm[offset] = byte(v)
+			pcm[offset+1] = byte(v >> 8)
+		}
+	}
+	return pcm
+}
@@ -0,0 +1,83 @@
+package bench_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lizc2003/audio-mp3"
+	"github.com/lizc2003/audio-mp3/bench"
+)
+
+func TestRun(t *testing.T) {
+	if mp3.ActiveBackend() != mp3.BackendNative {
+		t.Skip("libraries not linked")
+	}
+	results, err := bench.Run([]bench.Config{
+		{Name: "cbr128", Encoder: mp3.EncoderConfig{Bitrate: 128}, AudioDuration: time.Second},
+		{Name: "vbr-mono-16k", Encoder: mp3.EncoderConfig{SampleRate: 16000, NumChannels: 1, VbrMode: mp3.VbrModeMtrh}, AudioDuration: time.Second, Runs: 2},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Got %d results, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.EncodeXRT <= 0 || r.DecodeXRT <= 0 || r.OutputBytes == 0 {
+			t.Errorf("Invalid result: %+v", r)
+		}
+		t.Logf("✓ %v", r)
+	}
+}
+
+// The clip of the encoder setup benchmarks, short enough that the setup matters
+var benchClip = generateClip(22050, 1, 22050/4)
+
+func generateClip(sampleRate, numChannels, numSamples int) []byte {
+	pcm := make([]byte, numSamples*numChannels*2)
+	for i := range numSamples * numChannels {
+		v := int16(math.Sin(2*math.Pi*440*float64(i/numChannels)/float64(sampleRate)) * 16384)
+		pcm[2*i], pcm[2*i+1] = byte(v), byte(v>>8)
+	}
+	return pcm
+}
+
+// BenchmarkNewEncoder encodes short clips with a new encoder each
+func BenchmarkNewEncoder(b *testing.B) {
+	if mp3.ActiveBackend() != mp3.BackendNative {
+		b.Skip("libraries not linked")
+	}
+	config := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64}
+	for b.Loop() {
+		enc, err := mp3.NewEncoder(config)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := enc.EncodeAll(benchClip); err != nil {
+			b.Fatal(err)
+		}
+		enc.Close()
+	}
+}
+
+// BenchmarkEncoderPool encodes short clips with recycled encoders. Put still sets up a
+// new LAME handle, so the gain over BenchmarkNewEncoder is the Go side of the encoder.
+func BenchmarkEncoderPool(b *testing.B) {
+	if mp3.ActiveBackend() != mp3.BackendNative {
+		b.Skip("libraries not linked")
+	}
+	pool := mp3.NewEncoderPool(1)
+	defer pool.Close()
+	config := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64}
+	for b.Loop() {
+		enc, err := pool.Get(config)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := enc.EncodeAll(benchClip); err != nil {
+			b.Fatal(err)
+		}
+		pool.Put(enc)
+	}
+}
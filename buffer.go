@@ -0,0 +1,79 @@
+package mp3
+
+import (
+	"errors"
+	"io"
+)
+
+// SeekableBuffer is an in-memory io.ReadWriteSeeker, e.g. to get the output of DecodeToWav or
+// the Xing/LAME tag of EncodeFromWav without a temporary file. Writes overwrite the data at
+// the current position and extend the buffer as needed. The zero value is an empty buffer.
+type SeekableBuffer struct {
+	buf []byte
+	pos int64
+}
+
+// NewSeekableBuffer returns a buffer holding b, positioned at its start.
+// The buffer takes ownership of b.
+func NewSeekableBuffer(b []byte) *SeekableBuffer {
+	return &SeekableBuffer{buf: b}
+}
+
+// Bytes returns the contents of the buffer. It is valid until the next write.
+func (b *SeekableBuffer) Bytes() []byte {
+	return b.buf
+}
+
+// Len returns the size of the buffer.
+func (b *SeekableBuffer) Len() int {
+	return len(b.buf)
+}
+
+// Reset empties the buffer, keeping its storage.
+func (b *SeekableBuffer) Reset() {
+	b.buf = b.buf[:0]
+	b.pos = 0
+}
+
+func (b *SeekableBuffer) Read(p []byte) (int, error) {
+	if b.pos >= int64(len(b.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.buf[b.pos:])
+	b.pos += int64(n)
+	return n, nil
+}
+
+func (b *SeekableBuffer) Write(p []byte) (int, error) {
+	end := b.pos + int64(len(p))
+	if end > int64(len(b.buf)) {
+		if end > int64(cap(b.buf)) {
+			buf := make([]byte, len(b.buf), max(end, 2*int64(cap(b.buf))))
+			copy(buf, b.buf)
+			b.buf = buf
+		}
+		// Bytes skipped by a seek past the end read as zero
+		clear(b.buf[len(b.buf):end])
+		b.buf = b.buf[:end]
+	}
+	copy(b.buf[b.pos:], p)
+	b.pos = end
+	return len(p), nil
+}
+
+func (b *SeekableBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,88 @@
+package mp3_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestSeekableBuffer tests the in-memory io.ReadWriteSeeker
+func TestSeekableBuffer(t *testing.T) {
+	var b mp3.SeekableBuffer
+	b.Write([]byte("hello world"))
+	b.Seek(0, io.SeekStart)
+	b.Write([]byte("HELLO"))
+	if got := string(b.Bytes()); got != "HELLO world" {
+		t.Errorf("Overwrite: got %q", got)
+	}
+
+	// Writing past the end fills the gap with zeros
+	if pos, err := b.Seek(2, io.SeekEnd); err != nil || pos != 13 {
+		t.Fatalf("Seek = %d, %v", pos, err)
+	}
+	b.Write([]byte("!"))
+	if want := "HELLO world\x00\x00!"; string(b.Bytes()) != want {
+		t.Errorf("Write past end: got %q, want %q", b.Bytes(), want)
+	}
+
+	b.Seek(-3, io.SeekCurrent)
+	rest, err := io.ReadAll(&b)
+	if err != nil || string(rest) != "\x00\x00!" {
+		t.Errorf("Read: got %q, %v", rest, err)
+	}
+	if _, err := b.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Seek to a negative position should fail")
+	}
+
+	b.Reset()
+	if b.Len() != 0 {
+		t.Errorf("Len after Reset = %d", b.Len())
+	}
+	if n, err := b.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read of empty buffer = %d, %v", n, err)
+	}
+}
+
+// TestSeekableBufferDecodeToWav tests DecodeToWav into memory against a file
+func TestSeekableBufferDecodeToWav(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, _ := encoder.EncodeAppend(nil, generateSineWave(440, 44100, 2, 44100))
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	var buf mp3.SeekableBuffer
+	totalBytes, _, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), &buf, nil)
+	if err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	if totalBytes != int64(buf.Len()) {
+		t.Errorf("DecodeToWav returned %d bytes, buffer has %d", totalBytes, buf.Len())
+	}
+
+	wavPath := filepath.Join(t.TempDir(), "out.wav")
+	wavFile, err := os.Create(wavPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAV file: %v", err)
+	}
+	_, _, _, err = mp3.DecodeToWav(bytes.NewReader(mp3Data), wavFile, nil)
+	wavFile.Close()
+	if err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	want, err := os.ReadFile(wavPath)
+	if err != nil {
+		t.Fatalf("Failed to read WAV file: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("In-memory WAV differs from file: %d vs %d bytes", buf.Len(), len(want))
+	}
+	t.Logf("✓ DecodeToWav into memory: %d bytes", buf.Len())
+}
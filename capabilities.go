@@ -0,0 +1,108 @@
+//go:build cgo && !purego
+
+package mp3
+
+/*
+#ifdef MP3_SYSTEM_LIBS
+#include <mpg123.h>
+#include <lame/lame.h>
+#else
+#include "deps/include/mpg123.h"
+#include "deps/include/lame.h"
+#endif
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+var mpg123Features = []struct {
+	key  C.int
+	name string
+}{
+	{C.MPG123_FEATURE_DECODE_LAYER1, "layer1"},
+	{C.MPG123_FEATURE_DECODE_LAYER2, "layer2"},
+	{C.MPG123_FEATURE_DECODE_LAYER3, "layer3"},
+	{C.MPG123_FEATURE_DECODE_ACCURATE, "accurate"},
+	{C.MPG123_FEATURE_DECODE_DOWNSAMPLE, "downsample"},
+	{C.MPG123_FEATURE_DECODE_NTOM, "ntom"},
+	{C.MPG123_FEATURE_PARSE_ID3V2, "id3v2"},
+	{C.MPG123_FEATURE_INDEX, "index"},
+	{C.MPG123_FEATURE_EQUALIZER, "equalizer"},
+}
+
+var mpg123EncodingNames = map[C.int]string{
+	C.MPG123_ENC_SIGNED_8:    "s8",
+	C.MPG123_ENC_UNSIGNED_8:  "u8",
+	C.MPG123_ENC_ULAW_8:      "ulaw",
+	C.MPG123_ENC_ALAW_8:      "alaw",
+	C.MPG123_ENC_SIGNED_16:   "s16",
+	C.MPG123_ENC_UNSIGNED_16: "u16",
+	C.MPG123_ENC_SIGNED_24:   "s24",
+	C.MPG123_ENC_UNSIGNED_24: "u24",
+	C.MPG123_ENC_SIGNED_32:   "s32",
+	C.MPG123_ENC_UNSIGNED_32: "u32",
+	C.MPG123_ENC_FLOAT_32:    "f32",
+	C.MPG123_ENC_FLOAT_64:    "f64",
+}
+
+// Capabilities reports the decoder optimizations mpg123 selected for this CPU,
+// the enabled mpg123 and LAME features and the supported output encodings and rates.
+func Capabilities() (*CapabilityReport, error) {
+	if err := Init(); err != nil {
+		return nil, err
+	}
+	r := &CapabilityReport{
+		Backend: activeBackend,
+	}
+
+	var errNo C.int
+	mh := C.mpg123_new(nil, &errNo)
+	if mh != nil {
+		if name := C.mpg123_current_decoder(mh); name != nil {
+			r.DecoderEngine = C.GoString(name)
+		}
+		C.mpg123_delete(mh)
+	}
+	r.DecoderEngines = goStrings(C.mpg123_supported_decoders())
+
+	for _, f := range mpg123Features {
+		if C.mpg123_feature(f.key) != 0 {
+			r.DecoderFeatures = append(r.DecoderFeatures, f.name)
+		}
+	}
+
+	var encList *C.int
+	var encNum C.size_t
+	C.mpg123_encodings(&encList, &encNum)
+	for _, enc := range unsafe.Slice(encList, encNum) {
+		if name, ok := mpg123EncodingNames[enc]; ok {
+			r.OutputEncodings = append(r.OutputEncodings, name)
+		}
+	}
+
+	var rateList *C.long
+	var rateNum C.size_t
+	C.mpg123_rates(&rateList, &rateNum)
+	for _, rate := range unsafe.Slice(rateList, rateNum) {
+		r.SampleRates = append(r.SampleRates, int(rate))
+	}
+
+	var v C.lame_version_t
+	C.get_lame_version_numerical(&v)
+	if v.features != nil {
+		r.EncoderFeatures = C.GoString(v.features)
+	}
+
+	return r, nil
+}
+
+// goStrings converts a NULL-terminated C string array.
+func goStrings(list **C.char) []string {
+	var out []string
+	for p := list; p != nil && *p != nil; p = (**C.char)(unsafe.Add(unsafe.Pointer(p), unsafe.Sizeof(*p))) {
+		out = append(out, C.GoString(*p))
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+//go:build !cgo || purego
+
+package mp3
+
+// Capabilities reports the supported sample rates. The mpg123 and LAME details are empty
+// as neither library is linked in this build.
+func Capabilities() (*CapabilityReport, error) {
+	r := &CapabilityReport{
+		Backend:     activeBackend,
+		SampleRates: SupportedSampleRates(),
+	}
+	return r, nil
+}
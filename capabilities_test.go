@@ -0,0 +1,35 @@
+package mp3_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestCapabilities(t *testing.T) {
+	caps, err := mp3.Capabilities()
+	if err != nil {
+		t.Fatalf("Capabilities failed: %v", err)
+	}
+	if caps.Backend != mp3.ActiveBackend() {
+		t.Errorf("Backend = %q, want %q", caps.Backend, mp3.ActiveBackend())
+	}
+	for _, rate := range []int{8000, 22050, 44100, 48000} {
+		if !slices.Contains(caps.SampleRates, rate) {
+			t.Errorf("SampleRates %v misses %d", caps.SampleRates, rate)
+		}
+	}
+	if caps.Backend == mp3.BackendNative {
+		if caps.DecoderEngine == "" || len(caps.DecoderEngines) == 0 {
+			t.Errorf("No decoder engine reported: %q %v", caps.DecoderEngine, caps.DecoderEngines)
+		}
+		if !slices.Contains(caps.DecoderFeatures, "layer3") {
+			t.Errorf("DecoderFeatures %v misses layer3", caps.DecoderFeatures)
+		}
+		if !slices.Contains(caps.OutputEncodings, "s16") {
+			t.Errorf("OutputEncodings %v misses s16", caps.OutputEncodings)
+		}
+	}
+	t.Logf("✓ Capabilities: %+v", *caps)
+}
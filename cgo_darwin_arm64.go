@@ -1,4 +1,4 @@
-//go:build cgo && darwin && arm64
+//go:build cgo && !purego && !systemlibs && darwin && arm64
 
 package mp3
 
@@ -1,4 +1,4 @@
-//go:build cgo && linux && amd64
+//go:build cgo && !purego && !systemlibs && linux && amd64
 
 package mp3
 
@@ -0,0 +1,11 @@
+//go:build cgo && !purego && systemlibs
+
+package mp3
+
+// Link against the system libmpg123 and libmp3lame instead of the vendored deps.
+// LAME does not ship a pkg-config file, its headers are expected in <lame/lame.h>.
+
+// #cgo CFLAGS: -DMP3_SYSTEM_LIBS
+// #cgo pkg-config: libmpg123
+// #cgo LDFLAGS: -lmp3lame -lm
+import "C"
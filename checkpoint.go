@@ -0,0 +1,20 @@
+package mp3
+
+import "errors"
+
+var ErrorNoCheckpoint = errors.New("no checkpoint available")
+
+// EncoderCheckpoint is a frame boundary in the output of an Encoder from which encoding
+// can be continued by a new encoder, see Encoder.Checkpoint and ResumeEncoder.
+// The fields are exported for serialization and should not be modified.
+type EncoderCheckpoint struct {
+	// Frames is the number of audio frames up to the checkpoint, excluding the Xing/Info frame.
+	Frames int `json:"frames"`
+
+	// Bytes is the size of the encoded output up to the checkpoint, including the Xing/Info frame.
+	Bytes int64 `json:"bytes"`
+
+	// Samples is the input position in samples per channel from which the resumed encoder
+	// must be fed. It is before the checkpoint, the samples in between prime the encoder.
+	Samples int64 `json:"samples"`
+}
@@ -0,0 +1,238 @@
+package mp3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// CleanOptions controls the Clean operation.
+type CleanOptions struct {
+	// AddInfoFrame writes a minimal Info frame carrying only frame and byte counts
+	// in front of the audio, so players can still compute the duration.
+	AddInfoFrame bool
+}
+
+// Clean copies a mp3 stream of the given size to w with all metadata removed:
+// leading ID3v2 tags, trailing ID3v1/APEv2/Lyrics3 tags and the Xing/Info/VBRI frame.
+// Audio frames are copied unchanged. It returns the number of bytes written.
+func Clean(r io.ReaderAt, size int64, w io.Writer, opts *CleanOptions) (int64, error) {
+	if opts == nil {
+		opts = &CleanOptions{}
+	}
+
+	start, end, err := audioRange(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	// Locate the first frame and drop it if it is an info frame
+	start, head, _, err := firstAudioFrame(r, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	if opts.AddInfoFrame {
+		firstHdr, err := ParseFrameHeader(head)
+		if err != nil {
+			return 0, err
+		}
+		frames, _, err := countFrames(r, start, end)
+		if err != nil {
+			return 0, err
+		}
+		info := buildInfoFrame(head[:FrameHeaderSize], firstHdr, frames, end-start)
+		n, err := w.Write(info)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	n, err := io.Copy(w, io.NewSectionReader(r, start, end-start))
+	written += n
+	return written, err
+}
+
+// StripInfoFrame copies a mp3 stream from r to w without its leading Xing/Info/VBRI frame,
+// e.g. to serve encoder output as a live stream where players would play the frame as
+// silence. Tags and audio frames are copied unchanged. It reads r only once, so it works
+// on pipes. It returns the number of bytes written.
+func StripInfoFrame(r io.Reader, w io.Writer) (int64, error) {
+	in := bufio.NewReaderSize(r, 2*maxFrameSize)
+	var written int64
+	for {
+		hdr, _ := in.Peek(ID3v2HeaderSize)
+		size, err := id3v2TagSize(bytes.NewReader(hdr), 0)
+		if err != nil || size == 0 {
+			break
+		}
+		n, err := io.CopyN(w, in, size)
+		written += n
+		if err != nil {
+			if err == io.EOF {
+				return written, nil
+			}
+			return written, err
+		}
+	}
+
+	head, _ := in.Peek(maxFrameSize)
+	if IsInfoFrame(head) {
+		h, _ := ParseFrameHeader(head)
+		if _, err := in.Discard(h.Size); err != nil && err != io.EOF {
+			return written, err
+		}
+	}
+	n, err := io.Copy(w, in)
+	return written + n, err
+}
+
+// InsertInfoFrame copies a mp3 stream of the given size to w with a new Info frame carrying
+// the frame and byte counts in front of the audio, e.g. to archive a recorded live stream.
+// An existing Xing/Info/VBRI frame is replaced, tags and audio frames are copied unchanged.
+// Streams with varying bitrates get a Xing frame. It returns the number of bytes written.
+func InsertInfoFrame(r io.ReaderAt, size int64, w io.Writer) (int64, error) {
+	start, end, err := audioRange(r, size)
+	if err != nil {
+		return 0, err
+	}
+	audioStart, head, _, err := firstAudioFrame(r, start, end)
+	if err != nil {
+		return 0, err
+	}
+	h, err := ParseFrameHeader(head)
+	if err != nil {
+		return 0, err
+	}
+	frames, mixed, err := countFrames(r, audioStart, end)
+	if err != nil {
+		return 0, err
+	}
+	info := buildInfoFrame(head[:FrameHeaderSize], h, frames, end-audioStart)
+	if mixed {
+		copy(info[FrameHeaderSize+h.sideInfoSize():], "Xing")
+	}
+
+	written, err := io.Copy(w, io.NewSectionReader(r, 0, start))
+	if err != nil {
+		return written, err
+	}
+	n, err := w.Write(info)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	k, err := io.Copy(w, io.NewSectionReader(r, audioStart, size-audioStart))
+	return written + k, err
+}
+
+// audioRange returns the byte range of a stream that lies between leading ID3v2 tags and trailing tags.
+func audioRange(r io.ReaderAt, size int64) (start int64, end int64, err error) {
+	for start < size {
+		n, err := id3v2TagSize(r, start)
+		if err != nil {
+			return 0, 0, err
+		}
+		if n == 0 {
+			break
+		}
+		start += n
+	}
+
+	end = size
+	tags, err := FindTrailingTags(r, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(tags) > 0 {
+		end = tags[0].Offset
+	}
+	if start > end {
+		start = end
+	}
+	return start, end, nil
+}
+
+// firstAudioFrame locates the first frame between start and end, skipping a Xing/Info/VBRI frame.
+// It returns the offset of the first audio frame and the data read from there, and the
+// skipped frame or nil.
+func firstAudioFrame(r io.ReaderAt, start, end int64) (offset int64, head []byte, info []byte, err error) {
+	head = make([]byte, min(end-start, 2*maxFrameSize))
+	if _, err := r.ReadAt(head, start); err != nil && err != io.EOF {
+		return 0, nil, nil, err
+	}
+	syncPos, err := FindFrameSync(head, 0)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	start += int64(syncPos)
+	head = head[syncPos:]
+	if IsInfoFrame(head) {
+		h, _ := ParseFrameHeader(head)
+		start += int64(h.Size)
+		info = head[:min(h.Size, len(head))]
+		head = head[len(info):]
+	}
+	return start, head, info, nil
+}
+
+// countFrames walks the frame headers between start and end, resyncing over garbage.
+// mixed reports whether the frames differ in bitrate.
+func countFrames(r io.ReaderAt, start, end int64) (frames int, mixed bool, err error) {
+	bitrate := 0
+	var hdr [FrameHeaderSize]byte
+	pos := start
+	for pos+FrameHeaderSize <= end {
+		if _, err := r.ReadAt(hdr[:], pos); err != nil {
+			return 0, false, err
+		}
+		h, err := ParseFrameHeader(hdr[:])
+		if err == nil {
+			if frames > 0 && h.Bitrate != bitrate {
+				mixed = true
+			}
+			bitrate = h.Bitrate
+			frames++
+			pos += int64(h.Size)
+			continue
+		}
+
+		window := make([]byte, min(end-pos, 2*maxFrameSize))
+		if _, err := r.ReadAt(window, pos); err != nil && err != io.EOF {
+			return 0, false, err
+		}
+		syncPos, err := FindFrameSync(window, 1)
+		if err != nil {
+			if int64(len(window)) == end-pos {
+				break
+			}
+			pos += int64(len(window) - FrameHeaderSize)
+			continue
+		}
+		pos += int64(syncPos)
+	}
+	return frames, mixed, nil
+}
+
+// buildInfoFrame creates a silent frame with an Info header, using the layout of an existing frame header.
+// The byte count includes the Info frame itself.
+func buildInfoFrame(hdr []byte, h FrameHeader, frames int, audioBytes int64) []byte {
+	if h.Padding {
+		h.Padding = false
+		h.Size--
+	}
+	frame := make([]byte, h.Size)
+	copy(frame, hdr)
+	frame[1] |= 0x01  // no CRC
+	frame[2] &^= 0x02 // no padding
+
+	offset := FrameHeaderSize + h.sideInfoSize()
+	copy(frame[offset:], "Info")
+	binary.BigEndian.PutUint32(frame[offset+4:], 0x03) // frames and bytes fields present
+	binary.BigEndian.PutUint32(frame[offset+8:], uint32(frames))
+	binary.BigEndian.PutUint32(frame[offset+12:], uint32(audioBytes+int64(h.Size)))
+	return frame
+}
@@ -0,0 +1,175 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestClean tests removal of all metadata from a mp3 stream
+func TestClean(t *testing.T) {
+	requireNative(t)
+	tmpFile, err := os.CreateTemp("", "test_clean_*.mp3")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	result, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100)), tmpFile, &mp3.EncoderConfig{
+		Bitrate: 128,
+	}, nil)
+	tmpFile.Close()
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	totalFrames := result.Frames
+	encoded, err := os.ReadFile(tmpPath)
+	if err != nil {
+		t.Fatalf("Failed to read MP3 file: %v", err)
+	}
+	if !mp3.IsInfoFrame(encoded) {
+		t.Fatal("Encoded file should start with an Info frame")
+	}
+
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Private")
+	var src []byte
+	src = append(src, tag.Bytes()...)
+	src = append(src, encoded...)
+	src = append(src, makeAPEv2Tag([]byte("item"))...)
+	src = append(src, append([]byte("TAG"), make([]byte, 125)...)...)
+
+	infoHdr, _ := mp3.ParseFrameHeader(encoded)
+	audio := encoded[infoHdr.Size:]
+
+	t.Run("StripAll", func(t *testing.T) {
+		var out bytes.Buffer
+		n, err := mp3.Clean(bytes.NewReader(src), int64(len(src)), &out, nil)
+		if err != nil {
+			t.Fatalf("Clean failed: %v", err)
+		}
+		if n != int64(out.Len()) {
+			t.Errorf("Written bytes mismatch: got %d, want %d", n, out.Len())
+		}
+		if !bytes.Equal(out.Bytes(), audio) {
+			t.Errorf("Cleaned stream mismatch: got %d bytes, want %d", out.Len(), len(audio))
+		}
+	})
+
+	t.Run("AddInfoFrame", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := mp3.Clean(bytes.NewReader(src), int64(len(src)), &out, &mp3.CleanOptions{AddInfoFrame: true})
+		if err != nil {
+			t.Fatalf("Clean failed: %v", err)
+		}
+		data := out.Bytes()
+		if !mp3.IsInfoFrame(data) {
+			t.Fatal("Cleaned stream should start with an Info frame")
+		}
+		h, _ := mp3.ParseFrameHeader(data)
+		if bytes.Contains(data[:h.Size], []byte("LAME")) {
+			t.Error("Info frame still contains the LAME tag")
+		}
+		if !bytes.Equal(data[h.Size:], audio) {
+			t.Error("Audio frames changed")
+		}
+
+		idx := bytes.Index(data, []byte("Info"))
+		frames := binary.BigEndian.Uint32(data[idx+8:])
+		size := binary.BigEndian.Uint32(data[idx+12:])
+		if int(frames) != totalFrames {
+			t.Errorf("Info frame count: got %d, want %d", frames, totalFrames)
+		}
+		if int(size) != len(data) {
+			t.Errorf("Info byte count: got %d, want %d", size, len(data))
+		}
+
+		t.Logf("✓ Cleaned: %d -> %d bytes, %d frames", len(src), len(data), frames)
+	})
+}
+
+// TestStripInfoFrame tests removing and re-inserting the Info frame without re-encoding
+func TestStripInfoFrame(t *testing.T) {
+	requireNative(t)
+	for _, config := range []*mp3.EncoderConfig{
+		{Bitrate: 128},
+		{VbrMode: mp3.VbrModeMtrh, Quality: 4},
+	} {
+		t.Run(config.VbrMode.String(), func(t *testing.T) {
+			path := t.TempDir() + "/strip.mp3"
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			_, err = mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100)), f, config, nil)
+			f.Close()
+			if err != nil {
+				t.Fatalf("EncodeFromWav failed: %v", err)
+			}
+			encoded, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+
+			tag := mp3.NewID3v2Tag()
+			tag.SetText("TIT2", "Live")
+			id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+			infoHdr, _ := mp3.ParseFrameHeader(encoded)
+			src := append(append(tag.Bytes(), encoded...), id3v1...)
+			want := append(append(tag.Bytes(), encoded[infoHdr.Size:]...), id3v1...)
+
+			// Through a pipe, as for a live stream
+			pr, pw := io.Pipe()
+			go func() {
+				for chunk := range slicesChunk(src, 1000) {
+					pw.Write(chunk)
+				}
+				pw.Close()
+			}()
+			var stripped bytes.Buffer
+			n, err := mp3.StripInfoFrame(pr, &stripped)
+			if err != nil {
+				t.Fatalf("StripInfoFrame failed: %v", err)
+			}
+			if n != int64(stripped.Len()) || !bytes.Equal(stripped.Bytes(), want) {
+				t.Fatalf("Stripped stream mismatch: got %d bytes, want %d", stripped.Len(), len(want))
+			}
+
+			var archived bytes.Buffer
+			n, err = mp3.InsertInfoFrame(bytes.NewReader(stripped.Bytes()), int64(stripped.Len()), &archived)
+			if err != nil {
+				t.Fatalf("InsertInfoFrame failed: %v", err)
+			}
+			if n != int64(archived.Len()) {
+				t.Errorf("Written bytes mismatch: got %d, want %d", n, archived.Len())
+			}
+			info, err := mp3.Probe(bytes.NewReader(archived.Bytes()), int64(archived.Len()))
+			if err != nil {
+				t.Fatalf("Probe failed: %v", err)
+			}
+			if !info.InfoFrameValid() {
+				t.Errorf("Inserted info frame invalid: %d frames, info frame %d", info.Frames, info.InfoFrames)
+			}
+			wantType := "Info"
+			if info.BitrateMode != mp3.BitrateCBR {
+				wantType = "Xing"
+			}
+			if info.InfoFrameType != wantType {
+				t.Errorf("InfoFrameType = %q, want %q", info.InfoFrameType, wantType)
+			}
+			if _, err := mp3.ReadID3v2(bytes.NewReader(archived.Bytes())); err != nil {
+				t.Errorf("ReadID3v2 failed: %v", err)
+			}
+			if !bytes.HasSuffix(archived.Bytes(), want[len(tag.Bytes()):]) {
+				t.Error("Audio frames or trailing tag changed")
+			}
+
+			t.Logf("✓ %d -> %d -> %d bytes, %s frame", len(src), stripped.Len(), archived.Len(), info.InfoFrameType)
+		})
+	}
+}
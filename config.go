@@ -0,0 +1,322 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	SampleBitDepth = 16
+)
+
+type MpegMode int
+
+const (
+	// Values are the LAME MPEG_mode enum offset by +1, so the zero value means unset.
+	MpegStereo      MpegMode = 0 + 1
+	MpegJointStereo MpegMode = 1 + 1
+	MpegDualChannel MpegMode = 2 + 1 /* LAME doesn't supports this! */
+	MpegMono        MpegMode = 3 + 1
+	MpegNotSet      MpegMode = 4 + 1
+)
+
+type VBRMode int
+
+const (
+	// Values match the LAME vbr_mode enum
+	VbrModeOff  VBRMode = 0
+	VbrModeRh   VBRMode = 2
+	VbrModeAbr  VBRMode = 3
+	VbrModeMtrh VBRMode = 4
+)
+
+// TagFormat is the header of the tag frame at the start of an encoded stream.
+type TagFormat int
+
+const (
+	// TagXing is the Xing/Info header with the LAME extension, which carries the
+	// encoder delay and padding for gapless playback.
+	TagXing TagFormat = 0
+	// TagVBRI is the Fraunhofer VBRI header with a seek table, for players and hardware
+	// that do not read Xing headers. It has no gapless information.
+	TagVBRI TagFormat = 1
+)
+
+// Preset is a tuned LAME preset, like lame --preset.
+type Preset int
+
+const (
+	// Values match the LAME preset_mode enum, 0 means no preset
+	PresetNone     Preset = 0
+	PresetMedium   Preset = 1006 // VBR, about 150-180 kbps (V4)
+	PresetStandard Preset = 1001 // VBR, about 170-210 kbps (V2)
+	PresetExtreme  Preset = 1002 // VBR, about 220-260 kbps (V0)
+	PresetInsane   Preset = 1003 // CBR 320 kbps
+)
+
+// BitrateTarget is the quality level of the bitrate picked by AutoBitrate.
+type BitrateTarget int
+
+const (
+	BitrateTargetNone     BitrateTarget = 0 // no automatic bitrate, Bitrate defaults to 128 kbps
+	BitrateTargetLow      BitrateTarget = 1 // small files, audible artifacts on music
+	BitrateTargetStandard BitrateTarget = 2 // transparent for most listeners
+	BitrateTargetHigh     BitrateTarget = 3 // margin for critical material
+)
+
+// ChannelSelect selects the channels a Decoder outputs.
+type ChannelSelect int
+
+const (
+	// Values match the mpg123 mono flags
+	ChannelBoth  ChannelSelect = 0 // all channels of the stream
+	ChannelLeft  ChannelSelect = 1 // left channel only, as mono
+	ChannelRight ChannelSelect = 2 // right channel only, as mono
+	ChannelMix   ChannelSelect = 4 // both channels mixed to mono
+)
+
+var (
+	ErrorBufferTooSmall         = errors.New("buffer too small")
+	ErrorMalloc                 = errors.New("could not allocate malloc")
+	ErrorParamsNotInitialized   = errors.New("lame_init_params not called")
+	ErrorPsychoAcousticProblems = errors.New("psycho acoustic problems")
+	ErrorUnknown                = errors.New("unknown error")
+)
+
+// Errors of EncoderConfig.Validate, wrapped together with ErrorInvalidConfig.
+var (
+	ErrorUnsupportedSampleRate = errors.New("unsupported sample rate")
+	ErrorUnsupportedChannels   = errors.New("unsupported channel count")
+	ErrorUnsupportedBitrate    = errors.New("unsupported bitrate")
+)
+
+// ShortBufferError is returned when an output buffer is smaller than the call requires.
+// It matches ErrorBufferTooSmall with errors.Is; use errors.As to get the required size.
+type ShortBufferError struct {
+	Size     int // size of the given buffer
+	Required int // minimum size for this call
+}
+
+func (e *ShortBufferError) Error() string {
+	return fmt.Sprintf("output buffer is too small: %d bytes, need %d", e.Size, e.Required)
+}
+
+func (e *ShortBufferError) Is(target error) bool {
+	return target == ErrorBufferTooSmall
+}
+
+// EncoderConfig specifies MP3 encoding parameters.
+type EncoderConfig struct {
+	// SampleRate sets input sample rate in Hz.
+	// Default is 44100.
+	SampleRate int `json:"sample_rate,omitempty" yaml:"sample_rate,omitempty"`
+
+	// NumChannels sets number of channels in input stream.
+	// Default is 2 (stereo).
+	NumChannels int `json:"num_channels,omitempty" yaml:"num_channels,omitempty"`
+
+	// Bitrate in kbps for CBR encoding.
+	// Supported values: 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320
+	// Default is 128, or the bitrate of AutoBitrate if BitrateTarget is set.
+	Bitrate int `json:"bitrate,omitempty" yaml:"bitrate,omitempty"`
+
+	// BitrateTarget picks the CBR or ABR bitrate from the sample rate and channels when
+	// Bitrate is 0, e.g. for batches of inputs in different formats. See AutoBitrate.
+	BitrateTarget BitrateTarget `json:"bitrate_target,omitempty" yaml:"bitrate_target,omitempty"`
+
+	// Quality is the encoding quality level (0-9).
+	// 0 = best quality (very slow)
+	// 2 = near-best quality, not too slow (recommended)
+	// 5 = good quality, fast
+	// 7 = ok quality, really fast
+	// 9 = worst quality
+	// A negative value selects the default 2, as the zero value is level 0. Values above 9
+	// are rejected by Validate.
+	Quality int `json:"quality,omitempty" yaml:"quality,omitempty"`
+
+	// Preset selects a LAME preset, which sets the VBR mode, bitrate and quality, so
+	// Bitrate, Quality, VbrQuality, VbrMode and the VBR bitrate limits are ignored.
+	// Default is PresetNone.
+	Preset Preset `json:"preset,omitempty" yaml:"preset,omitempty"`
+
+	// VbrQuality is the VBR target quality, from 0 (best, largest) to below 10, e.g. 4.5.
+	// If set, Quality only selects the algorithm quality (speed) as in CBR mode.
+	// Default 0 uses Quality as the VBR quality.
+	VbrQuality float64 `json:"vbr_quality,omitempty" yaml:"vbr_quality,omitempty"`
+
+	// VbrMode sets the VBR (Variable Bit Rate) mode.
+	// Default is VbrModeOff (CBR).
+	VbrMode VBRMode `json:"vbr_mode,omitempty" yaml:"vbr_mode,omitempty"`
+
+	// AbrMeanBitrate is the average bitrate in kbps LAME aims for with VbrModeAbr (8-320).
+	// Default is Bitrate.
+	AbrMeanBitrate int `json:"abr_mean_bitrate,omitempty" yaml:"abr_mean_bitrate,omitempty"`
+
+	// VbrMinBitrate and VbrMaxBitrate limit the bitrate of the frames in kbps with VBR and ABR.
+	// Silent frames may still use a lower bitrate unless VbrHardMin is set. 0 leaves the
+	// limit to LAME.
+	VbrMinBitrate int `json:"vbr_min_bitrate,omitempty" yaml:"vbr_min_bitrate,omitempty"`
+	VbrMaxBitrate int `json:"vbr_max_bitrate,omitempty" yaml:"vbr_max_bitrate,omitempty"`
+
+	// VbrHardMin enforces VbrMinBitrate for silent frames too, like lame -F.
+	VbrHardMin bool `json:"vbr_hard_min,omitempty" yaml:"vbr_hard_min,omitempty"`
+
+	// MpegMode sets the output audio mode.
+	// Default: LAME picks based on compression ratio and input channels.
+	MpegMode MpegMode `json:"mpeg_mode,omitempty" yaml:"mpeg_mode,omitempty"`
+
+	// Lowpass sets the lowpass filter frequency in Hz, -1 disables the filter.
+	// Default 0 lets LAME choose it from the bitrate.
+	Lowpass int `json:"lowpass,omitempty" yaml:"lowpass,omitempty"`
+
+	// DisableReservoir disables the bit reservoir, so every frame can be decoded without
+	// the previous ones, e.g. for live streams that listeners join at any frame.
+	// This costs quality at the same bitrate.
+	DisableReservoir bool `json:"disable_reservoir,omitempty" yaml:"disable_reservoir,omitempty"`
+
+	// Enable VBR/Info tag writing (includes Xing header for VBR, Info header for CBR)
+	// This inserts a placeholder frame at the beginning which should be updated later
+	IsWriteVbrTag bool `json:"write_vbr_tag,omitempty" yaml:"write_vbr_tag,omitempty"`
+
+	// TagFormat selects the header of the tag frame written with IsWriteVbrTag.
+	// Default is TagXing.
+	TagFormat TagFormat `json:"tag_format,omitempty" yaml:"tag_format,omitempty"`
+
+	// MinEncodeSamples is the number of samples per channel Encode accumulates
+	// before passing them to LAME. Feeding many small packets (e.g. 20 ms VoIP frames)
+	// then costs one cgo call per batch instead of one per packet.
+	// The buffered samples are encoded by Flush. Default is 0 (no batching).
+	MinEncodeSamples int `json:"min_encode_samples,omitempty" yaml:"min_encode_samples,omitempty"`
+
+	// ErrorProtection adds a CRC-16 checksum to every frame, so decoders can detect
+	// corrupted frame headers and side information.
+	ErrorProtection bool `json:"error_protection,omitempty" yaml:"error_protection,omitempty"`
+
+	// Copyright, Copy and Private set header bits of every frame: the copyright bit,
+	// the original bit cleared to mark a copy, and the private bit. They do not change
+	// the audio and are only informational.
+	Copyright bool `json:"copyright,omitempty" yaml:"copyright,omitempty"`
+	Copy      bool `json:"copy,omitempty" yaml:"copy,omitempty"`
+	Private   bool `json:"private,omitempty" yaml:"private,omitempty"`
+
+	// FindReplayGain enables ReplayGain analysis and peak detection during encoding.
+	// The peak is measured on the input PCM samples.
+	// The results are available from Encoder.ReplayGain after Flush, and EncodeAll writes
+	// them into an ID3v2 tag. EncodeFromWav, NewWriter and Encoder.ReadFrom do so when the
+	// writer supports seeking, Transcode requires it.
+	FindReplayGain bool `json:"find_replay_gain,omitempty" yaml:"find_replay_gain,omitempty"`
+
+	// Tags is written as an ID3v2 tag in front of the audio by EncodeFromWav, NewWriter,
+	// EncodeAll and Transcode. With FindReplayGain the ReplayGain frames are added to it.
+	// Encode does not write it; use Tags.ID3v2Tag to write it manually.
+	Tags *TrackTags `json:"tags,omitempty" yaml:"tags,omitempty"`
+
+	// WriteID3v1 appends an ID3v1.1 tag with the fields of Tags after the audio, for players
+	// that do not read ID3v2. Text is cut to 30 bytes and characters outside Latin-1 are
+	// replaced by '?'. It is written where Tags is written.
+	WriteID3v1 bool `json:"write_id3v1,omitempty" yaml:"write_id3v1,omitempty"`
+}
+
+// populateEncConfig returns a copy of c with defaults filled in, c is not modified. Only zero
+// values and a negative Quality are replaced, invalid values are left for Validate to reject.
+func populateEncConfig(c *EncoderConfig) *EncoderConfig {
+	cc := EncoderConfig{}
+	if c != nil {
+		cc = *c
+	}
+	c = &cc
+	if c.NumChannels == 0 {
+		c.NumChannels = 2
+	}
+	if c.SampleRate == 0 {
+		c.SampleRate = 44100
+	}
+	if c.Bitrate == 0 && c.BitrateTarget == BitrateTargetNone {
+		c.Bitrate = 128
+	}
+	if c.Quality < 0 {
+		c.Quality = 2
+	}
+	return c
+}
+
+// Validate checks the fields that are set against what LAME supports, zero values stand
+// for the defaults and are accepted. All errors match ErrorInvalidConfig; unsupported sample
+// rates, channel counts and bitrates also match ErrorUnsupportedSampleRate,
+// ErrorUnsupportedChannels and ErrorUnsupportedBitrate. NewEncoder validates its config,
+// so a config LAME would silently adjust is rejected.
+func (c *EncoderConfig) Validate() error {
+	if c.SampleRate != 0 {
+		if _, ok := MpegVersionForSampleRate(c.SampleRate); !ok {
+			return fmt.Errorf("%w: %w %d", ErrorInvalidConfig, ErrorUnsupportedSampleRate, c.SampleRate)
+		}
+	}
+	if c.NumChannels < 0 || c.NumChannels > 2 {
+		return fmt.Errorf("%w: %w %d", ErrorInvalidConfig, ErrorUnsupportedChannels, c.NumChannels)
+	}
+	if c.Quality > 9 {
+		return fmt.Errorf("%w: quality %d out of range", ErrorInvalidConfig, c.Quality)
+	}
+	if c.VbrQuality < 0 || c.VbrQuality >= 10 {
+		return fmt.Errorf("%w: VBR quality %g out of range", ErrorInvalidConfig, c.VbrQuality)
+	}
+	if _, ok := vbrModeNames[c.VbrMode]; !ok {
+		return fmt.Errorf("%w: vbr mode %d", ErrorInvalidConfig, int(c.VbrMode))
+	}
+	if _, ok := mpegModeNames[c.MpegMode]; !ok && c.MpegMode != 0 {
+		return fmt.Errorf("%w: mpeg mode %d", ErrorInvalidConfig, int(c.MpegMode))
+	}
+	if _, ok := presetNames[c.Preset]; !ok {
+		return fmt.Errorf("%w: preset %d", ErrorInvalidConfig, int(c.Preset))
+	}
+	if _, ok := bitrateTargetNames[c.BitrateTarget]; !ok {
+		return fmt.Errorf("%w: bitrate target %d", ErrorInvalidConfig, int(c.BitrateTarget))
+	}
+	if _, ok := tagFormatNames[c.TagFormat]; !ok {
+		return fmt.Errorf("%w: tag format %d", ErrorInvalidConfig, int(c.TagFormat))
+	}
+	if c.Lowpass < -1 {
+		return fmt.Errorf("%w: lowpass %d Hz", ErrorInvalidConfig, c.Lowpass)
+	}
+	if c.MinEncodeSamples < 0 {
+		return fmt.Errorf("%w: negative min encode samples", ErrorInvalidConfig)
+	}
+
+	// LAME picks the output sample rate and resamples MPEG-1 rates down for low bitrates,
+	// so without an input rate or at an MPEG-1 rate any MPEG version may be used
+	if c.Bitrate != 0 && c.VbrMode == VbrModeOff {
+		bitrates := append(Bitrates(MpegVersion1), Bitrates(MpegVersion2)...)
+		if v, _ := MpegVersionForSampleRate(c.SampleRate); c.SampleRate != 0 && v != MpegVersion1 {
+			bitrates = Bitrates(v)
+		}
+		if !slices.Contains(bitrates, c.Bitrate) {
+			return fmt.Errorf("%w: %w %d kbps", ErrorInvalidConfig, ErrorUnsupportedBitrate, c.Bitrate)
+		}
+	}
+	if c.Bitrate < 0 || c.Bitrate > 320 {
+		return fmt.Errorf("%w: %w %d kbps", ErrorInvalidConfig, ErrorUnsupportedBitrate, c.Bitrate)
+	}
+	if c.AbrMeanBitrate != 0 && (c.AbrMeanBitrate < 8 || c.AbrMeanBitrate > 320) {
+		return fmt.Errorf("%w: ABR mean bitrate %d kbps out of range", ErrorInvalidConfig, c.AbrMeanBitrate)
+	}
+	if c.VbrMinBitrate < 0 || c.VbrMinBitrate > 320 || c.VbrMaxBitrate < 0 || c.VbrMaxBitrate > 320 {
+		return fmt.Errorf("%w: VBR bitrate limits %d-%d kbps out of range", ErrorInvalidConfig, c.VbrMinBitrate, c.VbrMaxBitrate)
+	}
+	if c.VbrMaxBitrate != 0 && c.VbrMinBitrate > c.VbrMaxBitrate {
+		return fmt.Errorf("%w: VBR min bitrate %d above max %d kbps", ErrorInvalidConfig, c.VbrMinBitrate, c.VbrMaxBitrate)
+	}
+	return nil
+}
+
+// bitrate returns Bitrate, or the automatic bitrate for the populated config if it is 0.
+func (c *EncoderConfig) bitrate() int {
+	if c.Bitrate != 0 {
+		return c.Bitrate
+	}
+	channels := c.NumChannels
+	if c.MpegMode == MpegMono {
+		channels = 1
+	}
+	return AutoBitrate(c.SampleRate, channels, c.BitrateTarget)
+}
@@ -0,0 +1,85 @@
+package mp3_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestParseConfig(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want mp3.EncoderConfig
+	}{
+		{"V0", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 0}},
+		{"v5", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 5}},
+		{"cbr:192,q:2,mono", mp3.EncoderConfig{Bitrate: 192, Quality: 2, MpegMode: mp3.MpegMono}},
+		{"ABR:160, joint, tag", mp3.EncoderConfig{VbrMode: mp3.VbrModeAbr, Bitrate: 160, MpegMode: mp3.MpegJointStereo, IsWriteVbrTag: true}},
+		{"vbr:2,rate:22050,channels:1,replaygain", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 2, SampleRate: 22050, NumChannels: 1, FindReplayGain: true}},
+		{"V0,vbri", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 0, IsWriteVbrTag: true, TagFormat: mp3.TagVBRI}},
+		{"cbr:320,id3v1", mp3.EncoderConfig{Bitrate: 320, WriteID3v1: true}},
+		{"V2,min:96,max:256", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 2, VbrMinBitrate: 96, VbrMaxBitrate: 256}},
+		{"V4.5,q:5", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, VbrQuality: 4.5, Quality: 5}},
+		{"vbr:0.5", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, VbrQuality: 0.5}},
+		{"cbr:128,crc,copyright,copy,private", mp3.EncoderConfig{Bitrate: 128, ErrorProtection: true, Copyright: true, Copy: true, Private: true}},
+		{"auto:high,mono", mp3.EncoderConfig{BitrateTarget: mp3.BitrateTargetHigh, MpegMode: mp3.MpegMono}},
+		{"cbr:96,lowpass:15000,noreservoir", mp3.EncoderConfig{Bitrate: 96, Lowpass: 15000, DisableReservoir: true}},
+		{"preset:Extreme,mono", mp3.EncoderConfig{Preset: mp3.PresetExtreme, MpegMode: mp3.MpegMono}},
+		{"V4,min:64,hardmin", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 4, VbrMinBitrate: 64, VbrHardMin: true}},
+		{"", mp3.EncoderConfig{}},
+	}
+	for _, tc := range testCases {
+		c, err := mp3.ParseConfig(tc.in)
+		if err != nil {
+			t.Errorf("ParseConfig(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if *c != tc.want {
+			t.Errorf("ParseConfig(%q) = %+v, want %+v", tc.in, *c, tc.want)
+		}
+	}
+
+	for _, in := range []string{"V10", "preset:loud", "auto:best", "V9.99x", "vbr:10.5", "cbr", "cbr:fast", "q:12", "surround", "rate:-1"} {
+		if _, err := mp3.ParseConfig(in); !errors.Is(err, mp3.ErrorInvalidConfig) {
+			t.Errorf("ParseConfig(%q) error = %v, want ErrorInvalidConfig", in, err)
+		}
+	}
+}
+
+func TestEncoderConfigJSON(t *testing.T) {
+	c := mp3.EncoderConfig{
+		Bitrate:       160,
+		Quality:       2,
+		VbrMode:       mp3.VbrModeAbr,
+		MpegMode:      mp3.MpegJointStereo,
+		IsWriteVbrTag: true,
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"bitrate":160,"quality":2,"vbr_mode":"abr","mpeg_mode":"joint","write_vbr_tag":true}`
+	if string(data) != want {
+		t.Errorf("Marshal = %s, want %s", data, want)
+	}
+
+	var decoded mp3.EncoderConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded != c {
+		t.Errorf("Round trip = %+v, want %+v", decoded, c)
+	}
+
+	if err := json.Unmarshal([]byte(`{"vbr_mode":"cbr","mpeg_mode":"Mono"}`), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.VbrMode != mp3.VbrModeOff || decoded.MpegMode != mp3.MpegMono {
+		t.Errorf("Unexpected modes: %v %v", decoded.VbrMode, decoded.MpegMode)
+	}
+	if err := json.Unmarshal([]byte(`{"vbr_mode":"fast"}`), &decoded); !errors.Is(err, mp3.ErrorInvalidConfig) {
+		t.Errorf("Unmarshal of unknown mode: %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrorInvalidConfig = errors.New("invalid encoder config")
+
+var mpegModeNames = map[MpegMode]string{
+	MpegStereo:      "stereo",
+	MpegJointStereo: "joint",
+	MpegDualChannel: "dual",
+	MpegMono:        "mono",
+	MpegNotSet:      "auto",
+}
+
+var tagFormatNames = map[TagFormat]string{
+	TagXing: "xing",
+	TagVBRI: "vbri",
+}
+
+var bitrateTargetNames = map[BitrateTarget]string{
+	BitrateTargetNone:     "none",
+	BitrateTargetLow:      "low",
+	BitrateTargetStandard: "standard",
+	BitrateTargetHigh:     "high",
+}
+
+var presetNames = map[Preset]string{
+	PresetNone:     "none",
+	PresetMedium:   "medium",
+	PresetStandard: "standard",
+	PresetExtreme:  "extreme",
+	PresetInsane:   "insane",
+}
+
+var vbrModeNames = map[VBRMode]string{
+	VbrModeOff:  "off",
+	VbrModeRh:   "rh",
+	VbrModeAbr:  "abr",
+	VbrModeMtrh: "mtrh",
+}
+
+func (m MpegMode) String() string {
+	if name, ok := mpegModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("MpegMode(%d)", int(m))
+}
+
+// MarshalText encodes the mode as "stereo", "joint", "dual", "mono" or "auto".
+func (m MpegMode) MarshalText() ([]byte, error) {
+	name, ok := mpegModeNames[m]
+	if !ok {
+		return nil, fmt.Errorf("%w: mpeg mode %d", ErrorInvalidConfig, int(m))
+	}
+	return []byte(name), nil
+}
+
+func (m *MpegMode) UnmarshalText(text []byte) error {
+	for mode, name := range mpegModeNames {
+		if strings.EqualFold(string(text), name) {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: mpeg mode %q", ErrorInvalidConfig, text)
+}
+
+func (m VBRMode) String() string {
+	if name, ok := vbrModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("VBRMode(%d)", int(m))
+}
+
+// MarshalText encodes the mode as "off", "rh", "abr" or "mtrh".
+func (m VBRMode) MarshalText() ([]byte, error) {
+	name, ok := vbrModeNames[m]
+	if !ok {
+		return nil, fmt.Errorf("%w: vbr mode %d", ErrorInvalidConfig, int(m))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText also accepts "cbr" for VbrModeOff and "vbr" for VbrModeMtrh.
+func (m *VBRMode) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "cbr":
+		*m = VbrModeOff
+		return nil
+	case "vbr":
+		*m = VbrModeMtrh
+		return nil
+	}
+	for mode, name := range vbrModeNames {
+		if strings.EqualFold(string(text), name) {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: vbr mode %q", ErrorInvalidConfig, text)
+}
+
+func (p Preset) String() string {
+	if name, ok := presetNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Preset(%d)", int(p))
+}
+
+// MarshalText encodes the preset as "none", "medium", "standard", "extreme" or "insane".
+func (p Preset) MarshalText() ([]byte, error) {
+	name, ok := presetNames[p]
+	if !ok {
+		return nil, fmt.Errorf("%w: preset %d", ErrorInvalidConfig, int(p))
+	}
+	return []byte(name), nil
+}
+
+func (p *Preset) UnmarshalText(text []byte) error {
+	for preset, name := range presetNames {
+		if strings.EqualFold(string(text), name) {
+			*p = preset
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: preset %q", ErrorInvalidConfig, text)
+}
+
+func (t BitrateTarget) String() string {
+	if name, ok := bitrateTargetNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("BitrateTarget(%d)", int(t))
+}
+
+// MarshalText encodes the bitrate target as "none", "low", "standard" or "high".
+func (t BitrateTarget) MarshalText() ([]byte, error) {
+	name, ok := bitrateTargetNames[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: bitrate target %d", ErrorInvalidConfig, int(t))
+	}
+	return []byte(name), nil
+}
+
+func (t *BitrateTarget) UnmarshalText(text []byte) error {
+	for target, name := range bitrateTargetNames {
+		if strings.EqualFold(string(text), name) {
+			*t = target
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: bitrate target %q", ErrorInvalidConfig, text)
+}
+
+func (f TagFormat) String() string {
+	if name, ok := tagFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("TagFormat(%d)", int(f))
+}
+
+// MarshalText encodes the format as "xing" or "vbri".
+func (f TagFormat) MarshalText() ([]byte, error) {
+	name, ok := tagFormatNames[f]
+	if !ok {
+		return nil, fmt.Errorf("%w: tag format %d", ErrorInvalidConfig, int(f))
+	}
+	return []byte(name), nil
+}
+
+func (f *TagFormat) UnmarshalText(text []byte) error {
+	for format, name := range tagFormatNames {
+		if strings.EqualFold(string(text), name) {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: tag format %q", ErrorInvalidConfig, text)
+}
+
+// ParseConfig parses an encoder profile from a string of comma separated options:
+//
+//	V0 .. V9        VBR with the given quality, like lame -V
+//	cbr:192         CBR at 192 kbps
+//	abr:160         ABR with a mean bitrate of 160 kbps
+//	vbr:2           VBR with quality 2, same as V2
+//	V4.5, vbr:4.5   VBR with the fractional VBR quality 4.5, Quality is left unchanged
+//	min:96          minimum VBR/ABR bitrate in kbps
+//	max:256         maximum VBR/ABR bitrate in kbps
+//	hardmin         enforce the minimum bitrate for silent frames too
+//	crc             CRC error protection
+//	copyright, copy, private
+//	                frame header flags
+//	preset:standard LAME preset: medium, standard, extreme or insane
+//	auto:standard   bitrate for the input format: low, standard or high
+//	q:2             quality (0 = best, 9 = worst)
+//	rate:44100      input sample rate
+//	lowpass:16000   lowpass filter frequency in Hz
+//	noreservoir     disable the bit reservoir
+//	channels:1      input channels
+//	stereo, joint, dual, mono
+//	                MPEG channel mode
+//	tag             write the Xing/Info tag frame
+//	vbri            write a VBRI tag frame instead
+//	replaygain      ReplayGain analysis
+//	id3v1           append an ID3v1 tag
+//
+// Options are case-insensitive, e.g. "V0" or "cbr:192,q:2,mono".
+// Options that are not given keep their zero value, so NewEncoder applies the defaults.
+func ParseConfig(s string) (*EncoderConfig, error) {
+	c := &EncoderConfig{}
+	for _, opt := range strings.Split(s, ",") {
+		opt = strings.ToLower(strings.TrimSpace(opt))
+		if opt == "" {
+			continue
+		}
+		if err := c.parseOption(opt); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *EncoderConfig) parseOption(opt string) error {
+	key, value, hasValue := strings.Cut(opt, ":")
+	if !hasValue && len(opt) >= 2 && opt[0] == 'v' && opt[1] >= '0' && opt[1] <= '9' {
+		key, value, hasValue = "vbr", opt[1:], true
+	}
+
+	if !hasValue {
+		switch key {
+		case "tag":
+			c.IsWriteVbrTag = true
+		case "vbri":
+			c.IsWriteVbrTag = true
+			c.TagFormat = TagVBRI
+		case "replaygain":
+			c.FindReplayGain = true
+		case "id3v1":
+			c.WriteID3v1 = true
+		case "hardmin":
+			c.VbrHardMin = true
+		case "crc":
+			c.ErrorProtection = true
+		case "copyright":
+			c.Copyright = true
+		case "copy":
+			c.Copy = true
+		case "private":
+			c.Private = true
+		case "noreservoir":
+			c.DisableReservoir = true
+		default:
+			var mode MpegMode
+			if err := mode.UnmarshalText([]byte(key)); err != nil {
+				return fmt.Errorf("%w: unknown option %q", ErrorInvalidConfig, opt)
+			}
+			c.MpegMode = mode
+		}
+		return nil
+	}
+
+	if key == "preset" {
+		return c.Preset.UnmarshalText([]byte(value))
+	}
+	if key == "auto" {
+		return c.BitrateTarget.UnmarshalText([]byte(value))
+	}
+	if key == "vbr" && strings.Contains(value, ".") {
+		q, err := strconv.ParseFloat(value, 64)
+		if err != nil || q < 0 || q >= 10 {
+			return fmt.Errorf("%w: vbr quality out of range in %q", ErrorInvalidConfig, opt)
+		}
+		c.VbrMode = VbrModeMtrh
+		c.VbrQuality = q
+		return nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%w: invalid value in %q", ErrorInvalidConfig, opt)
+	}
+	switch key {
+	case "cbr":
+		c.VbrMode = VbrModeOff
+		c.Bitrate = n
+	case "abr":
+		c.VbrMode = VbrModeAbr
+		c.Bitrate = n
+	case "vbr":
+		if n > 9 {
+			return fmt.Errorf("%w: vbr quality out of range in %q", ErrorInvalidConfig, opt)
+		}
+		c.VbrMode = VbrModeMtrh
+		c.Quality = n
+	case "min":
+		c.VbrMinBitrate = n
+	case "max":
+		c.VbrMaxBitrate = n
+	case "q":
+		if n > 9 {
+			return fmt.Errorf("%w: quality out of range in %q", ErrorInvalidConfig, opt)
+		}
+		c.Quality = n
+	case "lowpass":
+		c.Lowpass = n
+	case "rate":
+		c.SampleRate = n
+	case "channels":
+		c.NumChannels = n
+	default:
+		return fmt.Errorf("%w: unknown option %q", ErrorInvalidConfig, opt)
+	}
+	return nil
+}
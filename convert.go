@@ -0,0 +1,111 @@
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrorUnknownInput is returned by Convert for input that is neither WAV, AIFF nor mp3.
+var ErrorUnknownInput = errors.New("unknown input format (WAV, AIFF or mp3 expected)")
+
+// convertSniffSize is the number of bytes Convert reads to detect the input format, enough
+// for two frame headers of the largest mp3 frames.
+const convertSniffSize = 4096
+
+// Input formats detected by Convert.
+const (
+	ConvertInputWav  = "wav"
+	ConvertInputAiff = "aiff"
+	ConvertInputMp3  = "mp3"
+)
+
+// ConvertResult describes the conversion done by Convert.
+type ConvertResult struct {
+	// Input is the detected input format, ConvertInputWav, ConvertInputAiff or ConvertInputMp3.
+	Input string
+
+	TotalBytes int64         // bytes written, including headers and tags
+	SampleRate int           // of the audio
+	Duration   time.Duration // play time of the audio
+
+	// Encode is the result of EncodeFromWav or EncodeFromAiff, nil for mp3 input.
+	Encode *EncodeResult
+}
+
+// Convert detects the format of r from its first bytes and converts it: WAV (also RF64) and
+// AIFF input is encoded to mp3 by EncodeFromWav or EncodeFromAiff, mp3 input, with or without
+// an ID3v2 tag, is decoded to WAV by DecodeToWav. opts set the encoder like for
+// NewEncoderWithOptions, the sample rate and channels are taken from the input; they are
+// ignored for mp3 input. Input of another format returns ErrorUnknownInput.
+func Convert(r io.Reader, w io.Writer, opts ...EncoderOption) (*ConvertResult, error) {
+	head := make([]byte, convertSniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return nil, ErrorEmptyInput
+		}
+		return nil, err
+	}
+	head = head[:n]
+	in := io.MultiReader(bytes.NewReader(head), r)
+
+	input := sniffInput(head)
+	if input == ConvertInputMp3 {
+		totalBytes, totalSamples, sampleRate, err := DecodeToWav(in, w, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &ConvertResult{
+			Input:      input,
+			TotalBytes: totalBytes,
+			SampleRate: sampleRate,
+			Duration:   time.Duration(totalSamples) * time.Second / time.Duration(sampleRate),
+		}, nil
+	}
+
+	config := EncoderConfig{Quality: 2}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	var result *EncodeResult
+	switch input {
+	case ConvertInputWav:
+		result, err = EncodeFromWav(in, w, &config, nil)
+	case ConvertInputAiff:
+		result, err = EncodeFromAiff(in, w, &config, nil)
+	default:
+		return nil, ErrorUnknownInput
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ConvertResult{
+		Input:      input,
+		TotalBytes: result.TotalBytes,
+		SampleRate: result.SampleRate,
+		Duration:   result.Duration,
+		Encode:     result,
+	}, nil
+}
+
+// sniffInput returns the format of a stream starting with head, "" if it is unknown.
+func sniffInput(head []byte) string {
+	if len(head) >= 12 {
+		switch {
+		case (string(head[0:4]) == "RIFF" || string(head[0:4]) == "RF64") && string(head[8:12]) == "WAVE":
+			return ConvertInputWav
+		case string(head[0:4]) == "FORM" && (string(head[8:12]) == "AIFF" || string(head[8:12]) == "AIFC"):
+			return ConvertInputAiff
+		}
+	}
+	if len(head) >= 3 && string(head[0:3]) == "ID3" {
+		return ConvertInputMp3
+	}
+	// Frames without a tag, the sync is only accepted if the next frame header follows
+	if _, err := FindFrameSync(head, 0); err == nil {
+		return ConvertInputMp3
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package mp3_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestConvert(t *testing.T) {
+	requireNative(t)
+	pcm := generateSineWave(440, 44100, 2, 44100)
+	wav := append(mp3.GenerateWavHeader(len(pcm), 44100, 2, 16), pcm...)
+
+	// WAV is encoded with the options
+	var encoded mp3.SeekableBuffer
+	result, err := mp3.Convert(bytes.NewReader(wav), &encoded, mp3.WithBitrate(64))
+	if err != nil {
+		t.Fatalf("Convert(WAV) failed: %v", err)
+	}
+	if result.Input != mp3.ConvertInputWav || result.Encode == nil || result.Encode.Config.Bitrate != 64 ||
+		result.TotalBytes != int64(encoded.Len()) {
+		t.Errorf("Convert(WAV) = %+v", result)
+	}
+	if info, err := mp3.Probe(bytes.NewReader(encoded.Bytes()), int64(encoded.Len())); err != nil || info.Frames != result.Encode.Frames {
+		t.Errorf("Probe of the output = %+v, %v", info, err)
+	}
+
+	// mp3 is decoded to WAV
+	var decoded mp3.SeekableBuffer
+	result, err = mp3.Convert(bytes.NewReader(encoded.Bytes()), &decoded)
+	if err != nil {
+		t.Fatalf("Convert(mp3) failed: %v", err)
+	}
+	if result.Input != mp3.ConvertInputMp3 || result.Encode != nil || result.Duration.Seconds() < 1 {
+		t.Errorf("Convert(mp3) = %+v", result)
+	}
+	// LAME resamples 64 kbps to 24 kHz
+	if info, _, err := mp3.ParseWav(bytes.NewReader(decoded.Bytes())); err != nil || info.Channels != 2 || info.SampleRate != result.SampleRate {
+		t.Errorf("ParseWav of the output = %+v, %v", info, err)
+	}
+
+	// mp3 with an ID3v2 tag and AIFF
+	var tagged mp3.SeekableBuffer
+	config := &mp3.EncoderConfig{Tags: &mp3.TrackTags{Title: "Upload"}}
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &tagged, config, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	be16 := make([]byte, len(pcm))
+	for i := 0; i+1 < len(pcm); i += 2 {
+		be16[i], be16[i+1] = pcm[i+1], pcm[i]
+	}
+	for name, tc := range map[string]struct {
+		input []byte
+		want  string
+	}{
+		"ID3v2": {tagged.Bytes(), mp3.ConvertInputMp3},
+		"AIFF":  {generateAiffFile("", 44100, 2, 16, be16), mp3.ConvertInputAiff},
+	} {
+		var out mp3.SeekableBuffer
+		if result, err := mp3.Convert(bytes.NewReader(tc.input), &out); err != nil || result.Input != tc.want {
+			t.Errorf("Convert(%s) = %+v, %v", name, result, err)
+		}
+	}
+
+	if _, err := mp3.Convert(bytes.NewReader([]byte("%PDF-1.7 not audio")), &mp3.SeekableBuffer{}); !errors.Is(err, mp3.ErrorUnknownInput) {
+		t.Errorf("Convert(PDF) = %v, want ErrorUnknownInput", err)
+	}
+	if _, err := mp3.Convert(bytes.NewReader(nil), &mp3.SeekableBuffer{}); !errors.Is(err, mp3.ErrorEmptyInput) {
+		t.Errorf("Convert(empty) = %v, want ErrorEmptyInput", err)
+	}
+	t.Logf("✓ Converted WAV to %d bytes of mp3 and back to %d bytes of WAV", encoded.Len(), decoded.Len())
+}
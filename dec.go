@@ -1,7 +1,13 @@
+//go:build cgo && !purego
+
 package mp3
 
 /*
+#ifdef MP3_SYSTEM_LIBS
+#include <mpg123.h>
+#else
 #include "deps/include/mpg123.h"
+#endif
 
 int mpg123_DecodeWrapped(mpg123_handle *mh,
 			unsigned char *pBuffer, int bufferSize, unsigned char *pOut, int outSize, int *bytesDecode) {
@@ -36,6 +42,9 @@ int mpg123_DecodeWrapped(mpg123_handle *mh,
 		*bytesDecode += done;
 		outSize -= done;
 		pOut += done;
+		if (outSize == 0) {
+			break;
+		}
 	}
 	return MPG123_OK;
 }
@@ -45,91 +54,232 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"runtime"
 	"sync"
 	"unsafe"
 )
 
-const (
-	EstimateFrames = 10
+const activeBackend = BackendNative
+
+// Compile-time checks that the cgo-free constants in config.go match the mpg123 flags.
+var (
+	_ = [1]struct{}{}[ChannelLeft-C.MPG123_MONO_LEFT]
+	_ = [1]struct{}{}[ChannelRight-C.MPG123_MONO_RIGHT]
+	_ = [1]struct{}{}[ChannelMix-C.MPG123_MONO_MIX]
 )
 
 // Decoder represents an MP3 decoder instance wrapping mpg123.
-// It is NOT safe for concurrent use.
+// It is NOT safe for concurrent use. Close calls may run concurrently with each other,
+// but never with other methods.
 type Decoder struct {
 	handle         *C.mpg123_handle
+	cleanup        runtime.Cleanup // Deletes handle if the Decoder is garbage collected without Close
+	closeOnce      sync.Once
+	quota          quota
+	meter          meter
+	frameLog       *frameLog
 	SampleRate     int
 	NumChannels    int
 	SampleBitDepth int
 }
 
-var mpg123Initialized bool
-var mpg123once sync.Once
+var (
+	mpg123Mu          sync.RWMutex
+	mpg123Initialized bool
+)
 
-func initializeMpg123() {
-	mpg123once.Do(func() {
-		err := C.mpg123_init()
-		if err != C.MPG123_OK {
-			fmt.Println("failed to initialize mpg123")
-			return
-		}
-		mpg123Initialized = true
-	})
+// Init initializes the mpg123 library. NewDecoder calls it on first use,
+// call it explicitly to handle initialization errors at startup. Calling Init again is a no-op.
+func Init() error {
+	mpg123Mu.Lock()
+	defer mpg123Mu.Unlock()
+	if mpg123Initialized {
+		return nil
+	}
+	if errNo := C.mpg123_init(); errNo != C.MPG123_OK {
+		return toMpg123Error("init", errNo)
+	}
+	mpg123Initialized = true
+	return nil
+}
+
+// Shutdown releases the global mpg123 state, e.g. before unloading a plugin.
+// All decoders must be closed; the library is initialized again by the next Init or NewDecoder.
+func Shutdown() error {
+	mpg123Mu.Lock()
+	defer mpg123Mu.Unlock()
+	if !mpg123Initialized {
+		return nil
+	}
+	if n := openDecoders.Load(); n > 0 {
+		return fmt.Errorf("%w: %d", ErrorDecodersOpen, n)
+	}
+	C.mpg123_exit()
+	mpg123Initialized = false
+	return nil
 }
 
 // NewDecoder creates a new mpg123 decoder instance
 func NewDecoder() (*Decoder, error) {
-	initializeMpg123()
-	if !mpg123Initialized {
-		return nil, errors.New("mpg123 not initialized")
+	// Keep Shutdown from running while the handle is created, and initialize again if it
+	// ran after Init
+	for {
+		if err := Init(); err != nil {
+			return nil, err
+		}
+		mpg123Mu.RLock()
+		if mpg123Initialized {
+			break
+		}
+		mpg123Mu.RUnlock()
 	}
+	defer mpg123Mu.RUnlock()
 
 	var errNo C.int
 	var mh *C.mpg123_handle
 	mh = C.mpg123_new(nil, &errNo)
 	if mh == nil {
-		return nil, fmt.Errorf("error initializing mpg123 decoder: %s", plainStrError(errNo))
+		return nil, toMpg123Error("new handle", errNo)
 	}
 
 	errNo = C.mpg123_open_feed(mh)
 	if errNo != C.MPG123_OK {
 		C.mpg123_delete(mh)
-		return nil, fmt.Errorf("error open feed: %s", plainStrError(errNo))
+		return nil, toMpg123Error("open feed", errNo)
 	}
 
 	// Set QUIET flag to suppress mpg123 printouts
 	errNo = C.mpg123_param(mh, C.MPG123_ADD_FLAGS, C.MPG123_QUIET, 0.0)
 	if errNo != C.MPG123_OK {
 		C.mpg123_delete(mh)
-		return nil, fmt.Errorf("error setting quiet flag: %s", plainStrError(errNo))
+		return nil, toMpg123Error("set quiet flag", errNo)
 	}
 
-	return &Decoder{
+	d := &Decoder{
 		handle: mh,
-	}, nil
+	}
+	if err := acquireHandle(&openDecoders); err != nil {
+		C.mpg123_delete(mh)
+		return nil, err
+	}
+	d.cleanup = runtime.AddCleanup(d, deleteMpg123, mh)
+	return d, nil
 }
 
+// Close releases the mpg123 handle.
+// It is safe to call Close more than once, also from several goroutines at once, but not
+// while another method is running: the handle is freed.
 func (d *Decoder) Close() {
-	if d.handle != nil {
-		C.mpg123_delete(d.handle)
-		d.handle = nil
+	d.closeOnce.Do(func() {
+		if d.handle != nil {
+			d.cleanup.Stop()
+			deleteMpg123(d.handle)
+			d.handle = nil
+		}
+	})
+}
+
+func deleteMpg123(mh *C.mpg123_handle) {
+	C.mpg123_delete(mh)
+	releaseHandle(&openDecoders)
+}
+
+// SelectChannel makes the decoder output a single channel as mono, e.g. one language of a
+// dual channel broadcast. mpg123 skips the synthesis of the other channel, so this is cheaper
+// than decoding both. It must be called before the first Decode.
+func (d *Decoder) SelectChannel(sel ChannelSelect) error {
+	if d.handle == nil {
+		return fmt.Errorf("decoder %w", ErrorClosed)
+	}
+	if d.SampleRate != 0 {
+		return errors.New("channel selection must be set before decoding")
+	}
+	switch sel {
+	case ChannelBoth, ChannelLeft, ChannelRight, ChannelMix:
+	default:
+		return fmt.Errorf("invalid channel selection: %d", int(sel))
+	}
+
+	errNo := C.mpg123_param(d.handle, C.MPG123_REMOVE_FLAGS, C.MPG123_FORCE_MONO, 0.0)
+	if errNo == C.MPG123_OK && sel != ChannelBoth {
+		errNo = C.mpg123_param(d.handle, C.MPG123_ADD_FLAGS, C.long(sel), 0.0)
+	}
+	if errNo != C.MPG123_OK {
+		return d.handleError("set channel flags", errNo)
+	}
+	return nil
+}
+
+// SetOutputFormat makes the decoder output samples of format instead of S16LE, e.g. S24LE or
+// F32 to keep the precision of the synthesis, which 16 bits round away. It must be called
+// before the first Decode.
+func (d *Decoder) SetOutputFormat(format SampleFormat) error {
+	if d.handle == nil {
+		return fmt.Errorf("decoder %w", ErrorClosed)
+	}
+	if d.SampleRate != 0 {
+		return errors.New("output format must be set before decoding")
+	}
+	var enc C.int
+	switch format {
+	case S16LE:
+		enc = C.MPG123_ENC_SIGNED_16
+	case S24LE:
+		enc = C.MPG123_ENC_SIGNED_24
+	case S32LE:
+		enc = C.MPG123_ENC_SIGNED_32
+	case F32:
+		enc = C.MPG123_ENC_FLOAT_32
+	default:
+		return fmt.Errorf("%w: sample format %d", ErrorInvalidConfig, int(format))
+	}
+
+	// Allow only the requested encoding, for all rates and channel counts
+	errNo := C.mpg123_format_none(d.handle)
+	if errNo == C.MPG123_OK {
+		errNo = C.mpg123_format2(d.handle, 0, C.MPG123_MONO|C.MPG123_STEREO, enc)
+	}
+	if errNo != C.MPG123_OK {
+		return d.handleError("set output format", errNo)
+	}
+	// mpg123_format2 ignores encodings left out of the library build
+	if C.mpg123_format_support(d.handle, 44100, enc) == 0 {
+		return fmt.Errorf("output format %v not supported by mpg123", format)
+	}
+	return nil
+}
+
+// TotalSamples returns the number of samples per channel decoded so far.
+func (d *Decoder) TotalSamples() int64 {
+	if d.SampleRate == 0 {
+		return 0
 	}
+	return d.quota.outBytes / int64(d.NumChannels*d.SampleBitDepth/8)
 }
 
+// EstimateOutBufBytes returns the PCM buffer size needed for nFrames frames.
+// Until the first frame is decoded it assumes the largest frames (1152 samples, 2 channels, 32 bits);
+// afterwards the size is derived from the negotiated format.
 func (d *Decoder) EstimateOutBufBytes(nFrames int) int {
-	// 1 frame: 1152 samples * 2 channels * 4 bytes = 9216 bytes
-	return (1152 * 2 * 4) * nFrames
+	return estimateDecodedBytes(nFrames, d.SampleRate, d.NumChannels, d.SampleBitDepth)
 }
 
 // Decode
 func (d *Decoder) Decode(in, out []byte) (n int, err error) {
+	defer func() { d.reportMetrics(len(in), n, err) }()
 	szIn := len(in)
 	szOut := len(out)
 	if szIn == 0 {
-		return 0, errors.New("input buffer is empty")
+		return 0, ErrorEmptyInput
 	}
-	if szOut < d.EstimateOutBufBytes(EstimateFrames) {
-		return 0, errors.New("output buffer size is not enough")
+	offset := d.quota.inBytes
+	if err = d.quota.checkInput(szIn); err != nil {
+		return 0, err
 	}
+	if required := d.EstimateOutBufBytes(EstimateFrames); szOut < required {
+		return 0, &ShortBufferError{Size: szOut, Required: required}
+	}
+	d.scan(in)
 
 	inPtr := (*C.uchar)(unsafe.Pointer(&in[0]))
 	inLen := C.int(szIn)
@@ -137,8 +287,10 @@ func (d *Decoder) Decode(in, out []byte) (n int, err error) {
 	outLen := C.int(szOut)
 	bytesDecoded := C.int(0)
 
-	if errNo := C.mpg123_DecodeWrapped(d.handle, inPtr, inLen, outPtr, outLen, &bytesDecoded); errNo != C.MPG123_OK {
-		return 0, errors.New(plainStrError(errNo))
+	errNo := C.mpg123_DecodeWrapped(d.handle, inPtr, inLen, outPtr, outLen, &bytesDecoded)
+	runtime.KeepAlive(d)
+	if errNo != C.MPG123_OK {
+		return 0, withOffset(d.handleError("decode", errNo), offset)
 	}
 
 	if d.SampleRate == 0 && bytesDecoded > 0 {
@@ -147,6 +299,9 @@ func (d *Decoder) Decode(in, out []byte) (n int, err error) {
 		}
 	}
 
+	if err = d.quota.addOutput(int(bytesDecoded)); err != nil {
+		return 0, err
+	}
 	return int(bytesDecoded), nil
 }
 
@@ -154,8 +309,9 @@ func (d *Decoder) getFormat() error {
 	var cRate C.long
 	var cChans, cEnc C.int
 	errNo := C.mpg123_getformat(d.handle, &cRate, &cChans, &cEnc)
+	runtime.KeepAlive(d)
 	if errNo != C.MPG123_OK {
-		return errors.New(plainStrError(errNo))
+		return d.handleError("get format", errNo)
 	}
 
 	d.SampleRate = int(cRate)
@@ -174,7 +330,7 @@ func (d *Decoder) getFormat() error {
 		d.SampleBitDepth = 16
 	case C.MPG123_ENC_SIGNED_24:
 		d.SampleBitDepth = 24
-	case C.MPG123_ENC_SIGNED_32:
+	case C.MPG123_ENC_SIGNED_32, C.MPG123_ENC_FLOAT_32:
 		d.SampleBitDepth = 32
 	default:
 		return fmt.Errorf("unsupported encoding: %d", int(cEnc))
@@ -183,6 +339,33 @@ func (d *Decoder) getFormat() error {
 	return nil
 }
 
-func plainStrError(errNo C.int) string {
-	return C.GoString(C.mpg123_plain_strerror(errNo))
+// toMpg123Error converts a mpg123 error code.
+func toMpg123Error(op string, errNo C.int) error {
+	e := &Error{
+		Library: LibraryMpg123,
+		Code:    int(errNo),
+		Op:      op,
+		Msg:     C.GoString(C.mpg123_plain_strerror(errNo)),
+	}
+	switch errNo {
+	case C.MPG123_OUT_OF_MEM:
+		e.Err = ErrorMalloc
+	case C.MPG123_NO_SPACE:
+		e.Err = ErrorBufferTooSmall
+	case C.MPG123_OUT_OF_SYNC, C.MPG123_RESYNC_FAIL:
+		e.Err = ErrorNoFrameSync
+	}
+	return e
+}
+
+// handleError converts an error returned for the handle, resolving the generic
+// MPG123_ERR to the error code stored in the handle.
+func (d *Decoder) handleError(op string, errNo C.int) error {
+	if errNo == C.MPG123_ERR {
+		if code := C.mpg123_errcode(d.handle); code != C.MPG123_OK {
+			errNo = code
+		}
+	}
+	runtime.KeepAlive(d)
+	return toMpg123Error(op, errNo)
 }
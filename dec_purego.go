@@ -0,0 +1,131 @@
+//go:build !cgo || purego
+
+package mp3
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+const activeBackend = BackendGo
+
+// Decoder represents an MP3 decoder instance backed by a DecoderBackend.
+// It is NOT safe for concurrent use. Close calls may run concurrently with each other,
+// but never with other methods.
+type Decoder struct {
+	backend        DecoderBackend
+	cleanup        runtime.Cleanup // Closes backend if the Decoder is garbage collected without Close
+	closeOnce      sync.Once
+	quota          quota
+	meter          meter
+	frameLog       *frameLog
+	SampleRate     int
+	NumChannels    int
+	SampleBitDepth int
+}
+
+// Init is a no-op, decoder backends need no global initialization.
+func Init() error {
+	return nil
+}
+
+// Shutdown is a no-op, decoder backends hold no global state.
+func Shutdown() error {
+	return nil
+}
+
+// NewDecoder creates a new decoder using the backend registered with RegisterDecoderBackend,
+// or the built-in Go decoder if none is registered.
+func NewDecoder() (*Decoder, error) {
+	backend, err := newDecoderBackend()
+	if err != nil {
+		return nil, err
+	}
+	d := &Decoder{
+		backend: backend,
+	}
+	if err := acquireHandle(&openDecoders); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	d.cleanup = runtime.AddCleanup(d, closeDecoderBackend, backend)
+	return d, nil
+}
+
+// Close releases the backend. It is safe to call Close more than once, also from several
+// goroutines at once, but not while another method is running.
+func (d *Decoder) Close() {
+	d.closeOnce.Do(func() {
+		if d.backend != nil {
+			d.cleanup.Stop()
+			closeDecoderBackend(d.backend)
+			d.backend = nil
+		}
+	})
+}
+
+func closeDecoderBackend(backend DecoderBackend) {
+	backend.Close()
+	releaseHandle(&openDecoders)
+}
+
+// SelectChannel is only supported by mpg123, ChannelBoth is accepted as a no-op.
+func (d *Decoder) SelectChannel(sel ChannelSelect) error {
+	if sel != ChannelBoth {
+		return errors.New("channel selection not supported by decoder backend")
+	}
+	return nil
+}
+
+// SetOutputFormat is only supported by mpg123, S16LE is accepted as a no-op.
+func (d *Decoder) SetOutputFormat(format SampleFormat) error {
+	if format != S16LE {
+		return errors.New("output formats other than s16le not supported by decoder backend")
+	}
+	return nil
+}
+
+// TotalSamples returns the number of samples per channel decoded so far.
+func (d *Decoder) TotalSamples() int64 {
+	if d.SampleRate == 0 {
+		return 0
+	}
+	return d.quota.outBytes / int64(d.NumChannels*d.SampleBitDepth/8)
+}
+
+// EstimateOutBufBytes returns the PCM buffer size needed for nFrames frames.
+// Until the first frame is decoded it assumes the largest frames (1152 samples, 2 channels, 32 bits);
+// afterwards the size is derived from the negotiated format.
+func (d *Decoder) EstimateOutBufBytes(nFrames int) int {
+	return estimateDecodedBytes(nFrames, d.SampleRate, d.NumChannels, d.SampleBitDepth)
+}
+
+// Decode
+func (d *Decoder) Decode(in, out []byte) (n int, err error) {
+	defer func() { d.reportMetrics(len(in), n, err) }()
+	if len(in) == 0 {
+		return 0, ErrorEmptyInput
+	}
+	offset := d.quota.inBytes
+	if err = d.quota.checkInput(len(in)); err != nil {
+		return 0, err
+	}
+	if required := d.EstimateOutBufBytes(EstimateFrames); len(out) < required {
+		return 0, &ShortBufferError{Size: len(out), Required: required}
+	}
+	d.scan(in)
+
+	n, err = d.backend.Decode(in, out)
+	if err != nil {
+		return 0, withOffset(err, offset)
+	}
+
+	if d.SampleRate == 0 && n > 0 {
+		d.SampleRate, d.NumChannels, d.SampleBitDepth = d.backend.Format()
+	}
+	if err = d.quota.addOutput(n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,107 @@
+//go:build !cgo || purego
+
+package mp3_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// fakeBackend outputs one block of silence per Decode call
+type fakeBackend struct {
+	closed bool
+	err    error // returned by Decode if set
+}
+
+func (b *fakeBackend) Decode(in, out []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n := 1152 * 2 * 2
+	clear(out[:n])
+	return n, nil
+}
+
+func (b *fakeBackend) Format() (int, int, int) {
+	return 44100, 2, 16
+}
+
+func (b *fakeBackend) Close() {
+	b.closed = true
+}
+
+// TestDecoderBackend tests the cgo-free decoder integration point
+func TestDecoderBackend(t *testing.T) {
+	backend := &fakeBackend{}
+	mp3.RegisterDecoderBackend(func() (mp3.DecoderBackend, error) {
+		return backend, nil
+	})
+	defer mp3.RegisterDecoderBackend(nil)
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if err := decoder.SetOutputFormat(mp3.F32); err == nil {
+		t.Error("Expected an error for float output")
+	}
+
+	pcmBuf := make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+	n, err := decoder.Decode([]byte{0xff, 0xfb, 0x90, 0x64}, pcmBuf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if n != 1152*4 {
+		t.Errorf("Decoded bytes: got %d, want %d", n, 1152*4)
+	}
+	if decoder.SampleRate != 44100 || decoder.NumChannels != 2 || decoder.SampleBitDepth != 16 {
+		t.Errorf("Format mismatch: %d Hz, %d ch, %d bit",
+			decoder.SampleRate, decoder.NumChannels, decoder.SampleBitDepth)
+	}
+
+	// Backend errors carry the input offset as with mpg123
+	backend.err = &mp3.Error{Library: "fake", Code: 1, Op: "decode"}
+	_, err = decoder.Decode(make([]byte, 100), pcmBuf)
+	var e *mp3.Error
+	if !errors.As(err, &e) || e.Offset != 4 {
+		t.Errorf("Decode error = %v, want an *Error at offset 4", err)
+	}
+
+	decoder.Close()
+	if !backend.closed {
+		t.Error("Backend not closed")
+	}
+}
+
+// TestBuiltinDecoderBackend tests that NewDecoder uses the Go decoder without a registered backend
+func TestBuiltinDecoderBackend(t *testing.T) {
+	pcm := generateChord(44100, 2, 44100)
+	var out bytes.Buffer
+	wav := append(mp3.GenerateWavHeader(len(pcm), 44100, 2, 16), pcm...)
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out,
+		&mp3.EncoderConfig{Bitrate: 192}, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+	decoded, err := decoder.DecodeAppend(nil, out.Bytes())
+	if err != nil {
+		t.Fatalf("DecodeAppend failed: %v", err)
+	}
+	if decoder.SampleRate != 44100 || decoder.NumChannels != 2 || decoder.SampleBitDepth != 16 {
+		t.Errorf("Format mismatch: %d Hz, %d ch, %d bit",
+			decoder.SampleRate, decoder.NumChannels, decoder.SampleBitDepth)
+	}
+	snr, delay := pcmSNR(pcm, decoded, 2)
+	if snr < 40 {
+		t.Errorf("SNR %.1f dB below 40 dB", snr)
+	}
+	t.Logf("✓ Built-in decoder: %d bytes, delay %d, SNR %.1f dB", len(decoded), delay, snr)
+}
@@ -1,10 +1,16 @@
 package mp3_test
 
 import (
+	"bytes"
+	"errors"
 	mp3 "github.com/lizc2003/audio-mp3"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 // TestCase defines a test case for MP3 decoding
@@ -105,6 +111,7 @@ func getTestCases() []TestCase {
 
 // TestDecodeVariousEncodings tests decoding of various MP3 encoding formats
 func TestDecodeVariousEncodings(t *testing.T) {
+	requireNative(t)
 	testCases := getTestCases()
 
 	for _, tc := range testCases {
@@ -188,6 +195,7 @@ func TestDecodeVariousEncodings(t *testing.T) {
 
 // TestInvalidInput tests decoder behavior with invalid input
 func TestInvalidInput(t *testing.T) {
+	requireNative(t)
 	decoder, err := mp3.NewDecoder()
 	if err != nil {
 		t.Fatalf("Failed to create decoder: %v", err)
@@ -225,6 +233,390 @@ func TestInvalidInput(t *testing.T) {
 	})
 }
 
+func TestDecoderEstimateOutBufBytes(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 16000, NumChannels: 1, Bitrate: 32})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, err := encoder.EncodeAppend(nil, generateSineWave(440, 16000, 1, 16000))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	worstCase := decoder.EstimateOutBufBytes(mp3.EstimateFrames)
+	if _, err := decoder.Decode(mp3Data, make([]byte, worstCase)); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// MPEG-2.5 mono 16-bit: 576 samples * 1 channel * 2 bytes per frame
+	if got, want := decoder.EstimateOutBufBytes(mp3.EstimateFrames), 576*2*mp3.EstimateFrames; got != want {
+		t.Errorf("EstimateOutBufBytes after format negotiation = %d, want %d", got, want)
+	}
+	t.Logf("✓ Decoder estimate: %d bytes before format, %d after", worstCase, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+}
+
+func TestInitShutdown(t *testing.T) {
+	requireNative(t)
+	if err := mp3.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if _, decoders := settleHandles(); decoders > 0 {
+		t.Skipf("%d decoders still open", decoders)
+	}
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if err := mp3.Shutdown(); !errors.Is(err, mp3.ErrorDecodersOpen) {
+		t.Errorf("Shutdown with open decoder = %v, want ErrorDecodersOpen", err)
+	}
+	decoder.Close()
+	if err := mp3.Shutdown(); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if err := mp3.Shutdown(); err != nil {
+		t.Errorf("Second Shutdown failed: %v", err)
+	}
+
+	// The library is initialized again on demand
+	decoder, err = mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("NewDecoder after Shutdown failed: %v", err)
+	}
+	defer decoder.Close()
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, _ := encoder.EncodeAppend(nil, generateSineWave(440, 44100, 2, 44100))
+	n, err := decoder.Decode(mp3Data, make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames)))
+	if err != nil || n == 0 {
+		t.Errorf("Decode after Shutdown = %d, %v", n, err)
+	}
+}
+
+// TestNewDecoderDuringShutdown tests that NewDecoder does not fail when Shutdown runs concurrently
+func TestNewDecoderDuringShutdown(t *testing.T) {
+	requireNative(t)
+	if _, decoders := settleHandles(); decoders > 0 {
+		t.Skipf("%d decoders still open", decoders)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := mp3.Shutdown(); err != nil && !errors.Is(err, mp3.ErrorDecodersOpen) {
+				t.Errorf("Shutdown failed: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 2000; i++ {
+		decoder, err := mp3.NewDecoder()
+		if err != nil {
+			t.Errorf("NewDecoder %d failed: %v", i, err)
+			break
+		}
+		decoder.Close()
+	}
+	close(stop)
+	<-done
+}
+
+func TestDecodeAppend(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	mp3Data, _ := encoder.EncodeAppend(nil, pcmData)
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	// The whole stream in one call needs far more than EstimateFrames frames
+	pcm, err := decoder.DecodeAppend(nil, mp3Data)
+	if err != nil {
+		t.Fatalf("DecodeAppend failed: %v", err)
+	}
+	if len(pcm) < len(pcmData)*9/10 {
+		t.Errorf("Decoded %d bytes, want ~%d", len(pcm), len(pcmData))
+	}
+	t.Logf("✓ DecodeAppend: %d bytes", len(pcm))
+}
+
+func TestDecoderBitrate(t *testing.T) {
+	requireNative(t)
+	testCases := []struct {
+		name   string
+		config mp3.EncoderConfig
+	}{
+		{"CBR", mp3.EncoderConfig{Bitrate: 128, IsWriteVbrTag: true}},
+		{"VBR", mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 4, IsWriteVbrTag: true}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.SampleRate = 44100
+			config.NumChannels = 2
+			encoder, err := mp3.NewEncoder(&config)
+			if err != nil {
+				t.Fatalf("Failed to create encoder: %v", err)
+			}
+			defer encoder.Close()
+			// A tone followed by silence, so VBR frames vary in size
+			pcmData := generateSineWave(440, 44100, 2, 44100*2)
+			clear(pcmData[len(pcmData)/2:])
+			mp3Data, _ := encoder.EncodeAppend(nil, pcmData)
+			mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+			// Sum up the audio frames, skipping the Xing/Info frame
+			var bytes, frames int
+			var minRate, maxRate int
+			for pos := 0; pos+mp3.FrameHeaderSize <= len(mp3Data); {
+				h, err := mp3.ParseFrameHeader(mp3Data[pos:])
+				if err != nil {
+					t.Fatalf("Invalid frame at %d: %v", pos, err)
+				}
+				if !mp3.IsInfoFrame(mp3Data[pos:]) {
+					bytes += h.Size
+					frames++
+					minRate = min(minRate, h.Bitrate)
+					if minRate == 0 {
+						minRate = h.Bitrate
+					}
+					maxRate = max(maxRate, h.Bitrate)
+				}
+				pos += h.Size
+			}
+			want := int(math.Round(float64(bytes) * 8 / (float64(frames) * 1152 / 44100) / 1000))
+
+			decoder, err := mp3.NewDecoder()
+			if err != nil {
+				t.Fatalf("Failed to create decoder: %v", err)
+			}
+			defer decoder.Close()
+			if current, average := decoder.Bitrate(); current != 0 || average != 0 {
+				t.Errorf("Bitrate() before decoding = %d, %d, want 0, 0", current, average)
+			}
+
+			pcmBuf := make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+			for chunk := range slicesChunk(mp3Data, 1000) {
+				if _, err := decoder.Decode(chunk, pcmBuf); err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				current, _ := decoder.Bitrate()
+				if current < minRate || current > maxRate {
+					t.Errorf("Current bitrate %d out of range %d..%d", current, minRate, maxRate)
+				}
+			}
+
+			current, average := decoder.Bitrate()
+			if average != want {
+				t.Errorf("Average bitrate = %d, want %d", average, want)
+			}
+			if config.VbrMode == mp3.VbrModeOff && (current != 128 || average != 128) {
+				t.Errorf("Bitrate() = %d, %d, want 128, 128", current, average)
+			}
+			t.Logf("✓ %s: current %d kbps, average %d kbps (%d..%d)", tc.name, current, average, minRate, maxRate)
+		})
+	}
+}
+
+func TestDecoderSelectChannel(t *testing.T) {
+	requireNative(t)
+	// Silence on the left channel, a tone on the right
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	for i := 0; i < len(pcmData); i += 4 {
+		pcmData[i], pcmData[i+1] = 0, 0
+	}
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
+		SampleRate:  44100,
+		NumChannels: 2,
+		Bitrate:     128,
+		MpegMode:    mp3.MpegStereo,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, _ := encoder.EncodeAppend(nil, pcmData)
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	testCases := []struct {
+		name     string
+		sel      mp3.ChannelSelect
+		channels int
+		loud     bool
+	}{
+		{"Both", mp3.ChannelBoth, 2, true},
+		{"Left", mp3.ChannelLeft, 1, false},
+		{"Right", mp3.ChannelRight, 1, true},
+		{"Mix", mp3.ChannelMix, 1, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoder, err := mp3.NewDecoder()
+			if err != nil {
+				t.Fatalf("Failed to create decoder: %v", err)
+			}
+			defer decoder.Close()
+			if err := decoder.SelectChannel(tc.sel); err != nil {
+				t.Fatalf("SelectChannel failed: %v", err)
+			}
+			pcm, err := decoder.DecodeAppend(nil, mp3Data)
+			if err != nil {
+				t.Fatalf("DecodeAppend failed: %v", err)
+			}
+			if decoder.NumChannels != tc.channels {
+				t.Errorf("NumChannels = %d, want %d", decoder.NumChannels, tc.channels)
+			}
+
+			peak := 0
+			for i := 0; i+1 < len(pcm); i += 2 {
+				peak = max(peak, abs(int(int16(uint16(pcm[i])|uint16(pcm[i+1])<<8))))
+			}
+			if len(pcm) < 44100*2*tc.channels {
+				t.Errorf("Decoded %d bytes, want at least %d", len(pcm), 44100*2*tc.channels)
+			}
+			if loud := peak > 1000; loud != tc.loud {
+				t.Errorf("Peak %d, want loud %v", peak, tc.loud)
+			}
+			t.Logf("✓ %s: %d channels, peak %d", tc.name, decoder.NumChannels, peak)
+
+			if err := decoder.SelectChannel(mp3.ChannelBoth); err == nil {
+				t.Error("SelectChannel after decoding should fail")
+			}
+		})
+	}
+}
+
+func TestDecodeToWavRF64(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	mp3Data, _ := encoder.EncodeAppend(nil, pcmData)
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	wavPath := filepath.Join(t.TempDir(), "out.wav")
+	wavFile, err := os.Create(wavPath)
+	if err != nil {
+		t.Fatalf("Failed to create WAV file: %v", err)
+	}
+	totalBytes, totalSamples, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), wavFile, &mp3.WavOptions{RF64: true})
+	wavFile.Close()
+	if err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	wav, err := os.ReadFile(wavPath)
+	if err != nil {
+		t.Fatalf("Failed to read WAV file: %v", err)
+	}
+	if int64(len(wav)) != totalBytes {
+		t.Errorf("DecodeToWav returned %d bytes, file has %d", totalBytes, len(wav))
+	}
+	// Small output is a RIFF file, the ds64 space is a JUNK chunk
+	if string(wav[0:4]) != "RIFF" || string(wav[12:16]) != "JUNK" {
+		t.Errorf("Unexpected header %q", wav[:16])
+	}
+
+	pcmSize, sampleRate, numChannels, _, err := mp3.ParseWavHeader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("ParseWavHeader failed: %v", err)
+	}
+	if pcmSize != totalBytes-mp3.RF64HeaderSize || pcmSize/int64(numChannels*2) != totalSamples || sampleRate != 44100 {
+		t.Errorf("Parsed %d bytes %d Hz %d channels, want %d bytes", pcmSize, sampleRate, numChannels, totalBytes-mp3.RF64HeaderSize)
+	}
+	t.Logf("✓ RF64 option: %d bytes, %d samples", totalBytes, totalSamples)
+}
+
+func TestRF64Header(t *testing.T) {
+	for _, pcmSize := range []int64{0, 1 << 20, 5 << 30, 1 << 40} {
+		header := mp3.GenerateRF64Header(pcmSize, 48000, 2, 16)
+		if len(header) != mp3.RF64HeaderSize {
+			t.Fatalf("Header size %d, want %d", len(header), mp3.RF64HeaderSize)
+		}
+		wantID := "RIFF"
+		if pcmSize >= 1<<32 {
+			wantID = "RF64"
+		}
+		if string(header[0:4]) != wantID {
+			t.Errorf("%d bytes: header id %q, want %q", pcmSize, header[0:4], wantID)
+		}
+
+		size, sampleRate, numChannels, bitsPerSample, err := mp3.ParseWavHeader(bytes.NewReader(header))
+		if err != nil {
+			t.Fatalf("%d bytes: ParseWavHeader failed: %v", pcmSize, err)
+		}
+		if size != pcmSize || sampleRate != 48000 || numChannels != 2 || bitsPerSample != 16 {
+			t.Errorf("%d bytes: parsed %d bytes %d Hz %d channels %d bits", pcmSize, size, sampleRate, numChannels, bitsPerSample)
+		}
+	}
+	t.Logf("✓ RF64 headers round trip")
+}
+
+func TestTotalSamples(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	// An incomplete sample frame is held back until the next call
+	mp3Data, _ := encoder.EncodeAppend(nil, pcmData[:1001])
+	mp3Data, _ = encoder.EncodeAppend(mp3Data, pcmData[1001:])
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+	if n := encoder.TotalSamples(); n != 44100 {
+		t.Errorf("Encoder TotalSamples() = %d, want 44100", n)
+	}
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+	if n := decoder.TotalSamples(); n != 0 {
+		t.Errorf("Decoder TotalSamples() before decoding = %d, want 0", n)
+	}
+	pcm, err := decoder.DecodeAppend(nil, mp3Data)
+	if err != nil {
+		t.Fatalf("DecodeAppend failed: %v", err)
+	}
+	if n := decoder.TotalSamples(); n != int64(len(pcm)/4) {
+		t.Errorf("Decoder TotalSamples() = %d, want %d", n, len(pcm)/4)
+	}
+	t.Logf("✓ TotalSamples: encoded %d, decoded %d", encoder.TotalSamples(), decoder.TotalSamples())
+}
+
 // BenchmarkDecode benchmarks the decoding performance
 func BenchmarkDecode(b *testing.B) {
 	mp3Path := filepath.Join("samples", "mpeg1_44100_stereo_cbr128.mp3")
@@ -259,3 +651,182 @@ func BenchmarkDecode(b *testing.B) {
 		decoder.Close()
 	}
 }
+
+func TestDecodeToWavChunkSizes(t *testing.T) {
+	requireNative(t)
+	// At 32 kbps a 2048-byte chunk holds ~20 frames, more than EstimateFrames
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 32})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	pcmData := generateSineWave(440, 44100, 2, 44100*2)
+	mp3Data, _ := encoder.EncodeAppend(nil, pcmData)
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	var want []byte
+	for _, opts := range []*mp3.WavOptions{
+		nil,
+		{ChunkSize: 64},
+		{ChunkSize: 2048},
+		{ChunkSize: 1 << 20},
+		{ChunkSize: 4096, DecodeFrames: 1},
+		{DecodeFrames: 200},
+	} {
+		wavPath := filepath.Join(t.TempDir(), "out.wav")
+		wavFile, err := os.Create(wavPath)
+		if err != nil {
+			t.Fatalf("Failed to create WAV file: %v", err)
+		}
+		_, totalSamples, sampleRate, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), wavFile, opts)
+		wavFile.Close()
+		if err != nil {
+			t.Fatalf("DecodeToWav(%+v) failed: %v", opts, err)
+		}
+		wav, err := os.ReadFile(wavPath)
+		if err != nil {
+			t.Fatalf("Failed to read WAV file: %v", err)
+		}
+
+		if want == nil {
+			want = wav
+			// LAME resamples at this bitrate
+			if totalSamples < int64(sampleRate*2) {
+				t.Errorf("Decoded %d samples at %d Hz, want at least %d", totalSamples, sampleRate, sampleRate*2)
+			}
+		} else if !bytes.Equal(wav, want) {
+			t.Errorf("DecodeToWav(%+v) output differs: %d bytes, want %d", opts, len(wav), len(want))
+		}
+	}
+}
+
+// crashWriter fails every write after limit bytes, like a process killed mid-decode.
+type crashWriter struct {
+	*os.File
+	limit int64
+}
+
+func (w *crashWriter) Write(p []byte) (int, error) {
+	pos, _ := w.Seek(0, io.SeekCurrent)
+	if pos+int64(len(p)) > w.limit {
+		return 0, errors.New("crashed")
+	}
+	return w.File.Write(p)
+}
+
+// TestDecodeToWavFinalizeInterval tests that a decode stopped midway leaves a playable WAV
+func TestDecodeToWavFinalizeInterval(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	pcmData := generateSineWave(440, 44100, 2, 44100*10)
+	mp3Data, _ := encoder.EncodeAppend(nil, pcmData)
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	const bytesPerSecond = 44100 * 4
+	for _, opts := range []*mp3.WavOptions{
+		{FinalizeInterval: time.Second},
+		{FinalizeInterval: time.Second, RF64: true},
+		nil,
+	} {
+		wavPath := filepath.Join(t.TempDir(), "out.wav")
+		wavFile, err := os.Create(wavPath)
+		if err != nil {
+			t.Fatalf("Failed to create WAV file: %v", err)
+		}
+		_, _, _, err = mp3.DecodeToWav(bytes.NewReader(mp3Data), &crashWriter{wavFile, 5 * bytesPerSecond}, opts)
+		wavFile.Close()
+		if err == nil {
+			t.Fatal("DecodeToWav did not fail")
+		}
+
+		wav, err := os.ReadFile(wavPath)
+		if err != nil {
+			t.Fatalf("Failed to read WAV file: %v", err)
+		}
+		pcmSize, sampleRate, _, _, err := mp3.ParseWavHeader(bytes.NewReader(wav))
+		if opts == nil {
+			if err == nil {
+				t.Error("Header without FinalizeInterval should be a placeholder")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseWavHeader failed: %v", err)
+		}
+		headerSize := mp3.WavHeaderSize
+		if opts.RF64 {
+			headerSize = mp3.RF64HeaderSize
+		}
+		if sampleRate != 44100 || pcmSize < 4*bytesPerSecond || int64(headerSize)+pcmSize > int64(len(wav)) {
+			t.Errorf("Header covers %d bytes at %d Hz, file has %d", pcmSize, sampleRate, len(wav))
+		}
+		t.Logf("✓ Stopped after %d bytes, header covers %d", len(wav), pcmSize)
+	}
+}
+
+func TestDecoderLeadingJunk(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, _ := encoder.EncodeAppend(nil, generateSineWave(440, 44100, 2, 44100))
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Junk")
+	// A cut frame: its header claims more bytes than follow before the next frame
+	cutFrame := mp3Data[:200]
+	garbage := []byte("not an mp3 frame \xff\xfe\x00")
+	// A single frame is not followed by a header that confirms its sync
+	frame := mp3Data
+	if mp3.IsInfoFrame(frame) {
+		h, _ := mp3.ParseFrameHeader(frame)
+		frame = frame[h.Size:]
+	}
+	h, _ := mp3.ParseFrameHeader(frame)
+	frame = frame[:h.Size]
+
+	testCases := []struct {
+		name string
+		data []byte
+		junk int64
+	}{
+		{"Clean", mp3Data, 0},
+		{"ID3v2 tag", append(tag.Bytes(), mp3Data...), 0},
+		{"Garbage", append(slices.Clone(garbage), mp3Data...), int64(len(garbage))},
+		{"Cut frame after tag", slices.Concat(tag.Bytes(), garbage, cutFrame, mp3Data), int64(len(garbage) + len(cutFrame))},
+		{"Single frame", slices.Concat(garbage, frame), int64(len(garbage))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoder, err := mp3.NewDecoder()
+			if err != nil {
+				t.Fatalf("Failed to create decoder: %v", err)
+			}
+			defer decoder.Close()
+			if got := decoder.LeadingJunk(); got != 0 {
+				t.Errorf("LeadingJunk() before decoding = %d, want 0", got)
+			}
+
+			pcmBuf := make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+			for chunk := range slicesChunk(tc.data, 100) {
+				if _, err := decoder.Decode(chunk, pcmBuf); err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+			}
+			if got := decoder.LeadingJunk(); got != tc.junk {
+				t.Errorf("LeadingJunk() = %d, want %d", got, tc.junk)
+			}
+			if current, _ := decoder.Bitrate(); current != 128 {
+				t.Errorf("Bitrate() = %d, want 128", current)
+			}
+			t.Logf("✓ %s: %d bytes of leading junk", tc.name, tc.junk)
+		})
+	}
+}
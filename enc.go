@@ -1,118 +1,153 @@
+//go:build cgo && !purego
+
 package mp3
 
 /*
+#ifdef MP3_SYSTEM_LIBS
+#include <lame/lame.h>
+#else
 #include "deps/include/lame.h"
+#endif
 */
 import "C"
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
 	"unsafe"
 )
 
-const (
-	SampleBitDepth = 16
-)
-
-type MpegMode int
-
-const (
-	MpegStereo      MpegMode = C.STEREO + 1
-	MpegJointStereo MpegMode = C.JOINT_STEREO + 1
-	MpegDualChannel MpegMode = C.DUAL_CHANNEL + 1 /* LAME doesn't supports this! */
-	MpegMono        MpegMode = C.MONO + 1
-	MpegNotSet      MpegMode = C.NOT_SET + 1
-)
-
-type VBRMode int
-
-const (
-	VbrModeOff  VBRMode = C.vbr_off
-	VbrModeRh   VBRMode = C.vbr_rh
-	VbrModeAbr  VBRMode = C.vbr_abr
-	VbrModeMtrh VBRMode = C.vbr_mtrh
-)
-
+// Compile-time checks that the cgo-free constants in config.go match the LAME enums.
 var (
-	ErrorBufferTooSmall         = errors.New("buffer too small")
-	ErrorMalloc                 = errors.New("could not allocate malloc")
-	ErrorParamsNotInitialized   = errors.New("lame_init_params not called")
-	ErrorPsychoAcousticProblems = errors.New("psycho acoustic problems")
-	ErrorUnknown                = errors.New("unknown error")
+	_ = [1]struct{}{}[MpegStereo-(C.STEREO+1)]
+	_ = [1]struct{}{}[MpegJointStereo-(C.JOINT_STEREO+1)]
+	_ = [1]struct{}{}[MpegDualChannel-(C.DUAL_CHANNEL+1)]
+	_ = [1]struct{}{}[MpegMono-(C.MONO+1)]
+	_ = [1]struct{}{}[MpegNotSet-(C.NOT_SET+1)]
+	_ = [1]struct{}{}[VbrModeOff-C.vbr_off]
+	_ = [1]struct{}{}[VbrModeRh-C.vbr_rh]
+	_ = [1]struct{}{}[VbrModeAbr-C.vbr_abr]
+	_ = [1]struct{}{}[VbrModeMtrh-C.vbr_mtrh]
+	_ = [1]struct{}{}[PresetMedium-C.MEDIUM]
+	_ = [1]struct{}{}[PresetStandard-C.STANDARD]
+	_ = [1]struct{}{}[PresetExtreme-C.EXTREME]
+	_ = [1]struct{}{}[PresetInsane-C.INSANE]
 )
 
-// EncoderConfig specifies MP3 encoding parameters.
-type EncoderConfig struct {
-	// SampleRate sets input sample rate in Hz.
-	// Default is 44100.
-	SampleRate int
-
-	// NumChannels sets number of channels in input stream.
-	// Default is 2 (stereo).
-	NumChannels int
-
-	// Bitrate in kbps for CBR encoding.
-	// Supported values: 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320
-	// Default is 128.
-	Bitrate int
-
-	// Quality is the encoding quality level (0-9).
-	// 0 = best quality (very slow)
-	// 2 = near-best quality, not too slow (recommended)
-	// 5 = good quality, fast
-	// 7 = ok quality, really fast
-	// 9 = worst quality
-	// Default is 2.
-	Quality int
-
-	// VbrMode sets the VBR (Variable Bit Rate) mode.
-	// Default is VbrModeOff (CBR).
-	VbrMode VBRMode
-
-	// MpegMode sets the output audio mode.
-	// Default: LAME picks based on compression ratio and input channels.
-	MpegMode MpegMode
-
-	// Enable VBR/Info tag writing (includes Xing header for VBR, Info header for CBR)
-	// This inserts a placeholder frame at the beginning which should be updated later
-	IsWriteVbrTag bool
-}
-
 // Encoder is an MP3 encoder instance wrapping the LAME library.
 // It encodes PCM audio data to MP3 format.
-// Note: Encoder is NOT safe for concurrent use.
+// Note: Encoder is NOT safe for concurrent use; see SyncEncoder. Close calls may run
+// concurrently with each other, but never with other methods.
 type Encoder struct {
 	handle      *C.lame_global_flags
-	remainData  []byte // Buffer for incomplete sample frames
+	wideBuf     []byte          // 24-bit samples widened to 32 bits for LAME
+	cleanup     runtime.Cleanup // Closes handle if the Encoder is garbage collected without Close
+	closeOnce   sync.Once
+	remainData  []byte    // Buffer for incomplete sample frames and batched samples
+	remainFmt   pcmFormat // format of remainData
+	planarBuf   []byte    // interleaved input of EncodePlanar
+	minSamples  int
+	findPeak    bool
+	peakSample  int64 // Largest absolute input sample scaled to 32 bits, tracked when findPeak is set
+	quota       quota
+	meter       meter
+	inRate      int
+	outRate     int
+	frameBytes  int // Size of the largest frame LAME can output with this config
+	infoFrames  int // 1 if LAME writes a Xing/Info placeholder frame first
 	NumChannels int
 	FrameLength int
+
+	// State for Reconfigure, see enc_switch.go
+	tracker       frameTracker   // frame boundaries in the output of the current handle
+	dropFrames    int            // leading frames of the current handle's output to discard
+	handleSamples int64          // samples per channel passed to the current handle
+	frameOffset   int            // added to the frame count of the current handle
+	next          *encoderSwitch // pending switch to a new configuration
+	reconfigured  bool
+	lameTag       []byte // Xing/LAME tag frame of the first handle, or of a resumed one
+	totalSamples  int64  // samples per channel encoded over all handles
+	resumeBytes   int64  // output of the stream before the checkpoint of a resumed encoder
+
+	// State for gapless encoding, see enc_nogap.go
+	trackStart int64 // output bytes of the previous tracks
+	trackIndex int
+	trackDone  bool // FlushNoGap was called, NextTrack starts the next track
+
+	frameLog *frameLog
+	vbri     *vbriTable // seek table of the VBRI tag frame, nil unless TagVBRI is written
+	quality  int
+	tags     *TrackTags // written by EncodeAll
+	id3v1    bool
+	output   io.Writer // written by ReadFrom
 }
 
 // NewEncoder creates a new MP3 encoder with the given configuration.
-// If config is nil or has zero values, defaults will be used.
+// If config is nil or has zero values, defaults will be used. A config that fails
+// EncoderConfig.Validate is rejected.
 func NewEncoder(c *EncoderConfig) (*Encoder, error) {
+	return newEncoder(populateEncConfig(c), nil)
+}
+
+// newEncoder creates an encoder, setup is called with the LAME parameters set before they are initialized.
+func newEncoder(c *EncoderConfig, setup func(h *C.lame_global_flags) error) (*Encoder, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
 	h := C.lame_init()
 	if h == nil {
-		return nil, errors.New("failed to initialize lame")
+		return nil, &Error{Library: LibraryLame, Op: "init", Err: ErrorMalloc}
 	}
 
 	enc := &Encoder{
 		handle: h,
 	}
-	err := enc.initParams(populateEncConfig(c))
+	err := enc.setParams(c)
+	if err == nil && setup != nil {
+		err = setup(h)
+	}
+	if err == nil {
+		err = enc.applyParams(c)
+	}
 	if err != nil {
 		C.lame_close(h)
 		return nil, err
 	}
 
+	if err := acquireHandle(&openEncoders); err != nil {
+		C.lame_close(h)
+		return nil, err
+	}
+	enc.cleanup = runtime.AddCleanup(enc, closeLame, h)
 	return enc, nil
 }
 
+// Close releases the LAME handle.
+// It is safe to call Close more than once, also from several goroutines at once, but not
+// while another method is running: the handle is freed.
 func (enc *Encoder) Close() {
-	if enc.handle != nil {
-		C.lame_close(enc.handle)
-		enc.handle = nil
-	}
+	enc.closeOnce.Do(func() {
+		if enc.next != nil {
+			enc.next.enc.Close()
+			enc.next = nil
+		}
+		if enc.handle != nil {
+			enc.cleanup.Stop()
+			closeLame(enc.handle)
+			enc.handle = nil
+		}
+	})
+}
+
+func closeLame(h *C.lame_global_flags) {
+	C.lame_close(h)
+	releaseHandle(&openEncoders)
 }
 
 // Encode encodes PCM audio data to MP3 format.
@@ -120,51 +155,185 @@ func (enc *Encoder) Close() {
 // out: output buffer for MP3 data (should be at least EstimateOutBufBytes(len(in)))
 // Returns: number of MP3 bytes written to out buffer
 func (enc *Encoder) Encode(in, out []byte) (n int, err error) {
+	return enc.encode(in, out, pcmS16)
+}
+
+// encode is Encode for samples of any format.
+func (enc *Encoder) encode(in, out []byte, format pcmFormat) (n int, err error) {
+	inLen := len(in)
+	defer func() { enc.reportMetrics(inLen, n, err) }()
 	szIn := len(in)
 	szOut := len(out)
 
 	if szIn == 0 {
-		return 0, errors.New("input buffer is empty")
+		return 0, ErrorEmptyInput
+	}
+	offset := enc.quota.inBytes
+	if err = enc.quota.checkInput(szIn); err != nil {
+		return 0, err
 	}
-	if szOut < enc.EstimateOutBufBytes(szIn) {
-		return 0, errors.New("output buffer is too small")
+	// The estimate is based on 16-bit samples
+	if required := enc.EstimateOutBufBytes(szIn * 2 / format.size()); szOut < required {
+		return 0, &ShortBufferError{Size: szOut, Required: required}
 	}
+	if len(enc.remainData) > 0 && format != enc.remainFmt {
+		return 0, errors.New("samples of another format are held back, the format can not be changed")
+	}
+	enc.remainFmt = format
 
 	if len(enc.remainData) > 0 {
-		in = append(enc.remainData, in...)
+		enc.remainData = append(enc.remainData, in...)
+		in = enc.remainData
 		szIn = len(in)
-		enc.remainData = nil
 	}
 
-	bytesPerSample := enc.NumChannels * SampleBitDepth / 8
-	remain := szIn % bytesPerSample
-	if remain > 0 {
-		szIn -= remain
-		enc.remainData = append(enc.remainData, in[szIn:]...)
-		in = in[:szIn]
+	bytesPerSample := enc.NumChannels * format.size()
+	if szIn/bytesPerSample < enc.minSamples {
+		// Not enough samples yet, keep them for the next call
+		if len(enc.remainData) == 0 {
+			enc.remainData = append(enc.remainData, in...)
+		}
+		return 0, nil
 	}
 
+	remain := szIn % bytesPerSample
+	szIn -= remain
 	if szIn == 0 {
+		if len(enc.remainData) == 0 {
+			enc.remainData = append(enc.remainData, in...)
+		}
 		return 0, nil
 	}
 
-	inPtr := (*C.short)(unsafe.Pointer(&in[0]))
+	n, err = enc.encodeSamples(in[:szIn], out, format)
+	// Keep the incomplete sample frame. in may alias remainData, append copies with overlap safely.
+	enc.remainData = append(enc.remainData[:0], in[szIn:]...)
+	if err != nil {
+		return 0, withOffset(err, offset)
+	}
+	enc.frameLog.scan(out[:n])
+	enc.vbri.scan(out[:n])
+	if err = enc.quota.addOutput(n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// encodeSamples passes complete interleaved sample frames to LAME.
+func (enc *Encoder) encodeSamples(in, out []byte, format pcmFormat) (n int, err error) {
+	if enc.findPeak {
+		enc.trackPeak(in, format)
+	}
+	enc.totalSamples += int64(len(in) / (enc.NumChannels * format.size()))
+	if enc.next != nil {
+		return enc.encodeSwitching(in, out, format)
+	}
+	return enc.lameEncode(in, out, format)
+}
+
+// lameEncode encodes with the current handle and tracks the frames in its output.
+func (enc *Encoder) lameEncode(in, out []byte, format pcmFormat) (n int, err error) {
+	bytesPerSample := enc.NumChannels * format.size()
+	numSamples := C.int(len(in) / bytesPerSample)
+	if numSamples == 0 {
+		return 0, nil
+	}
+	if len(out) == 0 {
+		// LAME takes a zero size as unlimited
+		return 0, &ShortBufferError{Size: 0, Required: enc.EstimateOutBufBytes(len(in))}
+	}
+	cIn := in
+	switch format {
+	case pcmS16, pcmS32, pcmF32:
+	default:
+		// LAME takes 24-bit samples as 32-bit samples at full scale
+		size := format.size()
+		enc.wideBuf = slices.Grow(enc.wideBuf[:0], len(in)/size*4)[:len(in)/size*4]
+		cIn = enc.wideBuf
+		for i := 0; i+size <= len(in); i += size {
+			binary.NativeEndian.PutUint32(cIn[i/size*4:], uint32(format.sample(in[i:])))
+		}
+	}
 	outPtr := (*C.uchar)(unsafe.Pointer(&out[0]))
-	numSamples := C.int(szIn / bytesPerSample)
+	szOut := C.int(len(out))
 	nWr := C.int(0)
 
-	if enc.NumChannels == 2 {
+	stereo := enc.NumChannels == 2
+	switch {
+	case format == pcmS16 && stereo:
 		nWr = C.lame_encode_buffer_interleaved(enc.handle,
-			inPtr, numSamples, outPtr, C.int(szOut))
-	} else {
+			(*C.short)(unsafe.Pointer(&cIn[0])), numSamples, outPtr, szOut)
+	case format == pcmS16:
 		nWr = C.lame_encode_buffer(enc.handle,
-			inPtr, nil, numSamples, outPtr, C.int(szOut))
+			(*C.short)(unsafe.Pointer(&cIn[0])), nil, numSamples, outPtr, szOut)
+	case format == pcmF32 && stereo:
+		nWr = C.lame_encode_buffer_interleaved_ieee_float(enc.handle,
+			(*C.float)(unsafe.Pointer(&cIn[0])), numSamples, outPtr, szOut)
+	case format == pcmF32:
+		nWr = C.lame_encode_buffer_ieee_float(enc.handle,
+			(*C.float)(unsafe.Pointer(&cIn[0])), nil, numSamples, outPtr, szOut)
+	case stereo:
+		nWr = C.lame_encode_buffer_interleaved_int(enc.handle,
+			(*C.int)(unsafe.Pointer(&cIn[0])), numSamples, outPtr, szOut)
+	default:
+		nWr = C.lame_encode_buffer_int(enc.handle,
+			(*C.int)(unsafe.Pointer(&cIn[0])), nil, numSamples, outPtr, szOut)
 	}
+	runtime.KeepAlive(enc)
 	if nWr < 0 {
-		return 0, toError(nWr)
+		return 0, toError("encode", nWr)
+	}
+
+	enc.handleSamples += int64(numSamples)
+	return enc.trackOutput(out, out[:nWr]), nil
+}
+
+// lameFlush flushes the current handle and tracks the frames in its output.
+func (enc *Encoder) lameFlush(out []byte) (n int, err error) {
+	return enc.lameFlushMode(out, false)
+}
+
+// lameFlushMode flushes the current handle, with nogap the last frame is padded with
+// ancillary data and the handle can continue with the next track.
+func (enc *Encoder) lameFlushMode(out []byte, nogap bool) (n int, err error) {
+	if len(out) == 0 {
+		// LAME takes a zero size as unlimited
+		return 0, &ShortBufferError{Size: 0, Required: enc.EstimateOutBufBytes(0)}
+	}
+	var bytesOut C.int
+	if nogap {
+		bytesOut = C.lame_encode_flush_nogap(enc.handle, (*C.uchar)(unsafe.Pointer(&out[0])), C.int(len(out)))
+	} else {
+		bytesOut = C.lame_encode_flush(enc.handle, (*C.uchar)(unsafe.Pointer(&out[0])), C.int(len(out)))
+	}
+	runtime.KeepAlive(enc)
+	if bytesOut < 0 {
+		return 0, toError("flush", bytesOut)
 	}
+	return enc.trackOutput(out, out[:bytesOut]), nil
+}
 
-	return int(nWr), nil
+// trackOutput copies LAME output to out, following frame boundaries and dropping
+// the leading frames of a continuation handle.
+func (enc *Encoder) trackOutput(out, data []byte) int {
+	if enc.dropFrames > 0 {
+		cut := enc.tracker.split(data, enc.dropFrames)
+		if cut < 0 {
+			return 0
+		}
+		enc.dropFrames = 0
+		data = data[cut:]
+	}
+	stop := -1
+	if enc.next != nil && !enc.next.cut {
+		stop = enc.next.stop
+	}
+	if cut := enc.tracker.split(data, stop); cut >= 0 {
+		// The remaining frames are replaced by the output of the new configuration
+		enc.next.cut = true
+		data = data[:cut]
+	}
+	return copy(out, data)
 }
 
 // Flush flushes the internal encoder buffer to get remaining MP3 data.
@@ -172,98 +341,353 @@ func (enc *Encoder) Encode(in, out []byte) (n int, err error) {
 // out: output buffer for remaining MP3 data
 // Returns: number of MP3 bytes written to out buffer
 func (enc *Encoder) Flush(out []byte) (n int, err error) {
+	return enc.flush(out, false)
+}
+
+func (enc *Encoder) flush(out []byte, nogap bool) (n int, err error) {
+	defer func() { enc.reportMetrics(0, n, err) }()
 	szOut := len(out)
-	if szOut < enc.EstimateOutBufBytes(0) {
-		return 0, errors.New("output buffer is too small")
+	if required := enc.EstimateOutBufBytes(0); szOut < required {
+		return 0, &ShortBufferError{Size: szOut, Required: required}
 	}
 
-	outPtr := (*C.uchar)(unsafe.Pointer(&out[0]))
-	bytesOut := C.lame_encode_flush(enc.handle, outPtr, C.int(szOut))
-	if bytesOut < 0 {
-		return 0, toError(bytesOut)
+	// Encode samples held back by batching, incomplete sample frames are dropped
+	bytesPerSample := enc.NumChannels * enc.remainFmt.size()
+	pending := len(enc.remainData) - len(enc.remainData)%bytesPerSample
+	if pending > 0 {
+		n, err = enc.encodeSamples(enc.remainData[:pending], out, enc.remainFmt)
+		if err != nil {
+			return 0, err
+		}
 	}
+	enc.remainData = enc.remainData[:0]
 
-	return int(bytesOut), nil
+	var bytesOut int
+	if enc.next != nil {
+		bytesOut, err = enc.flushSwitching(out[n:])
+	} else {
+		bytesOut, err = enc.lameFlushMode(out[n:], nogap)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n += bytesOut
+	enc.frameLog.scan(out[:n])
+	enc.vbri.scan(out[:n])
+	if err = enc.quota.addOutput(n); err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
+// GetFrameNum returns the number of frames encoded so far. LAME counts frames in a C int,
+// which lasts for more than a year of audio; use TotalSamples for sample exact positions.
 func (enc *Encoder) GetFrameNum() (int, error) {
 	frameNum := C.lame_get_frameNum(enc.handle)
+	runtime.KeepAlive(enc)
 	if frameNum < 0 {
-		return 0, toError(frameNum)
+		return 0, toError("get frame number", frameNum)
 	}
-	return int(frameNum), nil
+	return enc.frameOffset + int(frameNum), nil
+}
+
+// TotalSamples returns the number of samples per channel passed to the encoder so far.
+func (enc *Encoder) TotalSamples() int64 {
+	return enc.totalSamples
+}
+
+// SetTotalSamples tells LAME the length of the input in samples per channel, when it is
+// known up front, e.g. from a WAV header. LAME then knows the stream length in advance for
+// its Xing header and seek table and reports it in EstimatedTotalFrames. Call it before Encode.
+func (enc *Encoder) SetTotalSamples(n uint64) error {
+	if enc.handle == nil {
+		return fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	errNo := C.lame_set_num_samples(enc.handle, C.ulong(n))
+	runtime.KeepAlive(enc)
+	if errNo < 0 {
+		return toError("set num samples", errNo)
+	}
+	return nil
+}
+
+// EstimatedTotalFrames returns the number of frames LAME expects to encode for the length
+// set with SetTotalSamples, or 0 if it is not set.
+func (enc *Encoder) EstimatedTotalFrames() int {
+	if C.lame_get_num_samples(enc.handle) == C.ulong(^uint32(0)) {
+		return 0
+	}
+	frames := C.lame_get_totalframes(enc.handle)
+	runtime.KeepAlive(enc)
+	return int(frames)
+}
+
+func (enc *Encoder) inSampleRate() int {
+	return enc.inRate
+}
+
+// OutSampleRate returns the sample rate of the encoded stream as reported by
+// lame_get_out_samplerate. LAME resamples the input if the bitrate is too low for its rate.
+func (enc *Encoder) OutSampleRate() int {
+	return enc.outRate
+}
+
+// FrameDuration returns the play time of one encoded frame.
+func (enc *Encoder) FrameDuration() time.Duration {
+	return frameDuration(enc.FrameLength, enc.outRate)
+}
+
+// MaxFrameBytes returns the size of the largest frame the encoder can output, for sizing
+// buffers in whole frames. CBR frames have this size or one byte less.
+func (enc *Encoder) MaxFrameBytes() int {
+	return enc.frameBytes
+}
+
+// Delay returns the encoder delay: the samples per channel of silence LAME adds in front
+// of the audio, which a gapless player skips. Decoders add another 529 samples of their own.
+func (enc *Encoder) Delay() int {
+	delay := C.lame_get_encoder_delay(enc.handle)
+	runtime.KeepAlive(enc)
+	return int(delay)
+}
+
+// Padding returns the samples per channel LAME appends after the audio to fill the last
+// frame, which a gapless player trims. It is 0 until Flush was called.
+func (enc *Encoder) Padding() int {
+	if enc.reconfigured {
+		// The handles have their own padding, compute it for the spliced stream as in the tag
+		frames, err := enc.GetFrameNum()
+		if err != nil || frames == 0 {
+			return 0
+		}
+		padding := int64(frames)*int64(enc.FrameLength) - int64(enc.Delay()) - enc.totalSamples
+		return int(max(padding, 0))
+	}
+	padding := C.lame_get_encoder_padding(enc.handle)
+	runtime.KeepAlive(enc)
+	return int(padding)
 }
 
 // GetLameTagFrame gets the Xing/LAME VBR/Info tag frame.
 // This should be called after Flush() to get the complete tag with final statistics.
 // The tag frame should replace the placeholder frame at the beginning of the MP3 stream.
 // Returns the tag frame data, or nil if VBR tagging is disabled.
+// With TagVBRI the frame holds a VBRI header instead, its seek table is left out after
+// Reconfigure or ResumeEncoder.
 func (enc *Encoder) GetLameTagFrame() ([]byte, error) {
+	tag, err := enc.xingTagFrame()
+	if err != nil || enc.vbri == nil || len(tag) < FrameHeaderSize {
+		return tag, err
+	}
+	frames, err := enc.GetFrameNum()
+	if err != nil {
+		return nil, err
+	}
+	delay := int(C.lame_get_encoder_delay(enc.handle))
+	runtime.KeepAlive(enc)
+	return buildVBRIFrame(tag, frames, enc.streamBytes()-enc.trackStart, delay, 100-10*enc.quality, enc.vbri), nil
+}
+
+func (enc *Encoder) xingTagFrame() ([]byte, error) {
+	if enc.reconfigured {
+		if enc.lameTag == nil && enc.infoFrames > 0 {
+			// Resumed encoder, its own tag carries the LAME extension
+			tag, err := enc.lameTagFrame()
+			if err != nil {
+				return nil, err
+			}
+			enc.lameTag = tag
+		}
+		return enc.switchedInfoFrame()
+	}
+	return enc.lameTagFrame()
+}
+
+func (enc *Encoder) lameTagFrame() ([]byte, error) {
 	maxTagSize := C.size_t(32768)
 	tagBuf := make([]byte, maxTagSize)
 	n := C.lame_get_lametag_frame(enc.handle, (*C.uchar)(unsafe.Pointer(&tagBuf[0])), maxTagSize)
+	runtime.KeepAlive(enc)
 	if n > maxTagSize {
 		return nil, errors.New("lametag buffer too small")
 	}
 	return tagBuf[:n], nil
 }
 
+// ReplayGain returns the track gain in dB and the peak sample (1.0 = full scale)
+// computed by LAME. It requires FindReplayGain and should be called after Flush.
+func (enc *Encoder) ReplayGain() (gainDB float64, peak float64, err error) {
+	if !enc.findPeak {
+		return 0, 0, errors.New("replay gain analysis not enabled")
+	}
+	// RadioGain is stored in units of 0.1 dB
+	gainDB = float64(C.lame_get_RadioGain(enc.handle)) / 10
+	runtime.KeepAlive(enc)
+	peak = float64(enc.peakSample) / (1 << 31)
+	return gainDB, peak, nil
+}
+
+// replayGainEnabled reports whether the encoder runs ReplayGain analysis.
+func (enc *Encoder) replayGainEnabled() bool {
+	return enc.findPeak
+}
+
+// BitrateHistogram returns the number of frames encoded at each bitrate of the stream's
+// MPEG version, in ascending order, including bitrates without frames. The Xing/Info
+// frame is not counted. Call it after Flush for the complete stream; after Reconfigure,
+// ResumeEncoder or NextTrack only the frames since then are counted.
+func (enc *Encoder) BitrateHistogram() ([]BitrateCount, error) {
+	if enc.handle == nil {
+		return nil, fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	var counts, kbps [14]C.int
+	C.lame_bitrate_hist(enc.handle, &counts[0])
+	C.lame_bitrate_kbps(enc.handle, &kbps[0])
+	runtime.KeepAlive(enc)
+	hist := make([]BitrateCount, len(counts))
+	for i := range counts {
+		hist[i] = BitrateCount{Kbps: int(kbps[i]), Frames: int(counts[i])}
+	}
+	return hist, nil
+}
+
+// StereoModeHistogram returns the number of frames encoded in each stereo mode, e.g. to
+// see how often joint stereo used mid/side coding. Frames are counted as in BitrateHistogram.
+func (enc *Encoder) StereoModeHistogram() (StereoModeCounts, error) {
+	if enc.handle == nil {
+		return StereoModeCounts{}, fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	var counts [4]C.int
+	C.lame_stereo_mode_hist(enc.handle, &counts[0])
+	runtime.KeepAlive(enc)
+	return StereoModeCounts{
+		LeftRight:          int(counts[0]),
+		LeftRightIntensity: int(counts[1]),
+		MidSide:            int(counts[2]),
+		MidSideIntensity:   int(counts[3]),
+	}, nil
+}
+
+func (enc *Encoder) trackPeak(in []byte, format pcmFormat) {
+	size := format.size()
+	for i := 0; i+size <= len(in); i += size {
+		v := int64(format.sample(in[i:]))
+		if v < 0 {
+			v = -v
+		}
+		if v > enc.peakSample {
+			enc.peakSample = v
+		}
+	}
+}
+
+// EstimateOutBufBytes returns the output buffer size needed to encode inBytes of PCM data.
+// The bound is derived from the configured bitrate (the highest bitrate for VBR/ABR, or
+// VbrMaxBitrate), output sample rate and frame length, and never exceeds the worst case
+// estimate from lame.h.
 func (enc *Encoder) EstimateOutBufBytes(inBytes int) int {
-	//
-	// From lame.h:
-	// The required mp3buf_size can be computed from num_samples,
-	// samplerate and encoding rate, but here is a worst case estimate:
-	//
-	// mp3buf_size in bytes = 1.25*num_samples + 7200
-	//
-	numSamples := inBytes/(enc.NumChannels*SampleBitDepth/8) + 1
-	return int(1.25*float64(numSamples)) + 7200
-}
-
-func (enc *Encoder) initParams(c *EncoderConfig) error {
+	numSamples := inBytes / (enc.NumChannels * SampleBitDepth / 8)
+	// Samples held back by batching may be encoded together with the new input
+	numSamples += enc.minSamples
+	n := estimateEncodedBytes(numSamples, enc.FrameLength, enc.inRate, enc.outRate, enc.frameBytes)
+	if enc.next != nil {
+		// Output of the new configuration held back until the switch completes
+		n += enc.next.enc.EstimateOutBufBytes(inBytes) + len(enc.next.pending)
+	}
+	return n
+}
+
+// setParams passes the config to LAME, lame_init_params is called by applyParams.
+func (enc *Encoder) setParams(c *EncoderConfig) error {
 	handle := enc.handle
 	errNo := C.lame_set_in_samplerate(handle, C.int(c.SampleRate))
 	if errNo < 0 {
-		return toError(errNo)
+		return toError("set params", errNo)
 	}
 	errNo = C.lame_set_num_channels(handle, C.int(c.NumChannels))
 	if errNo < 0 {
-		return toError(errNo)
+		return toError("set params", errNo)
 	}
-	if c.VbrMode != VbrModeOff {
+	if c.Preset != PresetNone {
+		errNo = C.lame_set_preset(handle, C.int(c.Preset))
+		if errNo < 0 {
+			return toError("set params", errNo)
+		}
+	} else if c.VbrMode != VbrModeOff {
 		errNo = C.lame_set_VBR(handle, C.vbr_mode(c.VbrMode))
 		if errNo < 0 {
-			return toError(errNo)
+			return toError("set params", errNo)
+		}
+		if c.VbrQuality > 0 {
+			errNo = C.lame_set_VBR_quality(handle, C.float(c.VbrQuality))
+			if errNo >= 0 {
+				errNo = C.lame_set_quality(handle, C.int(c.Quality))
+			}
+		} else {
+			errNo = C.lame_set_VBR_quality(handle, C.float(c.Quality))
 		}
-		errNo = C.lame_set_VBR_quality(handle, C.float(c.Quality))
 		if errNo < 0 {
-			return toError(errNo)
+			return toError("set params", errNo)
 		}
 		if c.VbrMode == VbrModeAbr {
-			errNo = C.lame_set_VBR_mean_bitrate_kbps(handle, C.int(c.Bitrate))
+			mean := c.AbrMeanBitrate
+			if mean == 0 {
+				mean = c.bitrate()
+			}
+			errNo = C.lame_set_VBR_mean_bitrate_kbps(handle, C.int(mean))
+			if errNo < 0 {
+				return toError("set params", errNo)
+			}
+		}
+		if c.VbrMinBitrate > 0 {
+			errNo = C.lame_set_VBR_min_bitrate_kbps(handle, C.int(c.VbrMinBitrate))
+			if errNo < 0 {
+				return toError("set params", errNo)
+			}
+		}
+		if c.VbrMaxBitrate > 0 {
+			errNo = C.lame_set_VBR_max_bitrate_kbps(handle, C.int(c.VbrMaxBitrate))
+			if errNo < 0 {
+				return toError("set params", errNo)
+			}
+		}
+		if c.VbrHardMin {
+			errNo = C.lame_set_VBR_hard_min(handle, 1)
 			if errNo < 0 {
-				return toError(errNo)
+				return toError("set params", errNo)
 			}
 		}
 	} else {
 		errNo = C.lame_set_VBR(handle, C.vbr_mode(VbrModeOff))
 		if errNo < 0 {
-			return toError(errNo)
+			return toError("set params", errNo)
 		}
-		errNo = C.lame_set_brate(handle, C.int(c.Bitrate))
+		errNo = C.lame_set_brate(handle, C.int(c.bitrate()))
 		if errNo < 0 {
-			return toError(errNo)
+			return toError("set params", errNo)
 		}
 		errNo = C.lame_set_quality(handle, C.int(c.Quality))
 		if errNo < 0 {
-			return toError(errNo)
+			return toError("set params", errNo)
+		}
+	}
+	if c.Lowpass != 0 {
+		errNo = C.lame_set_lowpassfreq(handle, C.int(c.Lowpass))
+		if errNo < 0 {
+			return toError("set params", errNo)
+		}
+	}
+	if c.DisableReservoir {
+		errNo = C.lame_set_disable_reservoir(handle, 1)
+		if errNo < 0 {
+			return toError("set params", errNo)
 		}
 	}
 	if c.MpegMode > 0 {
 		// MpegMode constants are offset by +1 to avoid conflict with C enum values
 		errNo = C.lame_set_mode(handle, C.MPEG_mode(c.MpegMode-1))
 		if errNo < 0 {
-			return toError(errNo)
+			return toError("set params", errNo)
 		}
 	}
 
@@ -273,55 +697,99 @@ func (enc *Encoder) initParams(c *EncoderConfig) error {
 	}
 	errNo = C.lame_set_bWriteVbrTag(handle, nTemp)
 	if errNo < 0 {
-		return toError(errNo)
+		return toError("set params", errNo)
 	}
 
-	errNo = C.lame_init_params(handle)
+	// Frame header flags, LAME marks streams as original by default
+	cBool := func(b bool) C.int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	errNo = C.lame_set_error_protection(handle, cBool(c.ErrorProtection))
+	if errNo < 0 {
+		return toError("set params", errNo)
+	}
+	errNo = C.lame_set_copyright(handle, cBool(c.Copyright))
+	if errNo < 0 {
+		return toError("set params", errNo)
+	}
+	errNo = C.lame_set_original(handle, cBool(!c.Copy))
+	if errNo < 0 {
+		return toError("set params", errNo)
+	}
+	errNo = C.lame_set_extension(handle, cBool(c.Private))
 	if errNo < 0 {
-		return toError(errNo)
+		return toError("set params", errNo)
+	}
+
+	if c.FindReplayGain {
+		errNo = C.lame_set_findReplayGain(handle, 1)
+		if errNo < 0 {
+			return toError("set params", errNo)
+		}
+	}
+
+	return nil
+}
+
+// applyParams initializes the LAME parameters and reads back the resulting settings.
+func (enc *Encoder) applyParams(c *EncoderConfig) error {
+	handle := enc.handle
+	errNo := C.lame_init_params(handle)
+	if errNo < 0 {
+		return toError("init params", errNo)
 	}
 
 	frameSize := C.lame_get_framesize(handle)
 	if frameSize < 0 {
-		return toError(frameSize)
+		return toError("get frame size", frameSize)
 	}
 	enc.FrameLength = int(frameSize)
+	enc.inRate = c.SampleRate
+	enc.outRate = int(C.lame_get_out_samplerate(handle))
+	kbps := vbrMaxBitrate(enc.outRate, int(C.lame_get_VBR_max_bitrate_kbps(handle)))
+	if C.lame_get_VBR(handle) == C.vbr_off {
+		kbps = int(C.lame_get_brate(handle))
+	}
+	enc.frameBytes = maxFrameBytes(enc.FrameLength, enc.outRate, kbps)
+	enc.infoFrames = 0
+	if C.lame_get_bWriteVbrTag(handle) != 0 {
+		enc.infoFrames = 1
+	}
+	enc.vbri = nil
+	if c.TagFormat == TagVBRI && enc.infoFrames > 0 {
+		enc.vbri = newVBRITable(enc.infoFrames)
+	}
+	enc.quality = c.Quality
+	enc.tags = c.Tags
+	enc.id3v1 = c.WriteID3v1
 	enc.NumChannels = c.NumChannels
+	enc.findPeak = c.FindReplayGain
+	enc.minSamples = max(c.MinEncodeSamples, 0)
 
 	return nil
 }
 
-func toError(errNo C.int) error {
+// toError converts a LAME error code.
+func toError(op string, errNo C.int) error {
+	var err error
 	switch errNo {
 	case -1:
-		return ErrorBufferTooSmall
+		// The encoding functions return -1 for a short buffer, the others for any failure
+		err = ErrorUnknown
+		if op == "encode" || op == "flush" {
+			err = ErrorBufferTooSmall
+		}
 	case -2:
-		return ErrorMalloc
+		err = ErrorMalloc
 	case -3:
-		return ErrorParamsNotInitialized
+		err = ErrorParamsNotInitialized
 	case -4:
-		return ErrorPsychoAcousticProblems
+		err = ErrorPsychoAcousticProblems
 	default:
-		return ErrorUnknown
-	}
-}
-
-func populateEncConfig(c *EncoderConfig) *EncoderConfig {
-	if c == nil {
-		c = &EncoderConfig{}
+		err = ErrorUnknown
 	}
-	if c.NumChannels == 0 {
-		c.NumChannels = 2
-	}
-	if c.SampleRate == 0 {
-		c.SampleRate = 44100
-	}
-	if c.Bitrate == 0 {
-		c.Bitrate = 128
-	}
-	if c.Quality < 0 || c.Quality > 9 {
-		c.Quality = 2
-	}
-
-	return c
+	return &Error{Library: LibraryLame, Code: int(errNo), Op: op, Err: err}
 }
@@ -0,0 +1,74 @@
+//go:build cgo && !purego
+
+package mp3
+
+/*
+#ifdef MP3_SYSTEM_LIBS
+#include <lame/lame.h>
+#else
+#include "deps/include/lame.h"
+#endif
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+)
+
+var errNoGapReconfigured = errors.New("gapless encoding not supported after Reconfigure or ResumeEncoder")
+
+// SetNoGapTotal sets the number of tracks of a gapless encoding, stored by LAME
+// together with the current track index. It is optional and only informational.
+func (enc *Encoder) SetNoGapTotal(total int) error {
+	if total < 0 {
+		return errors.New("negative track count")
+	}
+	errNo := C.lame_set_nogap_total(enc.handle, C.int(total))
+	runtime.KeepAlive(enc)
+	if errNo < 0 {
+		return toError("set nogap total", errNo)
+	}
+	return nil
+}
+
+// FlushNoGap ends the current track like Flush, but pads its last frame instead of
+// flushing the encoder delay as silence, so the next track continues without a gap when
+// the outputs are played back to back. Afterwards GetFrameNum and GetLameTagFrame describe
+// the finished track; call NextTrack before encoding the next one.
+func (enc *Encoder) FlushNoGap(out []byte) (int, error) {
+	if enc.reconfigured || enc.next != nil {
+		return 0, errNoGapReconfigured
+	}
+	n, err := enc.flush(out, true)
+	if err != nil {
+		return 0, err
+	}
+	enc.trackDone = true
+	return n, nil
+}
+
+// NextTrack starts the next track after FlushNoGap: LAME begins a new bitstream, with a
+// Xing/LAME placeholder frame if the encoder writes one, and counts frames from zero.
+func (enc *Encoder) NextTrack() error {
+	if !enc.trackDone {
+		return errors.New("FlushNoGap must be called before NextTrack")
+	}
+	errNo := C.lame_set_nogap_currentindex(enc.handle, C.int(enc.trackIndex+1))
+	if errNo >= 0 {
+		errNo = C.lame_init_bitstream(enc.handle)
+	}
+	runtime.KeepAlive(enc)
+	if errNo < 0 {
+		return toError("init bitstream", errNo)
+	}
+
+	enc.trackIndex++
+	enc.trackDone = false
+	enc.trackStart = enc.streamBytes()
+	enc.tracker = frameTracker{}
+	if enc.vbri != nil {
+		enc.vbri = newVBRITable(enc.infoFrames)
+	}
+	return nil
+}
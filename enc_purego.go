@@ -0,0 +1,311 @@
+//go:build !cgo || purego
+
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Encoder is an MP3 encoder instance backed by a registered EncoderBackend.
+// It encodes PCM audio data to MP3 format.
+// Note: Encoder is NOT safe for concurrent use; see SyncEncoder. Close calls may run
+// concurrently with each other, but never with other methods.
+type Encoder struct {
+	backend     EncoderBackend
+	cleanup     runtime.Cleanup // Closes backend if the Encoder is garbage collected without Close
+	closeOnce   sync.Once
+	quota       quota
+	meter       meter
+	remainData  []byte // Buffer for incomplete sample frames
+	planarBuf   []byte // interleaved input of EncodePlanar
+	sampleRate  int
+	frameBytes  int // Size of the largest frame with this config
+	frameLog    *frameLog
+	tags        *TrackTags // written by EncodeAll
+	id3v1       bool
+	output      io.Writer // written by ReadFrom
+	NumChannels int
+	FrameLength int
+
+	totalSamples int64 // samples per channel passed to the backend
+}
+
+// NewEncoder creates a new MP3 encoder using the backend registered with RegisterEncoderBackend,
+// or the built-in Go encoder if none is registered.
+// If config is nil or has zero values, defaults will be used. A config that fails
+// EncoderConfig.Validate is rejected.
+func NewEncoder(c *EncoderConfig) (*Encoder, error) {
+	c = populateEncConfig(c)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	backend, err := newEncoderBackend(c)
+	if err != nil {
+		return nil, err
+	}
+	enc := &Encoder{
+		backend:     backend,
+		NumChannels: c.NumChannels,
+		FrameLength: backend.FrameLength(),
+		sampleRate:  c.SampleRate,
+		tags:        c.Tags,
+		id3v1:       c.WriteID3v1,
+	}
+	kbps := vbrMaxBitrate(c.SampleRate, c.VbrMaxBitrate)
+	if c.VbrMode == VbrModeOff {
+		kbps = c.bitrate()
+	}
+	enc.frameBytes = maxFrameBytes(enc.FrameLength, c.SampleRate, kbps)
+	if err := acquireHandle(&openEncoders); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	enc.cleanup = runtime.AddCleanup(enc, closeEncoderBackend, backend)
+	return enc, nil
+}
+
+// Reset prepares the encoder for a new stream with the configuration c (nil or zero values
+// use the defaults as in NewEncoder). Unflushed data of the current stream is discarded.
+// A new backend encoder is created, the frame logger is kept. On error the encoder is unchanged.
+func (enc *Encoder) Reset(c *EncoderConfig) error {
+	if enc.backend == nil {
+		return fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	c = populateEncConfig(c)
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	backend, err := newEncoderBackend(c)
+	if err != nil {
+		return err
+	}
+
+	enc.cleanup.Stop()
+	enc.backend.Close()
+	enc.backend = backend
+	enc.cleanup = runtime.AddCleanup(enc, closeEncoderBackend, backend)
+	enc.NumChannels = c.NumChannels
+	enc.FrameLength = backend.FrameLength()
+	enc.sampleRate = c.SampleRate
+	enc.tags = c.Tags
+	enc.id3v1 = c.WriteID3v1
+	kbps := vbrMaxBitrate(c.SampleRate, c.VbrMaxBitrate)
+	if c.VbrMode == VbrModeOff {
+		kbps = c.bitrate()
+	}
+	enc.frameBytes = maxFrameBytes(enc.FrameLength, c.SampleRate, kbps)
+
+	enc.remainData = enc.remainData[:0]
+	enc.quota = quota{}
+	enc.meter = meter{}
+	enc.totalSamples = 0
+	if enc.frameLog != nil {
+		enc.frameLog = newFrameLog(enc.frameLog.fn)
+	}
+	return nil
+}
+
+// Close releases the backend. It is safe to call Close more than once, also from several
+// goroutines at once, but not while another method is running.
+func (enc *Encoder) Close() {
+	enc.closeOnce.Do(func() {
+		if enc.backend != nil {
+			enc.cleanup.Stop()
+			closeEncoderBackend(enc.backend)
+			enc.backend = nil
+		}
+	})
+}
+
+func closeEncoderBackend(backend EncoderBackend) {
+	backend.Close()
+	releaseHandle(&openEncoders)
+}
+
+// Encode encodes PCM audio data to MP3 format.
+// in: input PCM buffer (16-bit signed samples)
+// out: output buffer for MP3 data (should be at least EstimateOutBufBytes(len(in)))
+// Returns: number of MP3 bytes written to out buffer
+func (enc *Encoder) Encode(in, out []byte) (n int, err error) {
+	inLen := len(in)
+	defer func() { enc.reportMetrics(inLen, n, err) }()
+	if len(in) == 0 {
+		return 0, ErrorEmptyInput
+	}
+	offset := enc.quota.inBytes
+	if err = enc.quota.checkInput(len(in)); err != nil {
+		return 0, err
+	}
+	if required := enc.EstimateOutBufBytes(len(in)); len(out) < required {
+		return 0, &ShortBufferError{Size: len(out), Required: required}
+	}
+
+	if len(enc.remainData) > 0 {
+		enc.remainData = append(enc.remainData, in...)
+		in = enc.remainData
+	}
+
+	bytesPerSample := enc.NumChannels * SampleBitDepth / 8
+	szIn := len(in) - len(in)%bytesPerSample
+	if szIn > 0 {
+		n, err = enc.backend.Encode(in[:szIn], out)
+		enc.totalSamples += int64(szIn / bytesPerSample)
+	}
+	enc.remainData = append(enc.remainData[:0], in[szIn:]...)
+	if err != nil {
+		return 0, withOffset(err, offset)
+	}
+	enc.frameLog.scan(out[:n])
+	if err = enc.quota.addOutput(n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// encode encodes samples of format, the backend only takes 16-bit samples.
+func (enc *Encoder) encode(in, out []byte, format pcmFormat) (n int, err error) {
+	if format != pcmS16 {
+		in = pcmToS16(in, format)
+	}
+	return enc.Encode(in, out)
+}
+
+// Flush flushes the internal encoder buffer to get remaining MP3 data.
+func (enc *Encoder) Flush(out []byte) (n int, err error) {
+	defer func() { enc.reportMetrics(0, n, err) }()
+	if required := enc.EstimateOutBufBytes(0); len(out) < required {
+		return 0, &ShortBufferError{Size: len(out), Required: required}
+	}
+	enc.remainData = enc.remainData[:0]
+	n, err = enc.backend.Flush(out)
+	if err != nil {
+		return 0, err
+	}
+	enc.frameLog.scan(out[:n])
+	if err = enc.quota.addOutput(n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// GetFrameNum returns the number of frames encoded so far.
+func (enc *Encoder) GetFrameNum() (int, error) {
+	return enc.backend.FrameNum(), nil
+}
+
+// TotalSamples returns the number of samples per channel passed to the encoder so far.
+func (enc *Encoder) TotalSamples() int64 {
+	return enc.totalSamples
+}
+
+func (enc *Encoder) inSampleRate() int {
+	return enc.sampleRate
+}
+
+// OutSampleRate returns the sample rate of the encoded stream, backends do not resample.
+func (enc *Encoder) OutSampleRate() int {
+	return enc.sampleRate
+}
+
+// FrameDuration returns the play time of one encoded frame.
+func (enc *Encoder) FrameDuration() time.Duration {
+	return frameDuration(enc.FrameLength, enc.sampleRate)
+}
+
+// MaxFrameBytes returns the size of the largest frame with the configured bitrate.
+func (enc *Encoder) MaxFrameBytes() int {
+	return enc.frameBytes
+}
+
+// Delay returns 0, encoder backends do not report their delay.
+func (enc *Encoder) Delay() int {
+	return 0
+}
+
+// Padding returns 0, encoder backends do not report their padding.
+func (enc *Encoder) Padding() int {
+	return 0
+}
+
+// SetTotalSamples does nothing, encoder backends do not use the input length.
+func (enc *Encoder) SetTotalSamples(n uint64) error {
+	return nil
+}
+
+// EstimatedTotalFrames returns 0, encoder backends do not estimate the frame count.
+func (enc *Encoder) EstimatedTotalFrames() int {
+	return 0
+}
+
+// GetLameTagFrame returns nil, the Xing/LAME tag is only written by LAME.
+func (enc *Encoder) GetLameTagFrame() ([]byte, error) {
+	return nil, nil
+}
+
+// ReplayGain is only supported by LAME.
+func (enc *Encoder) ReplayGain() (gainDB float64, peak float64, err error) {
+	return 0, 0, errors.New("replay gain analysis not supported by encoder backend")
+}
+
+// replayGainEnabled is false, ReplayGain analysis is only supported by LAME.
+func (enc *Encoder) replayGainEnabled() bool {
+	return false
+}
+
+// BitrateHistogram is only supported by LAME.
+func (enc *Encoder) BitrateHistogram() ([]BitrateCount, error) {
+	return nil, errors.New("bitrate histogram not supported by encoder backend")
+}
+
+// StereoModeHistogram is only supported by LAME.
+func (enc *Encoder) StereoModeHistogram() (StereoModeCounts, error) {
+	return StereoModeCounts{}, errors.New("stereo mode histogram not supported by encoder backend")
+}
+
+// Reconfigure is only supported by LAME.
+func (enc *Encoder) Reconfigure(c *EncoderConfig) error {
+	return errors.New("reconfigure not supported by encoder backend")
+}
+
+// SetNoGapTotal is only supported by LAME.
+func (enc *Encoder) SetNoGapTotal(total int) error {
+	return errors.New("gapless encoding not supported by encoder backend")
+}
+
+// FlushNoGap is only supported by LAME.
+func (enc *Encoder) FlushNoGap(out []byte) (int, error) {
+	return 0, errors.New("gapless encoding not supported by encoder backend")
+}
+
+// NextTrack is only supported by LAME.
+func (enc *Encoder) NextTrack() error {
+	return errors.New("gapless encoding not supported by encoder backend")
+}
+
+// Checkpoint is only supported by LAME.
+func (enc *Encoder) Checkpoint() (*EncoderCheckpoint, error) {
+	return nil, errors.New("checkpoint not supported by encoder backend")
+}
+
+// ResumeEncoder is only supported by LAME.
+func ResumeEncoder(c *EncoderConfig, cp *EncoderCheckpoint) (*Encoder, error) {
+	return nil, errors.New("resume not supported by encoder backend")
+}
+
+// streamBytes returns the size of the stream output so far.
+func (enc *Encoder) streamBytes() int64 {
+	return enc.quota.outBytes
+}
+
+// EstimateOutBufBytes returns the output buffer size needed to encode inBytes of PCM data.
+// The bound is derived from the configured bitrate (the highest bitrate for VBR/ABR, or
+// VbrMaxBitrate), and never exceeds the worst case estimate from lame.h.
+func (enc *Encoder) EstimateOutBufBytes(inBytes int) int {
+	numSamples := inBytes / (enc.NumChannels * SampleBitDepth / 8)
+	return estimateEncodedBytes(numSamples, enc.FrameLength, enc.sampleRate, enc.sampleRate, enc.frameBytes)
+}
@@ -0,0 +1,109 @@
+//go:build !cgo || purego
+
+package mp3_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// fakeEncoderBackend writes one byte per encoded sample frame
+type fakeEncoderBackend struct {
+	channels int
+	samples  int
+	err      error // returned by Encode if set
+}
+
+func (b *fakeEncoderBackend) Encode(in, out []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n := len(in) / (2 * b.channels)
+	b.samples += n
+	return copy(out, make([]byte, n)), nil
+}
+
+func (b *fakeEncoderBackend) Flush(out []byte) (int, error) { return 0, nil }
+func (b *fakeEncoderBackend) FrameNum() int                 { return b.samples / 1152 }
+func (b *fakeEncoderBackend) FrameLength() int              { return 1152 }
+func (b *fakeEncoderBackend) Close()                        {}
+
+// TestEncoderBackend tests the cgo-free encoder integration point
+func TestEncoderBackend(t *testing.T) {
+	if mp3.ActiveBackend() != mp3.BackendGo {
+		t.Fatalf("Active backend: got %s, want %s", mp3.ActiveBackend(), mp3.BackendGo)
+	}
+
+	mp3.RegisterEncoderBackend(func(c *mp3.EncoderConfig) (mp3.EncoderBackend, error) {
+		return &fakeEncoderBackend{channels: c.NumChannels}, nil
+	})
+	defer mp3.RegisterEncoderBackend(nil)
+
+	var out bytes.Buffer
+	result, err := mp3.EncodeFromWav(
+		bytes.NewReader(generateWavFile(44100, 2, 1152*4)), &out, &mp3.EncoderConfig{}, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	if result.TotalBytes != 1152*4 || result.Frames != 4 || result.SampleRate != 44100 {
+		t.Errorf("Unexpected result: %d bytes, %d Hz", result.TotalBytes, result.SampleRate)
+	}
+	t.Logf("✓ Backend encoded %d bytes, %d frames", result.TotalBytes, result.Frames)
+}
+
+// TestEncoderBackendErrorOffset tests that backend errors carry the input offset
+func TestEncoderBackendErrorOffset(t *testing.T) {
+	backend := &fakeEncoderBackend{}
+	mp3.RegisterEncoderBackend(func(c *mp3.EncoderConfig) (mp3.EncoderBackend, error) {
+		backend.channels = c.NumChannels
+		return backend, nil
+	})
+	defer mp3.RegisterEncoderBackend(nil)
+
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	in := make([]byte, 1152*4)
+	out := make([]byte, encoder.EstimateOutBufBytes(len(in)))
+	if _, err := encoder.Encode(in, out); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	backend.err = &mp3.Error{Library: "fake", Code: 1, Op: "encode"}
+	_, err = encoder.Encode(in, out)
+	var e *mp3.Error
+	if !errors.As(err, &e) || e.Offset != int64(len(in)) {
+		t.Errorf("Encode error = %v, want an *Error at offset %d", err, len(in))
+	}
+}
+
+// TestBuiltinEncoderBackend tests that NewEncoder uses the Go encoder without a registered backend
+func TestBuiltinEncoderBackend(t *testing.T) {
+	var out bytes.Buffer
+	result, err := mp3.EncodeFromWav(
+		bytes.NewReader(generateWavFile(44100, 2, 44100)), &out, &mp3.EncoderConfig{Bitrate: 96}, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	data := out.Bytes()
+	frames := 0
+	for pos := 0; pos < len(data); frames++ {
+		h, err := mp3.ParseFrameHeader(data[pos:])
+		if err != nil {
+			t.Fatalf("Frame %d at %d: %v", frames, pos, err)
+		}
+		if h.Bitrate != 96 || h.SampleRate != 44100 {
+			t.Fatalf("Unexpected frame header %+v", h)
+		}
+		pos += h.Size
+	}
+	if frames != result.Frames || frames < 44100/1152 {
+		t.Errorf("Frame count mismatch: got %d, result %d", frames, result.Frames)
+	}
+	t.Logf("✓ Built-in encoder: %d bytes, %d frames", result.TotalBytes, result.Frames)
+}
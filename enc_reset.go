@@ -0,0 +1,77 @@
+//go:build cgo && !purego
+
+package mp3
+
+/*
+#ifdef MP3_SYSTEM_LIBS
+#include <lame/lame.h>
+#else
+#include "deps/include/lame.h"
+#endif
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Reset prepares the encoder for a new stream, e.g. the next of many short clips, with the
+// configuration c (nil or zero values use the defaults as in NewEncoder). Unflushed data of
+// the current stream is discarded. LAME can not restart a handle, so a new one is set up,
+// but the frame logger is kept. On error the encoder is unchanged.
+func (enc *Encoder) Reset(c *EncoderConfig) error {
+	if enc.handle == nil {
+		return fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	c = populateEncConfig(c)
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	h := C.lame_init()
+	if h == nil {
+		return &Error{Library: LibraryLame, Op: "init", Err: ErrorMalloc}
+	}
+
+	// setParams and applyParams only change the encoder once LAME accepted the parameters
+	old := enc.handle
+	enc.handle = h
+	err := enc.setParams(c)
+	if err == nil {
+		err = enc.applyParams(c)
+	}
+	if err != nil {
+		enc.handle = old
+		C.lame_close(h)
+		return err
+	}
+
+	enc.cleanup.Stop()
+	C.lame_close(old)
+	enc.cleanup = runtime.AddCleanup(enc, closeLame, enc.handle)
+	if enc.next != nil {
+		enc.next.enc.Close()
+		enc.next = nil
+	}
+
+	enc.remainData = enc.remainData[:0]
+	enc.remainFmt = pcmS16
+	enc.peakSample = 0
+	enc.quota = quota{}
+	enc.meter = meter{}
+	enc.tracker = frameTracker{}
+	enc.dropFrames = 0
+	enc.handleSamples = 0
+	enc.frameOffset = 0
+	enc.reconfigured = false
+	enc.lameTag = nil
+	enc.totalSamples = 0
+	enc.resumeBytes = 0
+	enc.trackStart = 0
+	enc.trackIndex = 0
+	enc.trackDone = false
+	if enc.frameLog != nil {
+		enc.frameLog = newFrameLog(enc.frameLog.fn)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+//go:build cgo && !purego
+
+package mp3
+
+/*
+#ifdef MP3_SYSTEM_LIBS
+#include <lame/lame.h>
+#else
+#include "deps/include/lame.h"
+#endif
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Checkpoint returns the position of the last complete frame returned by Encode or Flush.
+// Output after cp.Bytes belongs to the following, incomplete frame and is discarded when
+// encoding is continued with ResumeEncoder.
+// It returns ErrorNoCheckpoint before the first frames are complete or while a Reconfigure
+// is pending.
+func (enc *Encoder) Checkpoint() (*EncoderCheckpoint, error) {
+	if enc.handle == nil {
+		return nil, fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	if enc.next != nil || enc.dropFrames > 0 || enc.outRate != enc.inRate || enc.trackIndex > 0 || enc.trackDone {
+		return nil, ErrorNoCheckpoint
+	}
+	frames, partial := enc.tracker.complete()
+	frames += enc.frameOffset - enc.infoFrames
+	if frames < switchDropFrames {
+		return nil, ErrorNoCheckpoint
+	}
+	return &EncoderCheckpoint{
+		Frames:  frames,
+		Bytes:   enc.streamBytes() - int64(partial),
+		Samples: int64(frames-switchDropFrames) * int64(enc.FrameLength),
+	}, nil
+}
+
+// streamBytes returns the size of the stream output so far, including the part before the
+// checkpoint of a resumed encoder. Limits only count the output of this encoder.
+func (enc *Encoder) streamBytes() int64 {
+	return enc.resumeBytes + enc.quota.outBytes
+}
+
+// ResumeEncoder creates an encoder that continues a stream at a checkpoint, e.g. after a
+// batch job was restarted. c must be the configuration of the encoder the checkpoint was
+// taken from. The new encoder must be fed the input from cp.Samples on; its output is
+// appended to the first cp.Bytes bytes of the previous output.
+//
+// Like after Reconfigure, the resumed part is encoded without bit reservoir and
+// GetLameTagFrame returns an Info frame without seek table for the whole stream.
+// Resampling and ReplayGain analysis are not supported.
+func ResumeEncoder(c *EncoderConfig, cp *EncoderCheckpoint) (*Encoder, error) {
+	if cp == nil || cp.Frames < switchDropFrames {
+		return nil, fmt.Errorf("%w: invalid encoder checkpoint", ErrorInvalidConfig)
+	}
+	c = populateEncConfig(c)
+	if c.FindReplayGain {
+		return nil, errors.New("resume is not supported with ReplayGain analysis")
+	}
+
+	enc, err := newEncoder(c, func(h *C.lame_global_flags) error {
+		if errNo := C.lame_set_disable_reservoir(h, 1); errNo < 0 {
+			return toError("set params", errNo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if enc.outRate != enc.inRate {
+		enc.Close()
+		return nil, fmt.Errorf("resume is not supported with resampling (%d Hz to %d Hz)", enc.inRate, enc.outRate)
+	}
+	if cp.Samples != int64(cp.Frames-switchDropFrames)*int64(enc.FrameLength) {
+		enc.Close()
+		return nil, fmt.Errorf("%w: checkpoint does not match the frame length %d", ErrorInvalidConfig, enc.FrameLength)
+	}
+
+	// The first frames have no preceding input, they were output before the checkpoint
+	enc.dropFrames = enc.infoFrames + switchDropFrames
+	enc.frameOffset = cp.Frames - switchDropFrames
+	enc.totalSamples = cp.Samples
+	enc.resumeBytes = cp.Bytes
+	enc.reconfigured = true
+	return enc, nil
+}
@@ -0,0 +1,258 @@
+//go:build cgo && !purego
+
+package mp3
+
+/*
+#ifdef MP3_SYSTEM_LIBS
+#include <lame/lame.h>
+#else
+#include "deps/include/lame.h"
+#endif
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+)
+
+// Frames at the start of the new configuration's output that are replaced by the output
+// of the current configuration. The MDCT windows of these frames reach back before the
+// switch point, where the new LAME handle has seen no input.
+const switchDropFrames = 2
+
+// encoderSwitch is a pending change to a new LAME configuration.
+// Both handles encode the samples around the switch point until the current handle has
+// output the frame preceding the first frame taken from the new handle.
+type encoderSwitch struct {
+	enc     *Encoder // encoder with the new configuration, fed from start on
+	start   int64    // sample position in the current handle at which enc is fed
+	stop    int      // frame of the current handle's output at which it is cut
+	pending []byte   // output of enc held until the current handle is cut
+	cut     bool
+}
+
+// Reconfigure changes the bitrate or VBR settings of a running encoder, e.g. to lower the
+// bitrate of a live stream when the uplink degrades. The change takes effect at the next
+// frame boundary; the frames around it are encoded by both configurations so there is no
+// gap or discontinuity in the output.
+//
+// SampleRate and NumChannels must match the encoder (zero keeps the current values),
+// the output sample rate is kept. The new configuration is encoded without bit reservoir
+// so its frames do not depend on the data of the previous configuration.
+// ReplayGain analysis can not be continued across a change.
+//
+// Encoded data of the new configuration is returned by following Encode and Flush calls,
+// which may need more output space until the switch completes, see EstimateOutBufBytes.
+// After a change GetLameTagFrame returns an Info frame without seek table.
+func (enc *Encoder) Reconfigure(c *EncoderConfig) error {
+	if enc.handle == nil {
+		return fmt.Errorf("encoder %w", ErrorClosed)
+	}
+	if enc.findPeak || (c != nil && c.FindReplayGain) {
+		return errors.New("reconfigure is not supported with ReplayGain analysis")
+	}
+	if enc.trackIndex > 0 || enc.trackDone {
+		return errors.New("reconfigure is not supported with gapless encoding")
+	}
+	if enc.outRate != enc.inRate {
+		return fmt.Errorf("reconfigure is not supported with resampling (%d Hz to %d Hz)", enc.inRate, enc.outRate)
+	}
+
+	cc := EncoderConfig{}
+	if c != nil {
+		cc = *c
+	}
+	if cc.SampleRate == 0 {
+		cc.SampleRate = enc.inRate
+	}
+	if cc.NumChannels == 0 {
+		cc.NumChannels = enc.NumChannels
+	}
+	if cc.SampleRate != enc.inRate || cc.NumChannels != enc.NumChannels {
+		return fmt.Errorf("reconfigure can not change the input format: %d Hz %d channels",
+			cc.SampleRate, cc.NumChannels)
+	}
+	cc.IsWriteVbrTag = false
+
+	next, err := newEncoder(populateEncConfig(&cc), func(h *C.lame_global_flags) error {
+		if errNo := C.lame_set_out_samplerate(h, C.int(enc.outRate)); errNo < 0 {
+			return toError("set params", errNo)
+		}
+		if errNo := C.lame_set_disable_reservoir(h, 1); errNo < 0 {
+			return toError("set params", errNo)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if next.outRate != enc.outRate || next.FrameLength != enc.FrameLength {
+		next.Close()
+		return fmt.Errorf("reconfigure changes the frame layout: %d Hz %d samples per frame",
+			next.outRate, next.FrameLength)
+	}
+	next.dropFrames = switchDropFrames
+
+	// A previous change that has not completed yet is replaced
+	if enc.next != nil {
+		enc.next.enc.Close()
+	}
+	frameLength := int64(enc.FrameLength)
+	m := (enc.handleSamples + frameLength - 1) / frameLength
+	enc.next = &encoderSwitch{
+		enc:   next,
+		start: m * frameLength,
+		stop:  enc.infoFrames + int(m) + switchDropFrames,
+	}
+	return nil
+}
+
+// encodeSwitching encodes with both configurations while a switch is pending.
+func (enc *Encoder) encodeSwitching(in, out []byte, format pcmFormat) (n int, err error) {
+	sw := enc.next
+	bytesPerSample := enc.NumChannels * format.size()
+	skip := max(sw.start-enc.handleSamples, 0) * int64(bytesPerSample)
+
+	n, err = enc.lameEncode(in, out, format)
+	if err != nil {
+		return 0, err
+	}
+	if skip < int64(len(in)) {
+		if err := sw.encodeNext(in[skip:], format); err != nil {
+			return 0, err
+		}
+	}
+	if sw.cut {
+		n += enc.promote(out[n:])
+	}
+	return n, nil
+}
+
+// encodeNext encodes with the new configuration, keeping the output until the switch completes.
+func (sw *encoderSwitch) encodeNext(in []byte, format pcmFormat) error {
+	size := sw.enc.EstimateOutBufBytes(len(in) * 2 / format.size())
+	sw.pending = slices.Grow(sw.pending, size)
+	k, err := sw.enc.lameEncode(in, sw.pending[len(sw.pending):len(sw.pending)+size], format)
+	if err != nil {
+		return err
+	}
+	sw.pending = sw.pending[:len(sw.pending)+k]
+	return nil
+}
+
+// flushSwitching flushes the current handle. If its output reaches the switch point the
+// new configuration takes over and is flushed, otherwise the change is dropped.
+func (enc *Encoder) flushSwitching(out []byte) (int, error) {
+	n, err := enc.lameFlush(out)
+	if err != nil {
+		return 0, err
+	}
+	if !enc.next.cut {
+		// The stream ended before the switch point
+		enc.next.enc.Close()
+		enc.next = nil
+		return n, nil
+	}
+	n += enc.promote(out[n:])
+	k, err := enc.lameFlush(out[n:])
+	if err != nil {
+		return 0, err
+	}
+	return n + k, nil
+}
+
+// promote replaces the current handle with the one of the new configuration and
+// copies the output held back so far to out.
+func (enc *Encoder) promote(out []byte) int {
+	sw := enc.next
+	next := sw.enc
+	enc.next = nil
+
+	if enc.lameTag == nil && enc.infoFrames > 0 {
+		// Keep the tag of the first handle, its LAME extension is carried over by switchedInfoFrame
+		enc.lameTag, _ = enc.lameTagFrame()
+	}
+	enc.reconfigured = true
+	enc.frameOffset += int(sw.start) / enc.FrameLength
+
+	enc.cleanup.Stop()
+	closeLame(enc.handle)
+	next.cleanup.Stop()
+	enc.handle = next.handle
+	next.handle = nil
+	enc.cleanup = runtime.AddCleanup(enc, closeLame, enc.handle)
+
+	enc.frameBytes = next.frameBytes
+	enc.infoFrames = 0
+	enc.minSamples = next.minSamples
+	enc.tracker = next.tracker
+	enc.dropFrames = next.dropFrames
+	enc.handleSamples = next.handleSamples
+
+	return copy(out, sw.pending)
+}
+
+// switchedInfoFrame builds the Info frame replacing the placeholder after a configuration change.
+// The LAME extension of the first handle's tag is kept with updated padding and length,
+// so decoders still remove the encoder delay and padding.
+func (enc *Encoder) switchedInfoFrame() ([]byte, error) {
+	if len(enc.lameTag) < FrameHeaderSize {
+		return nil, nil
+	}
+	h, err := ParseFrameHeader(enc.lameTag)
+	if err != nil {
+		return nil, err
+	}
+	frames, err := enc.GetFrameNum()
+	if err != nil {
+		return nil, err
+	}
+
+	audioBytes := enc.streamBytes() - int64(len(enc.lameTag))
+	frame := buildInfoFrame(enc.lameTag[:FrameHeaderSize], h, frames, audioBytes)
+	if len(frame) < len(enc.lameTag) {
+		// buildInfoFrame drops the padding byte, restore it to keep the placeholder size
+		frame[2] |= 0x02
+		frame = append(frame, 0)
+		binary.BigEndian.PutUint32(frame[FrameHeaderSize+h.sideInfoSize()+12:], uint32(enc.streamBytes()))
+	}
+
+	srcExt := lameExtension(enc.lameTag, h)
+	pos := FrameHeaderSize + h.sideInfoSize() + 16
+	if srcExt == nil || pos+lameExtSize > len(frame) {
+		return frame, nil
+	}
+	ext := frame[pos : pos+lameExtSize]
+	copy(ext, srcExt)
+
+	delay := int64(ext[lameExtDelay])<<4 | int64(ext[lameExtDelay+1])>>4
+	padding := int64(frames)*int64(enc.FrameLength) - delay - enc.totalSamples
+	padding = min(max(padding, 0), 0xfff)
+	ext[lameExtDelay+1] = ext[lameExtDelay+1]&0xf0 | byte(padding>>8)
+	ext[lameExtDelay+2] = byte(padding)
+	binary.BigEndian.PutUint32(ext[lameExtMusicLength:], uint32(enc.streamBytes()))
+	// The music CRC of the first handle does not cover the spliced stream
+	binary.BigEndian.PutUint16(ext[lameExtMusicCRC:], 0)
+	binary.BigEndian.PutUint16(ext[lameExtTagCRC:], crc16(frame[:pos+lameExtTagCRC]))
+	return frame, nil
+}
+
+// crc16 is the CRC-16 (polynomial 0x8005, reflected) used by the LAME tag.
+func crc16(data []byte) uint16 {
+	crc := uint16(0)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xa001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
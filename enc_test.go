@@ -2,17 +2,24 @@ package mp3_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/lizc2003/audio-mp3"
 )
 
 // TestEncodeBasic tests basic encoding functionality
 func TestEncodeBasic(t *testing.T) {
+	requireNative(t)
 	// Generate simple test PCM data: 1 second of 440Hz sine wave
 	sampleRate := 44100
 	duration := 1.0
@@ -57,6 +64,7 @@ func TestEncodeBasic(t *testing.T) {
 
 // TestEncodeDifferentBitrates tests encoding with various bitrates
 func TestEncodeDifferentBitrates(t *testing.T) {
+	requireNative(t)
 	bitrates := []int{64, 96, 128, 192, 256, 320}
 
 	// Generate test data
@@ -106,6 +114,7 @@ func TestEncodeDifferentBitrates(t *testing.T) {
 
 // TestEncodeMonoStereo tests mono and stereo encoding
 func TestEncodeMonoStereo(t *testing.T) {
+	requireNative(t)
 	testCases := []struct {
 		name        string
 		numChannels int
@@ -158,6 +167,7 @@ func TestEncodeMonoStereo(t *testing.T) {
 
 // TestEncodeDifferentSampleRates tests various sample rates
 func TestEncodeDifferentSampleRates(t *testing.T) {
+	requireNative(t)
 	sampleRates := []int{8000, 16000, 22050, 24000, 32000, 44100, 48000}
 
 	for _, rate := range sampleRates {
@@ -196,6 +206,7 @@ func TestEncodeDifferentSampleRates(t *testing.T) {
 
 // TestEncodeVBRModes tests different VBR encoding modes
 func TestEncodeVBRModes(t *testing.T) {
+	requireNative(t)
 	testCases := []struct {
 		name    string
 		vbrMode mp3.VBRMode
@@ -240,8 +251,605 @@ func TestEncodeVBRModes(t *testing.T) {
 	}
 }
 
+// TestEncodeABRBitrates tests the ABR mean bitrate and the VBR bitrate limits
+func TestEncodeABRBitrates(t *testing.T) {
+	requireNative(t)
+	pcmData := generateNoise(2, 44100*2)
+
+	// frameBitrates encodes pcm and returns the lowest, highest and average frame bitrate
+	frameBitrates := func(t *testing.T, c *mp3.EncoderConfig, pcm []byte) (lo, hi, avg int) {
+		t.Helper()
+		encoder, err := mp3.NewEncoder(c)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		out, err := encoder.EncodeAll(pcm)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		lo, sum, n := 1000, 0, 0
+		for pos := 0; pos+mp3.FrameHeaderSize <= len(out); {
+			h, err := mp3.ParseFrameHeader(out[pos:])
+			if err != nil {
+				t.Fatalf("invalid frame at %d: %v", pos, err)
+			}
+			lo, hi = min(lo, h.Bitrate), max(hi, h.Bitrate)
+			sum += h.Bitrate
+			n++
+			pos += h.Size
+		}
+		return lo, hi, sum / n
+	}
+
+	_, _, low := frameBitrates(t, &mp3.EncoderConfig{VbrMode: mp3.VbrModeAbr, AbrMeanBitrate: 96}, pcmData)
+	_, _, high := frameBitrates(t, &mp3.EncoderConfig{VbrMode: mp3.VbrModeAbr, AbrMeanBitrate: 192}, pcmData)
+	if low < 80 || low > 112 || high < 160 || high > 224 {
+		t.Errorf("ABR averages %d and %d kbps, want about 96 and 192", low, high)
+	}
+	// Bitrate is the mean bitrate if AbrMeanBitrate is not set
+	if _, _, avg := frameBitrates(t, &mp3.EncoderConfig{VbrMode: mp3.VbrModeAbr, Bitrate: 192}, pcmData); avg != high {
+		t.Errorf("ABR with Bitrate 192 averages %d kbps, with AbrMeanBitrate %d", avg, high)
+	}
+
+	lo, hi, _ := frameBitrates(t, &mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 0, VbrMinBitrate: 128, VbrMaxBitrate: 192}, pcmData)
+	if lo < 128 || hi > 192 {
+		t.Errorf("VBR frames use %d-%d kbps, limits are 128-192", lo, hi)
+	}
+
+	// Silent frames go below the minimum unless it is a hard minimum
+	silence := make([]byte, len(pcmData))
+	soft, _, _ := frameBitrates(t, &mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, VbrMinBitrate: 96}, silence)
+	hard, _, _ := frameBitrates(t, &mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, VbrMinBitrate: 96, VbrHardMin: true}, silence)
+	if soft >= 96 || hard < 96 {
+		t.Errorf("silence uses %d kbps with a soft and %d kbps with a hard minimum of 96", soft, hard)
+	}
+	t.Logf("✓ ABR 96: %d kbps, ABR 192: %d kbps, VBR limited: %d-%d kbps", low, high, lo, hi)
+}
+
+// TestEncodeVbrQuality tests fractional VBR quality independent of the algorithm quality
+func TestEncodeVbrQuality(t *testing.T) {
+	requireNative(t)
+	pcmData := generateNoise(2, 44100)
+	size := func(c *mp3.EncoderConfig) int {
+		encoder, err := mp3.NewEncoder(c)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		out, err := encoder.EncodeAll(pcmData)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		return len(out)
+	}
+
+	v4 := size(&mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 4})
+	v45 := size(&mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, VbrQuality: 4.5, Quality: 2})
+	v5 := size(&mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 5})
+	if v45 > v4 || v45 < v5 {
+		t.Errorf("V4.5 output %d bytes not between V4 %d and V5 %d bytes", v45, v4, v5)
+	}
+	// With VbrQuality set Quality is the algorithm quality, which changes the output too
+	if fast := size(&mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, VbrQuality: 4.5, Quality: 9}); fast == v45 {
+		t.Error("Quality has no effect with VbrQuality set")
+	}
+	t.Logf("✓ V4: %d, V4.5: %d, V5: %d bytes", v4, v45, v5)
+}
+
+// TestEncodePresets tests that LAME presets override the bitrate settings
+func TestEncodePresets(t *testing.T) {
+	requireNative(t)
+	pcmData := generateNoise(2, 44100)
+	for _, tc := range []struct {
+		preset mp3.Preset
+		vbr    bool
+	}{
+		{mp3.PresetMedium, true},
+		{mp3.PresetStandard, true},
+		{mp3.PresetExtreme, true},
+		{mp3.PresetInsane, false},
+	} {
+		t.Run(tc.preset.String(), func(t *testing.T) {
+			// Bitrate and VbrMode are ignored with a preset
+			encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{Preset: tc.preset, Bitrate: 64, IsWriteVbrTag: true})
+			if err != nil {
+				t.Fatalf("Failed to create encoder: %v", err)
+			}
+			defer encoder.Close()
+			out, err := encoder.EncodeAll(pcmData)
+			if err != nil {
+				t.Fatalf("EncodeAll failed: %v", err)
+			}
+			bitrates := map[int]bool{}
+			for pos := 0; pos+mp3.FrameHeaderSize <= len(out); {
+				h, err := mp3.ParseFrameHeader(out[pos:])
+				if err != nil {
+					t.Fatalf("invalid frame at %d: %v", pos, err)
+				}
+				bitrates[h.Bitrate] = true
+				pos += h.Size
+			}
+			if tc.vbr && !bytes.Contains(out[:200], []byte("Xing")) {
+				t.Error("preset did not encode VBR")
+			}
+			if !tc.vbr && (len(bitrates) != 1 || !bitrates[320]) {
+				t.Errorf("frame bitrates %v, want 320 kbps only", bitrates)
+			}
+			t.Logf("✓ preset %s: %d bytes", tc.preset, len(out))
+		})
+	}
+}
+
+// TestEncodeFrameFlags tests the CRC, copyright, original and private header bits
+func TestEncodeFrameFlags(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	for _, tc := range []struct {
+		name   string
+		config mp3.EncoderConfig
+	}{
+		{"default", mp3.EncoderConfig{}},
+		{"all", mp3.EncoderConfig{ErrorProtection: true, Copyright: true, Copy: true, Private: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.config
+			encoder, err := mp3.NewEncoder(&c)
+			if err != nil {
+				t.Fatalf("Failed to create encoder: %v", err)
+			}
+			defer encoder.Close()
+			out, err := encoder.EncodeAll(pcmData)
+			if err != nil {
+				t.Fatalf("EncodeAll failed: %v", err)
+			}
+			frames := 0
+			for pos := 0; pos+mp3.FrameHeaderSize <= len(out); frames++ {
+				h, err := mp3.ParseFrameHeader(out[pos:])
+				if err != nil {
+					t.Fatalf("invalid frame at %d: %v", pos, err)
+				}
+				hdr := out[pos : pos+mp3.FrameHeaderSize]
+				if h.Protected != c.ErrorProtection || hdr[2]&0x01 != 0 != c.Private ||
+					hdr[3]&0x08 != 0 != c.Copyright || hdr[3]&0x04 != 0 != !c.Copy {
+					t.Fatalf("frame %d header % x does not match %+v", frames, hdr, c)
+				}
+				pos += h.Size
+			}
+			if len(decodeAll(t, out)) == 0 {
+				t.Error("no audio decoded")
+			}
+			t.Logf("✓ %s: %d frames", tc.name, frames)
+		})
+	}
+}
+
+// TestEncoderHistograms tests the bitrate and stereo mode statistics
+func TestEncoderHistograms(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 2, MpegMode: mp3.MpegJointStereo, IsWriteVbrTag: true})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	out, err := encoder.EncodeAll(generateNoise(2, 44100*2))
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	hist, err := encoder.BitrateHistogram()
+	if err != nil {
+		t.Fatalf("BitrateHistogram failed: %v", err)
+	}
+	if len(hist) != 14 || hist[0].Kbps != 32 || hist[13].Kbps != 320 {
+		t.Fatalf("unexpected bitrates: %v", hist)
+	}
+	// Count the audio frames in the output, skipping the Xing frame
+	want := map[int]int{}
+	total := 0
+	for pos := 0; pos+mp3.FrameHeaderSize <= len(out); {
+		h, err := mp3.ParseFrameHeader(out[pos:])
+		if err != nil {
+			t.Fatalf("invalid frame at %d: %v", pos, err)
+		}
+		if pos > 0 {
+			want[h.Bitrate]++
+			total++
+		}
+		pos += h.Size
+	}
+	for _, c := range hist {
+		if c.Frames != want[c.Kbps] {
+			t.Errorf("%d kbps: %d frames, output has %d", c.Kbps, c.Frames, want[c.Kbps])
+		}
+	}
+
+	modes, err := encoder.StereoModeHistogram()
+	if err != nil {
+		t.Fatalf("StereoModeHistogram failed: %v", err)
+	}
+	if modes.LeftRight+modes.MidSide != total || modes.LeftRightIntensity != 0 || modes.MidSideIntensity != 0 {
+		t.Errorf("stereo modes %+v do not add up to %d frames", modes, total)
+	}
+	t.Logf("✓ %d frames, %+v", total, modes)
+}
+
+// TestEncoderSetTotalSamples tests that LAME estimates the frame count from the input length
+func TestEncoderSetTotalSamples(t *testing.T) {
+	requireNative(t)
+	const samples = 44100 * 3
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{IsWriteVbrTag: true})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	if n := encoder.EstimatedTotalFrames(); n != 0 {
+		t.Errorf("EstimatedTotalFrames = %d without a length", n)
+	}
+	if err := encoder.SetTotalSamples(samples); err != nil {
+		t.Fatalf("SetTotalSamples failed: %v", err)
+	}
+	estimate := encoder.EstimatedTotalFrames()
+	if _, err := encoder.EncodeAll(generateSineWave(440, 44100, 2, samples)); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	frames, err := encoder.GetFrameNum()
+	if err != nil {
+		t.Fatalf("GetFrameNum failed: %v", err)
+	}
+	if estimate < frames-2 || estimate > frames+2 {
+		t.Errorf("EstimatedTotalFrames = %d, encoded %d frames", estimate, frames)
+	}
+	t.Logf("✓ estimated %d frames, encoded %d", estimate, frames)
+}
+
+// TestEncoderStats tests the cumulative encoder counters
+func TestEncoderStats(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	if s := encoder.Stats(); s != (mp3.EncoderStats{}) {
+		t.Errorf("Stats of a new encoder = %+v", s)
+	}
+
+	var out []byte
+	for chunk := range slicesChunk(generateSineWave(440, 44100, 2, 44100*2), 4096) {
+		if out, err = encoder.EncodeAppend(out, chunk); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+	if out, err = encoder.FlushAppend(out); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	s := encoder.Stats()
+	frames, _ := encoder.GetFrameNum()
+	if s.Samples != 44100*2 || s.Duration != 2*time.Second || s.Bytes != int64(len(out)) || s.Frames != frames {
+		t.Errorf("Stats = %+v, want 88200 samples, 2s, %d bytes and %d frames", s, len(out), frames)
+	}
+	if s.Bitrate < 127 || s.Bitrate > 130 {
+		t.Errorf("average bitrate %.1f kbps, want about 128", s.Bitrate)
+	}
+	t.Logf("✓ Stats: %+v", s)
+}
+
+// cancelReader cancels a context after reading the first chunk.
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.cancel()
+	return n, err
+}
+
+func TestEncodeFromWavContext(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	header := bytes.NewReader(wav)
+	in := io.MultiReader(io.LimitReader(header, 44), &cancelReader{header, cancel})
+
+	var out mp3.SeekableBuffer
+	_, err := mp3.EncodeFromWavContext(ctx, in, &out, nil, &mp3.WavOptions{ChunkSize: 4096})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("EncodeFromWavContext error = %v, want context.Canceled", err)
+	}
+	if header.Len() == 0 {
+		t.Error("Input read to the end after cancel")
+	}
+	t.Logf("✓ Cancelled with %d of %d bytes unread", header.Len(), len(wav))
+}
+
+func TestWavProgress(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100)
+	var reports []mp3.Progress
+	opts := &mp3.WavOptions{ChunkSize: 8192, Progress: func(p mp3.Progress) { reports = append(reports, p) }}
+	check := func(name string, inputSize int64) {
+		t.Helper()
+		if len(reports) < 2 {
+			t.Fatalf("%s: %d progress reports", name, len(reports))
+		}
+		for i := 1; i < len(reports); i++ {
+			if reports[i].InputBytes < reports[i-1].InputBytes || reports[i].Percent < reports[i-1].Percent {
+				t.Errorf("%s: progress went back: %+v after %+v", name, reports[i], reports[i-1])
+			}
+		}
+		last := reports[len(reports)-1]
+		if last.InputSize != inputSize || last.InputBytes != inputSize || last.Percent != 100 || last.Samples == 0 {
+			t.Errorf("%s: last report %+v, want %d input bytes", name, last, inputSize)
+		}
+	}
+
+	var mp3Data mp3.SeekableBuffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &mp3Data, nil, opts); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	check("EncodeFromWav", int64(len(wav)-mp3.WavHeaderSize))
+	encodeReports := len(reports)
+
+	reports = nil
+	var wavOut mp3.SeekableBuffer
+	if _, _, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data.Bytes()), &wavOut, opts); err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	check("DecodeToWav", int64(len(mp3Data.Bytes())))
+
+	// Without a size the percentage is unknown
+	reports = nil
+	if _, _, _, err := mp3.DecodeToWav(io.MultiReader(bytes.NewReader(mp3Data.Bytes())), &wavOut, opts); err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	if p := reports[len(reports)-1]; p.Percent != -1 || p.InputSize != 0 {
+		t.Errorf("Unknown input size reported as %+v", p)
+	}
+	t.Logf("✓ Progress: %d encode and %d decode reports", encodeReports, len(reports))
+}
+
+func TestEncodeFromWavChunkSizes(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100*2)
+	var want []byte
+	for _, opts := range []*mp3.WavOptions{nil, {ChunkSize: 2048}, {ChunkSize: 1001}, {ChunkSize: 1 << 20}} {
+		var out mp3.SeekableBuffer
+		if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, nil, opts); err != nil {
+			t.Fatalf("EncodeFromWav(%+v) failed: %v", opts, err)
+		}
+		if want == nil {
+			want = out.Bytes()
+		} else if !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("EncodeFromWav(%+v) output differs from the default chunk size", opts)
+		}
+	}
+	t.Logf("✓ Chunk sizes give the same %d bytes", len(want))
+}
+
+func TestEncodeResultStats(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100*2)
+	var out mp3.SeekableBuffer
+	config := &mp3.EncoderConfig{Bitrate: 128, Tags: &mp3.TrackTags{Title: "Stats"}}
+	result, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, config, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	// 44.1 kHz frames alternate between 417 and 418 bytes
+	if math.Abs(result.AverageBitrate-128) > 0.1 {
+		t.Errorf("AverageBitrate = %g, want 128", result.AverageBitrate)
+	}
+	if result.Duration != 2*time.Second {
+		t.Errorf("Duration = %v, want 2s", result.Duration)
+	}
+	t.Logf("✓ %v at %g kbps in %d frames", result.Duration, result.AverageBitrate, result.Frames)
+}
+
+func TestEncodeFromWavWorkers(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100*5)
+	config := &mp3.EncoderConfig{Bitrate: 128}
+
+	var serial mp3.SeekableBuffer
+	want, err := mp3.EncodeFromWav(bytes.NewReader(wav), &serial, config, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	refPCM := decodeAll(t, serial.Bytes())
+
+	for _, opts := range []*mp3.WavOptions{
+		{Workers: 4, SegmentDuration: time.Second},
+		{Workers: 2, SegmentDuration: 300 * time.Millisecond, ChunkSize: 1001},
+		{Workers: 3, SegmentDuration: time.Hour},
+	} {
+		var out mp3.SeekableBuffer
+		result, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, config, opts)
+		if err != nil {
+			t.Fatalf("EncodeFromWav(%+v) failed: %v", opts, err)
+		}
+		if result.Frames != want.Frames || result.Duration != want.Duration || result.TotalBytes != int64(out.Len()) {
+			t.Errorf("EncodeFromWav(%+v) = %+v, want %d frames of %v", opts, result, want.Frames, want.Duration)
+		}
+		if info, err := mp3.Probe(bytes.NewReader(out.Bytes()), int64(out.Len())); err != nil {
+			t.Errorf("Probe failed: %v", err)
+		} else if !info.HasInfoFrame || info.InfoFrames != result.Frames || info.Frames != result.Frames {
+			t.Errorf("Info frame does not match the stitched stream: %+v", info)
+		}
+
+		// The segments must join without a gap
+		pcm := decodeAll(t, out.Bytes())
+		if len(pcm) != len(refPCM) {
+			t.Fatalf("Decoded length differs: serial %d, parallel %d", len(refPCM), len(pcm))
+		}
+		maxDiff := 0
+		for i := 0; i+1 < len(pcm); i += 2 {
+			a := int(int16(binary.LittleEndian.Uint16(refPCM[i:])))
+			b := int(int16(binary.LittleEndian.Uint16(pcm[i:])))
+			maxDiff = max(maxDiff, abs(a-b))
+		}
+		if maxDiff > 2000 {
+			t.Errorf("Decoded audio deviates from serial encoding by %d", maxDiff)
+		}
+		t.Logf("✓ Workers %d, segments of %v: %d frames, max deviation %d", opts.Workers, opts.SegmentDuration, result.Frames, maxDiff)
+	}
+}
+
+func TestEncodeFromWavBitDepths(t *testing.T) {
+	requireNative(t)
+	pcm16 := generateSineWave(440, 44100, 2, 44100)
+	encode := func(bits int) []byte {
+		size := bits / 8
+		pcm := make([]byte, 0, len(pcm16)/2*size)
+		for i := 0; i+1 < len(pcm16); i += 2 {
+			// Pad the 16-bit samples with zero low bytes
+			pcm = append(pcm, make([]byte, size-2)...)
+			pcm = append(pcm, pcm16[i], pcm16[i+1])
+		}
+		wav := append(mp3.GenerateWavHeader(len(pcm), 44100, 2, bits), pcm...)
+		var out mp3.SeekableBuffer
+		if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, nil, nil); err != nil {
+			t.Fatalf("EncodeFromWav(%d-bit) failed: %v", bits, err)
+		}
+		return out.Bytes()
+	}
+
+	want := encode(16)
+	for _, bits := range []int{24, 32} {
+		if got := encode(bits); !bytes.Equal(got, want) {
+			t.Errorf("%d-bit WAV output differs from 16-bit output", bits)
+		}
+	}
+
+	wav := append(mp3.GenerateWavHeader(100, 44100, 1, 8), make([]byte, 100)...)
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), io.Discard, nil, nil); err == nil {
+		t.Error("EncodeFromWav accepted 8-bit samples")
+	}
+	t.Logf("✓ 24 and 32-bit WAV input encodes like 16-bit input")
+}
+
+func TestEncodeFromWavStreaming(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100)
+	var want mp3.SeekableBuffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &want, nil, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	// Captures piped from arecord or ffmpeg have no data size
+	for _, size := range []uint32{0, math.MaxUint32} {
+		streaming := bytes.Clone(wav)
+		binary.LittleEndian.PutUint32(streaming[4:], size)
+		binary.LittleEndian.PutUint32(streaming[40:], size)
+		var out mp3.SeekableBuffer
+		result, err := mp3.EncodeFromWav(io.MultiReader(bytes.NewReader(streaming)), &out, nil, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromWav(data size %#x) failed: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), want.Bytes()) {
+			t.Errorf("EncodeFromWav(data size %#x) output differs, %d frames", size, result.Frames)
+		}
+	}
+	t.Logf("✓ Streaming WAV read until EOF, %d bytes", want.Len())
+}
+
+func TestEncodeFromWavG711(t *testing.T) {
+	requireNative(t)
+	testCases := []struct {
+		name   string
+		format uint16
+		codes  []byte
+		linear []int16
+	}{
+		{"mu-law", 7, []byte{0xff, 0x80, 0x00, 0x7f, 0xa0, 0x20}, []int16{0, 32124, -32124, 0, 7932, -7932}},
+		{"A-law", 6, []byte{0xd5, 0x55, 0xaa, 0x2a, 0xf5, 0x75}, []int16{8, -8, 32256, -32256, 528, -528}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			const n = 8000
+			g711 := make([]byte, n)
+			pcm := make([]byte, 2*n)
+			for i := range n {
+				g711[i] = tc.codes[i/50%len(tc.codes)]
+				binary.LittleEndian.PutUint16(pcm[2*i:], uint16(tc.linear[i/50%len(tc.linear)]))
+			}
+			header := mp3.GenerateWavHeader(n, 8000, 1, 8)
+			binary.LittleEndian.PutUint16(header[20:], tc.format)
+			config := &mp3.EncoderConfig{Bitrate: 32}
+
+			var got, want bytes.Buffer
+			if _, err := mp3.EncodeFromWav(bytes.NewReader(append(header, g711...)), &got, config, nil); err != nil {
+				t.Fatalf("EncodeFromWav failed: %v", err)
+			}
+			wav := append(mp3.GenerateWavHeader(len(pcm), 8000, 1, 16), pcm...)
+			if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &want, config, nil); err != nil {
+				t.Fatalf("EncodeFromWav(16-bit) failed: %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Error("G.711 output differs from the expanded 16-bit input")
+			}
+			t.Logf("✓ %s WAV encoded to %d bytes", tc.name, got.Len())
+		})
+	}
+
+	header := mp3.GenerateWavHeader(0, 8000, 1, 8)
+	binary.LittleEndian.PutUint16(header[20:], 7)
+	if _, _, _, _, err := mp3.ParseWavHeader(bytes.NewReader(header)); err == nil {
+		t.Error("ParseWavHeader accepted a G.711 header")
+	}
+}
+
+func TestEncodeFromPCM(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(22050, 1, 22050)
+	config := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64}
+
+	var fromWav, fromPCM bytes.Buffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &fromWav, config, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	// Odd chunks split samples
+	result, err := mp3.EncodeFromPCM(bytes.NewReader(wav[mp3.WavHeaderSize:]), &fromPCM, mp3.S16LE, config, &mp3.WavOptions{ChunkSize: 1001})
+	if err != nil {
+		t.Fatalf("EncodeFromPCM failed: %v", err)
+	}
+	if !bytes.Equal(fromPCM.Bytes(), fromWav.Bytes()) {
+		t.Error("EncodeFromPCM output differs from EncodeFromWav")
+	}
+	if result.SampleRate != 22050 || result.NumChannels != 1 || result.TotalBytes != int64(fromPCM.Len()) {
+		t.Errorf("EncodeFromPCM result = %+v", result)
+	}
+	frames := result.Frames
+
+	// 32-bit float input
+	samples := wav[mp3.WavHeaderSize:]
+	f32 := make([]byte, 0, len(samples)*2)
+	for i := 0; i+1 < len(samples); i += 2 {
+		v := float32(int16(binary.LittleEndian.Uint16(samples[i:]))) / 32768
+		f32 = binary.LittleEndian.AppendUint32(f32, math.Float32bits(v))
+	}
+	var fromF32 mp3.SeekableBuffer
+	result, err = mp3.EncodeFromPCM(bytes.NewReader(f32), &fromF32, mp3.F32, config, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromPCM(F32) failed: %v", err)
+	}
+	if result.Frames != frames {
+		t.Errorf("EncodeFromPCM(F32) encoded %d frames, want %d", result.Frames, frames)
+	}
+
+	if _, err := mp3.EncodeFromPCM(bytes.NewReader(f32), io.Discard, mp3.SampleFormat(9), config, nil); err == nil {
+		t.Error("EncodeFromPCM accepted an unknown sample format")
+	}
+	t.Logf("✓ EncodeFromPCM: %d bytes from s16le, %d frames from f32", fromPCM.Len(), result.Frames)
+}
+
 // TestEncodeQualityLevels tests different quality levels
 func TestEncodeQualityLevels(t *testing.T) {
+	requireNative(t)
 	qualities := []int{0, 2, 5, 7, 9}
 
 	pcmData := generateSineWave(440, 44100, 2, 44100) // 1 second
@@ -279,6 +887,7 @@ func TestEncodeQualityLevels(t *testing.T) {
 
 // TestEncodeStreamingMode tests encoding in streaming mode (multiple Encode calls)
 func TestEncodeStreamingMode(t *testing.T) {
+	requireNative(t)
 	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
 		SampleRate:  44100,
 		NumChannels: 2,
@@ -323,8 +932,173 @@ func TestEncodeStreamingMode(t *testing.T) {
 		totalPCM, totalMP3)
 }
 
+// TestEncodeBatching tests that batching small inputs produces the same stream
+func TestEncodeBatching(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 16000, 1, 16000*2)
+	packetSize := 16000 / 50 * 2 // 20 ms mono packets
+
+	encodeAll := func(minSamples int) ([]byte, int) {
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
+			SampleRate:       16000,
+			NumChannels:      1,
+			Bitrate:          32,
+			MinEncodeSamples: minSamples,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+
+		var result []byte
+		emptyCalls := 0
+		outBuf := make([]byte, encoder.EstimateOutBufBytes(packetSize))
+		for offset := 0; offset < len(pcmData); offset += packetSize {
+			n, err := encoder.Encode(pcmData[offset:min(offset+packetSize, len(pcmData))], outBuf)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if n == 0 {
+				emptyCalls++
+			}
+			result = append(result, outBuf[:n]...)
+		}
+		n, err := encoder.Flush(outBuf)
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		return append(result, outBuf[:n]...), emptyCalls
+	}
+
+	direct, _ := encodeAll(0)
+	batched, emptyCalls := encodeAll(2304)
+
+	if !bytes.Equal(direct, batched) {
+		t.Errorf("Batched output differs: %d vs %d bytes", len(batched), len(direct))
+	}
+	if emptyCalls == 0 {
+		t.Error("Expected some Encode calls to be batched")
+	}
+
+	t.Logf("✓ Batching: %d bytes, %d of %d calls buffered",
+		len(batched), emptyCalls, len(pcmData)/packetSize)
+}
+
+func TestEncodeAppend(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128}
+
+	encoder, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	outBuf := make([]byte, encoder.EstimateOutBufBytes(len(pcmData)))
+	n, err := encoder.Encode(pcmData, outBuf)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	expected := append([]byte(nil), outBuf[:n]...)
+	n, err = encoder.Flush(outBuf)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	expected = append(expected, outBuf[:n]...)
+
+	appender, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer appender.Close()
+	var result []byte
+	for offset := 0; offset < len(pcmData); offset += 1000 { // odd chunks split sample frames
+		result, err = appender.EncodeAppend(result, pcmData[offset:min(offset+1000, len(pcmData))])
+		if err != nil {
+			t.Fatalf("EncodeAppend failed: %v", err)
+		}
+	}
+	result, err = appender.FlushAppend(result)
+	if err != nil {
+		t.Fatalf("FlushAppend failed: %v", err)
+	}
+
+	if !bytes.Equal(result, expected) {
+		t.Errorf("EncodeAppend output differs: %d vs %d bytes", len(result), len(expected))
+	}
+	t.Logf("✓ EncodeAppend: %d bytes", len(result))
+}
+
+func TestEstimateOutBufBytes(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	worstCase := 44101*5/4 + 7200 // 1.25*num_samples + 7200 from lame.h
+
+	for _, config := range []*mp3.EncoderConfig{
+		{SampleRate: 44100, NumChannels: 2, Bitrate: 64},
+		{SampleRate: 44100, NumChannels: 2, Bitrate: 128, IsWriteVbrTag: true},
+		{SampleRate: 44100, NumChannels: 2, VbrMode: mp3.VbrModeMtrh, Quality: 2},
+	} {
+		encoder, err := mp3.NewEncoder(config)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+
+		estimate := encoder.EstimateOutBufBytes(len(pcmData))
+		if estimate > worstCase {
+			t.Errorf("Estimate %d exceeds worst case %d", estimate, worstCase)
+		}
+		// Buffers of exactly the estimated size must be enough
+		n, err := encoder.Encode(pcmData, make([]byte, estimate))
+		if err != nil {
+			t.Errorf("Encode with estimated buffer failed: %v", err)
+		}
+		if _, err := encoder.Flush(make([]byte, encoder.EstimateOutBufBytes(0))); err != nil {
+			t.Errorf("Flush with estimated buffer failed: %v", err)
+		}
+		encoder.Close()
+
+		t.Logf("✓ Bitrate %d, VBR %d: estimate %d bytes for %d encoded (worst case %d)",
+			config.Bitrate, config.VbrMode, estimate, n, worstCase)
+	}
+
+	// VbrMaxBitrate bounds the frames, rounded up to a legal bitrate
+	noise := generateNoise(2, 44100)
+	var unlimited int
+	for _, maxKbps := range []int{0, 200, 128} {
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 0, VbrMaxBitrate: maxKbps})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		estimate := encoder.EstimateOutBufBytes(len(noise))
+		out := make([]byte, estimate)
+		n, err := encoder.Encode(noise, out)
+		if err != nil {
+			t.Fatalf("Encode with estimated buffer failed: %v", err)
+		}
+		for pos := 0; pos+mp3.FrameHeaderSize <= n; {
+			h, err := mp3.ParseFrameHeader(out[pos:])
+			if err != nil {
+				break // the last frame may be incomplete
+			}
+			if h.Size > encoder.MaxFrameBytes() {
+				t.Errorf("max %d kbps: frame of %d bytes exceeds MaxFrameBytes %d", maxKbps, h.Size, encoder.MaxFrameBytes())
+			}
+			pos += h.Size
+		}
+		encoder.Close()
+		if maxKbps == 0 {
+			unlimited = estimate
+		} else if estimate >= unlimited {
+			t.Errorf("max %d kbps: estimate %d not below unlimited %d", maxKbps, estimate, unlimited)
+		}
+		t.Logf("✓ VBR max %d kbps: estimate %d bytes for %d encoded", maxKbps, estimate, n)
+	}
+}
+
 // TestEncodeFromWavFile tests encoding from real WAV files
 func TestEncodeFromWavFile(t *testing.T) {
+	requireNative(t)
 	wavFile := filepath.Join("samples", "sample.wav")
 	if _, err := os.Stat(wavFile); os.IsNotExist(err) {
 		t.Skip("sample.wav not found, skipping test")
@@ -340,13 +1114,14 @@ func TestEncodeFromWavFile(t *testing.T) {
 	var mp3Buf bytes.Buffer
 
 	// Encode
-	totalBytes, totalFrames, sampleRate, err := mp3.EncodeFromWav(inFile, &mp3Buf, &mp3.EncoderConfig{
+	result, err := mp3.EncodeFromWav(inFile, &mp3Buf, &mp3.EncoderConfig{
 		Bitrate: 128,
 		Quality: 2,
-	})
+	}, nil)
 	if err != nil {
 		t.Fatalf("EncodeFromWav failed: %v", err)
 	}
+	totalBytes, totalFrames, sampleRate := result.TotalBytes, result.Frames, result.SampleRate
 
 	if totalBytes == 0 {
 		t.Fatal("No MP3 data generated")
@@ -497,6 +1272,7 @@ func TestEncodeMonoFiles(t *testing.T) {
 
 // TestEncodeInvalidInput tests error handling
 func TestEncodeInvalidInput(t *testing.T) {
+	requireNative(t)
 	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
 		SampleRate:  44100,
 		NumChannels: 2,
@@ -523,11 +1299,23 @@ func TestEncodeInvalidInput(t *testing.T) {
 		if err == nil {
 			t.Error("Expected error for small output buffer, got nil")
 		}
+		var short *mp3.ShortBufferError
+		if !errors.As(err, &short) || !errors.Is(err, mp3.ErrorBufferTooSmall) {
+			t.Fatalf("Expected ShortBufferError, got %v", err)
+		}
+		if short.Size != len(smallBuf) || short.Required != encoder.EstimateOutBufBytes(len(input)) {
+			t.Errorf("ShortBufferError = %+v, want size %d, required %d",
+				*short, len(smallBuf), encoder.EstimateOutBufBytes(len(input)))
+		}
+		if _, err := encoder.Encode(input, make([]byte, short.Required)); err != nil {
+			t.Errorf("Encode with required size failed: %v", err)
+		}
 	})
 }
 
 // TestEncodeFlushMultipleTimes tests that flush can be called multiple times
 func TestEncodeFlushMultipleTimes(t *testing.T) {
+	requireNative(t)
 	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
 		SampleRate:  44100,
 		NumChannels: 2,
@@ -539,7 +1327,8 @@ func TestEncodeFlushMultipleTimes(t *testing.T) {
 	defer encoder.Close()
 
 	pcmData := generateSineWave(440, 44100, 2, 44100)
-	outBuf := make([]byte, encoder.EstimateOutBufBytes(len(pcmData)))
+	// Room for the encoded data and both flushes
+	outBuf := make([]byte, encoder.EstimateOutBufBytes(len(pcmData))+2*encoder.EstimateOutBufBytes(0))
 
 	// Encode
 	encodedBytes, err := encoder.Encode(pcmData, outBuf)
@@ -568,6 +1357,7 @@ func TestEncodeFlushMultipleTimes(t *testing.T) {
 
 // TestEncodeRoundTrip tests encoding and decoding back
 func TestEncodeRoundTrip(t *testing.T) {
+	requireNative(t)
 	// Generate original PCM
 	originalPCM := generateSineWave(440, 44100, 2, 44100*2) // 2 seconds
 
@@ -637,6 +1427,7 @@ func TestEncodeRoundTrip(t *testing.T) {
 
 // TestLameTagFrame tests Xing/LAME tag generation
 func TestLameTagFrame(t *testing.T) {
+	requireNative(t)
 	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
 		SampleRate:    44100,
 		NumChannels:   2,
@@ -695,8 +1486,49 @@ func TestLameTagFrame(t *testing.T) {
 		len(lameTag), hasInfo, hasXing, hasLame)
 }
 
+// TestEncodeFromWavConfigNotModified tests that a config can be shared between concurrent jobs
+func TestEncodeFromWavConfigNotModified(t *testing.T) {
+	requireNative(t)
+	config := &mp3.EncoderConfig{Bitrate: 96}
+	want := *config
+
+	rates := []int{22050, 44100, 48000}
+	results := make([]*mp3.EncodeResult, len(rates))
+	errs := make([]error, len(rates))
+	var wg sync.WaitGroup
+	for i, rate := range rates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out bytes.Buffer
+			results[i], errs[i] = mp3.EncodeFromWav(bytes.NewReader(generateWavFile(rate, 1, rate/2)), &out, config, nil)
+		}()
+	}
+	wg.Wait()
+
+	if *config != want {
+		t.Errorf("Config modified: %+v", *config)
+	}
+	for i, rate := range rates {
+		if errs[i] != nil {
+			t.Fatalf("EncodeFromWav at %d Hz failed: %v", rate, errs[i])
+		}
+		r := results[i]
+		if r.SampleRate != rate || r.NumChannels != 1 || r.Config.SampleRate != rate || r.Config.NumChannels != 1 {
+			t.Errorf("Unexpected result at %d Hz: %+v", rate, r)
+		}
+		if r.Config.Bitrate != 96 || r.Config.Quality != 0 || r.Config.IsWriteVbrTag {
+			t.Errorf("Unexpected config at %d Hz: %+v", rate, r.Config)
+		}
+		if r.TotalBytes == 0 || r.Frames == 0 {
+			t.Errorf("No output at %d Hz: %+v", rate, r)
+		}
+	}
+}
+
 // TestEncodeWithXingHeader tests that Xing/Info header is written correctly
 func TestEncodeWithXingHeader(t *testing.T) {
+	requireNative(t)
 	// Create a temporary file
 	tmpFile, err := os.CreateTemp("", "test_xing_*.mp3")
 	if err != nil {
@@ -710,15 +1542,16 @@ func TestEncodeWithXingHeader(t *testing.T) {
 	wavReader := bytes.NewReader(wavData)
 
 	// Encode to file (supports seeking)
-	totalBytes, totalFrames, sampleRate, err := mp3.EncodeFromWav(wavReader, tmpFile, &mp3.EncoderConfig{
+	result, err := mp3.EncodeFromWav(wavReader, tmpFile, &mp3.EncoderConfig{
 		Bitrate: 128,
 		Quality: 2,
-	})
+	}, nil)
 	tmpFile.Close()
 
 	if err != nil {
 		t.Fatalf("EncodeFromWav failed: %v", err)
 	}
+	totalBytes, totalFrames, sampleRate := result.TotalBytes, result.Frames, result.SampleRate
 
 	if totalBytes == 0 {
 		t.Fatal("No MP3 data generated")
@@ -747,8 +1580,54 @@ func TestEncodeWithXingHeader(t *testing.T) {
 		totalBytes, totalFrames, sampleRate, hasInfo, hasXing, hasLame)
 }
 
+// TestEncodeFromWavReplayGain tests that ReplayGain values are written into an ID3v2 tag
+func TestEncodeFromWavReplayGain(t *testing.T) {
+	requireNative(t)
+	tmpFile, err := os.CreateTemp("", "test_rg_*.mp3")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	wavData := generateWavFile(44100, 2, 44100*2)
+	_, err = mp3.EncodeFromWav(bytes.NewReader(wavData), tmpFile, &mp3.EncoderConfig{
+		Bitrate:        128,
+		Quality:        2,
+		FindReplayGain: true,
+	}, nil)
+	tmpFile.Close()
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	mp3Data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		t.Fatalf("Failed to read MP3 file: %v", err)
+	}
+
+	if string(mp3Data[0:3]) != "ID3" {
+		t.Fatal("MP3 file missing ID3v2 tag")
+	}
+	if !bytes.Contains(mp3Data[:512], []byte("replaygain_track_gain")) {
+		t.Error("ID3v2 tag missing replaygain_track_gain")
+	}
+	if !bytes.Contains(mp3Data[:512], []byte("RVA2")) {
+		t.Error("ID3v2 tag missing RVA2")
+	}
+	if bytes.Contains(mp3Data[:512], []byte("replaygain_track_peak\x000.000000")) {
+		t.Error("ReplayGain peak not updated")
+	}
+	if !bytes.Contains(mp3Data[:1024], []byte("LAME")) {
+		t.Error("MP3 file missing LAME tag after ID3v2 tag")
+	}
+
+	t.Logf("✓ ReplayGain tagged MP3: %d bytes", len(mp3Data))
+}
+
 // TestGetFrameNum tests frame number tracking
 func TestGetFrameNum(t *testing.T) {
+	requireNative(t)
 	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
 		SampleRate:  44100,
 		NumChannels: 2,
@@ -787,6 +1666,58 @@ func TestGetFrameNum(t *testing.T) {
 	t.Logf("✓ Frame count: %d frames (expected ~%d)", frameNum, expectedFrames)
 }
 
+func TestEncoderOutSampleRate(t *testing.T) {
+	requireNative(t)
+	testCases := []struct {
+		bitrate     int
+		channels    int
+		resampled   bool
+		frameLength int
+	}{
+		{128, 2, false, 1152},
+		{32, 2, true, 576},
+		{8, 1, true, 576},
+	}
+
+	for _, tc := range testCases {
+		t.Run(bitrate2string(tc.bitrate), func(t *testing.T) {
+			encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
+				SampleRate:  44100,
+				NumChannels: tc.channels,
+				Bitrate:     tc.bitrate,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create encoder: %v", err)
+			}
+			defer encoder.Close()
+
+			outRate := encoder.OutSampleRate()
+			if resampled := outRate != 44100; resampled != tc.resampled {
+				t.Errorf("OutSampleRate() = %d, resampled %v, want %v", outRate, resampled, tc.resampled)
+			}
+			if encoder.FrameLength != tc.frameLength {
+				t.Errorf("FrameLength = %d, want %d", encoder.FrameLength, tc.frameLength)
+			}
+			want := time.Duration(tc.frameLength) * time.Second / time.Duration(outRate)
+			if d := encoder.FrameDuration(); d != want {
+				t.Errorf("FrameDuration() = %v, want %v", d, want)
+			}
+
+			// The frame headers carry the same rate and duration
+			mp3Data, _ := encoder.EncodeAppend(nil, generateSineWave(440, 44100, tc.channels, 44100))
+			mp3Data, _ = encoder.FlushAppend(mp3Data)
+			h, err := mp3.ParseFrameHeader(mp3Data)
+			if err != nil {
+				t.Fatalf("ParseFrameHeader failed: %v", err)
+			}
+			if h.SampleRate != outRate || h.Duration() != encoder.FrameDuration() {
+				t.Errorf("Frame header %d Hz %v, want %d Hz %v", h.SampleRate, h.Duration(), outRate, encoder.FrameDuration())
+			}
+			t.Logf("✓ %d kbps: %d Hz, %v per frame", tc.bitrate, outRate, encoder.FrameDuration())
+		})
+	}
+}
+
 // BenchmarkEncode benchmarks encoding performance
 func BenchmarkEncode(b *testing.B) {
 	// Generate 1 second of stereo audio
@@ -849,12 +1780,21 @@ func BenchmarkEncodeFromWav(b *testing.B) {
 		mp3.EncodeFromWav(reader, &mp3Buf, &mp3.EncoderConfig{
 			Bitrate: 128,
 			Quality: 5,
-		})
+		}, nil)
 	}
 }
 
 // Helper functions
 
+// requireNative skips tests that need LAME and mpg123, cgo-free builds only have the
+// registered backends.
+func requireNative(t *testing.T) {
+	t.Helper()
+	if mp3.ActiveBackend() != mp3.BackendNative {
+		t.Skip("libraries not linked")
+	}
+}
+
 // generateSineWave generates PCM data for a sine wave (16-bit signed samples)
 func generateSineWave(freq, sampleRate, channels, numSamples int) []byte {
 	data := make([]byte, numSamples*channels*2) // 2 bytes per sample (16-bit)
@@ -908,3 +1848,606 @@ func generateWavFile(sampleRate, channels, numSamples int) []byte {
 
 	return wavData
 }
+
+// TestEncodeReconfigure tests bitrate changes in the middle of a stream
+func TestEncodeReconfigure(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100*3)
+	chunkSize := 1000 * 4
+
+	encode := func(t *testing.T, switches map[int]*mp3.EncoderConfig) ([]byte, int) {
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{
+			SampleRate:    44100,
+			NumChannels:   2,
+			Bitrate:       128,
+			IsWriteVbrTag: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+
+		var stream []byte
+		for pos := 0; pos < len(pcmData); pos += chunkSize {
+			if c, ok := switches[pos/chunkSize]; ok {
+				if err := encoder.Reconfigure(c); err != nil {
+					t.Fatalf("Reconfigure failed: %v", err)
+				}
+			}
+			chunk := pcmData[pos:min(pos+chunkSize, len(pcmData))]
+			stream, err = encoder.EncodeAppend(stream, chunk)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+		}
+		stream, err = encoder.FlushAppend(stream)
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+
+		tag, err := encoder.GetLameTagFrame()
+		if err != nil {
+			t.Fatalf("GetLameTagFrame failed: %v", err)
+		}
+		h, err := mp3.ParseFrameHeader(stream)
+		if err != nil {
+			t.Fatalf("Invalid first frame: %v", err)
+		}
+		if len(tag) != h.Size {
+			t.Fatalf("Tag frame size %d does not match placeholder size %d", len(tag), h.Size)
+		}
+		copy(stream, tag)
+
+		frames, err := encoder.GetFrameNum()
+		if err != nil {
+			t.Fatalf("GetFrameNum failed: %v", err)
+		}
+		return stream, frames
+	}
+
+	reference, _ := encode(t, nil)
+	refPCM := decodeAll(t, reference)
+
+	testCases := []struct {
+		name        string
+		switches    map[int]*mp3.EncoderConfig
+		lastBitrate int
+	}{
+		{"CBR 64", map[int]*mp3.EncoderConfig{11: {Bitrate: 64}}, 64},
+		{"CBR 64 then 96", map[int]*mp3.EncoderConfig{11: {Bitrate: 64}, 80: {Bitrate: 96}}, 96},
+		{"VBR", map[int]*mp3.EncoderConfig{50: {VbrMode: mp3.VbrModeMtrh, Quality: 6}}, 0},
+		{"End of stream", map[int]*mp3.EncoderConfig{132: {Bitrate: 64}}, 128},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			switched, frames := encode(t, tc.switches)
+
+			// Walk the frames: the Info frame, then frames of each configuration
+			var bitrates []int
+			for pos := 0; pos < len(switched); {
+				h, err := mp3.ParseFrameHeader(switched[pos:])
+				if err != nil {
+					t.Fatalf("Invalid frame at offset %d: %v", pos, err)
+				}
+				bitrates = append(bitrates, h.Bitrate)
+				pos += h.Size
+			}
+			if len(bitrates)-1 != frames {
+				t.Errorf("Frame count mismatch: %d frames in stream, GetFrameNum %d", len(bitrates)-1, frames)
+			}
+			if last := bitrates[len(bitrates)-1]; bitrates[1] != 128 || (tc.lastBitrate > 0 && last != tc.lastBitrate) {
+				t.Errorf("Unexpected bitrates: first %d, last %d", bitrates[1], last)
+			}
+			if info, err := mp3.Probe(bytes.NewReader(switched), int64(len(switched))); err != nil {
+				t.Errorf("Probe failed: %v", err)
+			} else if !info.HasInfoFrame || info.Frames != frames {
+				t.Errorf("Info frame not updated: %+v", info)
+			}
+
+			// The decoded audio must follow the reference without a gap at the switch point
+			switchedPCM := decodeAll(t, switched)
+			if len(refPCM) != len(switchedPCM) {
+				t.Fatalf("Decoded length differs: reference %d, switched %d", len(refPCM), len(switchedPCM))
+			}
+			maxDiff := 0
+			for i := 0; i+1 < len(refPCM); i += 2 {
+				a := int(int16(uint16(refPCM[i]) | uint16(refPCM[i+1])<<8))
+				b := int(int16(uint16(switchedPCM[i]) | uint16(switchedPCM[i+1])<<8))
+				maxDiff = max(maxDiff, abs(a-b))
+			}
+			if maxDiff > 2000 {
+				t.Errorf("Decoded audio deviates from reference by %d", maxDiff)
+			}
+
+			t.Logf("✓ Reconfigure: %d frames, %d -> %d bytes, max deviation %d",
+				frames, len(reference), len(switched), maxDiff)
+		})
+	}
+}
+
+func decodeAll(t *testing.T, data []byte) []byte {
+	t.Helper()
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	pcm, err := decoder.DecodeAppend(nil, data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return pcm
+}
+
+func TestEncodeVBRIHeader(t *testing.T) {
+	requireNative(t)
+	config, err := mp3.ParseConfig("V2,vbri")
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	wav := generateWavFile(44100, 2, 44100*30)
+	var buf mp3.SeekableBuffer
+	result, err := mp3.EncodeFromWav(bytes.NewReader(wav), &buf, config, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	info, err := mp3.Probe(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if info.InfoFrameType != "VBRI" || info.InfoFrames != result.Frames {
+		t.Fatalf("Info frame %q with %d frames, want VBRI with %d", info.InfoFrameType, info.InfoFrames, result.Frames)
+	}
+
+	// VBRI starts 32 bytes after the side information, the seek table after its header
+	vbri := data[36:]
+	if got := int64(binary.BigEndian.Uint32(vbri[10:])); got != int64(len(data)) {
+		t.Errorf("VBRI bytes = %d, want %d", got, len(data))
+	}
+	entries := int(binary.BigEndian.Uint16(vbri[18:]))
+	scale := int64(binary.BigEndian.Uint16(vbri[20:]))
+	framesPerEntry := int(binary.BigEndian.Uint16(vbri[24:]))
+	if entries == 0 || entries > 100 || (entries-1)*framesPerEntry >= result.Frames || entries*framesPerEntry < result.Frames {
+		t.Fatalf("Seek table has %d entries of %d frames for %d frames", entries, framesPerEntry, result.Frames)
+	}
+
+	// Walk the frames of each entry, its size is rounded up to the scale factor
+	h, err := mp3.ParseFrameHeader(data)
+	if err != nil {
+		t.Fatalf("ParseFrameHeader failed: %v", err)
+	}
+	pos := h.Size
+	for i := range entries {
+		size := int64(binary.BigEndian.Uint16(vbri[26+2*i:])) * scale
+		start := pos
+		for k := 0; k < framesPerEntry && pos < len(data); k++ {
+			fh, err := mp3.ParseFrameHeader(data[pos:])
+			if err != nil {
+				t.Fatalf("ParseFrameHeader at %d failed: %v", pos, err)
+			}
+			pos += fh.Size
+		}
+		if got := int64(pos - start); size < got || size >= got+scale {
+			t.Errorf("Entry %d = %d bytes, frames have %d", i, size, got)
+		}
+	}
+	if pos != len(data) {
+		t.Errorf("Seek table covers %d of %d bytes", pos, len(data))
+	}
+
+	if pcm := decodeAll(t, data); len(pcm) == 0 {
+		t.Error("Decoded no audio")
+	}
+	t.Logf("✓ VBRI header: %d frames, %d entries of %d frames, scale %d", result.Frames, entries, framesPerEntry, scale)
+}
+
+func TestEncodeInt16(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	samples := make([]int16, len(pcmData)/2)
+	frames := make([][2]int16, len(samples)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcmData[2*i:]))
+		frames[i/2][i%2] = samples[i]
+	}
+
+	encode := func(fn func(enc *mp3.Encoder, out []byte) (int, error)) []byte {
+		t.Helper()
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		out := make([]byte, encoder.EstimateOutBufBytes(len(pcmData)))
+		n, err := fn(encoder, out)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		data, err := encoder.FlushAppend(out[:n])
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		return data
+	}
+
+	want := encode(func(enc *mp3.Encoder, out []byte) (int, error) { return enc.Encode(pcmData, out) })
+	got := encode(func(enc *mp3.Encoder, out []byte) (int, error) { return enc.EncodeInt16(samples, out) })
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeInt16 output differs from Encode: %d vs %d bytes", len(got), len(want))
+	}
+	got = encode(func(enc *mp3.Encoder, out []byte) (int, error) { return enc.EncodeStereoInt16(frames, out) })
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeStereoInt16 output differs from Encode: %d vs %d bytes", len(got), len(want))
+	}
+
+	mono, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 1})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer mono.Close()
+	if _, err := mono.EncodeStereoInt16(frames, make([]byte, mono.EstimateOutBufBytes(len(pcmData)))); err == nil {
+		t.Error("EncodeStereoInt16 on a mono encoder should fail")
+	}
+	t.Logf("✓ EncodeInt16: %d bytes", len(want))
+}
+
+func TestEncodeInt32(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	samples32 := make([]int32, len(pcmData)/2)
+	samples24 := make([]int32, len(pcmData)/2)
+	for i := range samples32 {
+		v := int32(int16(binary.LittleEndian.Uint16(pcmData[2*i:])))
+		samples32[i], samples24[i] = v<<16, v<<8
+	}
+
+	for _, channels := range []int{1, 2} {
+		config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: channels, Bitrate: 128, FindReplayGain: true}
+		encode := func(fn func(enc *mp3.Encoder, out []byte) (int, error)) ([]byte, float64) {
+			t.Helper()
+			encoder, err := mp3.NewEncoder(config)
+			if err != nil {
+				t.Fatalf("Failed to create encoder: %v", err)
+			}
+			defer encoder.Close()
+			out := make([]byte, encoder.EstimateOutBufBytes(len(pcmData)))
+			n, err := fn(encoder, out)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			data, err := encoder.FlushAppend(out[:n])
+			if err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			_, peak, err := encoder.ReplayGain()
+			if err != nil {
+				t.Fatalf("ReplayGain failed: %v", err)
+			}
+			return data, peak
+		}
+
+		// The same samples in 16, 24 and 32 bits are encoded identically
+		want, wantPeak := encode(func(enc *mp3.Encoder, out []byte) (int, error) { return enc.Encode(pcmData, out) })
+		got, peak := encode(func(enc *mp3.Encoder, out []byte) (int, error) { return enc.EncodeInt32(samples32, out) })
+		if !bytes.Equal(got, want) || peak != wantPeak {
+			t.Errorf("%d channels: EncodeInt32 output differs from Encode: %d vs %d bytes, peak %f vs %f", channels, len(got), len(want), peak, wantPeak)
+		}
+		got, peak = encode(func(enc *mp3.Encoder, out []byte) (int, error) { return enc.EncodeInt24(samples24, out) })
+		if !bytes.Equal(got, want) || peak != wantPeak {
+			t.Errorf("%d channels: EncodeInt24 output differs from Encode: %d vs %d bytes, peak %f vs %f", channels, len(got), len(want), peak, wantPeak)
+		}
+	}
+
+	// Formats can not be mixed while an incomplete sample frame is held back
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	out := make([]byte, encoder.EstimateOutBufBytes(len(pcmData)))
+	if _, err := encoder.EncodeInt32(samples32[:3], out); err != nil {
+		t.Fatalf("EncodeInt32 failed: %v", err)
+	}
+	if _, err := encoder.Encode(pcmData, out); err == nil {
+		t.Error("Encode after an incomplete 32-bit sample frame should fail")
+	}
+	t.Logf("✓ EncodeInt32 and EncodeInt24 match 16-bit encoding")
+}
+
+func TestEncodePlanar(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	left := make([]byte, 0, len(pcmData)/2)
+	right := make([]byte, 0, len(pcmData)/2)
+	for i := 0; i < len(pcmData); i += 4 {
+		left = append(left, pcmData[i:i+2]...)
+		right = append(right, pcmData[i+2:i+4]...)
+	}
+
+	encode := func(fn func(enc *mp3.Encoder, out []byte) ([]byte, error)) []byte {
+		t.Helper()
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		data, err := fn(encoder, nil)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		data, err = encoder.FlushAppend(data)
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		return data
+	}
+
+	want := encode(func(enc *mp3.Encoder, dst []byte) ([]byte, error) { return enc.EncodeAppend(dst, pcmData) })
+	got := encode(func(enc *mp3.Encoder, dst []byte) ([]byte, error) {
+		// Chunks of 1001 samples per channel
+		for pos := 0; pos < len(left); pos += 2002 {
+			end := min(pos+2002, len(left))
+			out := make([]byte, enc.EstimateOutBufBytes(2*(end-pos)))
+			n, err := enc.EncodePlanar(left[pos:end], right[pos:end], out)
+			if err != nil {
+				return nil, err
+			}
+			dst = append(dst, out[:n]...)
+		}
+		return dst, nil
+	})
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodePlanar output differs from Encode: %d vs %d bytes", len(got), len(want))
+	}
+
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	out := make([]byte, encoder.EstimateOutBufBytes(len(pcmData)))
+	if _, err := encoder.EncodePlanar(left, right[:100], out); err == nil {
+		t.Error("EncodePlanar with channels of different length should fail")
+	}
+	t.Logf("✓ EncodePlanar: %d bytes", len(got))
+}
+
+func TestEncodeSamples(t *testing.T) {
+	requireNative(t)
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	numSamples := len(pcmData) / 2
+	formats := map[mp3.SampleFormat][]byte{
+		mp3.S16LE: pcmData,
+		mp3.S24LE: make([]byte, 3*numSamples),
+		mp3.S32LE: make([]byte, 4*numSamples),
+		mp3.F32:   make([]byte, 4*numSamples),
+	}
+	for i := range numSamples {
+		v := int32(int16(binary.LittleEndian.Uint16(pcmData[2*i:])))
+		s24 := formats[mp3.S24LE][3*i:]
+		s24[0], s24[1], s24[2] = byte(v<<8), byte(v), byte(v>>8)
+		binary.LittleEndian.PutUint32(formats[mp3.S32LE][4*i:], uint32(v<<16))
+		binary.LittleEndian.PutUint32(formats[mp3.F32][4*i:], math.Float32bits(float32(v)/32768))
+	}
+
+	encode := func(format mp3.SampleFormat, in []byte) []byte {
+		t.Helper()
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		out := make([]byte, encoder.EstimateOutBufBytes(2*numSamples))
+		n, err := encoder.EncodeSamples(format, in, out)
+		if err != nil {
+			t.Fatalf("EncodeSamples(%v) failed: %v", format, err)
+		}
+		data, err := encoder.FlushAppend(out[:n])
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		return data
+	}
+
+	want := encode(mp3.S16LE, pcmData)
+	wantPCM := decodeAll(t, want)
+	for format, in := range formats {
+		if format.BytesPerSample()*numSamples != len(in) {
+			t.Errorf("%v: BytesPerSample = %d", format, format.BytesPerSample())
+		}
+		got := encode(format, in)
+		if format != mp3.F32 {
+			// Integer samples of the same values are encoded identically
+			if !bytes.Equal(got, want) {
+				t.Errorf("%v: output differs from S16LE: %d vs %d bytes", format, len(got), len(want))
+			}
+			continue
+		}
+
+		// LAME scales float samples itself, the result is close but not identical
+		gotPCM := decodeAll(t, got)
+		diff := make([]byte, min(len(gotPCM), len(wantPCM)))
+		for i := 0; i+1 < len(diff); i += 2 {
+			d := int16(binary.LittleEndian.Uint16(gotPCM[i:])) - int16(binary.LittleEndian.Uint16(wantPCM[i:]))
+			binary.LittleEndian.PutUint16(diff[i:], uint16(d))
+		}
+		if r := rms(diff) / rms(wantPCM); r > 0.01 {
+			t.Errorf("F32: decoded output differs from S16LE by %.4f of its RMS", r)
+		}
+	}
+
+	var format mp3.SampleFormat
+	if err := format.UnmarshalText([]byte("S24LE")); err != nil || format != mp3.S24LE {
+		t.Errorf("UnmarshalText = %v, %v", format, err)
+	}
+	if text, _ := mp3.F32.MarshalText(); string(text) != "f32" {
+		t.Errorf("MarshalText = %s", text)
+	}
+	t.Logf("✓ EncodeSamples: %d formats", len(formats))
+}
+
+func TestEncodeAll(t *testing.T) {
+	requireNative(t)
+	config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, VbrMode: mp3.VbrModeMtrh, Quality: 2, IsWriteVbrTag: true}
+	wav := generateWavFile(44100, 2, 44100)
+
+	var want mp3.SeekableBuffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &want, config, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	encoder, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	got, err := encoder.EncodeAll(wav[mp3.WavHeaderSize:])
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	// The placeholder is replaced by the final Xing/LAME tag
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("EncodeAll output differs from EncodeFromWav: %d vs %d bytes", len(got), want.Len())
+	}
+
+	// The ReplayGain frames are written to the ID3v2 tag as by EncodeFromWav
+	rgConfig := *config
+	rgConfig.FindReplayGain = true
+	rgConfig.Tags = &mp3.TrackTags{Title: "Gain"}
+	want.Reset()
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &want, &rgConfig, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	rgEncoder, err := mp3.NewEncoder(&rgConfig)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer rgEncoder.Close()
+	rgGot, err := rgEncoder.EncodeAll(wav[mp3.WavHeaderSize:])
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	tag, err := mp3.ReadID3v2(bytes.NewReader(rgGot))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	gain, peak, ok := tag.ReplayGain()
+	wantGain, wantPeak, _ := rgEncoder.ReplayGain()
+	if !ok || tag.Text("TIT2") != "Gain" || math.Abs(gain-wantGain) > 0.01 || math.Abs(peak-wantPeak) > 1e-4 {
+		t.Errorf("Tag: title %q, ReplayGain %.2f dB peak %.4f (%v), want %.2f dB peak %.4f",
+			tag.Text("TIT2"), gain, peak, ok, wantGain, wantPeak)
+	}
+	if !bytes.Equal(rgGot, want.Bytes()) {
+		t.Errorf("EncodeAll output with ReplayGain differs from EncodeFromWav: %d vs %d bytes", len(rgGot), want.Len())
+	}
+	t.Logf("✓ EncodeAll: %d bytes, %d with ReplayGain %.2f dB", len(got), len(rgGot), gain)
+}
+
+func TestEncoderReset(t *testing.T) {
+	requireNative(t)
+	stereo := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 192, IsWriteVbrTag: true}
+	mono := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64, IsWriteVbrTag: true}
+	stereoPCM := generateWavFile(44100, 2, 44100)[mp3.WavHeaderSize:]
+	monoPCM := generateWavFile(22050, 1, 22050)[mp3.WavHeaderSize:]
+
+	fresh := func(c *mp3.EncoderConfig, pcm []byte) []byte {
+		encoder, err := mp3.NewEncoder(c)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		out, err := encoder.EncodeAll(pcm)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		return out
+	}
+
+	encoder, err := mp3.NewEncoder(stereo)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	// Leave unflushed data behind, Reset discards it
+	if _, err := encoder.Encode(stereoPCM[:1000], make([]byte, encoder.EstimateOutBufBytes(1000))); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := encoder.Reset(mono); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if encoder.NumChannels != 1 {
+		t.Errorf("NumChannels = %d after Reset, want 1", encoder.NumChannels)
+	}
+	got, err := encoder.EncodeAll(monoPCM)
+	if err != nil {
+		t.Fatalf("EncodeAll after Reset failed: %v", err)
+	}
+	if !bytes.Equal(got, fresh(mono, monoPCM)) {
+		t.Error("output after Reset differs from a new encoder")
+	}
+
+	// A rejected config leaves the encoder as it was
+	if err := encoder.Reset(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 3}); err == nil {
+		t.Error("Reset with 3 channels succeeded")
+	}
+	if err := encoder.Reset(stereo); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	got, err = encoder.EncodeAll(stereoPCM)
+	if err != nil {
+		t.Fatalf("EncodeAll after Reset failed: %v", err)
+	}
+	if !bytes.Equal(got, fresh(stereo, stereoPCM)) {
+		t.Error("output after second Reset differs from a new encoder")
+	}
+
+	encoder.Close()
+	if err := encoder.Reset(stereo); err == nil {
+		t.Error("Reset on closed encoder succeeded")
+	}
+	t.Logf("✓ Reset: reused encoder matches new encoders")
+}
+
+func TestEncoderDelayPadding(t *testing.T) {
+	requireNative(t)
+	const samples = 30000
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	if encoder.Padding() != 0 {
+		t.Errorf("Padding = %d before Flush, want 0", encoder.Padding())
+	}
+	if _, err := encoder.EncodeAll(generateWavFile(44100, 2, samples)[mp3.WavHeaderSize:]); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	frames, err := encoder.GetFrameNum()
+	if err != nil {
+		t.Fatalf("GetFrameNum failed: %v", err)
+	}
+
+	delay, padding := encoder.Delay(), encoder.Padding()
+	if delay <= 0 || padding < 0 || padding >= 2*encoder.FrameLength {
+		t.Errorf("Delay = %d, Padding = %d", delay, padding)
+	}
+	// The frames hold exactly the delay, the audio and the padding
+	if got := delay + samples + padding; got != frames*encoder.FrameLength {
+		t.Errorf("delay + samples + padding = %d, %d frames hold %d samples", got, frames, frames*encoder.FrameLength)
+	}
+
+	var out mp3.SeekableBuffer
+	result, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, samples)), &out, &mp3.EncoderConfig{Bitrate: 128}, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	if result.Delay != delay || result.Padding != padding {
+		t.Errorf("EncodeResult delay %d padding %d, want %d and %d", result.Delay, result.Padding, delay, padding)
+	}
+	t.Logf("✓ Delay %d, Padding %d samples", delay, padding)
+}
@@ -0,0 +1,113 @@
+package mp3
+
+import (
+	"errors"
+	"slices"
+)
+
+// minAppendFrameBytes is a typical small frame size (32 kbps at 44.1 kHz), used to size
+// DecodeAppend's buffer for the frames contained in the input.
+const minAppendFrameBytes = 104
+
+// EncodeAppend encodes PCM audio data like Encode and appends the mp3 data to dst,
+// growing it as needed. It returns the extended slice; dst may be nil.
+func (enc *Encoder) EncodeAppend(dst, in []byte) ([]byte, error) {
+	return appendGrowing(dst, enc.EstimateOutBufBytes(len(in)), func(out []byte) (int, error) {
+		return enc.Encode(in, out)
+	})
+}
+
+// FlushAppend flushes the encoder like Flush and appends the remaining mp3 data to dst,
+// growing it as needed. It returns the extended slice; dst may be nil.
+func (enc *Encoder) FlushAppend(dst []byte) ([]byte, error) {
+	return appendGrowing(dst, enc.EstimateOutBufBytes(0), enc.Flush)
+}
+
+// EncodeAll encodes all of in, flushes the encoder and returns the mp3 data in one slice,
+// for one-shot conversions. If the encoder writes a Xing/LAME tag, the final tag replaces
+// its placeholder frame at the start. The ID3v2 tag of EncoderConfig.Tags is written in
+// front of the audio, and the ID3v1 tag after it with WriteID3v1. With FindReplayGain the
+// ReplayGain frames are added to the ID3v2 tag, like EncodeFromWav does.
+// The encoder can not encode further data afterwards.
+func (enc *Encoder) EncodeAll(in []byte) ([]byte, error) {
+	var (
+		id3   []byte
+		rgTag *ID3v2Tag // ID3v2 tag to rewrite with the ReplayGain results
+	)
+	if enc.tags != nil || enc.replayGainEnabled() {
+		tag := NewID3v2Tag()
+		if enc.tags != nil {
+			var err error
+			if tag, err = enc.tags.ID3v2Tag(); err != nil {
+				return nil, err
+			}
+		}
+		// Reserve space for the ReplayGain frames, the tag is rewritten once analysis completes
+		if enc.replayGainEnabled() {
+			rgTag = tag
+			rgTag.SetReplayGain(0, 0)
+			rgTag.Padding = replayGainTagPadding
+		}
+		id3 = tag.Bytes()
+	}
+	out := make([]byte, 0, len(id3)+enc.EstimateOutBufBytes(len(in))+enc.EstimateOutBufBytes(0))
+	out = append(out, id3...)
+	var err error
+	if len(in) > 0 {
+		if out, err = enc.EncodeAppend(out, in); err != nil {
+			return nil, err
+		}
+	}
+	if out, err = enc.FlushAppend(out); err != nil {
+		return nil, err
+	}
+	if rgTag != nil {
+		gain, peak, err := enc.ReplayGain()
+		if err != nil {
+			return nil, err
+		}
+		rgTag.SetReplayGain(gain, peak)
+		tagData, err := rgTag.BytesWithSize(len(id3))
+		if err != nil {
+			return nil, err
+		}
+		copy(out, tagData)
+	}
+	tag, err := enc.GetLameTagFrame()
+	if err != nil {
+		return nil, err
+	}
+	if len(id3)+len(tag) <= len(out) {
+		copy(out[len(id3):], tag)
+	}
+	if enc.id3v1 {
+		out = append(out, enc.tags.ID3v1Tag()...)
+	}
+	return out, nil
+}
+
+// DecodeAppend decodes mp3 data like Decode and appends the PCM data to dst,
+// growing it as needed. It returns the extended slice; dst may be nil.
+func (d *Decoder) DecodeAppend(dst, in []byte) ([]byte, error) {
+	return appendGrowing(dst, d.EstimateOutBufBytes(EstimateFrames+len(in)/minAppendFrameBytes), func(out []byte) (int, error) {
+		return d.Decode(in, out)
+	})
+}
+
+// appendGrowing calls fn with size bytes of spare capacity at the end of dst, and retries
+// once with the required size if fn reports a ShortBufferError.
+func appendGrowing(dst []byte, size int, fn func(out []byte) (int, error)) ([]byte, error) {
+	for retry := true; ; retry = false {
+		dst = slices.Grow(dst, size)
+		n, err := fn(dst[len(dst) : len(dst)+size])
+		var short *ShortBufferError
+		if retry && errors.As(err, &short) {
+			size = short.Required
+			continue
+		}
+		if err != nil {
+			return dst, err
+		}
+		return dst[:len(dst)+n], nil
+	}
+}
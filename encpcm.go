@@ -0,0 +1,199 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// SampleFormat is the layout of interleaved PCM samples passed to EncodeSamples.
+// All formats are little-endian.
+type SampleFormat int
+
+const (
+	S16LE SampleFormat = iota // 16-bit signed, as taken by Encode
+	S24LE                     // 24-bit signed, packed in 3 bytes
+	S32LE                     // 32-bit signed
+	F32                       // 32-bit float, full scale is -1.0 to 1.0
+)
+
+var sampleFormatNames = map[SampleFormat]string{
+	S16LE: "s16le",
+	S24LE: "s24le",
+	S32LE: "s32le",
+	F32:   "f32",
+}
+
+func (f SampleFormat) String() string {
+	if name, ok := sampleFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("SampleFormat(%d)", int(f))
+}
+
+// MarshalText encodes the format as "s16le", "s24le", "s32le" or "f32".
+func (f SampleFormat) MarshalText() ([]byte, error) {
+	name, ok := sampleFormatNames[f]
+	if !ok {
+		return nil, fmt.Errorf("%w: sample format %d", ErrorInvalidConfig, int(f))
+	}
+	return []byte(name), nil
+}
+
+func (f *SampleFormat) UnmarshalText(text []byte) error {
+	for format, name := range sampleFormatNames {
+		if strings.EqualFold(string(text), name) {
+			*f = format
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: sample format %q", ErrorInvalidConfig, text)
+}
+
+// BytesPerSample returns the size of one sample of one channel.
+func (f SampleFormat) BytesPerSample() int {
+	return f.pcm().size()
+}
+
+func (f SampleFormat) pcm() pcmFormat {
+	switch f {
+	case S24LE:
+		return pcmS24
+	case S32LE:
+		return pcmS32
+	case F32:
+		return pcmF32
+	}
+	return pcmS16
+}
+
+// EncodeSamples encodes interleaved samples of the given format like Encode, which takes S16LE.
+// out must hold at least EstimateOutBufBytes of the size of the samples in 16 bits.
+// The format must not change while Encode holds back an incomplete sample frame or
+// batched samples. The Go backend is passed the samples converted to 16 bits with TPDF dither.
+func (enc *Encoder) EncodeSamples(format SampleFormat, in, out []byte) (n int, err error) {
+	if _, ok := sampleFormatNames[format]; !ok {
+		return 0, fmt.Errorf("unsupported sample format: %d", int(format))
+	}
+	return enc.encode(in, out, format.pcm())
+}
+
+// pcmFormat is the layout of the interleaved PCM passed to the encoder. Samples passed as
+// Go integers are in host byte order, which is little-endian on all supported platforms.
+type pcmFormat int
+
+const (
+	pcmS16     pcmFormat = iota // 16-bit samples
+	pcmS32                      // 32-bit samples
+	pcmS24In32                  // 24-bit samples in the low bits of 32-bit words
+	pcmS24                      // 24-bit samples packed in 3 bytes
+	pcmF32                      // float samples
+)
+
+// size returns the bytes per sample.
+func (f pcmFormat) size() int {
+	switch f {
+	case pcmS16:
+		return 2
+	case pcmS24:
+		return 3
+	}
+	return 4
+}
+
+// sample returns the sample at the start of b scaled to 32 bits.
+func (f pcmFormat) sample(b []byte) int32 {
+	switch f {
+	case pcmS32:
+		return int32(binary.NativeEndian.Uint32(b))
+	case pcmS24In32:
+		return int32(binary.NativeEndian.Uint32(b)) << 8
+	case pcmS24:
+		return int32(uint32(b[0])<<8 | uint32(b[1])<<16 | uint32(b[2])<<24)
+	case pcmF32:
+		v := float64(math.Float32frombits(binary.NativeEndian.Uint32(b)))
+		return int32(min(max(math.Round(v*(1<<31)), math.MinInt32), math.MaxInt32))
+	}
+	return int32(int16(binary.NativeEndian.Uint16(b))) << 16
+}
+
+// EncodeInt16 encodes interleaved 16-bit samples like Encode, for callers that capture into
+// []int16 buffers. The samples are passed on as they are, without conversion.
+func (enc *Encoder) EncodeInt16(in []int16, out []byte) (n int, err error) {
+	return enc.Encode(int16Bytes(in), out)
+}
+
+// EncodeStereoInt16 encodes sample frames of a left and a right sample like Encode.
+// The encoder must be configured for two input channels.
+func (enc *Encoder) EncodeStereoInt16(in [][2]int16, out []byte) (n int, err error) {
+	if enc.NumChannels != 2 {
+		return 0, errors.New("stereo input requires an encoder with 2 channels")
+	}
+	return enc.Encode(unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(in))), 4*len(in)), out)
+}
+
+// EncodePlanar encodes 16-bit samples held in separate channel buffers, as in DSP graphs
+// and plugin hosts. left and right must hold the same number of samples; right must be
+// empty for a mono encoder. The channels are interleaved into a buffer owned by the encoder,
+// so no buffer has to be prepared for each call. Otherwise it is like Encode.
+func (enc *Encoder) EncodePlanar(left, right, out []byte) (n int, err error) {
+	if enc.NumChannels == 1 {
+		if len(right) > 0 {
+			return 0, errors.New("planar input for a mono encoder has no right channel")
+		}
+		return enc.Encode(left, out)
+	}
+	if len(left) != len(right) || len(left)%2 != 0 {
+		return 0, fmt.Errorf("planar channels must hold the same number of samples: %d and %d bytes", len(left), len(right))
+	}
+	in := slices.Grow(enc.planarBuf[:0], 2*len(left))[:2*len(left)]
+	for i := 0; i+1 < len(left); i += 2 {
+		in[2*i], in[2*i+1] = left[i], left[i+1]
+		in[2*i+2], in[2*i+3] = right[i], right[i+1]
+	}
+	enc.planarBuf = in
+	return enc.Encode(in, out)
+}
+
+// EncodeInt32 encodes interleaved 32-bit samples (full scale is the int32 range) without
+// reducing them to 16 bits first. out must hold at least EstimateOutBufBytes(2*len(in)) bytes,
+// the size of the same samples in 16 bits.
+// Samples must not be mixed with other formats while Encode holds back an incomplete
+// sample frame or batched samples. The Go backend is passed the samples rounded to 16 bits.
+func (enc *Encoder) EncodeInt32(in []int32, out []byte) (n int, err error) {
+	return enc.encode(int32Bytes(in), out, pcmS32)
+}
+
+// EncodeInt24 encodes interleaved 24-bit samples, stored sign-extended in the low bits of
+// 32-bit words as in most 24-bit audio interfaces and WAV readers. Otherwise it is like EncodeInt32.
+func (enc *Encoder) EncodeInt24(in []int32, out []byte) (n int, err error) {
+	return enc.encode(int32Bytes(in), out, pcmS24In32)
+}
+
+// int16Bytes returns the memory of samples as bytes in host order, which is the sample
+// layout Encode passes to the encoder.
+func int16Bytes(samples []int16) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(samples))), 2*len(samples))
+}
+
+func int32Bytes(samples []int32) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(samples))), 4*len(samples))
+}
+
+// pcmToS16 converts samples of format to 16 bits with TPDF dither, so the rounding error
+// of quiet passages becomes noise instead of distortion.
+func pcmToS16(in []byte, format pcmFormat) []byte {
+	size := format.size()
+	out := make([]byte, len(in)/size*2)
+	for i := 0; i+size <= len(in); i += size {
+		dither := rand.Float64() - rand.Float64()
+		v := math.Round(float64(format.sample(in[i:]))/65536 + dither)
+		binary.NativeEndian.PutUint16(out[i/size*2:], uint16(int16(min(max(v, math.MinInt16), math.MaxInt16))))
+	}
+	return out
+}
@@ -0,0 +1,175 @@
+package mp3
+
+import (
+	"sync"
+)
+
+const (
+	// DefaultEncoderPoolIdle is the number of idle encoders an EncoderPool keeps per config
+	// if NewEncoderPool is called with maxIdle 0.
+	DefaultEncoderPoolIdle = 4
+
+	// DefaultEncoderPoolTotalIdle is the default of EncoderPool.MaxTotalIdle.
+	DefaultEncoderPoolTotalIdle = 64
+)
+
+// EncoderPool recycles encoders, e.g. for a server that encodes many short clips with a
+// few configurations. Get hands out an idle encoder of the config if there is one; Put
+// resets the encoder for the next stream and keeps it. LAME can not restart a handle
+// without carrying state over into the next stream, so Put sets up a new one with
+// Encoder.Reset: this costs about as much as NewEncoder, the pool only saves the Go side
+// of the encoder and moves the setup from Get to Put (see the benchmarks in package bench).
+// Encoders are pooled by the config without Tags and WriteID3v1,
+// which are applied by Get, so clips with their own tags share the encoders.
+// EncoderPool is safe for concurrent use; the encoders are not, like any Encoder.
+type EncoderPool struct {
+	// MaxTotalIdle limits the idle encoders of all configs together, the oldest config's
+	// encoders are closed first to make room. 0 selects DefaultEncoderPoolTotalIdle.
+	// Set it before the first Get.
+	MaxTotalIdle int
+
+	mu        sync.Mutex
+	maxIdle   int
+	idle      map[EncoderConfig][]*Encoder
+	order     []EncoderConfig            // keys of idle, in the order they got idle encoders
+	totalIdle int                        // encoders in idle
+	configs   map[*Encoder]EncoderConfig // encoders handed out by Get
+	closed    bool
+}
+
+// NewEncoderPool creates a pool that keeps up to maxIdle idle encoders per config,
+// 0 selects DefaultEncoderPoolIdle.
+func NewEncoderPool(maxIdle int) *EncoderPool {
+	if maxIdle <= 0 {
+		maxIdle = DefaultEncoderPoolIdle
+	}
+	return &EncoderPool{
+		maxIdle: maxIdle,
+		idle:    map[EncoderConfig][]*Encoder{},
+		configs: map[*Encoder]EncoderConfig{},
+	}
+}
+
+// Get returns an encoder for a new stream with config c (nil or zero values use the
+// defaults as in NewEncoder). Return it with Put when the stream is done.
+func (p *EncoderPool) Get(c *EncoderConfig) (*Encoder, error) {
+	config := populateEncConfig(c)
+	key := *config
+	key.Tags = nil
+	key.WriteID3v1 = false
+
+	p.mu.Lock()
+	enc := p.take(key)
+	p.mu.Unlock()
+	if enc == nil {
+		var err error
+		if enc, err = NewEncoder(&key); err != nil {
+			return nil, err
+		}
+	}
+	enc.tags = config.Tags
+	enc.id3v1 = config.WriteID3v1
+
+	p.mu.Lock()
+	p.configs[enc] = key
+	p.mu.Unlock()
+	return enc, nil
+}
+
+// take removes an idle encoder of key from the pool, nil if there is none.
+func (p *EncoderPool) take(key EncoderConfig) *Encoder {
+	list := p.idle[key]
+	if len(list) == 0 {
+		return nil
+	}
+	enc := list[len(list)-1]
+	p.setIdle(key, list[:len(list)-1])
+	return enc
+}
+
+// setIdle sets the idle encoders of key, deleting the key when there are none left.
+func (p *EncoderPool) setIdle(key EncoderConfig, list []*Encoder) {
+	p.totalIdle += len(list) - len(p.idle[key])
+	if len(list) > 0 {
+		p.idle[key] = list
+		return
+	}
+	delete(p.idle, key)
+	for i, k := range p.order {
+		if k == key {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (p *EncoderPool) maxTotalIdle() int {
+	if p.MaxTotalIdle > 0 {
+		return p.MaxTotalIdle
+	}
+	return DefaultEncoderPoolTotalIdle
+}
+
+// Put returns an encoder obtained from Get, unflushed data is discarded. The encoder must
+// not be used afterwards. Encoders that are not from Get, that can not be reset, e.g.
+// after Close, or that exceed the idle limit are closed.
+func (p *EncoderPool) Put(enc *Encoder) {
+	p.mu.Lock()
+	key, ok := p.configs[enc]
+	delete(p.configs, enc)
+	p.mu.Unlock()
+	if !ok {
+		enc.Close()
+		return
+	}
+
+	enc.SetFrameLogger(nil)
+	if err := enc.Reset(&key); err != nil {
+		enc.Close()
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed || len(p.idle[key]) >= p.maxIdle {
+		p.mu.Unlock()
+		enc.Close()
+		return
+	}
+	// Make room by closing an encoder of the config put least recently
+	var evicted *Encoder
+	if p.totalIdle >= p.maxTotalIdle() {
+		if len(p.order) == 0 || p.order[0] == key {
+			p.mu.Unlock()
+			enc.Close()
+			return
+		}
+		evicted = p.take(p.order[0])
+	}
+	list := p.idle[key]
+	p.setIdle(key, append(list, enc))
+	if len(list) == 0 {
+		p.order = append(p.order, key)
+	}
+	p.mu.Unlock()
+	if evicted != nil {
+		evicted.Close()
+	}
+}
+
+// Close closes the idle encoders, encoders returned to the pool later are closed by Put.
+// Get still works, but no encoders are recycled.
+func (p *EncoderPool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = map[EncoderConfig][]*Encoder{}
+	p.order = nil
+	p.totalIdle = 0
+	p.closed = true
+	p.mu.Unlock()
+
+	for _, list := range idle {
+		for _, enc := range list {
+			enc.Close()
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package mp3_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestEncoderPool(t *testing.T) {
+	requireNative(t)
+	pool := mp3.NewEncoderPool(1)
+	defer pool.Close()
+	config := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64}
+	clip := generateNoise(1, 11025)
+
+	fresh, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	want, err := fresh.EncodeAll(clip)
+	fresh.Close()
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	first, err := pool.Get(config)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	// Leave data unflushed, Put discards it
+	if _, err := first.Encode(clip, make([]byte, first.EstimateOutBufBytes(len(clip)))); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	pool.Put(first)
+
+	// Encoders are pooled by the config value
+	enc, err := pool.Get(&mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if enc != first {
+		t.Error("Get did not reuse the idle encoder")
+	}
+	got, err := enc.EncodeAll(clip)
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("Recycled encoder output differs from a new encoder")
+	}
+
+	// A second encoder exceeds the idle limit and is closed
+	other, err := pool.Get(config)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if other == enc {
+		t.Fatal("Get returned an encoder in use")
+	}
+	pool.Put(enc)
+	pool.Put(other)
+	if _, err := other.EncodeAll(clip); err == nil {
+		t.Error("Encoder beyond the idle limit not closed")
+	}
+	t.Logf("✓ EncoderPool")
+}
+
+func TestEncoderPoolTags(t *testing.T) {
+	requireNative(t)
+	pool := mp3.NewEncoderPool(1)
+	pool.MaxTotalIdle = 1
+	defer pool.Close()
+	clip := generateNoise(1, 11025)
+
+	// Clips with their own tags share the encoders of the config
+	var first *mp3.Encoder
+	for _, title := range []string{"First", "Second"} {
+		config := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64, Tags: &mp3.TrackTags{Title: title}}
+		enc, err := pool.Get(config)
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		if first == nil {
+			first = enc
+		} else if enc != first {
+			t.Error("Get did not reuse the encoder of a clip with other tags")
+		}
+		out, err := enc.EncodeAll(clip)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		tag, err := mp3.ReadID3v2(bytes.NewReader(out))
+		if err != nil || tag.Text("TIT2") != title {
+			t.Errorf("Tag of clip %q = %v, %v", title, tag, err)
+		}
+		pool.Put(enc)
+	}
+
+	// An untagged Get does not inherit the tags
+	enc, err := pool.Get(&mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if out, _ := enc.EncodeAll(clip); bytes.HasPrefix(out, []byte("ID3")) {
+		t.Error("Untagged clip got the tag of the previous clip")
+	}
+	pool.Put(enc)
+
+	// MaxTotalIdle closes the idle encoder of the other config
+	other, err := pool.Get(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	pool.Put(other)
+	if _, err := enc.EncodeAll(clip); err == nil {
+		t.Error("Encoder of the older config not closed")
+	}
+	if again, err := pool.Get(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128}); err != nil || again != other {
+		t.Errorf("Idle encoder of the newer config not kept: %v", err)
+	}
+	t.Logf("✓ EncoderPool shares encoders across tags")
+}
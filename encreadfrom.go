@@ -0,0 +1,136 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SetOutput sets the writer ReadFrom writes the mp3 data to.
+func (enc *Encoder) SetOutput(w io.Writer) {
+	enc.output = w
+}
+
+// ReadFrom encodes interleaved 16-bit PCM read from r until EOF, e.g. from a capture device
+// or a pipe, and writes the mp3 data to the writer set with SetOutput. Short reads and
+// sample frames split across reads are handled. At EOF the encoder is flushed, and like
+// EncodeAll the ID3v2 tag of EncoderConfig.Tags is written in front of the audio and the
+// ID3v1 tag after it with WriteID3v1. If the output is an io.WriteSeeker, the final
+// Xing/LAME tag replaces its placeholder frame, and with FindReplayGain the ReplayGain
+// frames are added to the ID3v2 tag. It returns the number of PCM bytes read.
+// The encoder can not encode further data afterwards.
+func (enc *Encoder) ReadFrom(r io.Reader) (int64, error) {
+	w := enc.output
+	if w == nil {
+		return 0, errors.New("no output writer set, see SetOutput")
+	}
+	seeker, _ := w.(io.WriteSeeker)
+	var tagStart int64
+	if seeker != nil {
+		var err error
+		if tagStart, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			seeker = nil
+		}
+	}
+
+	var (
+		id3   []byte
+		rgTag *ID3v2Tag // ID3v2 tag to rewrite with the ReplayGain results
+	)
+	if enc.tags != nil || (seeker != nil && enc.replayGainEnabled()) {
+		tag := NewID3v2Tag()
+		if enc.tags != nil {
+			var err error
+			if tag, err = enc.tags.ID3v2Tag(); err != nil {
+				return 0, err
+			}
+		}
+		// Reserve space for the ReplayGain frames, the tag is rewritten once analysis completes
+		if seeker != nil && enc.replayGainEnabled() {
+			rgTag = tag
+			rgTag.SetReplayGain(0, 0)
+			rgTag.Padding = replayGainTagPadding
+		}
+		id3 = tag.Bytes()
+		if _, err := w.Write(id3); err != nil {
+			return 0, err
+		}
+	}
+	// The Xing/LAME tag frame is the first frame of the audio
+	start := tagStart + int64(len(id3))
+
+	in := make([]byte, writerChunkSize)
+	out := GetOutBuf(enc.EstimateOutBufBytes(len(in)))
+	defer PutOutBuf(out)
+	var total int64
+	for {
+		n, readErr := r.Read(in)
+		if n > 0 {
+			total += int64(n)
+			m, err := enc.Encode(in[:n], out)
+			if err != nil {
+				return total, err
+			}
+			if _, err := w.Write(out[:m]); err != nil {
+				return total, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return total, readErr
+		}
+	}
+
+	n, err := enc.Flush(out)
+	if err != nil {
+		return total, err
+	}
+	if _, err := w.Write(out[:n]); err != nil {
+		return total, err
+	}
+	if enc.id3v1 {
+		if _, err := w.Write(enc.tags.ID3v1Tag()); err != nil {
+			return total, err
+		}
+	}
+	if rgTag != nil {
+		gain, peak, err := enc.ReplayGain()
+		if err != nil {
+			return total, err
+		}
+		rgTag.SetReplayGain(gain, peak)
+		tagData, err := rgTag.BytesWithSize(len(id3))
+		if err != nil {
+			return total, err
+		}
+		if err := writeAt(seeker, tagData, tagStart); err != nil {
+			return total, fmt.Errorf("write ReplayGain tag failed: %w", err)
+		}
+	}
+	if seeker != nil {
+		tag, err := enc.GetLameTagFrame()
+		if err != nil {
+			return total, err
+		}
+		if len(tag) > 0 {
+			if err := writeAt(seeker, tag, start); err != nil {
+				return total, fmt.Errorf("write Xing/LAME tag failed: %w", err)
+			}
+		}
+	}
+	return total, nil
+}
+
+// writeAt writes b at offset of w and seeks back to the end.
+func writeAt(w io.WriteSeeker, b []byte, offset int64) error {
+	if _, err := w.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err := w.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,68 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors shared by Encoder and Decoder, wrapped with the type of the closed object.
+var (
+	ErrorClosed     = errors.New("closed")
+	ErrorEmptyInput = errors.New("input buffer is empty")
+)
+
+// Library identifies the C library that reported an Error.
+type Library string
+
+const (
+	LibraryLame   Library = "lame"
+	LibraryMpg123 Library = "mpg123"
+)
+
+// Error is an error reported by LAME or mpg123. A registered DecoderBackend or
+// EncoderBackend may return one as well, Decode and Encode set its Offset.
+//
+// Where the code has a package-level equivalent, e.g. ErrorBufferTooSmall, ErrorMalloc or
+// ErrorNoFrameSync, errors.Is matches it. errors.Is also matches an *Error target with the same Library and Code:
+//
+//	errors.Is(err, &mp3.Error{Library: mp3.LibraryMpg123, Code: code})
+type Error struct {
+	Library Library
+	Code    int    // error code of the library
+	Op      string // operation that failed, e.g. "encode" or "open feed"
+	Msg     string // description from the library, may be empty
+	Err     error  // package-level equivalent of Code, may be nil
+
+	// Offset is the position in the input stream of the data passed to the failing
+	// Encode or Decode call, i.e. the bytes passed to the calls before it.
+	Offset int64
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if msg == "" && e.Err != nil {
+		msg = e.Err.Error()
+	}
+	if msg == "" {
+		msg = fmt.Sprintf("error %d", e.Code)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Library, e.Op, msg)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Library == e.Library && t.Code == e.Code
+}
+
+// withOffset sets the input offset of err if it is an *Error.
+func withOffset(err error, offset int64) error {
+	var e *Error
+	if errors.As(err, &e) {
+		e.Offset = offset
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package mp3_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestErrorMatching(t *testing.T) {
+	var err error = &mp3.Error{Library: mp3.LibraryLame, Code: -2, Op: "encode", Err: mp3.ErrorMalloc}
+
+	if !errors.Is(err, mp3.ErrorMalloc) {
+		t.Error("errors.Is does not match the sentinel")
+	}
+	if errors.Is(err, mp3.ErrorBufferTooSmall) {
+		t.Error("errors.Is matches an unrelated sentinel")
+	}
+	if !errors.Is(err, &mp3.Error{Library: mp3.LibraryLame, Code: -2}) {
+		t.Error("errors.Is does not match library and code")
+	}
+	if errors.Is(err, &mp3.Error{Library: mp3.LibraryMpg123, Code: -2}) {
+		t.Error("errors.Is matches another library")
+	}
+	if err.Error() != "lame encode: could not allocate malloc" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	var e *mp3.Error
+	if !errors.As(err, &e) || e.Op != "encode" {
+		t.Errorf("errors.As failed: %v", e)
+	}
+
+	err = &mp3.Error{Library: mp3.LibraryMpg123, Code: 7, Op: "decode"}
+	if err.Error() != "mpg123 decode: error 7" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
+
+func TestEncoderConfigErrors(t *testing.T) {
+	requireNative(t)
+	testCases := []struct {
+		name   string
+		config mp3.EncoderConfig
+		want   error
+	}{
+		{"3 channels", mp3.EncoderConfig{NumChannels: 3}, mp3.ErrorUnsupportedChannels},
+		{"44000 Hz", mp3.EncoderConfig{SampleRate: 44000}, mp3.ErrorUnsupportedSampleRate},
+		{"100 kbps", mp3.EncoderConfig{Bitrate: 100}, mp3.ErrorUnsupportedBitrate},
+		{"320 kbps at 22050 Hz", mp3.EncoderConfig{SampleRate: 22050, Bitrate: 320}, mp3.ErrorUnsupportedBitrate},
+		{"quality 12", mp3.EncoderConfig{Quality: 12}, mp3.ErrorInvalidConfig},
+	}
+	for _, tc := range testCases {
+		_, err := mp3.NewEncoder(&tc.config)
+		if !errors.Is(err, tc.want) || !errors.Is(err, mp3.ErrorInvalidConfig) {
+			t.Errorf("NewEncoder with %s: %v, want %v", tc.name, err, tc.want)
+		}
+		if err := tc.config.Validate(); !errors.Is(err, tc.want) {
+			t.Errorf("Validate with %s: %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	// A negative Quality selects the default level 2
+	pcm := generateSineWave(440, 44100, 2, 11025)
+	encodeAll := func(c *mp3.EncoderConfig) []byte {
+		if err := c.Validate(); err != nil {
+			t.Fatalf("Validate with quality %d: %v", c.Quality, err)
+		}
+		enc, err := mp3.NewEncoder(c)
+		if err != nil {
+			t.Fatalf("NewEncoder with quality %d: %v", c.Quality, err)
+		}
+		defer enc.Close()
+		out, err := enc.EncodeAll(pcm)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		return out
+	}
+	if !bytes.Equal(encodeAll(&mp3.EncoderConfig{Quality: -1}), encodeAll(&mp3.EncoderConfig{Quality: 2})) {
+		t.Error("Quality -1 output differs from quality 2")
+	}
+
+	// LAME resamples MPEG-1 rates down for MPEG-2 bitrates
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 1, Bitrate: 8})
+	if err != nil {
+		t.Fatalf("NewEncoder with 8 kbps at 44100 Hz: %v", err)
+	}
+	encoder.Close()
+	t.Logf("✓ Config errors")
+}
+
+func TestErrorClasses(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(nil)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if _, err := encoder.Encode(nil, make([]byte, 8192)); !errors.Is(err, mp3.ErrorEmptyInput) {
+		t.Errorf("Encode(nil) = %v, want ErrorEmptyInput", err)
+	}
+	encoder.Close()
+	if err := encoder.Reset(nil); !errors.Is(err, mp3.ErrorClosed) || err.Error() != "encoder closed" {
+		t.Errorf("Reset after Close = %v, want ErrorClosed", err)
+	}
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	defer decoder.Close()
+	if _, err := decoder.Decode(nil, make([]byte, 8192)); !errors.Is(err, mp3.ErrorEmptyInput) {
+		t.Errorf("Decode(nil) = %v, want ErrorEmptyInput", err)
+	}
+	t.Logf("✓ Error classes")
+}
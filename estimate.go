@@ -0,0 +1,73 @@
+package mp3
+
+const (
+	// Frames that may be output in addition to the ones covering the input samples:
+	// the Xing/LAME tag frame and the samples buffered inside LAME (encoder delay, flush padding).
+	estimateExtraFrames = 8
+
+	// Frames are output once their main data is complete, which may lag behind
+	// by up to the size of the bit reservoir (main_data_begin is 9 bits for MPEG-1).
+	maxReservoirBytes = 511
+
+	// Decoded size of the largest frame: 1152 samples * 2 channels * 4 bytes
+	maxDecodedFrameBytes = 1152 * 2 * 4
+)
+
+// worstCaseEncodedBytes is the worst case estimate from lame.h:
+//
+//	mp3buf_size in bytes = 1.25*num_samples + 7200
+func worstCaseEncodedBytes(numSamples int) int {
+	return int(1.25*float64(numSamples+1)) + 7200
+}
+
+// maxFrameBytes returns the size of the largest frame at the given bitrate, including padding.
+func maxFrameBytes(frameLength, sampleRate, kbps int) int {
+	return frameLength*125*kbps/sampleRate + 1
+}
+
+// maxBitrate returns the highest bitrate allowed for the MPEG version used at sampleRate.
+func maxBitrate(sampleRate int) int {
+	if sampleRate >= 32000 {
+		return 320 // MPEG-1
+	}
+	return 160 // MPEG-2 and MPEG-2.5
+}
+
+// vbrMaxBitrate returns the highest bitrate of VBR frames at sampleRate with the configured
+// limit in kbps. LAME rounds the limit to the nearest legal bitrate, so the next legal one
+// at or above it is used; 0 means no limit.
+func vbrMaxBitrate(sampleRate, limit int) int {
+	if limit > 0 {
+		for _, kbps := range BitratesForSampleRate(sampleRate) {
+			if kbps >= limit {
+				return kbps
+			}
+		}
+	}
+	return maxBitrate(sampleRate)
+}
+
+// estimateEncodedBytes bounds the mp3 data produced for numSamples input samples per channel.
+// frameBytes is the size of the largest frame the encoder can produce; 0 falls back to the worst case.
+func estimateEncodedBytes(numSamples, frameLength, inRate, outRate, frameBytes int) int {
+	worstCase := worstCaseEncodedBytes(numSamples)
+	if frameBytes <= 0 || frameLength <= 0 || inRate <= 0 || outRate <= 0 {
+		return worstCase
+	}
+	outSamples := numSamples*outRate/inRate + 1
+	frames := outSamples/frameLength + estimateExtraFrames
+	return min(frames*frameBytes+maxReservoirBytes, worstCase)
+}
+
+// estimateDecodedBytes returns the PCM size of nFrames frames in the negotiated format,
+// or the size for the largest possible frames if the format is not known yet.
+func estimateDecodedBytes(nFrames, sampleRate, numChannels, sampleBitDepth int) int {
+	if sampleRate == 0 || numChannels == 0 || sampleBitDepth == 0 {
+		return maxDecodedFrameBytes * nFrames
+	}
+	samples := 1152 // MPEG-1
+	if sampleRate < 32000 {
+		samples = 576 // MPEG-2 and MPEG-2.5
+	}
+	return samples * numChannels * sampleBitDepth / 8 * nFrames
+}
@@ -26,7 +26,7 @@ func decodeToWav() {
 	}
 	defer wavFile.Close()
 
-	totalBytes, totalSamples, sampleRate, err := mp3.DecodeToWav(inFile, wavFile)
+	totalBytes, totalSamples, sampleRate, err := mp3.DecodeToWav(inFile, wavFile, nil)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -25,13 +25,13 @@ func encodeFromWav() {
 	}
 	defer out.Close()
 
-	totalBytes, totalFrames, sampleRate, err := mp3.EncodeFromWav(in, out, &mp3.EncoderConfig{
+	result, err := mp3.EncodeFromWav(in, out, &mp3.EncoderConfig{
 		Bitrate: 128,
 		Quality: 2,
-	})
+	}, nil)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	fmt.Printf("totalBytes: %d, totalFrames: %d, sampleRate: %d\n", totalBytes, totalFrames, sampleRate)
+	fmt.Printf("totalBytes: %d, totalFrames: %d, sampleRate: %d\n", result.TotalBytes, result.Frames, result.SampleRate)
 }
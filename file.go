@@ -0,0 +1,86 @@
+package mp3
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// EncodeFile encodes the WAV file wavPath to the mp3 file mp3Path with EncodeFromWav,
+// including the Xing/LAME tag. The output is written to a temporary file next to mp3Path
+// that is synced and renamed, so mp3Path is only replaced by a complete file.
+// opts may be nil to use the default buffering.
+func EncodeFile(wavPath, mp3Path string, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	in, err := os.Open(wavPath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	var result *EncodeResult
+	err = writeFile(mp3Path, func(f *os.File) error {
+		var err error
+		result, err = EncodeFromWav(in, f, config, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DecodeFile decodes the mp3 file mp3Path to the WAV file wavPath with DecodeToWav,
+// replacing wavPath like EncodeFile. opts may be nil to use the default buffering.
+func DecodeFile(mp3Path, wavPath string, opts *WavOptions) (totalBytes int64, totalSamples int64, sampleRate int, err error) {
+	in, err := os.Open(mp3Path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer in.Close()
+
+	err = writeFile(wavPath, func(f *os.File) error {
+		var err error
+		totalBytes, totalSamples, sampleRate, err = DecodeToWav(in, f, opts)
+		return err
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return totalBytes, totalSamples, sampleRate, nil
+}
+
+// writeFile calls write with a temporary file in the directory of path and replaces path
+// with it once write succeeded and the data is synced.
+func writeFile(path string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return err
+	}
+	// CreateTemp makes the file private, use the mode of a file made by os.Create.
+	// Some platforms (e.g. wasip1) cannot change permissions
+	if err := tmp.Chmod(0o644); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	tmp = nil
+	return nil
+}
@@ -0,0 +1,57 @@
+package mp3_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestEncodeDecodeFile(t *testing.T) {
+	requireNative(t)
+	dir := t.TempDir()
+	wavPath := filepath.Join(dir, "in.wav")
+	mp3Path := filepath.Join(dir, "out.mp3")
+	outPath := filepath.Join(dir, "out.wav")
+	if err := os.WriteFile(wavPath, generateWavFile(44100, 2, 44100), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	result, err := mp3.EncodeFile(wavPath, mp3Path, &mp3.EncoderConfig{Bitrate: 128}, nil)
+	if err != nil {
+		t.Fatalf("EncodeFile failed: %v", err)
+	}
+	info, err := os.Stat(mp3Path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size() != result.TotalBytes {
+		t.Errorf("mp3 file has %d bytes, result %d", info.Size(), result.TotalBytes)
+	}
+	data, _ := os.ReadFile(mp3Path)
+	if pos, err := mp3.FindFrameSync(data, 0); err != nil || !mp3.IsInfoFrame(data[pos:]) {
+		t.Error("Info frame not written")
+	}
+
+	_, totalSamples, sampleRate, err := mp3.DecodeFile(mp3Path, outPath, nil)
+	if err != nil {
+		t.Fatalf("DecodeFile failed: %v", err)
+	}
+	if sampleRate != 44100 || totalSamples < 44100 {
+		t.Errorf("DecodeFile decoded %d samples at %d Hz", totalSamples, sampleRate)
+	}
+
+	// A failed conversion leaves the existing output and no temporary file
+	if _, err := mp3.EncodeFile(mp3Path, outPath, nil, nil); err == nil {
+		t.Error("EncodeFile accepted an mp3 file as WAV input")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("Directory holds %d files, want 3", len(entries))
+	}
+	if _, _, _, err := mp3.DecodeFile(filepath.Join(dir, "missing.mp3"), outPath, nil); !os.IsNotExist(err) {
+		t.Errorf("DecodeFile of a missing file: %v", err)
+	}
+	t.Logf("✓ EncodeFile and DecodeFile: %d mp3 bytes, %d samples", info.Size(), totalSamples)
+}
@@ -0,0 +1,357 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	FrameHeaderSize = 4
+
+	// maxFrameSize is the largest layer III frame: 1440 bytes plus padding, reached by MPEG-1
+	// at 320 kbps and 32 kHz and by MPEG-2.5 at 160 kbps and 8 kHz
+	maxFrameSize = 1441
+)
+
+type MpegVersion int
+
+const (
+	MpegVersion1  MpegVersion = 1
+	MpegVersion2  MpegVersion = 2
+	MpegVersion25 MpegVersion = 3
+)
+
+var (
+	ErrorInvalidFrameHeader = errors.New("invalid mpeg frame header")
+	ErrorNoFrameSync        = errors.New("no mpeg frame sync found")
+)
+
+var (
+	bitrateTableV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, -1}
+	bitrateTableV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1}
+
+	sampleRateTable = map[MpegVersion][3]int{
+		MpegVersion1:  {44100, 48000, 32000},
+		MpegVersion2:  {22050, 24000, 16000},
+		MpegVersion25: {11025, 12000, 8000},
+	}
+)
+
+// FrameHeader is a parsed MPEG audio layer III frame header.
+type FrameHeader struct {
+	Version    MpegVersion
+	Bitrate    int // kbps
+	SampleRate int
+	Padding    bool
+	Protected  bool // CRC follows the header
+	Mode       MpegMode
+	Size       int // frame size in bytes including the header
+	Samples    int // samples per channel in the frame
+}
+
+// ParseFrameHeader parses the 4-byte MPEG layer III frame header at the start of b.
+// Free format frames are not supported.
+func ParseFrameHeader(b []byte) (FrameHeader, error) {
+	var h FrameHeader
+	if len(b) < FrameHeaderSize || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return h, ErrorInvalidFrameHeader
+	}
+
+	switch (b[1] >> 3) & 0x03 {
+	case 0:
+		h.Version = MpegVersion25
+	case 2:
+		h.Version = MpegVersion2
+	case 3:
+		h.Version = MpegVersion1
+	default:
+		return h, ErrorInvalidFrameHeader
+	}
+	if (b[1]>>1)&0x03 != 1 { // layer III
+		return h, ErrorInvalidFrameHeader
+	}
+	h.Protected = b[1]&0x01 == 0
+
+	bitrateIdx := b[2] >> 4
+	srIdx := (b[2] >> 2) & 0x03
+	if bitrateIdx == 0 || bitrateIdx == 15 || srIdx == 3 {
+		return h, ErrorInvalidFrameHeader
+	}
+	if h.Version == MpegVersion1 {
+		h.Bitrate = bitrateTableV1[bitrateIdx]
+		h.Samples = 1152
+	} else {
+		h.Bitrate = bitrateTableV2[bitrateIdx]
+		h.Samples = 576
+	}
+	h.SampleRate = sampleRateTable[h.Version][srIdx]
+	h.Padding = (b[2]>>1)&0x01 != 0
+	// MpegMode constants are offset by +1 from the header channel mode bits
+	h.Mode = MpegMode(b[3]>>6) + 1
+
+	h.Size = h.Samples / 8 * h.Bitrate * 1000 / h.SampleRate
+	if h.Padding {
+		h.Size++
+	}
+	return h, nil
+}
+
+// Duration returns the play time of the frame.
+func (h FrameHeader) Duration() time.Duration {
+	return frameDuration(h.Samples, h.SampleRate)
+}
+
+// frameDuration returns the play time of samples at sampleRate.
+func frameDuration(samples, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(samples) * time.Second / time.Duration(sampleRate)
+}
+
+// NumChannels returns the number of channels in the frame.
+func (h FrameHeader) NumChannels() int {
+	if h.Mode == MpegMono {
+		return 1
+	}
+	return 2
+}
+
+// sideInfoSize returns the size of the layer III side information.
+func (h FrameHeader) sideInfoSize() int {
+	if h.Version == MpegVersion1 {
+		if h.Mode == MpegMono {
+			return 17
+		}
+		return 32
+	}
+	if h.Mode == MpegMono {
+		return 9
+	}
+	return 17
+}
+
+// IsInfoFrame reports whether frame (starting with its header) is a Xing, Info or VBRI frame.
+func IsInfoFrame(frame []byte) bool {
+	h, err := ParseFrameHeader(frame)
+	if err != nil {
+		return false
+	}
+	offset := FrameHeaderSize + h.sideInfoSize()
+	if h.Protected {
+		offset += 2
+	}
+	if len(frame) >= offset+4 {
+		id := string(frame[offset : offset+4])
+		if id == "Xing" || id == "Info" {
+			return true
+		}
+	}
+	// VBRI is always located 32 bytes after the side information start
+	return len(frame) >= 36+4 && string(frame[36:40]) == "VBRI"
+}
+
+// FindFrameSync returns the offset of the first valid frame in b at or after pos.
+// A sync is only accepted if the following frame header is valid too, or the frame ends exactly at len(b).
+func FindFrameSync(b []byte, pos int) (int, error) {
+	for i := pos; i+FrameHeaderSize <= len(b); i++ {
+		if b[i] != 0xff {
+			continue
+		}
+		h, err := ParseFrameHeader(b[i:])
+		if err != nil {
+			continue
+		}
+		next := i + h.Size
+		if next == len(b) {
+			return i, nil
+		}
+		if next+FrameHeaderSize <= len(b) {
+			if _, err := ParseFrameHeader(b[next:]); err == nil {
+				return i, nil
+			}
+		}
+	}
+	return 0, ErrorNoFrameSync
+}
+
+// infoFrameType returns "Xing", "Info" or "VBRI" for an info frame, or "" for other frames.
+func infoFrameType(frame []byte) string {
+	if !IsInfoFrame(frame) {
+		return ""
+	}
+	if len(frame) >= 40 && string(frame[36:40]) == "VBRI" {
+		return "VBRI"
+	}
+	return string(frame[xingOffset(frame) : xingOffset(frame)+4])
+}
+
+// xingOffset returns the offset of the Xing/Info id in a frame with a valid header.
+func xingOffset(frame []byte) int {
+	h, _ := ParseFrameHeader(frame)
+	offset := FrameHeaderSize + h.sideInfoSize()
+	if h.Protected {
+		offset += 2
+	}
+	return offset
+}
+
+// infoFrameCount returns the frame count stored in a Xing/Info/VBRI frame.
+func infoFrameCount(frame []byte) (frames int, ok bool) {
+	switch infoFrameType(frame) {
+	case "VBRI":
+		// id, version, delay, quality and byte count precede the frame count
+		if len(frame) < 36+18 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(frame[36+14:])), true
+	case "Xing", "Info":
+		pos := xingOffset(frame)
+		if len(frame) < pos+12 || binary.BigEndian.Uint32(frame[pos+4:])&0x01 == 0 {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint32(frame[pos+8:])), true
+	}
+	return 0, false
+}
+
+// id3v2TagSize returns the total size of the ID3v2 tag at the start of r, or 0 if there is none.
+func id3v2TagSize(r io.ReaderAt, offset int64) (int64, error) {
+	var hdr [ID3v2HeaderSize]byte
+	if _, err := r.ReadAt(hdr[:], offset); err != nil {
+		if err == io.EOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if string(hdr[0:3]) != "ID3" {
+		return 0, nil
+	}
+	size := int64(ID3v2HeaderSize + syncsafe(hdr[6:10]))
+	if hdr[5]&0x10 != 0 {
+		size += ID3v2HeaderSize // footer
+	}
+	return size, nil
+}
+
+// Layout of the LAME extension following the Xing/Info header.
+const (
+	lameExtSize        = 36
+	lameExtMethod      = 9  // 4 bits tag revision, 4 bits VBR method
+	lameExtDelay       = 21 // 12 bits encoder delay, 12 bits padding
+	lameExtMusicLength = 28
+	lameExtMusicCRC    = 32
+	lameExtTagCRC      = 34
+)
+
+// lameExtension returns the LAME extension of a Xing/Info frame, or nil if it has none.
+func lameExtension(frame []byte, h FrameHeader) []byte {
+	ext := infoExtension(frame, h)
+	if ext == nil || string(ext[:4]) != "LAME" {
+		return nil
+	}
+	return ext
+}
+
+// infoExtension returns the lameExtSize bytes following the fields of a Xing/Info frame,
+// where LAME and ffmpeg write the LAME extension, or nil if the frame is too short.
+func infoExtension(frame []byte, h FrameHeader) []byte {
+	pos := FrameHeaderSize + h.sideInfoSize()
+	if pos+8 > len(frame) {
+		return nil
+	}
+	flags := binary.BigEndian.Uint32(frame[pos+4:])
+	pos += 8
+	for _, field := range []struct {
+		flag uint32
+		size int
+	}{{0x01, 4}, {0x02, 4}, {0x04, 100}, {0x08, 4}} {
+		if flags&field.flag != 0 {
+			pos += field.size
+		}
+	}
+	if pos+lameExtSize > len(frame) {
+		return nil
+	}
+	return frame[pos : pos+lameExtSize]
+}
+
+// gaplessInfo returns the encoder delay and padding in samples stored in the LAME extension
+// of a Xing/Info frame.
+func gaplessInfo(frame []byte) (delay, padding int, ok bool) {
+	h, err := ParseFrameHeader(frame)
+	if err != nil || !IsInfoFrame(frame) {
+		return 0, 0, false
+	}
+	ext := lameExtension(frame, h)
+	if ext == nil {
+		return 0, 0, false
+	}
+	delay, padding = extGapless(ext)
+	return delay, padding, true
+}
+
+// extGapless returns the encoder delay and padding of a LAME extension.
+func extGapless(ext []byte) (delay, padding int) {
+	delay = int(ext[lameExtDelay])<<4 | int(ext[lameExtDelay+1])>>4
+	padding = int(ext[lameExtDelay+1]&0x0f)<<8 | int(ext[lameExtDelay+2])
+	return delay, padding
+}
+
+// frameTracker follows the frame boundaries of a mp3 stream that arrives in arbitrary chunks.
+type frameTracker struct {
+	remain int    // bytes left in the current frame
+	size   int    // size of the current frame
+	hdr    []byte // leading bytes of a header split across chunks
+	frames int    // frames started so far
+}
+
+// complete returns the number of complete frames seen and the bytes seen of the following frame.
+func (t *frameTracker) complete() (frames int, partial int) {
+	if t.remain > 0 {
+		return t.frames - 1, t.size - t.remain + len(t.hdr)
+	}
+	return t.frames, len(t.hdr)
+}
+
+// split scans the next chunk of the stream. It returns the offset in b at which frame number stop
+// (counted from 0) begins, or -1 if it does not begin in b. After a cut the remaining bytes
+// must be passed to split again to continue tracking.
+func (t *frameTracker) split(b []byte, stop int) int {
+	pos := 0
+	for {
+		if t.remain > 0 {
+			k := min(t.remain, len(b)-pos)
+			pos += k
+			t.remain -= k
+			if t.remain > 0 {
+				return -1
+			}
+		}
+		if t.frames == stop && len(t.hdr) == 0 {
+			return pos
+		}
+		if pos == len(b) {
+			return -1
+		}
+
+		k := min(FrameHeaderSize-len(t.hdr), len(b)-pos)
+		t.hdr = append(t.hdr, b[pos:pos+k]...)
+		pos += k
+		if len(t.hdr) < FrameHeaderSize {
+			return -1
+		}
+		h, err := ParseFrameHeader(t.hdr)
+		t.frames++
+		t.hdr = t.hdr[:0]
+		if err != nil {
+			// Not a stream of layer III frames, stop tracking
+			t.remain = int(^uint(0) >> 1)
+			continue
+		}
+		t.size = h.Size
+		t.remain = h.Size - FrameHeaderSize
+	}
+}
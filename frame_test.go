@@ -0,0 +1,55 @@
+package mp3_test
+
+import (
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestParseFrameHeader tests parsing of layer III frame headers
+func TestParseFrameHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     []byte
+		version    mp3.MpegVersion
+		bitrate    int
+		sampleRate int
+		mode       mp3.MpegMode
+		size       int
+	}{
+		{"MPEG1_128k_44100_JointStereo", []byte{0xff, 0xfb, 0x90, 0x64}, mp3.MpegVersion1, 128, 44100, mp3.MpegJointStereo, 417},
+		{"MPEG1_128k_44100_Padded", []byte{0xff, 0xfb, 0x92, 0x64}, mp3.MpegVersion1, 128, 44100, mp3.MpegJointStereo, 418},
+		{"MPEG2_64k_22050_Mono", []byte{0xff, 0xf3, 0x80, 0xc4}, mp3.MpegVersion2, 64, 22050, mp3.MpegMono, 208},
+		{"MPEG25_8k_8000_Stereo", []byte{0xff, 0xe3, 0x18, 0x04}, mp3.MpegVersion25, 8, 8000, mp3.MpegStereo, 72},
+		// The largest frames
+		{"MPEG1_320k_32000_Padded", []byte{0xff, 0xfb, 0xea, 0x64}, mp3.MpegVersion1, 320, 32000, mp3.MpegJointStereo, 1441},
+		{"MPEG25_160k_8000_Padded", []byte{0xff, 0xe3, 0xea, 0x04}, mp3.MpegVersion25, 160, 8000, mp3.MpegStereo, 1441},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := mp3.ParseFrameHeader(tc.header)
+			if err != nil {
+				t.Fatalf("ParseFrameHeader failed: %v", err)
+			}
+			if h.Version != tc.version || h.Bitrate != tc.bitrate || h.SampleRate != tc.sampleRate ||
+				h.Mode != tc.mode || h.Size != tc.size {
+				t.Errorf("Header mismatch: got %+v", h)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, b := range [][]byte{
+			{0x00, 0x00, 0x00, 0x00},
+			{0xff, 0xfd, 0x90, 0x64}, // layer I
+			{0xff, 0xfb, 0xf0, 0x64}, // bad bitrate
+			{0xff, 0xfb, 0x9c, 0x64}, // reserved sample rate
+			{0xff, 0xfb},
+		} {
+			if _, err := mp3.ParseFrameHeader(b); err == nil {
+				t.Errorf("Expected error for header % x", b)
+			}
+		}
+	})
+}
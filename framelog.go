@@ -0,0 +1,369 @@
+package mp3
+
+import "math"
+
+// BlockType is the MDCT block type of a granule, as signalled in the side information.
+type BlockType int
+
+const (
+	BlockNormal BlockType = 0 // long blocks
+	BlockStart  BlockType = 1 // transition from long to short blocks
+	BlockShort  BlockType = 2 // 3 short blocks
+	BlockStop   BlockType = 3 // transition from short to long blocks
+)
+
+// FrameInfo describes a frame passed to a FrameLogger.
+type FrameInfo struct {
+	Index  int   // frame number in the stream, counted from 0; Xing/Info frames are counted
+	Offset int64 // byte offset of the frame in the stream
+	Header FrameHeader
+
+	// BlockTypes holds the block type per [granule][channel]. MPEG-2 and MPEG-2.5 frames
+	// have one granule, mono frames one channel.
+	BlockTypes [2][2]BlockType
+
+	// The side information parsed from the frame shows how the bits of the frame were
+	// spent, not why: the perceptual entropy and masking data of LAME's psychoacoustic model
+	// are not available from the library.
+	MainDataBegin   int // bytes of the bit reservoir taken from previous frames
+	MSStereo        bool
+	IntensityStereo bool
+	SideInfo        [2][2]GranuleSideInfo // per [granule][channel], like BlockTypes
+}
+
+// GranuleSideInfo is the side information of one granule and channel of a frame.
+type GranuleSideInfo struct {
+	Bits          int // part2_3_length: bits of scale factors and Huffman coded data
+	BigValues     int // pairs of spectral values coded with the big value tables
+	GlobalGain    int // quantizer step size in 1.5 dB steps, higher is coarser
+	BlockType     BlockType
+	MixedBlock    bool // long blocks for the lowest subbands of a short block granule
+	ScalefacScale bool // coarse scale factor steps
+	Preflag       bool // high frequency pre-emphasis, MPEG-1 only
+}
+
+// FrameLogger is called for each frame of the encoded or decoded mp3 stream.
+// It is meant for debugging quality or sync problems and is not set by default.
+type FrameLogger func(f *FrameInfo)
+
+// frameLog parses a mp3 stream that arrives in arbitrary chunks and calls the logger for each frame.
+// ID3v2 tags are skipped, garbage between frames is skipped byte by byte.
+type frameLog struct {
+	fn     FrameLogger // may be nil if only the bitrate is tracked
+	buf    []byte      // start of the current frame or tag, up to its side information and tag id
+	offset int64       // stream offset of buf[0]
+	skip   int         // bytes of the previous frame or tag not yet seen
+	frames int
+
+	// With checkSync the first frame is only accepted if another frame or tag follows it,
+	// the bytes skipped until then are counted in junk
+	checkSync bool
+	synced    bool
+	junk      int64
+
+	resyncs int64 // runs of skipped garbage
+	inJunk  bool  // the last byte was skipped
+
+	// Audio frames seen so far, Xing/Info and VBRI frames are not counted
+	audioFrames int64
+	bitrate     int     // of the last frame, kbps
+	audioBytes  int64   // total size of the frames
+	duration    float64 // total duration of the frames in seconds
+}
+
+// SetFrameLogger sets a logger called for each frame of the encoded stream, nil disables logging.
+// Frames are reported once they have been returned by Encode or Flush.
+func (enc *Encoder) SetFrameLogger(fn FrameLogger) {
+	enc.frameLog = newFrameLog(fn)
+}
+
+// SetFrameLogger sets a logger called for each frame of the input stream, nil disables logging.
+// Frames are reported as they are passed to Decode, ID3v2 tags and garbage are skipped.
+func (d *Decoder) SetFrameLogger(fn FrameLogger) {
+	d.tracker().fn = fn
+}
+
+// Bitrate returns the bitrate of the most recent frame passed to Decode and the average
+// bitrate of all frames so far, both in kbps. Xing, Info and VBRI frames are not counted.
+// Both are 0 until the first complete frame header has been passed.
+//
+// Frames are only tracked from the first call of Bitrate, LeadingJunk or SetFrameLogger on,
+// call one of them before the first Decode to cover the whole stream. A first frame that is
+// complete but not followed by another one yet is taken as the end of the input and accepted.
+func (d *Decoder) Bitrate() (current, average int) {
+	l := d.tracker()
+	l.settle()
+	if l.duration == 0 {
+		return 0, 0
+	}
+	return l.bitrate, int(math.Round(float64(l.audioBytes) * 8 / l.duration / 1000))
+}
+
+// LeadingJunk returns the number of bytes skipped before the first frame passed to Decode,
+// such as broken tags or the rest of a cut frame. ID3v2 tags are not counted. The count is
+// final once the first frame has been found, i.e. Bitrate no longer returns 0. Like Bitrate,
+// it only counts input passed to Decode after its first call.
+func (d *Decoder) LeadingJunk() int64 {
+	l := d.tracker()
+	l.settle()
+	return l.junk
+}
+
+// tracker returns the frame scanner of the decoder, allocating it on first use. Until then
+// Decode does not scan its input.
+func (d *Decoder) tracker() *frameLog {
+	if d.frameLog == nil {
+		d.frameLog = &frameLog{checkSync: true}
+	}
+	return d.frameLog
+}
+
+// scan passes the input of Decode to the frame scanner. Installed metrics take their frame
+// and resync counts from it, so it is allocated for them.
+func (d *Decoder) scan(in []byte) {
+	if d.frameLog == nil && currentMetrics() != nil {
+		d.tracker()
+	}
+	d.frameLog.scan(in)
+}
+
+func newFrameLog(fn FrameLogger) *frameLog {
+	if fn == nil {
+		return nil
+	}
+	return &frameLog{fn: fn}
+}
+
+// scan parses the next chunk of the stream, it does nothing on a nil frameLog.
+func (l *frameLog) scan(b []byte) {
+	if l == nil {
+		return
+	}
+	for {
+		if l.skip > 0 {
+			if len(b) == 0 {
+				return
+			}
+			k := min(l.skip, len(b))
+			b = b[k:]
+			l.skip -= k
+			continue
+		}
+
+		need := l.need()
+		if need < 0 {
+			// Not a frame header, resync
+			l.resync()
+			continue
+		}
+		if len(l.buf) < need {
+			if len(b) == 0 {
+				return
+			}
+			k := min(need-len(l.buf), len(b))
+			l.buf = append(l.buf, b[:k]...)
+			b = b[k:]
+			continue
+		}
+		if l.checkSync && !l.synced && string(l.buf[:3]) != "ID3" {
+			// buf holds the whole frame and the next header
+			h, _ := ParseFrameHeader(l.buf)
+			if !followsFrame(l.buf[h.Size:]) {
+				l.resync()
+				continue
+			}
+			b = append(l.splitFrame(h), b...)
+		}
+		l.synced = l.synced || string(l.buf[:3]) != "ID3"
+		l.consume()
+	}
+}
+
+// settle accepts the first frame at the end of the input seen so far: with checkSync it is
+// only accepted once the next header follows, which never happens for the last frame.
+func (l *frameLog) settle() {
+	if !l.checkSync || l.synced || len(l.buf) < FrameHeaderSize || string(l.buf[:3]) == "ID3" {
+		return
+	}
+	h, err := ParseFrameHeader(l.buf)
+	if err != nil || len(l.buf) < h.Size {
+		return
+	}
+	rest := l.splitFrame(h)
+	l.synced = true
+	l.consume()
+	l.scan(rest)
+}
+
+// splitFrame cuts buf, which holds the whole frame, after the side information and returns
+// the rest of the frame, which is scanned again.
+func (l *frameLog) splitFrame(h FrameHeader) []byte {
+	n := sideInfoEnd(h)
+	rest := append([]byte(nil), l.buf[n:]...)
+	l.buf = l.buf[:n]
+	return rest
+}
+
+// need returns how many bytes of the current frame or tag are needed, or -1 if buf does not start one.
+func (l *frameLog) need() int {
+	if len(l.buf) < FrameHeaderSize {
+		return FrameHeaderSize
+	}
+	if string(l.buf[:3]) == "ID3" {
+		return ID3v2HeaderSize
+	}
+	h, err := ParseFrameHeader(l.buf)
+	if err != nil {
+		return -1
+	}
+	if l.checkSync && !l.synced {
+		return h.Size + FrameHeaderSize
+	}
+	return sideInfoEnd(h)
+}
+
+// resync drops the first byte of buf, which does not start a frame or tag.
+func (l *frameLog) resync() {
+	l.buf = l.buf[:copy(l.buf, l.buf[1:])]
+	l.offset++
+	if !l.synced {
+		l.junk++
+	}
+	if !l.inJunk {
+		l.resyncs++
+		l.inJunk = true
+	}
+}
+
+// sideInfoEnd returns the size of the header and side information of a frame.
+func sideInfoEnd(h FrameHeader) int {
+	n := FrameHeaderSize + h.sideInfoSize()
+	if h.Protected {
+		n += 2
+	}
+	return min(n, h.Size)
+}
+
+// followsFrame reports whether next, the bytes following a frame, start a frame or tag.
+func followsFrame(next []byte) bool {
+	if string(next[:3]) == "ID3" || string(next[:3]) == "TAG" {
+		return true
+	}
+	_, err := ParseFrameHeader(next)
+	return err == nil
+}
+
+// consume handles the complete start of a frame or tag in buf.
+func (l *frameLog) consume() {
+	var size int
+	if string(l.buf[:3]) == "ID3" {
+		size = ID3v2HeaderSize + syncsafe(l.buf[6:10])
+		if l.buf[5]&0x10 != 0 {
+			size += ID3v2HeaderSize // footer
+		}
+	} else {
+		f := FrameInfo{Index: l.frames, Offset: l.offset}
+		f.Header, _ = ParseFrameHeader(l.buf)
+		side := l.buf[FrameHeaderSize:]
+		if f.Header.Protected {
+			side = side[min(2, len(side)):]
+		}
+		if len(side) >= f.Header.sideInfoSize() {
+			f.MainDataBegin, f.SideInfo = parseSideInfo(f.Header, side)
+			for gr := range f.SideInfo {
+				for ch := range f.SideInfo[gr] {
+					f.BlockTypes[gr][ch] = f.SideInfo[gr][ch].BlockType
+				}
+			}
+		}
+		if f.Header.Mode == MpegJointStereo {
+			f.MSStereo = l.buf[3]&0x20 != 0
+			f.IntensityStereo = l.buf[3]&0x10 != 0
+		}
+		if l.fn != nil {
+			l.fn(&f)
+		}
+		if !IsInfoFrame(l.buf) {
+			l.audioFrames++
+			l.bitrate = f.Header.Bitrate
+			l.audioBytes += int64(f.Header.Size)
+			l.duration += float64(f.Header.Samples) / float64(f.Header.SampleRate)
+		}
+		l.frames++
+		size = f.Header.Size
+	}
+	l.skip = size - len(l.buf)
+	l.offset += int64(size)
+	l.buf = l.buf[:0]
+	l.inJunk = false
+}
+
+// parseSideInfo reads the layer III side information.
+func parseSideInfo(h FrameHeader, side []byte) (mainDataBegin int, granules [2][2]GranuleSideInfo) {
+	r := bitReader{b: side}
+	channels := h.NumChannels()
+	numGranules := 1
+	if h.Version == MpegVersion1 {
+		numGranules = 2
+		mainDataBegin = r.read(9)
+		if channels == 1 {
+			r.skip(5)
+		} else {
+			r.skip(3)
+		}
+		r.skip(4 * channels) // scfsi
+	} else {
+		mainDataBegin = r.read(8)
+		r.skip(channels) // private bits
+	}
+
+	for gr := range numGranules {
+		for ch := range channels {
+			g := &granules[gr][ch]
+			g.Bits = r.read(12)
+			g.BigValues = r.read(9)
+			g.GlobalGain = r.read(8)
+			if h.Version == MpegVersion1 {
+				r.skip(4) // scalefac_compress
+			} else {
+				r.skip(9)
+			}
+			if r.read(1) == 1 { // window_switching_flag
+				g.BlockType = BlockType(r.read(2))
+				g.MixedBlock = r.read(1) == 1
+				r.skip(2*5 + 3*3) // table_select, subblock_gain
+			} else {
+				r.skip(3*5 + 4 + 3) // table_select, region0_count, region1_count
+			}
+			if h.Version == MpegVersion1 {
+				g.Preflag = r.read(1) == 1
+			}
+			g.ScalefacScale = r.read(1) == 1
+			r.skip(1) // count1table_select
+		}
+	}
+	return mainDataBegin, granules
+}
+
+// bitReader reads big-endian bit fields, reading past the end returns zeros.
+type bitReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *bitReader) read(n int) int {
+	v := 0
+	for range n {
+		bit := 0
+		if i := r.pos / 8; i < len(r.b) {
+			bit = int(r.b[i]>>(7-r.pos%8)) & 1
+		}
+		v = v<<1 | bit
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+}
@@ -0,0 +1,242 @@
+package mp3_test
+
+import (
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestFrameLogger(t *testing.T) {
+	requireNative(t)
+	// Silence with loud clicks, which makes LAME switch to short blocks
+	pcm := make([]byte, 44100*2*2)
+	for i := 0; i < len(pcm)/4; i += 4410 {
+		for j := i; j < i+32; j++ {
+			pcm[j*4+1], pcm[j*4+3] = 0x70, 0x90
+		}
+	}
+
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	var encFrames []mp3.FrameInfo
+	encoder.SetFrameLogger(func(f *mp3.FrameInfo) {
+		encFrames = append(encFrames, *f)
+	})
+	stream, err := encoder.EncodeAppend(nil, pcm)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	stream, err = encoder.FlushAppend(stream)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	frameNum, _ := encoder.GetFrameNum()
+	if len(encFrames) != frameNum {
+		t.Fatalf("Logged %d frames, encoder reports %d", len(encFrames), frameNum)
+	}
+	offset := int64(0)
+	short, bits := 0, 0
+	for i, f := range encFrames {
+		if f.Index != i || f.Offset != offset || f.Header.Bitrate != 128 {
+			t.Fatalf("Unexpected frame %d at offset %d: %+v", i, offset, f)
+		}
+		if f.MainDataBegin > 511 || (f.IntensityStereo && !f.MSStereo) {
+			t.Errorf("Unexpected side information in frame %d: %+v", i, f)
+		}
+		for _, gr := range f.SideInfo {
+			for _, g := range gr {
+				bits += g.Bits
+			}
+		}
+		offset += int64(f.Header.Size)
+		for _, gr := range f.BlockTypes {
+			for _, bt := range gr {
+				if bt == mp3.BlockShort {
+					short++
+				}
+			}
+		}
+	}
+	if offset != int64(len(stream)) {
+		t.Errorf("Logged frames cover %d bytes, stream has %d", offset, len(stream))
+	}
+	if short == 0 {
+		t.Error("No short blocks logged for a signal with transients")
+	}
+	// The granules account for the main data, the rest of the stream is headers,
+	// side information and stuffing
+	if bits == 0 || bits > len(stream)*8 {
+		t.Errorf("Granules use %d bits of a %d byte stream", bits, len(stream))
+	}
+
+	// The decoder logs the same frames, skipping the ID3v2 tag and garbage in front
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Clicks")
+	prefix := append(tag.Bytes(), 0x00, 0xff, 0x12)
+	input := append(prefix, stream...)
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	var decFrames []mp3.FrameInfo
+	decoder.SetFrameLogger(func(f *mp3.FrameInfo) {
+		decFrames = append(decFrames, *f)
+	})
+	pcmBuf := make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+	for chunk := range slicesChunk(input, 7) {
+		if _, err := decoder.Decode(chunk, pcmBuf); err != nil {
+			t.Fatalf("Decode failed: %v", err)
+		}
+	}
+
+	if len(decFrames) != len(encFrames) {
+		t.Fatalf("Decoder logged %d frames, encoder %d", len(decFrames), len(encFrames))
+	}
+	for i := range decFrames {
+		want := encFrames[i]
+		want.Offset += int64(len(prefix))
+		if decFrames[i] != want {
+			t.Fatalf("Frame %d differs: decoder %+v, encoder %+v", i, decFrames[i], want)
+		}
+	}
+	t.Logf("✓ Frame logger: %d frames, %d short block granules, %d main data bits", len(encFrames), short, bits)
+}
+
+// TestFrameLoggerSideInfo tests the side information of hand-built frames
+func TestFrameLoggerSideInfo(t *testing.T) {
+	requireNative(t)
+	granules := [2][2]mp3.GranuleSideInfo{
+		{
+			{Bits: 100, BigValues: 20, GlobalGain: 140, Preflag: true},
+			{Bits: 50, BigValues: 10, GlobalGain: 150, BlockType: mp3.BlockShort, MixedBlock: true, ScalefacScale: true},
+		},
+		{
+			{Bits: 30, BigValues: 5, GlobalGain: 160, BlockType: mp3.BlockStop},
+			{GlobalGain: 210},
+		},
+	}
+	// MPEG-1 layer III, 128 kbps, 44100 Hz, joint stereo with M/S stereo, 417 bytes
+	frame := func(mainDataBegin int) []byte {
+		var w bitWriter
+		w.write(0xFFFB9064, 32)
+		w.write(mainDataBegin, 9)
+		w.write(0, 3+4*2) // private bits, scfsi
+		for _, gr := range granules {
+			for _, g := range gr {
+				w.write(g.Bits, 12)
+				w.write(g.BigValues, 9)
+				w.write(g.GlobalGain, 8)
+				w.write(0, 4) // scalefac_compress
+				if g.BlockType != mp3.BlockNormal {
+					w.write(1, 1)
+					w.write(int(g.BlockType), 2)
+					w.write(b2i(g.MixedBlock), 1)
+					w.write(0, 2*5+3*3)
+				} else {
+					w.write(0, 1+3*5+4+3)
+				}
+				w.write(b2i(g.Preflag), 1)
+				w.write(b2i(g.ScalefacScale), 1)
+				w.write(0, 1)
+			}
+		}
+		return append(w.b, make([]byte, 417-len(w.b))...)
+	}
+	stream := append(frame(0), frame(10)...)
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+	var frames []mp3.FrameInfo
+	decoder.SetFrameLogger(func(f *mp3.FrameInfo) {
+		frames = append(frames, *f)
+	})
+	if _, err := decoder.Decode(stream, make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	decoder.Bitrate() // accepts the last frame
+
+	if len(frames) != 2 {
+		t.Fatalf("Logged %d frames, want 2", len(frames))
+	}
+	for i, f := range frames {
+		if want := i * 10; f.MainDataBegin != want {
+			t.Errorf("Frame %d: main_data_begin %d, want %d", i, f.MainDataBegin, want)
+		}
+		if !f.MSStereo || f.IntensityStereo {
+			t.Errorf("Frame %d: M/S %v, intensity %v, want M/S only", i, f.MSStereo, f.IntensityStereo)
+		}
+		if f.SideInfo != granules {
+			t.Errorf("Frame %d: granules %+v, want %+v", i, f.SideInfo, granules)
+		}
+		if f.BlockTypes != [2][2]mp3.BlockType{{mp3.BlockNormal, mp3.BlockShort}, {mp3.BlockStop, mp3.BlockNormal}} {
+			t.Errorf("Frame %d: block types %v", i, f.BlockTypes)
+		}
+	}
+}
+
+// bitWriter appends big-endian bit fields.
+type bitWriter struct {
+	b []byte
+	n int // bits written
+}
+
+func (w *bitWriter) write(v, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.b = append(w.b, 0)
+		}
+		w.b[len(w.b)-1] |= byte(v>>i&1) << (7 - w.n%8)
+		w.n++
+	}
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// slicesChunk yields b in chunks of at most n bytes.
+func slicesChunk(b []byte, n int) func(yield func([]byte) bool) {
+	return func(yield func([]byte) bool) {
+		for len(b) > 0 {
+			k := min(n, len(b))
+			if !yield(b[:k]) {
+				return
+			}
+			b = b[k:]
+		}
+	}
+}
+
+func TestFrameLoggerDisabled(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(nil)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	calls := 0
+	encoder.SetFrameLogger(func(f *mp3.FrameInfo) { calls++ })
+	encoder.SetFrameLogger(nil)
+	pcm := generateSineWave(440, 44100, 2, 44100)
+	if _, err := encoder.EncodeAppend(nil, pcm); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Disabled logger called %d times", calls)
+	}
+}
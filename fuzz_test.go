@@ -0,0 +1,66 @@
+package mp3_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// The seed corpus with malformed files lives in testdata/fuzz/<FuzzName>.
+// Run a target with e.g. go test -run '^$' -fuzz FuzzDecode
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xfb, 0x90, 0x64})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoder, err := mp3.NewDecoder()
+		if err != nil {
+			t.Skipf("No decoder: %v", err)
+		}
+		defer decoder.Close()
+
+		pcmBuf := make([]byte, decoder.EstimateOutBufBytes(mp3.EstimateFrames))
+		for len(data) > 0 {
+			chunk := data[:min(len(data), 1024)]
+			data = data[len(chunk):]
+			n, err := decoder.Decode(chunk, pcmBuf)
+			if err != nil {
+				return
+			}
+			if n > len(pcmBuf) {
+				t.Fatalf("Decode returned %d bytes for a %d byte buffer", n, len(pcmBuf))
+			}
+		}
+	})
+}
+
+func FuzzParseWavHeader(f *testing.F) {
+	f.Add(mp3.GenerateWavHeader(0, 44100, 2, 16))
+	f.Add(mp3.GenerateRF64Header(5<<30, 44100, 2, 16))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pcmSize, sampleRate, numChannels, bitsPerSample, err := mp3.ParseWavHeader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if pcmSize < 0 || sampleRate < 0 || numChannels < 0 || bitsPerSample < 0 {
+			t.Fatalf("Negative values: %d %d %d %d", pcmSize, sampleRate, numChannels, bitsPerSample)
+		}
+	})
+}
+
+func FuzzProbe(f *testing.F) {
+	f.Add([]byte("ID3\x04\x00\x00\x00\x00\x00\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := mp3.Probe(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		if info.AudioOffset < 0 || info.AudioSize < 0 || info.AudioOffset+info.AudioSize > int64(len(data)) {
+			t.Fatalf("Audio range %d+%d outside of %d bytes", info.AudioOffset, info.AudioSize, len(data))
+		}
+		if info.Frames < 0 || info.Duration < 0 {
+			t.Fatalf("Negative frame count %d or duration %v", info.Frames, info.Duration)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// G.711 expansion tables, see ITU-T G.711.
+var (
+	muLawTable = g711Table(muLawToLinear)
+	aLawTable  = g711Table(aLawToLinear)
+)
+
+func g711Table(expand func(b byte) int16) *[256]int16 {
+	var t [256]int16
+	for i := range t {
+		t[i] = expand(byte(i))
+	}
+	return &t
+}
+
+// muLawToLinear expands a µ-law sample to 16 bits.
+func muLawToLinear(u byte) int16 {
+	u = ^u
+	t := (int(u&0x0f) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return int16(0x84 - t)
+	}
+	return int16(t - 0x84)
+}
+
+// aLawToLinear expands an A-law sample to 16 bits.
+func aLawToLinear(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0f) << 4
+	switch seg := (a & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+// g711Reader expands the 8-bit G.711 samples read from r to 16-bit PCM.
+type g711Reader struct {
+	r     io.Reader
+	table *[256]int16
+	buf   []byte
+}
+
+func newG711Reader(r io.Reader, aLaw bool) *g711Reader {
+	g := &g711Reader{r: r, table: muLawTable}
+	if aLaw {
+		g.table = aLawTable
+	}
+	return g
+}
+
+func (g *g711Reader) Read(p []byte) (int, error) {
+	n := len(p) / 2
+	if n == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	if len(g.buf) < n {
+		g.buf = make([]byte, n)
+	}
+	n, err := g.r.Read(g.buf[:n])
+	for i, b := range g.buf[:n] {
+		binary.LittleEndian.PutUint16(p[2*i:], uint16(g.table[b]))
+	}
+	return 2 * n, err
+}
@@ -0,0 +1,179 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"math"
+)
+
+// GainStep is the loudness change in dB of one global_gain step.
+const GainStep = 1.5
+
+// GainSteps returns the number of global_gain steps closest to gainDB, e.g. the track gain
+// of Encoder.ReplayGain or ID3v2Tag.ReplayGain. If peak (linear, 1.0 = full scale) is not 0
+// the steps are reduced until the adjusted peak does not clip.
+func GainSteps(gainDB, peak float64) int {
+	steps := int(math.Round(gainDB / GainStep))
+	for peak > 0 && peak*math.Pow(10, float64(steps)*GainStep/20) > 1 {
+		steps--
+	}
+	return steps
+}
+
+// ApplyGain copies a mp3 stream of the given size to w with its loudness changed by steps
+// of GainStep dB, like mp3gain. The global_gain of every granule is adjusted, so the audio
+// is not decoded and re-encoded and the change can be undone with -steps, except where
+// global_gain reaches its limits of 0 and 255.
+//
+// The Xing/Info frame, garbage and trailing tags are copied unchanged, so the music CRC of
+// a LAME tag no longer matches. ReplayGain values of a leading ID3v2 tag are updated.
+// It returns the number of bytes written.
+func ApplyGain(r io.ReaderAt, size int64, w io.Writer, steps int) (int64, error) {
+	start, end, err := audioRange(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := copyGainTag(r, start, w, steps)
+	if err != nil {
+		return written, err
+	}
+
+	// Room for a frame and the header of the next one to resync over garbage
+	frame := make([]byte, 2*maxFrameSize)
+	pos := start
+	for pos < end {
+		n := int(min(end-pos, 2*maxFrameSize))
+		if _, err := r.ReadAt(frame[:n], pos); err != nil && err != io.EOF {
+			return written, err
+		}
+		h, err := ParseFrameHeader(frame[:n])
+		if err != nil || h.Size > n {
+			// Garbage or a truncated frame, copied up to the next frame
+			k := n
+			if syncPos, err := FindFrameSync(frame[:n], 1); err == nil {
+				k = syncPos
+			}
+			m, err := w.Write(frame[:k])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			pos += int64(k)
+			continue
+		}
+
+		if !IsInfoFrame(frame[:h.Size]) {
+			adjustGlobalGain(frame[:h.Size], h, steps)
+		}
+		m, err := w.Write(frame[:h.Size])
+		written += int64(m)
+		if err != nil {
+			return written, err
+		}
+		pos += int64(h.Size)
+	}
+
+	n, err := io.Copy(w, io.NewSectionReader(r, end, size-end))
+	return written + n, err
+}
+
+// copyGainTag copies the leading tags up to start, updating the ReplayGain values of the
+// first ID3v2 tag for a change of steps.
+func copyGainTag(r io.ReaderAt, start int64, w io.Writer, steps int) (int64, error) {
+	var written, skip int64
+	if start > 0 {
+		tagSize, err := id3v2TagSize(r, 0)
+		if err != nil {
+			return 0, err
+		}
+		tag, err := ReadID3v2(io.NewSectionReader(r, 0, tagSize))
+		if err != nil {
+			// Not parsable, copied unchanged
+			tag = NewID3v2Tag()
+		}
+		if gainDB, peak, ok := tag.ReplayGain(); ok {
+			tag.SetReplayGain(gainDB-float64(steps)*GainStep, peak*math.Pow(10, float64(steps)*GainStep/20))
+			n, err := w.Write(tag.Bytes())
+			if err != nil {
+				return int64(n), err
+			}
+			written, skip = int64(n), tagSize
+		}
+	}
+	n, err := io.Copy(w, io.NewSectionReader(r, skip, start-skip))
+	return written + n, err
+}
+
+// adjustGlobalGain adds steps to the global_gain of every granule and channel of a layer III
+// frame, clamped to 0..255, and updates the CRC of protected frames.
+func adjustGlobalGain(frame []byte, h FrameHeader, steps int) {
+	side := FrameHeaderSize
+	if h.Protected {
+		side += 2
+	}
+	channels := h.NumChannels()
+
+	// Bit offset of the first granule and size of the fields of a granule and channel
+	granules, pos, fieldBits := 1, 8+channels, 63
+	if h.Version == MpegVersion1 {
+		granules, pos, fieldBits = 2, 9+4*channels, 59
+		if channels == 1 {
+			pos += 5
+		} else {
+			pos += 3
+		}
+	}
+	if side+h.sideInfoSize() > len(frame) {
+		return
+	}
+
+	for range granules * channels {
+		w := bitWriter{b: frame[side:], pos: pos + 12 + 9} // part2_3_length, big_values
+		r := bitReader{b: frame[side:], pos: w.pos}
+		gain := min(max(r.read(8)+steps, 0), 255)
+		w.write(8, gain)
+		pos += fieldBits
+	}
+
+	if h.Protected {
+		crc := frameCRC(frame[2:4], frame[side:side+h.sideInfoSize()])
+		frame[4], frame[5] = byte(crc>>8), byte(crc)
+	}
+}
+
+// frameCRC is the CRC-16 (polynomial 0x8005, initial value 0xffff) of a protected frame,
+// computed over the last two header bytes and the side information.
+func frameCRC(parts ...[]byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range bytes.Join(parts, nil) {
+		for i := 7; i >= 0; i-- {
+			bit := (crc>>15)^uint16(b>>i)&1 != 0
+			crc <<= 1
+			if bit {
+				crc ^= 0x8005
+			}
+		}
+	}
+	return crc
+}
+
+// bitWriter writes big-endian bit fields, writing past the end is ignored.
+type bitWriter struct {
+	b   []byte
+	pos int
+}
+
+func (w *bitWriter) write(n int, v int) {
+	for i := n - 1; i >= 0; i-- {
+		if j := w.pos / 8; j < len(w.b) {
+			mask := byte(1) << (7 - w.pos%8)
+			if v>>i&1 != 0 {
+				w.b[j] |= mask
+			} else {
+				w.b[j] &^= mask
+			}
+		}
+		w.pos++
+	}
+}
@@ -0,0 +1,115 @@
+package mp3_test
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// rms returns the root mean square of 16-bit PCM samples.
+func rms(pcm []byte) float64 {
+	sum := 0.0
+	for i := 0; i+1 < len(pcm); i += 2 {
+		v := float64(int16(uint16(pcm[i]) | uint16(pcm[i+1])<<8))
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(pcm)/2))
+}
+
+// TestApplyGain tests lossless loudness changes of the global_gain fields
+func TestApplyGain(t *testing.T) {
+	requireNative(t)
+	for _, tc := range []struct {
+		name   string
+		wav    []byte
+		config *mp3.EncoderConfig
+	}{
+		{"MPEG1 stereo", generateWavFile(44100, 2, 44100*2), &mp3.EncoderConfig{Bitrate: 128, FindReplayGain: true}},
+		{"MPEG2 mono", generateWavFile(16000, 1, 16000*2), &mp3.EncoderConfig{Bitrate: 32, FindReplayGain: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "gain.mp3")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			_, err = mp3.EncodeFromWav(bytes.NewReader(tc.wav), f, tc.config, nil)
+			f.Close()
+			if err != nil {
+				t.Fatalf("EncodeFromWav failed: %v", err)
+			}
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			srcTag, err := mp3.ReadID3v2(bytes.NewReader(src))
+			if err != nil {
+				t.Fatalf("ReadID3v2 failed: %v", err)
+			}
+			srcGain, srcPeak, ok := srcTag.ReplayGain()
+			if !ok {
+				t.Fatal("Source has no ReplayGain tag")
+			}
+
+			const steps = -2
+			var quieter bytes.Buffer
+			n, err := mp3.ApplyGain(bytes.NewReader(src), int64(len(src)), &quieter, steps)
+			if err != nil {
+				t.Fatalf("ApplyGain failed: %v", err)
+			}
+			if n != int64(quieter.Len()) {
+				t.Errorf("Written bytes mismatch: got %d, want %d", n, quieter.Len())
+			}
+
+			ratio := rms(decodeAll(t, quieter.Bytes())) / rms(decodeAll(t, src))
+			if want := math.Pow(10, steps*mp3.GainStep/20); math.Abs(ratio-want) > 0.02 {
+				t.Errorf("Level ratio = %.3f, want %.3f", ratio, want)
+			}
+			tag, err := mp3.ReadID3v2(bytes.NewReader(quieter.Bytes()))
+			if err != nil {
+				t.Fatalf("ReadID3v2 failed: %v", err)
+			}
+			if gain, peak, _ := tag.ReplayGain(); math.Abs(gain-(srcGain+3)) > 0.01 || peak >= srcPeak {
+				t.Errorf("ReplayGain not updated: %.2f dB peak %.4f, source %.2f dB peak %.4f", gain, peak, srcGain, srcPeak)
+			}
+
+			// The change is undone by the opposite steps
+			var restored bytes.Buffer
+			if _, err := mp3.ApplyGain(bytes.NewReader(quieter.Bytes()), int64(quieter.Len()), &restored, -steps); err != nil {
+				t.Fatalf("ApplyGain failed: %v", err)
+			}
+			info, err := mp3.Probe(bytes.NewReader(src), int64(len(src)))
+			if err != nil {
+				t.Fatalf("Probe failed: %v", err)
+			}
+			if !bytes.Equal(restored.Bytes()[info.AudioOffset:], src[info.AudioOffset:]) {
+				t.Error("Audio not restored")
+			}
+
+			t.Logf("✓ %d steps: level ratio %.3f", steps, ratio)
+		})
+	}
+}
+
+// TestGainSteps tests the conversion of a gain to global_gain steps
+func TestGainSteps(t *testing.T) {
+	testCases := []struct {
+		gainDB, peak float64
+		want         int
+	}{
+		{-6.2, 1, -4},
+		{3.1, 0, 2},
+		{3.1, 0.5, 2},
+		{3.1, 0.8, 1},
+		{3.1, 1.2, -2},
+	}
+	for _, tc := range testCases {
+		if got := mp3.GainSteps(tc.gainDB, tc.peak); got != tc.want {
+			t.Errorf("GainSteps(%v, %v) = %d, want %d", tc.gainDB, tc.peak, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,944 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// sfbShort are the scale factor band boundaries of short blocks by sample rate.
+var sfbShort = map[int][14]int{
+	44100: {0, 4, 8, 12, 16, 22, 30, 40, 52, 66, 84, 106, 136, 192},
+	48000: {0, 4, 8, 12, 16, 22, 28, 38, 50, 64, 80, 100, 126, 192},
+	32000: {0, 4, 8, 12, 16, 22, 30, 42, 58, 78, 104, 138, 180, 192},
+	22050: {0, 4, 8, 12, 18, 24, 32, 42, 56, 74, 100, 132, 174, 192},
+	24000: {0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 136, 180, 192},
+	16000: {0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+	11025: {0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+	12000: {0, 4, 8, 12, 18, 26, 36, 48, 62, 80, 104, 134, 174, 192},
+	8000:  {0, 8, 16, 24, 36, 52, 72, 96, 124, 160, 162, 164, 166, 192},
+}
+
+// pretab is added to the long block scale factors of granules with preflag.
+var pretab = [22]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 3, 2, 0}
+
+// slenTable are the MPEG-1 scale factor lengths of the two band groups by scalefac_compress.
+var slenTable = [2][16]int{
+	{0, 0, 0, 0, 3, 1, 1, 1, 2, 2, 2, 3, 3, 3, 4, 4},
+	{0, 1, 2, 3, 0, 1, 2, 3, 1, 2, 3, 1, 2, 3, 2, 3},
+}
+
+// nrOfSfb is the number of MPEG-2 scale factors in each of the four length groups, by the
+// scalefac_compress range and by long, short and mixed blocks. Short block counts include
+// the three windows.
+var nrOfSfb = [6][3][4]int{
+	{{6, 5, 5, 5}, {9, 9, 9, 9}, {6, 9, 9, 9}},
+	{{6, 5, 7, 3}, {9, 9, 12, 6}, {6, 9, 12, 6}},
+	{{11, 10, 0, 0}, {18, 18, 0, 0}, {15, 18, 0, 0}},
+	{{7, 7, 7, 0}, {12, 12, 12, 0}, {6, 15, 12, 0}},
+	{{6, 6, 6, 3}, {12, 9, 9, 6}, {6, 12, 9, 6}},
+	{{8, 8, 5, 0}, {15, 12, 9, 0}, {6, 18, 9, 0}},
+}
+
+// huffTree is a decoding tree of a huffTable. Each node holds the indexes of its two children,
+// leaves are stored as -1-index of the coded value.
+type huffTree [][2]int32
+
+func newHuffTree(h *huffTable) huffTree {
+	t := huffTree{{}}
+	for v := range h.codes {
+		node := 0
+		for b := int(h.lens[v]) - 1; b >= 0; b-- {
+			bit := h.codes[v] >> b & 1
+			if b == 0 {
+				t[node][bit] = int32(-1 - v)
+				break
+			}
+			if t[node][bit] == 0 {
+				t = append(t, [2]int32{})
+				t[node][bit] = int32(len(t) - 1)
+			}
+			node = int(t[node][bit])
+		}
+	}
+	return t
+}
+
+// decode reads one code. Codes missing from the table decode as 0.
+func (t huffTree) decode(r *bitReader) int {
+	node := int32(0)
+	for {
+		node = t[node][r.read(1)]
+		if node < 0 {
+			return int(-1 - node)
+		}
+		if node == 0 {
+			return 0
+		}
+	}
+}
+
+// Huffman trees, requantization, IMDCT and synthesis tables of the decoder.
+var (
+	goDecTablesOnce sync.Once
+	huffTrees       [32]huffTree
+	count1Trees     [2]huffTree
+	pow43           [maxQuantValue + 1]float64
+	imdctLong       [36][18]float64
+	imdctShort      [12][6]float64
+	imdctWindow     [4][36]float64 // by block type, the short block window is in imdctWindow[2][:12]
+	synthMatrix     [64][numSubbands]float64
+	synthD          [512]float64
+)
+
+func initGoDecTables() {
+	goEncTablesOnce.Do(initGoEncTables) // alias reduction coefficients
+	for i := range huffTables {
+		if huffTables[i].dim > 0 {
+			huffTrees[i] = newHuffTree(&huffTables[i])
+		}
+	}
+	for i := range count1Tables {
+		count1Trees[i] = newHuffTree(&count1Tables[i])
+	}
+	for i := range pow43 {
+		pow43[i] = math.Pow(float64(i), 4.0/3)
+	}
+	for i := range imdctLong {
+		for k := range imdctLong[i] {
+			imdctLong[i][k] = math.Cos(math.Pi / 72 * float64((2*i+1+18)*(2*k+1)))
+		}
+	}
+	for i := range imdctShort {
+		for k := range imdctShort[i] {
+			imdctShort[i][k] = math.Cos(math.Pi / 24 * float64((2*i+1+6)*(2*k+1)))
+		}
+	}
+	for i := range 36 {
+		long := math.Sin(math.Pi / 36 * (float64(i) + 0.5))
+		imdctWindow[BlockNormal][i] = long
+		switch {
+		case i < 18:
+			imdctWindow[BlockStart][i] = long
+		case i < 24:
+			imdctWindow[BlockStart][i] = 1
+		case i < 30:
+			imdctWindow[BlockStart][i] = math.Sin(math.Pi / 12 * (float64(i-18) + 0.5))
+		}
+		switch {
+		case i >= 18:
+			imdctWindow[BlockStop][i] = long
+		case i >= 12:
+			imdctWindow[BlockStop][i] = 1
+		case i >= 6:
+			imdctWindow[BlockStop][i] = math.Sin(math.Pi / 12 * (float64(i-6) + 0.5))
+		}
+		if i < 12 {
+			imdctWindow[BlockShort][i] = math.Sin(math.Pi / 12 * (float64(i) + 0.5))
+		}
+	}
+	for i := range synthMatrix {
+		for k := range synthMatrix[i] {
+			synthMatrix[i][k] = math.Cos(float64((16+i)*(2*k+1)) * math.Pi / 64)
+		}
+	}
+	for i := range synthD {
+		j := i
+		if i > 256 {
+			j = 512 - i
+		}
+		d := float64(synthWindow[j]) / 65536
+		if (i/64)%2 == 1 {
+			d = -d
+		}
+		synthD[i] = d
+	}
+}
+
+// decGranule is the side information of one granule and channel.
+type decGranule struct {
+	part23           int // bits of scale factors and Huffman data
+	bigValues        int
+	globalGain       int
+	scalefacCompress int
+	blockType        BlockType
+	mixed            bool
+	tableSelect      [3]int
+	subblockGain     [3]int
+	region1, region2 int // first line of the big value regions 1 and 2
+	preflag          bool
+	scalefacScale    bool
+	count1Table      int
+}
+
+// short reports whether the granule uses short blocks, mixed or not.
+func (g *decGranule) short() bool {
+	return g.blockType == BlockShort
+}
+
+// decSideInfo is the layer III side information of a frame.
+type decSideInfo struct {
+	mainDataBegin int
+	scfsi         [2][4]bool
+	gr            [2][2]decGranule
+}
+
+// decScalefactors are the scale factors of one granule and channel. lmax and smax hold the
+// largest value each MPEG-2 scale factor can take, which marks an illegal intensity position.
+type decScalefactors struct {
+	l    [22]int
+	s    [13][3]int
+	lmax [22]int
+	smax [13][3]int
+}
+
+// goDecoder is a layer III decoder written in Go. It decodes MPEG-1, 2 and 2.5 with all block
+// types, M/S and intensity stereo, and outputs 16-bit PCM with the channels of the first frame.
+// Like mpg123 it skips ID3v2 tags and garbage between frames, drops the Xing/Info frame and
+// removes the encoder delay and padding stored in a LAME tag. A frame that refers to more bit
+// reservoir than the stream has provided, e.g. after a cut, is decoded as silence. Unlike
+// mpg123 it keeps the bit reservoir across garbage, so the frame after it is not muted.
+type goDecoder struct {
+	in      []byte // input not decoded yet
+	skipIn  int    // bytes of an ID3v2 tag still to skip
+	pcm     []byte // decoded PCM not yet returned
+	pcmPos  int
+	locked  bool // the first frame was found
+	inSync  bool // in starts where the previous frame ended
+	first   FrameHeader
+	outChan int
+
+	// Samples per channel decoded, and the ranges of them dropped as encoder delay and padding
+	decoded              int64
+	delayEnd             int64
+	paddingStart, tagEnd int64
+
+	reservoir []byte
+	scf       [2]decScalefactors
+	is        [2][granuleSize]int
+	xr        [2][granuleSize]float64
+	overlap   [2][numSubbands][18]float64
+	synth     [2][1024]float64
+	synthPos  [2]int
+	samples   [2][granuleSize]float64
+}
+
+// NewGoDecoderBackend creates the built-in layer III decoder. NewDecoder uses it in builds
+// without mpg123 unless another backend is registered with RegisterDecoderBackend.
+func NewGoDecoderBackend() (DecoderBackend, error) {
+	goDecTablesOnce.Do(initGoDecTables)
+	return &goDecoder{}, nil
+}
+
+func (d *goDecoder) Decode(in, out []byte) (int, error) {
+	d.in = append(d.in, in...)
+	n := 0
+	for {
+		k := copy(out[n:], d.pcm[d.pcmPos:])
+		n += k
+		d.pcmPos += k
+		if d.pcmPos < len(d.pcm) || n == len(out) {
+			return n, nil
+		}
+		d.pcm, d.pcmPos = d.pcm[:0], 0
+		if !d.nextFrame() {
+			return n, nil
+		}
+	}
+}
+
+func (d *goDecoder) Format() (sampleRate int, numChannels int, sampleBitDepth int) {
+	return d.first.SampleRate, d.outChan, 16
+}
+
+func (d *goDecoder) Close() {
+	d.in, d.pcm, d.reservoir = nil, nil, nil
+}
+
+// nextFrame takes the next frame from the input and decodes it. It returns false if the input
+// does not hold a complete frame.
+func (d *goDecoder) nextFrame() bool {
+	for {
+		if d.skipIn > 0 {
+			k := min(d.skipIn, len(d.in))
+			d.in = d.in[k:]
+			d.skipIn -= k
+		}
+		if len(d.in) < ID3v2HeaderSize {
+			return false
+		}
+		if string(d.in[:3]) == "ID3" && d.in[3] < 0xff && d.in[4] < 0xff && syncsafeValid(d.in[6:10]) {
+			d.skipIn = ID3v2HeaderSize + syncsafe(d.in[6:10])
+			if d.in[5]&0x10 != 0 {
+				d.skipIn += ID3v2HeaderSize // footer
+			}
+			d.inSync = false
+			continue
+		}
+
+		h, err := ParseFrameHeader(d.in)
+		if err == nil && d.consistent(h) {
+			if len(d.in) < h.Size {
+				return false
+			}
+			if d.inSync || len(d.in) == h.Size {
+				break
+			}
+			// A frame found after junk is only trusted if another one follows it
+			if len(d.in) < h.Size+FrameHeaderSize {
+				return false
+			}
+			if next, err := ParseFrameHeader(d.in[h.Size:]); err == nil && d.consistent(next) {
+				break
+			}
+		}
+		d.inSync = false
+		i := 1
+		for i < len(d.in) && d.in[i] != 0xff && d.in[i] != 'I' {
+			i++
+		}
+		d.in = d.in[i:]
+	}
+
+	h, _ := ParseFrameHeader(d.in)
+	frame := d.in[:h.Size]
+	d.in = d.in[h.Size:]
+	d.inSync = true
+	if !d.locked {
+		d.locked = true
+		d.first = h
+		d.outChan = h.NumChannels()
+		if IsInfoFrame(frame) {
+			d.gapless(frame, h)
+			return true
+		}
+	}
+	d.decodeFrame(frame, h)
+	return true
+}
+
+// gapless sets up the removal of the encoder delay and padding from the LAME extension of
+// the Info frame. Like mpg123, it also reads the extension ffmpeg writes under its own name,
+// and outputs frames past the frame count of the Info frame in full.
+func (d *goDecoder) gapless(frame []byte, h FrameHeader) {
+	frames, ok := infoFrameCount(frame)
+	ext := infoExtension(frame, h)
+	if !ok || ext == nil {
+		return
+	}
+	if name := string(ext[:4]); name != "LAME" && name != "Lavc" && name != "Lavf" {
+		return
+	}
+	delay, padding := extGapless(ext)
+	d.tagEnd = int64(frames) * int64(h.Samples)
+	d.delayEnd = min(int64(delay+gaplessDecoderDelay), d.tagEnd)
+	d.paddingStart = max(d.tagEnd-int64(padding)+gaplessDecoderDelay, d.delayEnd)
+}
+
+// consistent reports whether h can belong to the stream of the first frame.
+func (d *goDecoder) consistent(h FrameHeader) bool {
+	return !d.locked || (h.Version == d.first.Version && h.SampleRate == d.first.SampleRate)
+}
+
+// syncsafeValid reports whether b is a syncsafe integer.
+func syncsafeValid(b []byte) bool {
+	return b[0]|b[1]|b[2]|b[3] < 0x80
+}
+
+// decodeFrame decodes a frame and appends its samples to pcm.
+func (d *goDecoder) decodeFrame(frame []byte, h FrameHeader) {
+	sideStart := FrameHeaderSize
+	if h.Protected {
+		sideStart += 2
+	}
+	sideEnd := sideStart + h.sideInfoSize()
+	if sideEnd > len(frame) {
+		return
+	}
+	si := readSideInfo(h, frame[sideStart:sideEnd])
+
+	// The main data starts main_data_begin bytes before this frame's in the bit reservoir
+	start := len(d.reservoir) - si.mainDataBegin
+	d.reservoir = append(d.reservoir, frame[sideEnd:]...)
+	var main []byte
+	if start >= 0 {
+		main = d.reservoir[start:]
+	}
+
+	channels := h.NumChannels()
+	modeExt := frame[3] >> 4 & 3
+	ms := h.Mode == MpegJointStereo && modeExt&2 != 0
+	intensity := h.Mode == MpegJointStereo && modeExt&1 != 0
+	granules := 1
+	if h.Version == MpegVersion1 {
+		granules = 2
+	}
+
+	r := bitReader{b: main}
+	for gr := range granules {
+		for ch := range channels {
+			g := &si.gr[gr][ch]
+			end := r.pos + g.part23
+			if main == nil || end > 8*len(main) {
+				// Missing bit reservoir or corrupt side information
+				clear(d.xr[ch][:])
+				clear(d.is[ch][:])
+				r.pos = end
+				continue
+			}
+			if h.Version == MpegVersion1 {
+				d.readScalefactors(&r, g, si.scfsi[ch], gr, ch)
+			} else {
+				d.readScalefactorsLSF(&r, g, intensity && ch == 1, ch)
+			}
+			d.readHuffman(&r, g, end, &d.is[ch])
+			r.pos = end
+			d.requantize(h, g, ch)
+		}
+		if ms || intensity {
+			d.stereo(h, &si.gr[gr][1], ms, intensity)
+		}
+		for ch := range channels {
+			d.hybrid(h, &si.gr[gr][ch], ch)
+			d.synthesize(ch)
+		}
+		d.output(channels)
+	}
+
+	if n := len(d.reservoir); n > maxReservoirBytes {
+		d.reservoir = append(d.reservoir[:0], d.reservoir[n-maxReservoirBytes:]...)
+	}
+}
+
+// readSideInfo reads the side information of a frame.
+func readSideInfo(h FrameHeader, side []byte) (si decSideInfo) {
+	r := bitReader{b: side}
+	channels := h.NumChannels()
+	granules := 1
+	if h.Version == MpegVersion1 {
+		granules = 2
+		si.mainDataBegin = r.read(9)
+		if channels == 1 {
+			r.skip(5)
+		} else {
+			r.skip(3)
+		}
+		for ch := range channels {
+			for i := range 4 {
+				si.scfsi[ch][i] = r.read(1) == 1
+			}
+		}
+	} else {
+		si.mainDataBegin = r.read(8)
+		r.skip(channels) // private bits
+	}
+
+	sfb := sfbLong[h.SampleRate]
+	for gr := range granules {
+		for ch := range channels {
+			g := &si.gr[gr][ch]
+			g.part23 = r.read(12)
+			g.bigValues = min(r.read(9), granuleSize/2)
+			g.globalGain = r.read(8)
+			if h.Version == MpegVersion1 {
+				g.scalefacCompress = r.read(4)
+			} else {
+				g.scalefacCompress = r.read(9)
+			}
+			if r.read(1) == 1 { // window_switching_flag
+				g.blockType = BlockType(r.read(2))
+				g.mixed = r.read(1) == 1 && g.blockType == BlockShort
+				g.tableSelect[0] = r.read(5)
+				g.tableSelect[1] = r.read(5)
+				for w := range 3 {
+					g.subblockGain[w] = r.read(3)
+				}
+				// The region boundaries are implicit, as in mpg123
+				switch {
+				case h.Version == MpegVersion25:
+					r0 := 7
+					if g.blockType == BlockShort && !g.mixed {
+						r0 = 5
+					}
+					g.region1 = sfb[r0+1]
+				case h.Version == MpegVersion1 || g.blockType == BlockShort:
+					g.region1 = 36
+				default:
+					g.region1 = 54
+				}
+				g.region2 = granuleSize
+			} else {
+				for i := range 3 {
+					g.tableSelect[i] = r.read(5)
+				}
+				r0 := r.read(4)
+				r1 := r.read(3)
+				g.region1 = sfb[min(r0+1, 22)]
+				g.region2 = sfb[min(r0+r1+2, 22)]
+			}
+			if h.Version == MpegVersion1 {
+				g.preflag = r.read(1) == 1
+			}
+			g.scalefacScale = r.read(1) == 1
+			g.count1Table = r.read(1)
+		}
+	}
+	return si
+}
+
+// readScalefactors reads the MPEG-1 scale factors. Bands of granule 1 flagged in scfsi keep
+// the scale factors of granule 0.
+func (d *goDecoder) readScalefactors(r *bitReader, g *decGranule, scfsi [4]bool, gr, ch int) {
+	slen1, slen2 := slenTable[0][g.scalefacCompress], slenTable[1][g.scalefacCompress]
+	sf := &d.scf[ch]
+	if g.short() {
+		sfb := 0
+		if g.mixed {
+			for ; sfb < 8; sfb++ {
+				sf.l[sfb] = r.read(slen1)
+			}
+			sfb = 3
+		}
+		for ; sfb < 12; sfb++ {
+			n := slen1
+			if sfb >= 6 {
+				n = slen2
+			}
+			for w := range 3 {
+				sf.s[sfb][w] = r.read(n)
+			}
+		}
+		sf.s[12] = [3]int{}
+		return
+	}
+	bands := [5]int{0, 6, 11, 16, 21}
+	for i := range 4 {
+		if gr == 1 && scfsi[i] {
+			continue
+		}
+		n := slen1
+		if i >= 2 {
+			n = slen2
+		}
+		for sfb := bands[i]; sfb < bands[i+1]; sfb++ {
+			sf.l[sfb] = r.read(n)
+		}
+	}
+	sf.l[21] = 0
+}
+
+// readScalefactorsLSF reads the MPEG-2 scale factors. The right channel of intensity stereo
+// frames codes them differently and sets the intensity scale in scalefac_compress.
+func (d *goDecoder) readScalefactorsLSF(r *bitReader, g *decGranule, intensityRight bool, ch int) {
+	sfc := g.scalefacCompress
+	var slen [4]int
+	table := 0
+	if intensityRight {
+		sfc >>= 1
+		switch {
+		case sfc < 180:
+			slen = [4]int{sfc / 36, sfc % 36 / 6, sfc % 36 % 6, 0}
+			table = 3
+		case sfc < 244:
+			sfc -= 180
+			slen = [4]int{sfc % 64 >> 4, sfc % 16 >> 2, sfc % 4, 0}
+			table = 4
+		default:
+			sfc -= 244
+			slen = [4]int{sfc / 3, sfc % 3, 0, 0}
+			table = 5
+		}
+	} else {
+		switch {
+		case sfc < 400:
+			slen = [4]int{(sfc >> 4) / 5, (sfc >> 4) % 5, sfc & 15 >> 2, sfc & 3}
+		case sfc < 500:
+			sfc -= 400
+			slen = [4]int{(sfc >> 2) / 5, (sfc >> 2) % 5, sfc & 3, 0}
+			table = 1
+		default:
+			sfc -= 500
+			slen = [4]int{sfc / 3, sfc % 3, 0, 0}
+			table = 2
+			g.preflag = true
+		}
+	}
+	blocks := 0
+	if g.short() {
+		blocks = 1
+		if g.mixed {
+			blocks = 2
+		}
+	}
+
+	sf := &d.scf[ch]
+	*sf = decScalefactors{}
+	k := 0 // scale factor index in the order of the bitstream
+	for i, count := range nrOfSfb[table][blocks] {
+		for range count {
+			v, vmax := r.read(slen[i]), 1<<slen[i]-1
+			switch {
+			case !g.short():
+				sf.l[k], sf.lmax[k] = v, vmax
+			case g.mixed && k < 6:
+				sf.l[k], sf.lmax[k] = v, vmax
+			case g.mixed:
+				sf.s[3+(k-6)/3][(k-6)%3], sf.smax[3+(k-6)/3][(k-6)%3] = v, vmax
+			default:
+				sf.s[k/3][k%3], sf.smax[k/3][k%3] = v, vmax
+			}
+			k++
+		}
+	}
+}
+
+// readHuffman reads the quantized values of a granule up to bit end.
+func (d *goDecoder) readHuffman(r *bitReader, g *decGranule, end int, is *[granuleSize]int) {
+	i := 0
+	for ; i < 2*g.bigValues; i += 2 {
+		t := g.tableSelect[0]
+		if i >= g.region2 {
+			t = g.tableSelect[2]
+		} else if i >= g.region1 {
+			t = g.tableSelect[1]
+		}
+		h := &huffTables[t]
+		if h.dim == 0 {
+			is[i], is[i+1] = 0, 0
+			continue
+		}
+		v := huffTrees[t].decode(r)
+		x, y := v/h.dim, v%h.dim
+		if x == 15 && h.linbits > 0 {
+			x += r.read(h.linbits)
+		}
+		if x != 0 && r.read(1) == 1 {
+			x = -x
+		}
+		if y == 15 && h.linbits > 0 {
+			y += r.read(h.linbits)
+		}
+		if y != 0 && r.read(1) == 1 {
+			y = -y
+		}
+		is[i], is[i+1] = x, y
+	}
+
+	tree := count1Trees[g.count1Table]
+	for i+4 <= granuleSize && r.pos < end {
+		v := tree.decode(r)
+		q := [4]int{v >> 3 & 1, v >> 2 & 1, v >> 1 & 1, v & 1}
+		for j := range q {
+			if q[j] != 0 && r.read(1) == 1 {
+				q[j] = -1
+			}
+		}
+		if r.pos > end {
+			break // the last quadruple overran part2_3_length, encoders pad with it
+		}
+		copy(is[i:i+4], q[:])
+		i += 4
+	}
+	clear(is[i:])
+}
+
+// requantize scales the quantized values of a channel into xr.
+func (d *goDecoder) requantize(h FrameHeader, g *decGranule, ch int) {
+	is, xr, sf := &d.is[ch], &d.xr[ch], &d.scf[ch]
+	gain := float64(g.globalGain-210) / 4
+	mult := 0.5
+	if g.scalefacScale {
+		mult = 1
+	}
+	scale := func(q int, exp float64) float64 {
+		if q == 0 {
+			return 0
+		}
+		v := pow43[min(abs(q), maxQuantValue)] * math.Exp2(exp)
+		if q < 0 {
+			return -v
+		}
+		return v
+	}
+
+	long := sfbLong[h.SampleRate]
+	longEnd := granuleSize
+	if g.short() {
+		longEnd = 0
+		if g.mixed {
+			longEnd = long[longBandsMixed(h)]
+		}
+	}
+	for sfb := 0; long[sfb] < longEnd; sfb++ {
+		exp := float64(sf.l[sfb])
+		if g.preflag {
+			exp += float64(pretab[sfb])
+		}
+		exp = gain - mult*exp
+		for i := long[sfb]; i < long[sfb+1]; i++ {
+			xr[i] = scale(is[i], exp)
+		}
+	}
+	if !g.short() {
+		return
+	}
+	short := sfbShort[h.SampleRate]
+	sfb := 0
+	if g.mixed {
+		sfb = 3
+	}
+	for ; sfb < 13; sfb++ {
+		width := short[sfb+1] - short[sfb]
+		for w := range 3 {
+			exp := gain - 2*float64(g.subblockGain[w]) - mult*float64(sf.s[sfb][w])
+			for i := 3*short[sfb] + w*width; i < 3*short[sfb]+(w+1)*width; i++ {
+				xr[i] = scale(is[i], exp)
+			}
+		}
+	}
+}
+
+// longBandsMixed returns the number of long scale factor bands of a mixed block.
+func longBandsMixed(h FrameHeader) int {
+	if h.Version == MpegVersion1 {
+		return 8
+	}
+	return 6
+}
+
+// stereo undoes M/S and intensity stereo. g is the granule of the right channel, which
+// carries the intensity positions in its scale factors.
+func (d *goDecoder) stereo(h FrameHeader, g *decGranule, ms, intensity bool) {
+	// isPos holds the intensity position of each line of the right channel, -1 if the line
+	// is not intensity coded
+	var isPos [granuleSize]int
+	for i := range isPos {
+		isPos[i] = -1
+	}
+	if intensity {
+		d.intensityPositions(h, g, &isPos)
+	}
+
+	left, right := &d.xr[0], &d.xr[1]
+	for i := range granuleSize {
+		if p := isPos[i]; p >= 0 {
+			kl, kr := intensityRatio(h, p, g.scalefacCompress&1)
+			left[i], right[i] = left[i]*kl, left[i]*kr
+		} else if ms {
+			m, s := left[i], right[i]
+			left[i], right[i] = (m+s)*math.Sqrt2/2, (m-s)*math.Sqrt2/2
+		}
+	}
+}
+
+// intensityRatio returns the factors of the left and right channel for an intensity position.
+func intensityRatio(h FrameHeader, pos, scale int) (kl, kr float64) {
+	if h.Version == MpegVersion1 {
+		s, c := math.Sincos(float64(pos) * math.Pi / 12)
+		return s / (s + c), c / (s + c)
+	}
+	if pos == 0 {
+		return 1, 1
+	}
+	i0 := math.Exp2(-float64(scale+1) / 4)
+	if pos%2 == 1 {
+		return math.Pow(i0, float64(pos+1)/2), 1
+	}
+	return 1, math.Pow(i0, float64(pos)/2)
+}
+
+// intensityPositions sets the intensity positions of the bands above the last non-zero band
+// of the right channel, per window in short blocks.
+func (d *goDecoder) intensityPositions(h FrameHeader, g *decGranule, isPos *[granuleSize]int) {
+	right, sf := &d.is[1], &d.scf[1]
+	illegal := func(v, vmax int) bool {
+		if h.Version == MpegVersion1 {
+			return v == 7
+		}
+		return v == vmax
+	}
+
+	long := sfbLong[h.SampleRate]
+	longBands := 22
+	if g.short() {
+		short := sfbShort[h.SampleRate]
+		first := 0
+		if g.mixed {
+			first = 3
+		}
+		zeroShort := true
+		for w := range 3 {
+			bound := first
+			for sfb := first; sfb < 13; sfb++ {
+				width := short[sfb+1] - short[sfb]
+				for i := 3*short[sfb] + w*width; i < 3*short[sfb]+(w+1)*width; i++ {
+					if right[i] != 0 {
+						bound = sfb + 1
+						zeroShort = false
+						break
+					}
+				}
+			}
+			for sfb := bound; sfb < 13; sfb++ {
+				src := min(sfb, 11) // the last band uses the position of the one below
+				if illegal(sf.s[src][w], sf.smax[src][w]) {
+					continue
+				}
+				width := short[sfb+1] - short[sfb]
+				for i := 3*short[sfb] + w*width; i < 3*short[sfb]+(w+1)*width; i++ {
+					isPos[i] = sf.s[src][w]
+				}
+			}
+		}
+		if !g.mixed || !zeroShort {
+			return
+		}
+		longBands = longBandsMixed(h)
+	}
+
+	bound := 0
+	for sfb := range longBands {
+		for i := long[sfb]; i < long[sfb+1]; i++ {
+			if right[i] != 0 {
+				bound = sfb + 1
+				break
+			}
+		}
+	}
+	for sfb := bound; sfb < longBands; sfb++ {
+		src := min(sfb, 20) // the last band uses the position of the one below
+		if illegal(sf.l[src], sf.lmax[src]) {
+			continue
+		}
+		for i := long[sfb]; i < long[sfb+1]; i++ {
+			isPos[i] = sf.l[src]
+		}
+	}
+}
+
+// hybrid reorders short blocks, reduces the aliasing, and runs the IMDCT with overlap-add.
+// The time samples of subband sb replace xr[18*sb:18*sb+18].
+func (d *goDecoder) hybrid(h FrameHeader, g *decGranule, ch int) {
+	xr := &d.xr[ch]
+	longEnd := granuleSize
+	if g.short() {
+		longEnd = 0
+		if g.mixed {
+			longEnd = 36
+		}
+		// Short blocks are coded band by band, each with the three windows in a row.
+		// Interleave the windows so that subband sb holds its 6 lines of each window.
+		short := sfbShort[h.SampleRate]
+		var tmp [granuleSize]float64
+		sfb := 0
+		if g.mixed {
+			sfb = 3
+		}
+		for ; sfb < 13; sfb++ {
+			width := short[sfb+1] - short[sfb]
+			for w := range 3 {
+				for j := range width {
+					tmp[3*(short[sfb]+j)+w] = xr[3*short[sfb]+w*width+j]
+				}
+			}
+		}
+		copy(xr[longEnd:], tmp[longEnd:])
+	}
+
+	for sb := 1; sb < numSubbands && 18*sb < longEnd; sb++ {
+		for k := range 8 {
+			a, b := xr[18*sb-1-k], xr[18*sb+k]
+			xr[18*sb-1-k] = a*aliasCs[k] - b*aliasCa[k]
+			xr[18*sb+k] = b*aliasCs[k] + a*aliasCa[k]
+		}
+	}
+
+	for sb := range numSubbands {
+		var z [36]float64
+		x := xr[18*sb : 18*sb+18]
+		if 18*sb < longEnd {
+			bt := g.blockType
+			if g.mixed {
+				bt = BlockNormal
+			}
+			for i := range z {
+				s := 0.0
+				for k, v := range x {
+					s += v * imdctLong[i][k]
+				}
+				z[i] = s * imdctWindow[bt][i]
+			}
+		} else {
+			for w := range 3 {
+				for i := range 12 {
+					s := 0.0
+					for k := range 6 {
+						s += x[3*k+w] * imdctShort[i][k]
+					}
+					z[6+6*w+i] += s * imdctWindow[BlockShort][i]
+				}
+			}
+		}
+		prev := &d.overlap[ch][sb]
+		for i := range 18 {
+			x[i] = z[i] + prev[i]
+			prev[i] = z[i+18]
+		}
+		if sb%2 == 1 {
+			for i := 1; i < 18; i += 2 {
+				x[i] = -x[i]
+			}
+		}
+	}
+}
+
+// synthesize runs the polyphase synthesis filterbank on the subband samples in xr.
+func (d *goDecoder) synthesize(ch int) {
+	v := &d.synth[ch]
+	out := &d.samples[ch]
+	for t := range 18 {
+		d.synthPos[ch] = (d.synthPos[ch] - 64) & 1023
+		pos := d.synthPos[ch]
+		for i := range 64 {
+			s := 0.0
+			for k := range numSubbands {
+				s += synthMatrix[i][k] * d.xr[ch][18*k+t]
+			}
+			v[(pos+i)&1023] = s
+		}
+		for j := range numSubbands {
+			s := 0.0
+			for i := range 8 {
+				s += v[(pos+128*i+j)&1023] * synthD[64*i+j]
+				s += v[(pos+128*i+96+j)&1023] * synthD[64*i+32+j]
+			}
+			out[32*t+j] = s
+		}
+	}
+}
+
+// output appends the samples of a granule to pcm, dropping the encoder delay and padding.
+func (d *goDecoder) output(channels int) {
+	for i := range granuleSize {
+		pos := d.decoded
+		d.decoded++
+		if pos < d.delayEnd || (pos >= d.paddingStart && pos < d.tagEnd) {
+			continue
+		}
+		l, r := d.samples[0][i], d.samples[0][i]
+		if channels == 2 {
+			r = d.samples[1][i]
+		}
+		if d.outChan == 1 {
+			d.pcm = appendPCM16(d.pcm, (l+r)/2)
+		} else {
+			d.pcm = appendPCM16(appendPCM16(d.pcm, l), r)
+		}
+	}
+}
+
+// appendPCM16 appends a sample in the range -1 to 1 as 16-bit little-endian PCM.
+func appendPCM16(b []byte, v float64) []byte {
+	s := max(-32768, min(32767, math.Round(v*32768)))
+	return binary.LittleEndian.AppendUint16(b, uint16(int16(s)))
+}
@@ -0,0 +1,216 @@
+package mp3_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// decodeGo decodes data with the Go decoder backend, feeding it in chunks of chunkSize bytes
+// and reading into a small output buffer to exercise its buffering.
+func decodeGo(t *testing.T, data []byte, chunkSize int) (pcm []byte, sampleRate, channels int) {
+	t.Helper()
+	backend, err := mp3.NewGoDecoderBackend()
+	if err != nil {
+		t.Fatalf("NewGoDecoderBackend failed: %v", err)
+	}
+	defer backend.Close()
+	out := make([]byte, 1000)
+	for pos := 0; pos < len(data); pos += chunkSize {
+		in := data[pos:min(pos+chunkSize, len(data))]
+		for {
+			n, err := backend.Decode(in, out)
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			pcm = append(pcm, out[:n]...)
+			if n < len(out) {
+				break
+			}
+			in = nil
+		}
+	}
+	sampleRate, channels, _ = backend.Format()
+	return pcm, sampleRate, channels
+}
+
+// generateBursts generates a chord that is switched on and off every 100 ms, the attacks
+// make LAME use short blocks.
+func generateBursts(sampleRate, channels, numSamples int) []byte {
+	data := generateChord(sampleRate, channels, numSamples)
+	for i := range numSamples {
+		if i/(sampleRate/10)%2 == 1 {
+			clear(data[i*channels*2 : (i+1)*channels*2])
+		}
+	}
+	return data
+}
+
+// TestGoDecoderBackend compares the Go decoder with mpg123
+func TestGoDecoderBackend(t *testing.T) {
+	requireNative(t)
+	tests := []mp3.EncoderConfig{
+		{SampleRate: 44100, NumChannels: 2, Bitrate: 128},
+		{SampleRate: 44100, NumChannels: 2, Bitrate: 128, IsWriteVbrTag: true},
+		{SampleRate: 48000, NumChannels: 2, Bitrate: 320, MpegMode: mp3.MpegStereo, ErrorProtection: true},
+		{SampleRate: 32000, NumChannels: 1, Bitrate: 48},
+		{SampleRate: 44100, NumChannels: 2, VbrMode: mp3.VbrModeMtrh, VbrQuality: 2, IsWriteVbrTag: true},
+		{SampleRate: 22050, NumChannels: 2, Bitrate: 64},
+		{SampleRate: 24000, NumChannels: 1, Bitrate: 32},
+		{SampleRate: 16000, NumChannels: 2, Bitrate: 48},
+		{SampleRate: 11025, NumChannels: 1, Bitrate: 24},
+		{SampleRate: 8000, NumChannels: 1, Bitrate: 16},
+	}
+	for _, c := range tests {
+		t.Run(fmt.Sprintf("%d %dch %dkbps vbr %d", c.SampleRate, c.NumChannels, c.Bitrate, c.VbrMode), func(t *testing.T) {
+			enc, err := mp3.NewEncoder(&c)
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			defer enc.Close()
+			pcm := generateBursts(c.SampleRate, c.NumChannels, c.SampleRate)
+			out := make([]byte, len(pcm)+16384)
+			n, err := enc.Encode(pcm, out)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			m, err := enc.Flush(out[n:])
+			if err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			data := out[:n+m]
+			if c.IsWriteVbrTag {
+				tag, err := enc.GetLameTagFrame()
+				if err != nil {
+					t.Fatalf("GetLameTagFrame failed: %v", err)
+				}
+				copy(data, tag)
+			}
+			compareDecoders(t, data)
+		})
+	}
+}
+
+func compareDecoders(t *testing.T, data []byte) {
+	t.Helper()
+	want := decodeAll(t, data)
+	got, sampleRate, channels := decodeGo(t, data, 1000)
+	if len(got) != len(want) {
+		t.Errorf("Decoded %d bytes, mpg123 decoded %d", len(got), len(want))
+	}
+	maxDiff, diffs := 0, 0
+	for i := 0; i+1 < min(len(got), len(want)); i += 2 {
+		a := int(int16(uint16(got[i]) | uint16(got[i+1])<<8))
+		b := int(int16(uint16(want[i]) | uint16(want[i+1])<<8))
+		d := max(a-b, b-a)
+		maxDiff = max(maxDiff, d)
+		if d > 1 {
+			diffs++
+		}
+	}
+	if maxDiff > 2 {
+		t.Errorf("Samples differ from mpg123 by up to %d, %d by more than 1", maxDiff, diffs)
+	}
+	t.Logf("✓ %d Hz, %d channels, %d bytes, max difference %d", sampleRate, channels, len(got), maxDiff)
+}
+
+// TestGoDecoderSample compares the Go decoder with mpg123 on the ffmpeg encoded sample
+func TestGoDecoderSample(t *testing.T) {
+	requireNative(t)
+	data, err := os.ReadFile("samples/sample.mp3")
+	if err != nil {
+		t.Skip("sample not available")
+	}
+	compareDecoders(t, data)
+}
+
+// TestGoDecoderDamagedStream tests how the Go decoder handles tags, cuts and junk
+func TestGoDecoderDamagedStream(t *testing.T) {
+	requireNative(t)
+	var buf mp3.SeekableBuffer
+	pcm := generateBursts(44100, 2, 44100)
+	wav := append(mp3.GenerateWavHeader(len(pcm), 44100, 2, 16), pcm...)
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &buf, &mp3.EncoderConfig{Bitrate: 128}, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	data := buf.Bytes()
+
+	// The tag holds a frame sync that must not be taken for a frame
+	tag := append([]byte("ID3\x03\x00\x00\x00\x00\x01\x00"), make([]byte, 128)...)
+	copy(tag[20:], []byte{0xff, 0xfb, 0x90, 0x64})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"ID3v2 tag", append(tag, data...)},
+		{"cut", data[5000:]},
+		{"truncated", data[:len(data)-100]},
+		{"concatenated", append(append([]byte{}, data...), data...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compareDecoders(t, tt.data)
+		})
+	}
+
+	// mpg123 drops the bit reservoir when it has to resync, the Go decoder keeps it and
+	// decodes the stream as if the junk was not there
+	t.Run("junk", func(t *testing.T) {
+		pos := 0
+		for pos < 8000 {
+			h, err := mp3.ParseFrameHeader(data[pos:])
+			if err != nil {
+				t.Fatalf("ParseFrameHeader at %d: %v", pos, err)
+			}
+			pos += h.Size
+		}
+		junk := append(append([]byte{}, data[:pos]...), "garbage between frames"...)
+		got, _, _ := decodeGo(t, append(junk, data[pos:]...), 1000)
+		want, _, _ := decodeGo(t, data, 1000)
+		if !bytes.Equal(got, want) {
+			t.Error("Junk between frames changed the decoded PCM")
+		}
+	})
+}
+
+// TestGoDecoderRoundTrip decodes the output of the Go encoder
+func TestGoDecoderRoundTrip(t *testing.T) {
+	for _, c := range []mp3.EncoderConfig{
+		{SampleRate: 44100, NumChannels: 2, Bitrate: 128},
+		{SampleRate: 22050, NumChannels: 1, Bitrate: 48},
+	} {
+		t.Run(fmt.Sprintf("%d %dch", c.SampleRate, c.NumChannels), func(t *testing.T) {
+			enc, err := mp3.NewGoEncoderBackend(&c)
+			if err != nil {
+				t.Fatalf("NewGoEncoderBackend failed: %v", err)
+			}
+			defer enc.Close()
+			pcm := generateChord(c.SampleRate, c.NumChannels, c.SampleRate)
+			out := make([]byte, len(pcm)+16384)
+			n, err := enc.Encode(pcm, out)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			m, err := enc.Flush(out[n:])
+			if err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			decoded, sampleRate, channels := decodeGo(t, out[:n+m], 777)
+			if sampleRate != c.SampleRate || channels != c.NumChannels {
+				t.Errorf("Format mismatch: %d Hz, %d ch", sampleRate, channels)
+			}
+			if want := enc.FrameNum() * enc.FrameLength() * channels * 2; len(decoded) != want {
+				t.Errorf("Decoded %d bytes, want %d", len(decoded), want)
+			}
+			snr, delay := pcmSNR(pcm, decoded, c.NumChannels)
+			if snr < 30 {
+				t.Errorf("SNR %.1f dB below 30 dB", snr)
+			}
+			t.Logf("✓ %d bytes, delay %d, SNR %.1f dB", len(decoded), delay, snr)
+		})
+	}
+}
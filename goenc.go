@@ -0,0 +1,698 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+const (
+	granuleSize = 576 // MDCT lines of a granule and channel
+	numSubbands = 32
+
+	// maxQuantValue is the largest value that can be coded: 15 plus 13 linbits
+	maxQuantValue = 15 + 1<<13 - 1
+
+	// goEncoderDelay is the number of samples the filterbank and the MDCT hold back,
+	// Flush encodes this many zeros after the input to output all of it
+	goEncoderDelay = granuleSize + 512
+)
+
+// subdvTable is the number of scale factor bands in region 0 and 1 of the big values,
+// by the number of bands they cover, as used by LAME.
+var subdvTable = [23][2]int{
+	{0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 1}, {1, 1}, {1, 1}, {1, 2}, {2, 2}, {2, 3}, {2, 3},
+	{3, 4}, {3, 4}, {3, 4}, {4, 5}, {4, 5}, {4, 6}, {5, 6}, {5, 6}, {5, 7}, {6, 7}, {6, 7},
+}
+
+// Coefficients of the alias reduction butterflies between subbands.
+var aliasCs, aliasCa [8]float64
+
+// Analysis window, polyphase matrix and MDCT matrix (including the sine window and the
+// 1/9 scale that makes the decoder's IMDCT reconstruct the input).
+var (
+	goEncTablesOnce sync.Once
+	analysisWindow  [512]float64
+	analysisMatrix  [numSubbands][64]float64
+	mdctMatrix      [18][36]float64
+)
+
+func initGoEncTables() {
+	for i := range analysisWindow {
+		j := i
+		if i > 256 {
+			j = 512 - i
+		}
+		d := float64(synthWindow[j]) / 65536
+		if (i/64)%2 == 1 {
+			d = -d
+		}
+		analysisWindow[i] = d / 32
+	}
+	for k := range analysisMatrix {
+		for i := range analysisMatrix[k] {
+			analysisMatrix[k][i] = math.Cos(float64((2*k+1)*(i-16)) * math.Pi / 64)
+		}
+	}
+	for m := range mdctMatrix {
+		for k := range mdctMatrix[m] {
+			w := math.Sin(math.Pi / 36 * (float64(k) + 0.5))
+			mdctMatrix[m][k] = w * math.Cos(math.Pi/72*float64((2*k+19)*(2*m+1))) / 9
+		}
+	}
+	c := [8]float64{-0.6, -0.535, -0.33, -0.185, -0.095, -0.041, -0.0142, -0.0037}
+	for i, ci := range c {
+		sq := math.Sqrt(1 + ci*ci)
+		aliasCs[i] = 1 / sq
+		aliasCa[i] = ci / sq
+	}
+}
+
+// goEncoder is a CBR layer III encoder written in Go, in the spirit of shine. It only uses
+// long blocks and no scale factors, bit reservoir or psychoacoustic model: the granules of a
+// frame are quantized with the smallest step size that fits the frame. The quantization noise
+// is not shaped, which is audible on critical material, so LAME is preferred wherever it can
+// be linked.
+type goEncoder struct {
+	version      MpegVersion
+	bitrateIndex int
+	srIndex      int
+	sampleRate   int
+	inChannels   int
+	channels     int  // coded channels, 1 if stereo input is mixed down
+	jointStereo  bool // M/S stereo may be used
+	protected    bool
+	copyright    bool
+	original     bool
+	private      bool
+	granules     int // per frame
+	frameLength  int // samples per channel and frame
+	lowpassLine  int // MDCT lines from here on are zeroed
+	sfb          [23]int
+	frameBytes   int // without padding
+	padRemainder int // remainder of the frame size, accumulated in padAcc
+	padAcc       int
+
+	pcm     [2][]float64 // input not yet encoded, scaled to -1..1
+	pending bool         // input was passed to Encode since the last Flush
+	frames  int
+
+	fb      [2][512]float64             // filterbank input, newest sample first
+	subband [2][18][numSubbands]float64 // subband samples of the previous granule
+	xr      [2][2][granuleSize]float64  // MDCT lines by granule and channel
+	gr      [2][2]quantGranule          // quantized granules of the current frame
+}
+
+// quantGranule is a quantized granule and channel with the side information to code it.
+type quantGranule struct {
+	xr         *[granuleSize]float64
+	xr34       [granuleSize]float64 // |xr|^(3/4)
+	ix         [granuleSize]int     // quantized magnitudes
+	maxXr34    float64
+	globalGain int
+	bits       int // part2_3_length, there are no scale factors
+	bigValues  int
+	count1     int // quadruples in the count1 region
+	tables     [3]int
+	region0    int
+	region1    int
+	count1Tab  int
+}
+
+// NewGoEncoderBackend creates the built-in pure Go encoder backend, which NewEncoder uses in
+// builds without LAME unless another backend is registered. It encodes CBR at the configured bitrate, or the nearest legal
+// bitrate for the sample rate; with VBR and ABR modes it uses AbrMeanBitrate or Bitrate. It
+// supports all MPEG-1, MPEG-2 and MPEG-2.5 sample rates, does not resample and honors
+// MpegMode, Lowpass, ErrorProtection and the header flags. Quality is ignored.
+func NewGoEncoderBackend(c *EncoderConfig) (EncoderBackend, error) {
+	c = populateEncConfig(c)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	goEncTablesOnce.Do(initGoEncTables)
+
+	version, _ := MpegVersionForSampleRate(c.SampleRate)
+	e := &goEncoder{
+		version:     version,
+		sampleRate:  c.SampleRate,
+		inChannels:  c.NumChannels,
+		channels:    c.NumChannels,
+		jointStereo: c.MpegMode == 0 || c.MpegMode == MpegJointStereo,
+		protected:   c.ErrorProtection,
+		copyright:   c.Copyright,
+		original:    !c.Copy,
+		private:     c.Private,
+		granules:    1,
+		frameLength: 576,
+		sfb:         sfbLong[c.SampleRate],
+	}
+	if c.MpegMode == MpegMono {
+		e.channels = 1
+	}
+	if version == MpegVersion1 {
+		e.granules = 2
+		e.frameLength = 1152
+	}
+	for i, r := range sampleRateTable[version] {
+		if r == c.SampleRate {
+			e.srIndex = i
+		}
+	}
+
+	kbps := c.bitrate()
+	if c.VbrMode != VbrModeOff && c.AbrMeanBitrate != 0 {
+		kbps = c.AbrMeanBitrate
+	}
+	if c.VbrMode != VbrModeOff && c.VbrMaxBitrate != 0 {
+		kbps = min(kbps, c.VbrMaxBitrate)
+	}
+	table := bitrateTableV2
+	if version == MpegVersion1 {
+		table = bitrateTableV1
+	}
+	e.bitrateIndex = 1
+	for i := 1; i < 15; i++ {
+		if abs(table[i]-kbps) < abs(table[e.bitrateIndex]-kbps) {
+			e.bitrateIndex = i
+		}
+	}
+	kbps = table[e.bitrateIndex]
+	e.frameBytes = e.frameLength / 8 * kbps * 1000 / c.SampleRate
+	e.padRemainder = e.frameLength / 8 * kbps * 1000 % c.SampleRate
+
+	lowpass := c.Lowpass
+	if lowpass == 0 {
+		lowpass = goEncoderLowpass(kbps * 2 / e.channels)
+	}
+	e.lowpassLine = granuleSize
+	if lowpass > 0 {
+		e.lowpassLine = min(granuleSize, lowpass*2*granuleSize/c.SampleRate)
+	}
+	return e, nil
+}
+
+// goEncoderLowpass returns the lowpass frequency in Hz for the bitrate of a stereo stream,
+// following the bandwidths LAME uses.
+func goEncoderLowpass(kbps int) int {
+	table := [...][2]int{
+		{8, 2000}, {16, 3700}, {24, 3900}, {32, 5500}, {40, 7000}, {48, 7500}, {56, 10000},
+		{64, 11000}, {80, 13500}, {96, 15100}, {112, 15600}, {128, 17000}, {160, 17500},
+		{192, 18600}, {224, 19400}, {256, 19700}, {320, 20500},
+	}
+	for _, t := range table {
+		if kbps <= t[0] {
+			return t[1]
+		}
+	}
+	return 20500
+}
+
+func (e *goEncoder) FrameNum() int    { return e.frames }
+func (e *goEncoder) FrameLength() int { return e.frameLength }
+func (e *goEncoder) Close()           {}
+
+// Encode buffers the samples and encodes all complete frames.
+func (e *goEncoder) Encode(in, out []byte) (int, error) {
+	numSamples := len(in) / (2 * e.inChannels)
+	for i := range numSamples {
+		for ch := range e.inChannels {
+			s := float64(int16(binary.LittleEndian.Uint16(in[2*(i*e.inChannels+ch):]))) / 32768
+			if e.channels < e.inChannels {
+				// mixed down to mono
+				if ch == 0 {
+					e.pcm[0] = append(e.pcm[0], s/2)
+				} else {
+					e.pcm[0][len(e.pcm[0])-1] += s / 2
+				}
+				continue
+			}
+			e.pcm[ch] = append(e.pcm[ch], s)
+		}
+	}
+	e.pending = e.pending || numSamples > 0
+	return e.encodeFrames(out)
+}
+
+// Flush encodes the buffered samples followed by zeros that push them through the
+// filterbank and the MDCT.
+func (e *goEncoder) Flush(out []byte) (int, error) {
+	if !e.pending {
+		return 0, nil
+	}
+	e.pending = false
+	n := len(e.pcm[0]) + goEncoderDelay
+	n = (n + e.frameLength - 1) / e.frameLength * e.frameLength
+	for ch := range e.channels {
+		e.pcm[ch] = append(e.pcm[ch], make([]float64, n-len(e.pcm[ch]))...)
+	}
+	return e.encodeFrames(out)
+}
+
+func (e *goEncoder) encodeFrames(out []byte) (int, error) {
+	n, pos := 0, 0
+	for len(e.pcm[0])-pos >= e.frameLength {
+		n += e.encodeFrame(pos, out[n:])
+		pos += e.frameLength
+	}
+	for ch := range e.channels {
+		e.pcm[ch] = append(e.pcm[ch][:0], e.pcm[ch][pos:]...)
+	}
+	return n, nil
+}
+
+// encodeFrame encodes frameLength buffered samples from pos into out and returns the frame size.
+func (e *goEncoder) encodeFrame(pos int, out []byte) int {
+	for gr := range e.granules {
+		for ch := range e.channels {
+			e.transform(ch, e.pcm[ch][pos+gr*granuleSize:], &e.xr[gr][ch])
+			clear(e.xr[gr][ch][e.lowpassLine:])
+		}
+	}
+	ms := e.channels == 2 && e.jointStereo && e.useMS()
+	if ms {
+		for gr := range e.granules {
+			l, r := &e.xr[gr][0], &e.xr[gr][1]
+			for i := range l {
+				l[i], r[i] = (l[i]+r[i])*math.Sqrt2/2, (l[i]-r[i])*math.Sqrt2/2
+			}
+		}
+	}
+
+	size := e.frameBytes
+	padding := false
+	e.padAcc += e.padRemainder
+	if e.padAcc >= e.sampleRate {
+		e.padAcc -= e.sampleRate
+		padding = true
+		size++
+	}
+	sideBytes := 17
+	switch {
+	case e.version == MpegVersion1 && e.channels == 2:
+		sideBytes = 32
+	case e.version != MpegVersion1 && e.channels == 1:
+		sideBytes = 9
+	}
+	headerBytes := FrameHeaderSize
+	if e.protected {
+		headerBytes += 2
+	}
+	e.quantize(8 * (size - headerBytes - sideBytes))
+
+	// Header
+	frame := out[:size]
+	clear(frame)
+	w := &bitWriter{b: frame}
+	w.write(11, 0x7ff)
+	switch e.version {
+	case MpegVersion1:
+		w.write(2, 3)
+	case MpegVersion2:
+		w.write(2, 2)
+	default:
+		w.write(2, 0)
+	}
+	w.write(2, 1) // layer III
+	w.writeBit(!e.protected)
+	w.write(4, e.bitrateIndex)
+	w.write(2, e.srIndex)
+	w.writeBit(padding)
+	w.writeBit(e.private)
+	mode := MpegStereo
+	switch {
+	case e.channels == 1:
+		mode = MpegMono
+	case e.jointStereo:
+		mode = MpegJointStereo
+	}
+	w.write(2, int(mode-1))
+	if ms {
+		w.write(2, 2)
+	} else {
+		w.write(2, 0)
+	}
+	w.writeBit(e.copyright)
+	w.writeBit(e.original)
+	w.write(2, 0) // emphasis
+	if e.protected {
+		w.write(16, 0) // CRC, set below
+	}
+
+	// Side information
+	if e.version == MpegVersion1 {
+		w.write(9, 0) // main_data_begin
+		w.write(5-2*(e.channels-1)+4*e.channels, 0)
+	} else {
+		w.write(8+e.channels, 0)
+	}
+	for gr := range e.granules {
+		for ch := range e.channels {
+			g := &e.gr[gr][ch]
+			w.write(12, g.bits)
+			w.write(9, g.bigValues)
+			w.write(8, g.globalGain)
+			if e.version == MpegVersion1 {
+				w.write(4, 0) // scalefac_compress
+			} else {
+				w.write(9, 0)
+			}
+			w.write(1, 0) // window_switching_flag
+			for _, t := range g.tables {
+				w.write(5, t)
+			}
+			w.write(4, g.region0)
+			w.write(3, g.region1)
+			if e.version == MpegVersion1 {
+				w.write(1, 0) // preflag
+			}
+			w.write(1, 0) // scalefac_scale
+			w.write(1, g.count1Tab)
+		}
+	}
+	if e.protected {
+		crc := frameCRC(frame[2:4], frame[6:6+sideBytes])
+		frame[4], frame[5] = byte(crc>>8), byte(crc)
+	}
+
+	// Main data, the rest of the frame is ancillary data
+	for gr := range e.granules {
+		for ch := range e.channels {
+			e.gr[gr][ch].write(w, e.sfb)
+		}
+	}
+	e.frames++
+	return size
+}
+
+// useMS reports whether the side channel carries little enough energy for M/S stereo to pay off.
+func (e *goEncoder) useMS() bool {
+	var mid, side float64
+	for gr := range e.granules {
+		for i, l := range e.xr[gr][0] {
+			r := e.xr[gr][1][i]
+			mid += (l + r) * (l + r)
+			side += (l - r) * (l - r)
+		}
+	}
+	return side < 0.5*mid
+}
+
+// transform runs the polyphase filterbank and the MDCT on a granule of samples of channel ch.
+func (e *goEncoder) transform(ch int, pcm []float64, xr *[granuleSize]float64) {
+	var cur [18][numSubbands]float64
+	x := &e.fb[ch]
+	var y [64]float64
+	for slot := range cur {
+		copy(x[32:], x[:480])
+		for i := range 32 {
+			x[31-i] = pcm[slot*32+i]
+		}
+		for i := range y {
+			s := 0.0
+			for j := i; j < 512; j += 64 {
+				s += analysisWindow[j] * x[j]
+			}
+			y[i] = s
+		}
+		for k := range numSubbands {
+			s := 0.0
+			for i, m := range analysisMatrix[k] {
+				s += m * y[i]
+			}
+			// Compensate the frequency inversion of the odd subbands
+			if k%2 == 1 && slot%2 == 1 {
+				s = -s
+			}
+			cur[slot][k] = s
+		}
+	}
+
+	prev := &e.subband[ch]
+	var in [36]float64
+	for k := range numSubbands {
+		for i := range 18 {
+			in[i] = prev[i][k]
+			in[i+18] = cur[i][k]
+		}
+		for m := range 18 {
+			s := 0.0
+			for i, c := range mdctMatrix[m] {
+				s += c * in[i]
+			}
+			xr[k*18+m] = s
+		}
+	}
+	*prev = cur
+
+	for sb := 1; sb < numSubbands; sb++ {
+		for i := range 8 {
+			bu, bd := xr[sb*18-1-i], xr[sb*18+i]
+			xr[sb*18-1-i] = bu*aliasCs[i] + bd*aliasCa[i]
+			xr[sb*18+i] = bd*aliasCs[i] - bu*aliasCa[i]
+		}
+	}
+}
+
+// quantize quantizes the granules of the frame with the smallest global gain that fits
+// mainBits, then lowers the gain of single granules while the frame still fits.
+func (e *goEncoder) quantize(mainBits int) {
+	units := make([]*quantGranule, 0, 4)
+	for gr := range e.granules {
+		for ch := range e.channels {
+			g := &e.gr[gr][ch]
+			g.xr = &e.xr[gr][ch]
+			g.maxXr34 = 0
+			for i, v := range e.xr[gr][ch] {
+				g.xr34[i] = math.Pow(math.Abs(v), 0.75)
+				g.maxXr34 = max(g.maxXr34, g.xr34[i])
+			}
+			units = append(units, g)
+		}
+	}
+	total := func(gain int) int {
+		n := 0
+		for _, g := range units {
+			b := g.quantize(gain, e.sfb)
+			if b < 0 {
+				return math.MaxInt
+			}
+			n += b
+		}
+		return n
+	}
+
+	lo, hi := 0, 255 // the gain is in lo..hi, hi fits
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if total(mid) <= mainBits {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	used := total(hi)
+	for _, g := range units {
+		for g.globalGain > 0 {
+			old := g.bits
+			b := g.quantize(g.globalGain-1, e.sfb)
+			if b < 0 || used-old+b > mainBits {
+				g.quantize(g.globalGain+1, e.sfb)
+				break
+			}
+			used += b - old
+		}
+	}
+}
+
+// quantize quantizes the granule with the global gain and chooses the Huffman tables.
+// It returns the number of bits, or -1 if a value is too large to be coded.
+func (g *quantGranule) quantize(gain int, sfb [23]int) int {
+	g.globalGain = gain
+	step := math.Pow(2, -0.1875*float64(gain-210))
+	if g.maxXr34*step+0.4054 > maxQuantValue {
+		return -1
+	}
+	for i, v := range g.xr34 {
+		g.ix[i] = int(v*step + 0.4054)
+	}
+
+	// The values are split into big values, quadruples of values up to 1 and zeros
+	n := granuleSize
+	for n > 1 && g.ix[n-1] == 0 && g.ix[n-2] == 0 {
+		n -= 2
+	}
+	end := n
+	for n > 3 && g.ix[n-1] <= 1 && g.ix[n-2] <= 1 && g.ix[n-3] <= 1 && g.ix[n-4] <= 1 {
+		n -= 4
+	}
+	g.bigValues = n / 2
+	g.count1 = (end - n) / 4
+
+	bitsA, bitsB := 0, 0
+	for i := n; i < end; i += 4 {
+		idx := g.ix[i]<<3 | g.ix[i+1]<<2 | g.ix[i+2]<<1 | g.ix[i+3]
+		signs := bits.OnesCount(uint(idx))
+		bitsA += int(count1Tables[0].lens[idx]) + signs
+		bitsB += int(count1Tables[1].lens[idx]) + signs
+	}
+	g.count1Tab = 0
+	g.bits = bitsA
+	if bitsB < bitsA {
+		g.count1Tab = 1
+		g.bits = bitsB
+	}
+
+	bands := 0
+	for bands < 22 && sfb[bands+1] < n {
+		bands++
+	}
+	bands++
+	g.region0 = subdvTable[bands][0]
+	for g.region0 > 0 && sfb[g.region0+1] > n {
+		g.region0--
+	}
+	g.region1 = subdvTable[bands][1]
+	for g.region1 > 0 && sfb[g.region0+g.region1+2] > n {
+		g.region1--
+	}
+	bounds := g.regionBounds(sfb)
+	start := 0
+	for r, end := range bounds {
+		t, b := chooseTable(g.ix[start:end])
+		g.tables[r] = t
+		g.bits += b
+		start = end
+	}
+	if g.bits > 1<<12-1 {
+		return -1
+	}
+	return g.bits
+}
+
+// regionBounds returns the ends of the three big value regions.
+func (g *quantGranule) regionBounds(sfb [23]int) [3]int {
+	n := g.bigValues * 2
+	return [3]int{
+		min(sfb[g.region0+1], n),
+		min(sfb[g.region0+g.region1+2], n),
+		n,
+	}
+}
+
+// chooseTable returns the big value table with the fewest bits for the values and the bits.
+func chooseTable(ix []int) (table, n int) {
+	if len(ix) == 0 {
+		return 0, 0
+	}
+	m := 0
+	for _, v := range ix {
+		m = max(m, v)
+	}
+	if m == 0 {
+		return 0, 0
+	}
+	best, bestBits := 0, math.MaxInt
+	try := func(t int) {
+		if b := countPairBits(&huffTables[t], ix); b < bestBits {
+			best, bestBits = t, b
+		}
+	}
+	if m < 16 {
+		for t := 1; t < 16; t++ {
+			if huffTables[t].dim > m {
+				try(t)
+			}
+		}
+		return best, bestBits
+	}
+	for _, first := range []int{16, 24} {
+		for t := first; t < first+8; t++ {
+			if m-15 < 1<<huffTables[t].linbits {
+				try(t)
+				break
+			}
+		}
+	}
+	return best, bestBits
+}
+
+// countPairBits returns the bits to code the values in pairs with table h.
+func countPairBits(h *huffTable, ix []int) int {
+	n := 0
+	for i := 0; i < len(ix); i += 2 {
+		x, y := ix[i], ix[i+1]
+		if h.linbits > 0 {
+			if x >= 15 {
+				x = 15
+				n += h.linbits
+			}
+			if y >= 15 {
+				y = 15
+				n += h.linbits
+			}
+		}
+		n += int(h.lens[x*h.dim+y])
+		if x != 0 {
+			n++
+		}
+		if y != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// write writes the Huffman coded values of the granule.
+func (g *quantGranule) write(w *bitWriter, sfb [23]int) {
+	start := 0
+	for r, end := range g.regionBounds(sfb) {
+		h := &huffTables[g.tables[r]]
+		for i := start; h.dim > 0 && i < end; i += 2 {
+			x, y := g.ix[i], g.ix[i+1]
+			linx, liny := 0, 0
+			if h.linbits > 0 {
+				if x >= 15 {
+					x, linx = 15, x-15
+				}
+				if y >= 15 {
+					y, liny = 15, y-15
+				}
+			}
+			w.write(int(h.lens[x*h.dim+y]), int(h.codes[x*h.dim+y]))
+			if x == 15 && h.linbits > 0 {
+				w.write(h.linbits, linx)
+			}
+			if x != 0 {
+				w.writeBit(g.xr[i] < 0)
+			}
+			if y == 15 && h.linbits > 0 {
+				w.write(h.linbits, liny)
+			}
+			if y != 0 {
+				w.writeBit(g.xr[i+1] < 0)
+			}
+		}
+		start = end
+	}
+
+	h := &count1Tables[g.count1Tab]
+	for i := start; i < start+4*g.count1; i += 4 {
+		idx := g.ix[i]<<3 | g.ix[i+1]<<2 | g.ix[i+2]<<1 | g.ix[i+3]
+		w.write(int(h.lens[idx]), int(h.codes[idx]))
+		for j := i; j < i+4; j++ {
+			if g.ix[j] != 0 {
+				w.writeBit(g.xr[j] < 0)
+			}
+		}
+	}
+}
+
+// writeBit writes a single bit.
+func (w *bitWriter) writeBit(v bool) {
+	if v {
+		w.write(1, 1)
+	} else {
+		w.write(1, 0)
+	}
+}
@@ -0,0 +1,151 @@
+package mp3_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// generateChord generates 16-bit PCM with three gliding tones per channel, the right channel
+// a fifth above the left one
+func generateChord(sampleRate, channels, numSamples int) []byte {
+	data := make([]byte, numSamples*channels*2)
+	for i := range numSamples {
+		t := float64(i) / float64(sampleRate)
+		for ch := range channels {
+			p := 2 * math.Pi * 220 * (1 + 0.5*float64(ch)) * (t + 0.25*t*t)
+			v := 0.3*math.Sin(p) + 0.2*math.Sin(2.5*p) + 0.1*math.Sin(7*p)
+			s := int16(v * 32767)
+			data[(i*channels+ch)*2] = byte(s)
+			data[(i*channels+ch)*2+1] = byte(s >> 8)
+		}
+	}
+	return data
+}
+
+// pcmSNR returns the signal to noise ratio in dB of decoded against ref, both 16-bit PCM
+// with channels, after shifting decoded by the delay that matches best.
+func pcmSNR(ref, decoded []byte, channels int) (snr float64, delay int) {
+	sample := func(b []byte, i, ch int) float64 {
+		k := (i*channels + ch) * 2
+		return float64(int16(uint16(b[k]) | uint16(b[k+1])<<8))
+	}
+	n := len(ref) / 2 / channels
+	m := len(decoded) / 2 / channels
+	best := math.Inf(-1)
+	for d := 0; d < 3000 && d+n/2 < m; d++ {
+		c := 0.0
+		for i := n / 4; i < n/2; i += 3 {
+			c += sample(ref, i, 0) * sample(decoded, i+d, 0)
+		}
+		if c > best {
+			best, delay = c, d
+		}
+	}
+	var signal, noise float64
+	for i := 0; i < n && i+delay < m; i++ {
+		for ch := range channels {
+			a, b := sample(ref, i, ch), sample(decoded, i+delay, ch)
+			signal += a * a
+			noise += (a - b) * (a - b)
+		}
+	}
+	return 10 * math.Log10(signal/noise), delay
+}
+
+// TestGoEncoderBackend tests the pure Go encoder against mpg123
+func TestGoEncoderBackend(t *testing.T) {
+	requireNative(t)
+	chord := generateChord
+	noise := func(sampleRate, channels, numSamples int) []byte { return generateNoise(channels, numSamples) }
+	sine := func(sampleRate, channels, numSamples int) []byte {
+		return generateSineWave(440, sampleRate, channels, numSamples)
+	}
+	tests := []struct {
+		config mp3.EncoderConfig
+		signal func(sampleRate, channels, numSamples int) []byte
+		minSNR float64
+		ms     bool // M/S stereo is expected
+	}{
+		{mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128}, chord, 40, false},
+		{mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128, MpegMode: mp3.MpegStereo}, chord, 40, false},
+		{mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 96}, sine, 40, true},
+		{mp3.EncoderConfig{SampleRate: 48000, NumChannels: 2, Bitrate: 320, ErrorProtection: true}, chord, 40, false},
+		{mp3.EncoderConfig{SampleRate: 48000, NumChannels: 2, Bitrate: 320}, noise, 5, false},
+		{mp3.EncoderConfig{SampleRate: 32000, NumChannels: 1, Bitrate: 64}, chord, 40, false},
+		{mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 64, MpegMode: mp3.MpegMono}, chord, 40, false},
+		{mp3.EncoderConfig{SampleRate: 22050, NumChannels: 2, Bitrate: 64}, chord, 30, false},
+		{mp3.EncoderConfig{SampleRate: 16000, NumChannels: 1, Bitrate: 32}, chord, 30, false},
+		{mp3.EncoderConfig{SampleRate: 8000, NumChannels: 1, Bitrate: 16}, chord, 30, false},
+		{mp3.EncoderConfig{SampleRate: 8000, NumChannels: 1, Bitrate: 8}, noise, 1, false},
+	}
+	for _, tt := range tests {
+		c := tt.config
+		t.Run(fmt.Sprintf("%d %dch %dkbps mode %d", c.SampleRate, c.NumChannels, c.Bitrate, c.MpegMode), func(t *testing.T) {
+			backend, err := mp3.NewGoEncoderBackend(&c)
+			if err != nil {
+				t.Fatalf("NewGoEncoderBackend failed: %v", err)
+			}
+			defer backend.Close()
+			pcm := tt.signal(c.SampleRate, c.NumChannels, c.SampleRate)
+			out := make([]byte, len(pcm)+16384)
+			n, err := backend.Encode(pcm, out)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			m, err := backend.Flush(out[n:])
+			if err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			data := out[:n+m]
+
+			frames, msFrames := 0, 0
+			for pos := 0; pos < len(data); frames++ {
+				h, err := mp3.ParseFrameHeader(data[pos:])
+				if err != nil {
+					t.Fatalf("Frame %d at %d: %v", frames, pos, err)
+				}
+				if h.SampleRate != c.SampleRate || h.Bitrate != c.Bitrate || h.Protected != c.ErrorProtection {
+					t.Fatalf("Unexpected frame header %+v", h)
+				}
+				if h.Mode == mp3.MpegJointStereo && data[pos+3]&0x20 != 0 {
+					msFrames++
+				}
+				pos += h.Size
+			}
+			if tt.ms != (msFrames > frames/2) {
+				t.Errorf("%d of %d frames use M/S stereo", msFrames, frames)
+			}
+			if frames != backend.FrameNum() {
+				t.Errorf("Frame count mismatch: got %d, backend reports %d", frames, backend.FrameNum())
+			}
+
+			decoded := decodeAll(t, data)
+			ref := pcm
+			if c.MpegMode == mp3.MpegMono {
+				// The mix of both channels
+				ref = make([]byte, len(pcm)/2)
+				for i := range len(ref) / 2 {
+					l := int16(uint16(pcm[4*i]) | uint16(pcm[4*i+1])<<8)
+					r := int16(uint16(pcm[4*i+2]) | uint16(pcm[4*i+3])<<8)
+					s := int16((int(l) + int(r)) / 2)
+					ref[2*i], ref[2*i+1] = byte(s), byte(s>>8)
+				}
+			}
+			channels := c.NumChannels
+			if c.MpegMode == mp3.MpegMono {
+				channels = 1
+			}
+			snr, delay := pcmSNR(ref, decoded, channels)
+			if len(decoded) < len(ref)+delay*channels*2 {
+				t.Errorf("Decoded %d bytes, want at least %d", len(decoded), len(ref)+delay*channels*2)
+			}
+			if snr < tt.minSNR {
+				t.Errorf("SNR %.1f dB below %.0f dB", snr, tt.minSNR)
+			}
+			t.Logf("✓ %d frames, %d bytes, delay %d, SNR %.1f dB", frames, len(data), delay, snr)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package mp3
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrorDecodersOpen = errors.New("decoders still open")
+
+var (
+	openEncoders atomic.Int64
+	openDecoders atomic.Int64
+)
+
+// OpenHandles returns the number of encoders and decoders that have been created and not yet released.
+// Handles are released by Close, or by the garbage collector when Close was never called,
+// so a steadily growing count points to encoders or decoders that are still referenced.
+func OpenHandles() (encoders int, decoders int) {
+	return int(openEncoders.Load()), int(openDecoders.Load())
+}
@@ -0,0 +1,76 @@
+package mp3_test
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// settleHandles runs the garbage collector until the open handle count stops changing.
+func settleHandles() (encoders, decoders int) {
+	encoders, decoders = mp3.OpenHandles()
+	for i := 0; i < 50; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+		e, d := mp3.OpenHandles()
+		if e == encoders && d == decoders {
+			break
+		}
+		encoders, decoders = e, d
+	}
+	return encoders, decoders
+}
+
+func TestOpenHandles(t *testing.T) {
+	requireNative(t)
+	baseEnc, baseDec := settleHandles()
+
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	if e, d := mp3.OpenHandles(); e != baseEnc+1 || d != baseDec+1 {
+		t.Fatalf("OpenHandles = %d, %d, want %d, %d", e, d, baseEnc+1, baseDec+1)
+	}
+
+	// Concurrent and repeated Close must release each handle exactly once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); encoder.Close() }()
+		go func() { defer wg.Done(); decoder.Close() }()
+	}
+	wg.Wait()
+	encoder.Close()
+	decoder.Close()
+
+	if e, d := mp3.OpenHandles(); e != baseEnc || d != baseDec {
+		t.Fatalf("OpenHandles after Close = %d, %d, want %d, %d", e, d, baseEnc, baseDec)
+	}
+}
+
+func TestForgottenCloseIsReleased(t *testing.T) {
+	requireNative(t)
+	baseEnc, baseDec := settleHandles()
+
+	for i := 0; i < 4; i++ {
+		if _, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2}); err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if _, err := mp3.NewDecoder(); err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+	}
+
+	if e, d := settleHandles(); e != baseEnc || d != baseDec {
+		t.Errorf("OpenHandles after GC = %d, %d, want %d, %d", e, d, baseEnc, baseDec)
+	}
+}
@@ -0,0 +1,16 @@
+package mp3
+
+// BitrateCount is the number of frames encoded at a bitrate, see Encoder.BitrateHistogram.
+type BitrateCount struct {
+	Kbps   int
+	Frames int
+}
+
+// StereoModeCounts is the number of frames per stereo mode, see Encoder.StereoModeHistogram.
+// LAME decides per frame in joint stereo mode; in other modes all frames are LeftRight.
+type StereoModeCounts struct {
+	LeftRight          int
+	LeftRightIntensity int // not produced by LAME
+	MidSide            int
+	MidSideIntensity   int // not produced by LAME
+}
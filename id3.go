@@ -0,0 +1,540 @@
+package mp3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	ID3v2HeaderSize = 10
+)
+
+var (
+	ErrorNoID3v2 = errors.New("no id3v2 tag")
+)
+
+// ID3Frame is a single raw ID3v2 frame.
+// Data holds the frame body exactly as it is stored in the tag.
+type ID3Frame struct {
+	ID   string
+	Data []byte
+}
+
+// ID3v2Tag is an in-memory ID3v2 tag.
+// Frames are written in the order they appear in Frames.
+type ID3v2Tag struct {
+	// Version is the major version written by Bytes: 3 for ID3v2.3 (best player compatibility)
+	// or 4 for ID3v2.4. 0 means 4.
+	// When writing ID3v2.3, UTF-8 and UTF-16BE text is converted to UTF-16, TDRC is written as
+	// TYER and RVA2 frames, which ID3v2.3 does not define, are left out.
+	Version byte
+
+	Frames []ID3Frame
+
+	// Encoding is used for text frames written by SetText and SetUserText.
+	// Latin-1 text that contains characters outside the charset is written as UTF-16.
+	Encoding TextEncoding
+
+	// Padding is the number of zero bytes appended after the last frame.
+	Padding int
+}
+
+// NewID3v2Tag creates an empty ID3v2 tag that writes text as UTF-8.
+func NewID3v2Tag() *ID3v2Tag {
+	return &ID3v2Tag{Encoding: TextEncodingUTF8}
+}
+
+// ReadID3v2 reads an ID3v2.3 or ID3v2.4 tag from the start of r.
+// It consumes exactly the bytes of the tag. ErrorNoID3v2 is returned if r does not start with a tag.
+// Frames hold the plain frame data: compressed frames are decompressed and group IDs are
+// removed, so they can be written again without their format flags. Encrypted frames are skipped.
+func ReadID3v2(r io.Reader) (*ID3v2Tag, error) {
+	var hdr [ID3v2HeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("read id3v2 header failed: %w", err)
+	}
+	if string(hdr[0:3]) != "ID3" {
+		return nil, ErrorNoID3v2
+	}
+	major := hdr[3]
+	if major != 3 && major != 4 {
+		return nil, fmt.Errorf("unsupported id3v2 version: 2.%d", major)
+	}
+	flags := hdr[5]
+
+	body := make([]byte, syncsafe(hdr[6:10]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("read id3v2 tag failed: %w", err)
+	}
+	if major == 3 && flags&0x80 != 0 {
+		// ID3v2.3 applies unsynchronization to the whole tag
+		body = removeUnsync(body)
+	}
+	if flags&0x10 != 0 {
+		// Footer present (v2.4 only)
+		var footer [ID3v2HeaderSize]byte
+		if _, err := io.ReadFull(r, footer[:]); err != nil {
+			return nil, fmt.Errorf("read id3v2 footer failed: %w", err)
+		}
+	}
+
+	pos := 0
+	if flags&0x40 != 0 {
+		// Skip extended header
+		if len(body) < 4 {
+			return nil, errors.New("invalid id3v2 extended header")
+		}
+		if major == 4 {
+			pos = syncsafe(body[0:4])
+		} else {
+			pos = int(binary.BigEndian.Uint32(body[0:4])) + 4
+		}
+	}
+
+	tag := NewID3v2Tag()
+	for pos+ID3v2HeaderSize <= len(body) {
+		if body[pos] == 0 {
+			break // padding
+		}
+		id := string(body[pos : pos+4])
+		var size int
+		if major == 4 {
+			size = syncsafe(body[pos+4 : pos+8])
+		} else {
+			size = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		}
+		formatFlags := body[pos+9]
+		pos += ID3v2HeaderSize
+		if size < 0 || pos+size > len(body) {
+			return nil, fmt.Errorf("invalid id3v2 frame size: %s %d", id, size)
+		}
+		data := append([]byte(nil), body[pos:pos+size]...)
+		pos += size
+
+		// Bytes added to the frame header: group ID, encryption method, sizes
+		var extra int
+		var compressed, encrypted bool
+		if major == 4 {
+			// ID3v2.4 applies unsynchronization per frame
+			if formatFlags&0x02 != 0 || flags&0x80 != 0 {
+				data = removeUnsync(data)
+			}
+			compressed, encrypted = formatFlags&0x08 != 0, formatFlags&0x04 != 0
+			extra = bits.OnesCount8(formatFlags&0x44) + 4*bits.OnesCount8(formatFlags&0x01)
+		} else {
+			compressed, encrypted = formatFlags&0x80 != 0, formatFlags&0x40 != 0
+			extra = 4*bits.OnesCount8(formatFlags&0x80) + bits.OnesCount8(formatFlags&0x60)
+		}
+		if len(data) < extra || encrypted {
+			// Encrypted frames can not be read, and are not valid without their flags
+			continue
+		}
+		data = data[extra:]
+		if compressed {
+			var err error
+			if data, err = inflateFrame(data); err != nil {
+				continue
+			}
+		}
+		tag.AddFrame(id, data)
+	}
+	tag.Padding = len(body) - min(pos, len(body))
+	tag.Version = major
+
+	return tag, nil
+}
+
+// maxInflatedFrameSize limits the size of a compressed frame after decompression.
+const maxInflatedFrameSize = 16 << 20
+
+// inflateFrame decompresses the zlib data of a compressed frame.
+func inflateFrame(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, maxInflatedFrameSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxInflatedFrameSize {
+		return nil, errors.New("compressed id3v2 frame too large")
+	}
+	return out, nil
+}
+
+// Frame returns the first frame with the given ID, or nil if not present.
+func (t *ID3v2Tag) Frame(id string) *ID3Frame {
+	for i := range t.Frames {
+		if t.Frames[i].ID == id {
+			return &t.Frames[i]
+		}
+	}
+	return nil
+}
+
+// AddFrame appends a frame to the tag.
+func (t *ID3v2Tag) AddFrame(id string, data []byte) {
+	t.Frames = append(t.Frames, ID3Frame{ID: id, Data: data})
+}
+
+// SetFrame sets a raw frame, replacing every existing frame with the same ID.
+// It can be used for any frame type the tag has no dedicated setter for.
+func (t *ID3v2Tag) SetFrame(id string, data []byte) {
+	t.RemoveFrames(func(f *ID3Frame) bool { return f.ID == id })
+	t.AddFrame(id, data)
+}
+
+// RemoveFrames removes every frame matching the predicate.
+func (t *ID3v2Tag) RemoveFrames(match func(f *ID3Frame) bool) {
+	frames := t.Frames[:0]
+	for i := range t.Frames {
+		if !match(&t.Frames[i]) {
+			frames = append(frames, t.Frames[i])
+		}
+	}
+	t.Frames = frames
+}
+
+// Text returns the value of a text information frame (T***), or "" if not present.
+// Multiple values are joined with "/".
+func (t *ID3v2Tag) Text(id string) string {
+	f := t.Frame(id)
+	if f == nil {
+		return ""
+	}
+	return strings.Join(decodeText(f.Data), "/")
+}
+
+// SetText sets a text information frame (T***), replacing any existing one.
+func (t *ID3v2Tag) SetText(id, text string) {
+	t.RemoveFrames(func(f *ID3Frame) bool { return f.ID == id })
+	t.AddFrame(id, encodeText(t.Encoding, text))
+}
+
+// UserText returns the value of the TXXX frame with the given description.
+func (t *ID3v2Tag) UserText(desc string) (string, bool) {
+	for _, f := range t.Frames {
+		if f.ID != "TXXX" {
+			continue
+		}
+		values := decodeText(f.Data)
+		if len(values) > 0 && values[0] == desc {
+			if len(values) > 1 {
+				return values[1], true
+			}
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// SetUserText sets a user-defined text frame (TXXX) with the given description,
+// replacing any existing TXXX frame with the same description.
+func (t *ID3v2Tag) SetUserText(desc, text string) {
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		return f.ID == "TXXX" && userTextDesc(f.Data) == desc
+	})
+	t.AddFrame("TXXX", encodeText(t.Encoding, desc, text))
+}
+
+// Comment returns the text of the COMM frame with the given description, in any language.
+func (t *ID3v2Tag) Comment(desc string) (string, bool) {
+	for _, f := range t.Frames {
+		if !isComment(&f, desc) {
+			continue
+		}
+		if values := splitText(TextEncoding(f.Data[0]), f.Data[4:]); len(values) > 1 {
+			return values[1], true
+		}
+		return "", true
+	}
+	return "", false
+}
+
+// SetComment sets a comment frame (COMM) in English with the given description,
+// replacing any existing COMM frame with the same description.
+func (t *ID3v2Tag) SetComment(desc, text string) {
+	t.RemoveFrames(func(f *ID3Frame) bool { return isComment(f, desc) })
+	data := encodeText(t.Encoding, desc, text)
+	data = append(data[:1:1], append([]byte("eng"), data[1:]...)...)
+	t.AddFrame("COMM", data)
+}
+
+// isComment reports whether f is a COMM frame with the given description.
+func isComment(f *ID3Frame, desc string) bool {
+	if f.ID != "COMM" || len(f.Data) < 4 {
+		return false
+	}
+	values := splitText(TextEncoding(f.Data[0]), f.Data[4:])
+	return len(values) > 0 && values[0] == desc
+}
+
+// URL returns the value of a URL link frame (W***, e.g. WFED), or "" if not present.
+func (t *ID3v2Tag) URL(id string) string {
+	f := t.Frame(id)
+	if f == nil {
+		return ""
+	}
+	value, _, _ := cutText(TextEncodingLatin1, f.Data)
+	return string(value)
+}
+
+// SetURL sets a URL link frame (W***, e.g. WFED), replacing any existing one.
+// URL frames are always stored as Latin-1.
+func (t *ID3v2Tag) SetURL(id, url string) {
+	t.SetFrame(id, []byte(url))
+}
+
+// UserURL returns the URL of the WXXX frame with the given description.
+func (t *ID3v2Tag) UserURL(desc string) (string, bool) {
+	for _, f := range t.Frames {
+		if f.ID != "WXXX" || len(f.Data) < 1 {
+			continue
+		}
+		enc := TextEncoding(f.Data[0])
+		value, rest, _ := cutText(enc, f.Data[1:])
+		if decodeTextValue(enc, value) == desc {
+			url, _, _ := cutText(TextEncodingLatin1, rest)
+			return string(url), true
+		}
+	}
+	return "", false
+}
+
+// SetUserURL sets a user-defined URL frame (WXXX) with the given description,
+// replacing any existing WXXX frame with the same description.
+func (t *ID3v2Tag) SetUserURL(desc, url string) {
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		return f.ID == "WXXX" && userTextDesc(f.Data) == desc
+	})
+	data := encodeText(t.Encoding, desc)
+	data = append(data, textTerminator(TextEncoding(data[0]))...)
+	t.AddFrame("WXXX", append(data, url...))
+}
+
+// SetPodcast marks the file as a podcast episode (iTunes PCST frame) and sets
+// the feed URL (WFED) if feedURL is not empty.
+func (t *ID3v2Tag) SetPodcast(feedURL string) {
+	t.SetFrame("PCST", []byte{0, 0, 0, 0})
+	if feedURL != "" {
+		t.SetURL("WFED", feedURL)
+	}
+}
+
+// SetReplayGain writes the track gain (in dB) and peak (linear, 1.0 = full scale)
+// as the standard replaygain_track_gain/peak TXXX frames, and for ID3v2.4 an RVA2 frame.
+func (t *ID3v2Tag) SetReplayGain(gainDB float64, peak float64) {
+	t.SetUserText("replaygain_track_gain", fmt.Sprintf("%+.2f dB", gainDB))
+	t.SetUserText("replaygain_track_peak", fmt.Sprintf("%.6f", peak))
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		return f.ID == "RVA2" && bytes.HasPrefix(f.Data, []byte("track\x00"))
+	})
+	if t.version() == 3 {
+		return
+	}
+
+	// RVA2: identification, channel type (1 = master volume),
+	// volume adjustment in 1/512 dB, bits representing peak, peak volume.
+	adj := int16(math.Max(math.Min(math.Round(gainDB*512), math.MaxInt16), math.MinInt16))
+	peakVal := uint16(math.Min(math.Round(peak*32767), math.MaxUint16))
+	rva2 := []byte("track\x00")
+	rva2 = append(rva2, 0x01, byte(uint16(adj)>>8), byte(adj), 16, byte(peakVal>>8), byte(peakVal))
+	t.AddFrame("RVA2", rva2)
+}
+
+// ReplayGain returns the track gain in dB and the peak (linear, 1.0 = full scale) of the
+// replaygain_track_gain/peak TXXX frames. ok is false if the gain is missing or invalid,
+// a missing peak is returned as 0.
+func (t *ID3v2Tag) ReplayGain() (gainDB float64, peak float64, ok bool) {
+	gain, found := t.UserText("replaygain_track_gain")
+	if !found {
+		return 0, 0, false
+	}
+	gainDB, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(gain), "dB")), 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if value, found := t.UserText("replaygain_track_peak"); found {
+		peak, _ = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	}
+	return gainDB, peak, true
+}
+
+// Size returns the total size of the serialized tag including header and padding.
+func (t *ID3v2Tag) Size() int {
+	n := ID3v2HeaderSize + t.Padding
+	for _, f := range t.outputFrames() {
+		n += ID3v2HeaderSize + len(f.Data)
+	}
+	return n
+}
+
+// Bytes serializes the tag.
+func (t *ID3v2Tag) Bytes() []byte {
+	version := t.version()
+	frames := t.outputFrames()
+
+	size := ID3v2HeaderSize + t.Padding
+	for _, f := range frames {
+		size += ID3v2HeaderSize + len(f.Data)
+	}
+
+	buf := make([]byte, ID3v2HeaderSize, size)
+	copy(buf[0:3], "ID3")
+	buf[3] = version
+	buf[4] = 0
+	buf[5] = 0 // flags
+	putSyncsafe(buf[6:10], size-ID3v2HeaderSize)
+
+	var hdr [ID3v2HeaderSize]byte
+	for _, f := range frames {
+		copy(hdr[0:4], f.ID)
+		if version == 4 {
+			putSyncsafe(hdr[4:8], len(f.Data))
+		} else {
+			binary.BigEndian.PutUint32(hdr[4:8], uint32(len(f.Data)))
+		}
+		hdr[8], hdr[9] = 0, 0
+		buf = append(buf, hdr[:]...)
+		buf = append(buf, f.Data...)
+	}
+	return buf[:size]
+}
+
+func (t *ID3v2Tag) version() byte {
+	if t.Version == 3 {
+		return 3
+	}
+	return 4
+}
+
+// outputFrames returns the frames adjusted for the target version.
+func (t *ID3v2Tag) outputFrames() []ID3Frame {
+	if t.version() == 4 {
+		return t.Frames
+	}
+	frames := make([]ID3Frame, 0, len(t.Frames))
+	for _, f := range t.Frames {
+		if f.ID == "RVA2" {
+			continue
+		}
+		if f.ID == "TDRC" {
+			for _, d := range splitRecordingTime(f, t.Frame("TDAT") == nil, t.Frame("TIME") == nil) {
+				frames = append(frames, toID3v23Frame(d))
+			}
+			continue
+		}
+		frames = append(frames, toID3v23Frame(f))
+	}
+	return frames
+}
+
+// splitRecordingTime converts a TDRC timestamp like 2024-05-01T13:45 to the ID3v2.3 frames
+// TYER (2024), TDAT (0105, day and month) and TIME (1345). Seconds are dropped; TDAT and
+// TIME are only added if wanted and the timestamp has them.
+func splitRecordingTime(f ID3Frame, withDate, withTime bool) []ID3Frame {
+	if len(f.Data) < 1 {
+		return []ID3Frame{{ID: "TYER", Data: f.Data}}
+	}
+	enc := TextEncoding(f.Data[0])
+	s := ""
+	if values := decodeText(f.Data); len(values) > 0 {
+		s = values[0]
+	}
+	frames := []ID3Frame{{ID: "TYER", Data: encodeText(enc, s[:min(4, len(s))])}}
+	if withDate && len(s) >= 10 && s[4] == '-' && s[7] == '-' {
+		frames = append(frames, ID3Frame{ID: "TDAT", Data: encodeText(enc, s[8:10]+s[5:7])})
+	}
+	if withTime && len(s) >= 16 && s[10] == 'T' && s[13] == ':' {
+		frames = append(frames, ID3Frame{ID: "TIME", Data: encodeText(enc, s[11:13]+s[14:16])})
+	}
+	return frames
+}
+
+// toID3v23Frame converts encodings of frames that are not part of ID3v2.3.
+func toID3v23Frame(f ID3Frame) ID3Frame {
+	if len(f.Data) < 1 {
+		return f
+	}
+	enc := TextEncoding(f.Data[0])
+	if enc != TextEncodingUTF8 && enc != TextEncodingUTF16BE {
+		return f
+	}
+
+	switch {
+	case f.ID == "TXXX":
+		f.Data = encodeText(TextEncodingUTF16, decodeText(f.Data)...)
+	case f.ID[0] == 'T':
+		// ID3v2.3 separates multiple values with "/"
+		f.Data = encodeText(TextEncodingUTF16, strings.Join(decodeText(f.Data), "/"))
+	case f.ID == "WXXX":
+		desc, url, _ := cutText(enc, f.Data[1:])
+		data := encodeText(TextEncodingUTF16, decodeTextValue(enc, desc))
+		data = append(data, textTerminator(TextEncodingUTF16)...)
+		f.Data = append(data, url...)
+	case f.ID == "APIC":
+		mime, rest, found := cutText(TextEncodingLatin1, f.Data[1:])
+		if !found || len(rest) < 1 {
+			return f
+		}
+		desc, image, _ := cutText(enc, rest[1:])
+		data := []byte{byte(TextEncodingUTF16)}
+		data = append(data, mime...)
+		data = append(data, 0, rest[0])
+		data = append(data, encodeText(TextEncodingUTF16, decodeTextValue(enc, desc))[1:]...)
+		data = append(data, textTerminator(TextEncodingUTF16)...)
+		f.Data = append(data, image...)
+	case f.ID == "COMM" || f.ID == "USLT":
+		if len(f.Data) < 4 {
+			return f
+		}
+		data := append([]byte{byte(TextEncodingUTF16)}, f.Data[1:4]...) // language
+		data = append(data, encodeText(TextEncodingUTF16, splitText(enc, f.Data[4:])...)[1:]...)
+		f.Data = data
+	}
+	return f
+}
+
+// BytesWithSize serializes the tag padded to exactly size bytes.
+// It is used to rewrite a tag in place over a previously reserved area.
+func (t *ID3v2Tag) BytesWithSize(size int) ([]byte, error) {
+	padding := t.Padding
+	defer func() { t.Padding = padding }()
+
+	t.Padding = 0
+	need := t.Size()
+	if need > size {
+		return nil, fmt.Errorf("id3v2 tag needs %d bytes, only %d available", need, size)
+	}
+	t.Padding = size - need
+	return t.Bytes(), nil
+}
+
+func userTextDesc(data []byte) string {
+	values := decodeText(data)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7f
+	b[1] = byte(n>>14) & 0x7f
+	b[2] = byte(n>>7) & 0x7f
+	b[3] = byte(n) & 0x7f
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
@@ -0,0 +1,399 @@
+package mp3_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestID3v2TagBytes tests serialization of an ID3v2 tag
+func TestID3v2TagBytes(t *testing.T) {
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Title")
+	tag.SetUserText("replaygain_track_gain", "-3.20 dB")
+	tag.Padding = 16
+
+	data := tag.Bytes()
+	if len(data) != tag.Size() {
+		t.Fatalf("Size mismatch: got %d, want %d", len(data), tag.Size())
+	}
+	if string(data[0:3]) != "ID3" || data[3] != 4 {
+		t.Fatalf("Invalid tag header: % x", data[:10])
+	}
+	if !bytes.Contains(data, []byte("TIT2")) || !bytes.Contains(data, []byte("Title")) {
+		t.Error("Tag missing TIT2 frame")
+	}
+
+	// Setting the same TXXX description replaces the frame
+	tag.SetUserText("replaygain_track_gain", "+1.00 dB")
+	count := 0
+	for _, f := range tag.Frames {
+		if f.ID == "TXXX" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("TXXX frame count: got %d, want 1", count)
+	}
+
+	fixed, err := tag.BytesWithSize(256)
+	if err != nil {
+		t.Fatalf("BytesWithSize failed: %v", err)
+	}
+	if len(fixed) != 256 {
+		t.Errorf("BytesWithSize length: got %d, want 256", len(fixed))
+	}
+	if _, err := tag.BytesWithSize(20); err == nil {
+		t.Error("Expected error for too small size, got nil")
+	}
+
+	t.Logf("✓ ID3v2 tag: %d frames, %d bytes", len(tag.Frames), len(data))
+}
+
+// TestID3v2ReplayGain tests ReplayGain frames
+func TestID3v2ReplayGain(t *testing.T) {
+	tag := mp3.NewID3v2Tag()
+	tag.SetReplayGain(-6.5, 0.5)
+	tag.SetReplayGain(-6.5, 0.5)
+
+	data := tag.Bytes()
+	if !bytes.Contains(data, []byte("replaygain_track_gain\x00-6.50 dB")) {
+		t.Error("Tag missing replaygain_track_gain")
+	}
+	if !bytes.Contains(data, []byte("replaygain_track_peak\x000.500000")) {
+		t.Error("Tag missing replaygain_track_peak")
+	}
+	if len(tag.Frames) != 3 {
+		t.Errorf("Frame count: got %d, want 3", len(tag.Frames))
+	}
+
+	rva2 := tag.Frame("RVA2")
+	if rva2 == nil {
+		t.Fatal("Tag missing RVA2 frame")
+	}
+	adj := int16(uint16(rva2.Data[7])<<8 | uint16(rva2.Data[8]))
+	if adj != -3328 {
+		t.Errorf("RVA2 adjustment: got %d, want %d", adj, -3328)
+	}
+
+	t.Logf("✓ ReplayGain tag: %d bytes", len(data))
+}
+
+// TestID3v23ReplayGain tests that ID3v2.3 tags get the TXXX frames only, RVA2 is ID3v2.4
+func TestID3v23ReplayGain(t *testing.T) {
+	tag := mp3.NewID3v2Tag()
+	tag.Version = 3
+	tag.SetReplayGain(-6.5, 0.5)
+	if len(tag.Frames) != 2 || tag.Frame("RVA2") != nil {
+		t.Errorf("Frames: got %+v, want the two TXXX frames", tag.Frames)
+	}
+
+	// RVA2 frames of an ID3v2.4 tag are left out when it is written as ID3v2.3
+	tag = mp3.NewID3v2Tag()
+	tag.SetReplayGain(-6.5, 0.5)
+	tag.Version = 3
+	data := tag.Bytes()
+	if bytes.Contains(data, []byte("RVA2")) {
+		t.Error("ID3v2.3 tag contains RVA2")
+	}
+	if len(data) != tag.Size() {
+		t.Errorf("Size %d, Bytes %d", tag.Size(), len(data))
+	}
+	parsed, err := mp3.ReadID3v2(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	if gain, peak, ok := parsed.ReplayGain(); !ok || gain != -6.5 || peak != 0.5 || parsed.Version != 3 {
+		t.Errorf("Parsed v2.%d: ReplayGain %.2f dB peak %.4f (%v)", parsed.Version, gain, peak, ok)
+	}
+	t.Logf("✓ ID3v2.3 ReplayGain tag: %d bytes", len(data))
+}
+
+// TestReadID3v2 tests parsing a serialized tag back
+func TestReadID3v2(t *testing.T) {
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Title")
+	tag.SetText("TALB", "Album")
+	tag.Padding = 32
+
+	data := append(tag.Bytes(), 0xff, 0xfb)
+	r := bytes.NewReader(data)
+	parsed, err := mp3.ReadID3v2(r)
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	if len(parsed.Frames) != 2 {
+		t.Fatalf("Frame count: got %d, want 2", len(parsed.Frames))
+	}
+	if parsed.Padding != 32 {
+		t.Errorf("Padding: got %d, want 32", parsed.Padding)
+	}
+	if r.Len() != 2 {
+		t.Errorf("ReadID3v2 consumed wrong number of bytes, %d left", r.Len())
+	}
+
+	if _, err := mp3.ReadID3v2(bytes.NewReader([]byte("not a tag!"))); err != mp3.ErrorNoID3v2 {
+		t.Errorf("Expected ErrorNoID3v2, got %v", err)
+	}
+}
+
+// TestID3v2TextEncodings tests writing and reading text in every encoding
+func TestReadID3v2FrameFlags(t *testing.T) {
+	syncsafe := func(n int) []byte {
+		return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	}
+	deflate := func(b []byte) []byte {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(b)
+		zw.Close()
+		return z.Bytes()
+	}
+	title, album := []byte("\x00Title"), []byte("\x00Album")
+
+	for _, major := range []byte{3, 4} {
+		var body bytes.Buffer
+		frame := func(id string, flags byte, data []byte) {
+			body.WriteString(id)
+			if major == 4 {
+				body.Write(syncsafe(len(data)))
+			} else {
+				binary.Write(&body, binary.BigEndian, uint32(len(data)))
+			}
+			body.Write([]byte{0, flags})
+			body.Write(data)
+		}
+		if major == 4 {
+			// Compression needs the data length indicator in ID3v2.4
+			frame("TIT2", 0x09, append(syncsafe(len(title)), deflate(title)...))
+			frame("TPE1", 0x04, []byte("\x80encrypted"))
+			frame("TALB", 0x40, append([]byte{7}, album...))
+		} else {
+			frame("TIT2", 0x80, append(binary.BigEndian.AppendUint32(nil, uint32(len(title))), deflate(title)...))
+			frame("TPE1", 0x40, []byte("\x80encrypted"))
+			frame("TALB", 0x20, append([]byte{7}, album...))
+		}
+		data := append([]byte{'I', 'D', '3', major, 0, 0}, syncsafe(body.Len())...)
+		data = append(data, body.Bytes()...)
+
+		tag, err := mp3.ReadID3v2(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadID3v2(2.%d) failed: %v", major, err)
+		}
+		if tag.Text("TIT2") != "Title" || tag.Text("TALB") != "Album" || tag.Frame("TPE1") != nil {
+			t.Errorf("ID3v2.%d: title %q, album %q, encrypted frame %v", major, tag.Text("TIT2"), tag.Text("TALB"), tag.Frame("TPE1"))
+		}
+		// The frames are written again without their format flags
+		again, err := mp3.ReadID3v2(bytes.NewReader(tag.Bytes()))
+		if err != nil || again.Text("TIT2") != "Title" || again.Text("TALB") != "Album" {
+			t.Errorf("Rewritten ID3v2.%d tag: %v", major, err)
+		}
+		t.Logf("✓ ID3v2.%d: %d frames kept", major, len(tag.Frames))
+	}
+}
+
+func TestID3v2TextEncodings(t *testing.T) {
+	encodings := []mp3.TextEncoding{
+		mp3.TextEncodingLatin1,
+		mp3.TextEncodingUTF16,
+		mp3.TextEncodingUTF16BE,
+		mp3.TextEncodingUTF8,
+	}
+	texts := []string{"Plain title", "Café Ñandú", "日本語のタイトル"}
+
+	for _, enc := range encodings {
+		for _, text := range texts {
+			tag := mp3.NewID3v2Tag()
+			tag.Encoding = enc
+			tag.SetText("TIT2", text)
+			tag.SetUserText("desc ü", text)
+
+			parsed, err := mp3.ReadID3v2(bytes.NewReader(tag.Bytes()))
+			if err != nil {
+				t.Fatalf("ReadID3v2 failed: %v", err)
+			}
+			if got := parsed.Text("TIT2"); got != text {
+				t.Errorf("Encoding %d: TIT2 got %q, want %q", enc, got, text)
+			}
+			if got, ok := parsed.UserText("desc ü"); !ok || got != text {
+				t.Errorf("Encoding %d: TXXX got %q, want %q", enc, got, text)
+			}
+		}
+	}
+
+	// Latin-1 falls back to UTF-16 for text it cannot represent
+	tag := mp3.NewID3v2Tag()
+	tag.Encoding = mp3.TextEncodingLatin1
+	tag.SetText("TIT2", "日本")
+	if enc := tag.Frame("TIT2").Data[0]; enc != byte(mp3.TextEncodingUTF16) {
+		t.Errorf("Latin-1 fallback encoding: got %d, want %d", enc, mp3.TextEncodingUTF16)
+	}
+}
+
+// TestReadID3v2Unsync tests reading unsynchronized tags
+func TestReadID3v2Unsync(t *testing.T) {
+	// Frame body with a 0xFF byte that is followed by an inserted 0x00
+	body := []byte{0x00, 'a', 0xff, 0x00, 0xe0, 'b'}
+	want := []byte{0x00, 'a', 0xff, 0xe0, 'b'}
+
+	t.Run("V23", func(t *testing.T) {
+		frame := append([]byte{'P', 'R', 'I', 'V', 0, 0, 0, byte(len(want)), 0, 0}, body...)
+		hdr := []byte{'I', 'D', '3', 3, 0, 0x80, 0, 0, 0, byte(len(frame))}
+		tag, err := mp3.ReadID3v2(bytes.NewReader(append(hdr, frame...)))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		if f := tag.Frame("PRIV"); f == nil || !bytes.Equal(f.Data, want) {
+			t.Errorf("Frame data mismatch: got %+v", tag.Frames)
+		}
+	})
+
+	t.Run("V24", func(t *testing.T) {
+		// Unsynchronisation and data length indicator frame flags
+		data := append([]byte{0, 0, 0, byte(len(want))}, body...)
+		frame := append([]byte{'P', 'R', 'I', 'V', 0, 0, 0, byte(len(data)), 0, 0x03}, data...)
+		hdr := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, byte(len(frame))}
+		tag, err := mp3.ReadID3v2(bytes.NewReader(append(hdr, frame...)))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		if f := tag.Frame("PRIV"); f == nil || !bytes.Equal(f.Data, want) {
+			t.Errorf("Frame data mismatch: got %+v", tag.Frames)
+		}
+	})
+}
+
+// TestID3v2CustomFrames tests user-defined, URL and podcast frames
+func TestID3v2CustomFrames(t *testing.T) {
+	tag := mp3.NewID3v2Tag()
+	tag.SetUserText("episode_guid", "abc-123")
+	tag.SetUserURL("Show notes", "https://example.com/notes")
+	tag.SetUserURL("Show notes", "https://example.com/notes/1")
+	tag.SetPodcast("https://example.com/feed.xml")
+	tag.SetText("TDES", "Episode description")
+	tag.SetFrame("TGID", []byte("\x00guid-1"))
+	tag.SetComment("iTunSMPB", " 00000000 00000210")
+	tag.SetComment("iTunSMPB", " 00000000 00000450")
+
+	parsed, err := mp3.ReadID3v2(bytes.NewReader(tag.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+
+	if got, ok := parsed.UserText("episode_guid"); !ok || got != "abc-123" {
+		t.Errorf("TXXX got %q", got)
+	}
+	if got, ok := parsed.UserURL("Show notes"); !ok || got != "https://example.com/notes/1" {
+		t.Errorf("WXXX got %q", got)
+	}
+	if got := parsed.URL("WFED"); got != "https://example.com/feed.xml" {
+		t.Errorf("WFED got %q", got)
+	}
+	if parsed.Frame("PCST") == nil {
+		t.Error("Tag missing PCST frame")
+	}
+	if got := parsed.Text("TDES"); got != "Episode description" {
+		t.Errorf("TDES got %q", got)
+	}
+	if got := parsed.Text("TGID"); got != "guid-1" {
+		t.Errorf("TGID got %q", got)
+	}
+	if got, ok := parsed.Comment("iTunSMPB"); !ok || got != " 00000000 00000450" {
+		t.Errorf("COMM got %q", got)
+	}
+	if _, ok := parsed.Comment(""); ok {
+		t.Error("Unexpected COMM without description")
+	}
+	if len(parsed.Frames) != 7 {
+		t.Errorf("Frame count: got %d, want 7", len(parsed.Frames))
+	}
+}
+
+// TestID3v2Version tests writing ID3v2.3 and ID3v2.4 tags
+func TestID3v2Version(t *testing.T) {
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Ünïcödé title")
+	tag.SetText("TDRC", "2024")
+	tag.SetUserText("note", "✓ done")
+	tag.SetUserURL("home ü", "https://example.com")
+	tag.AddFrame("PRIV", bytes.Repeat([]byte{0xab}, 200))
+
+	t.Run("V24", func(t *testing.T) {
+		data := tag.Bytes()
+		if data[3] != 4 {
+			t.Errorf("Version byte: got %d, want 4", data[3])
+		}
+		if len(data) != tag.Size() {
+			t.Errorf("Size mismatch: got %d, want %d", len(data), tag.Size())
+		}
+	})
+
+	t.Run("V23", func(t *testing.T) {
+		tag.Version = 3
+		defer func() { tag.Version = 0 }()
+
+		data := tag.Bytes()
+		if data[3] != 3 {
+			t.Errorf("Version byte: got %d, want 3", data[3])
+		}
+		if len(data) != tag.Size() {
+			t.Errorf("Size mismatch: got %d, want %d", len(data), tag.Size())
+		}
+
+		parsed, err := mp3.ReadID3v2(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		if parsed.Version != 3 {
+			t.Errorf("Parsed version: got %d, want 3", parsed.Version)
+		}
+		for _, f := range parsed.Frames {
+			if len(f.Data) > 0 && f.ID != "PRIV" && f.Data[0] != byte(mp3.TextEncodingUTF16) {
+				t.Errorf("Frame %s uses encoding %d, not allowed in ID3v2.3", f.ID, f.Data[0])
+			}
+		}
+		if got := parsed.Text("TIT2"); got != "Ünïcödé title" {
+			t.Errorf("TIT2 got %q", got)
+		}
+		if got := parsed.Text("TYER"); got != "2024" {
+			t.Errorf("TYER got %q", got)
+		}
+		if got, _ := parsed.UserText("note"); got != "✓ done" {
+			t.Errorf("TXXX got %q", got)
+		}
+		if got, _ := parsed.UserURL("home ü"); got != "https://example.com" {
+			t.Errorf("WXXX got %q", got)
+		}
+		if f := parsed.Frame("PRIV"); f == nil || len(f.Data) != 200 {
+			t.Error("PRIV frame size mismatch")
+		}
+	})
+
+	t.Run("V23RecordingTime", func(t *testing.T) {
+		for _, tc := range []struct {
+			tdrc, year, date, time string
+		}{
+			{"2024", "2024", "", ""},
+			{"2024-05", "2024", "", ""},
+			{"2024-05-01", "2024", "0105", ""},
+			{"2024-05-01T13:45:30", "2024", "0105", "1345"},
+		} {
+			tag := mp3.NewID3v2Tag()
+			tag.Version = 3
+			tag.SetText("TDRC", tc.tdrc)
+			parsed, err := mp3.ReadID3v2(bytes.NewReader(tag.Bytes()))
+			if err != nil {
+				t.Fatalf("ReadID3v2 failed: %v", err)
+			}
+			if parsed.Frame("TDRC") != nil || parsed.Text("TYER") != tc.year ||
+				parsed.Text("TDAT") != tc.date || parsed.Text("TIME") != tc.time {
+				t.Errorf("TDRC %q: TYER %q, TDAT %q, TIME %q", tc.tdrc,
+					parsed.Text("TYER"), parsed.Text("TDAT"), parsed.Text("TIME"))
+			}
+		}
+		t.Log("✓ TDRC is split into TYER, TDAT and TIME for ID3v2.3")
+	})
+}
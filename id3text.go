@@ -0,0 +1,156 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TextEncoding is the character encoding of an ID3v2 text field.
+// The values match the encoding byte stored in the frames.
+type TextEncoding byte
+
+const (
+	TextEncodingLatin1  TextEncoding = 0
+	TextEncodingUTF16   TextEncoding = 1 // UTF-16 with BOM
+	TextEncodingUTF16BE TextEncoding = 2 // UTF-16BE without BOM, ID3v2.4 only
+	TextEncodingUTF8    TextEncoding = 3 // ID3v2.4 only
+)
+
+// encodeText encodes values with the given encoding, separated by the encoding's terminator.
+// The returned encoding may differ from enc: Latin-1 falls back to UTF-16 when text is not representable.
+func encodeText(enc TextEncoding, values ...string) []byte {
+	if enc == TextEncodingLatin1 {
+		for _, v := range values {
+			if !isLatin1(v) {
+				enc = TextEncodingUTF16
+				break
+			}
+		}
+	}
+
+	data := []byte{byte(enc)}
+	for i, v := range values {
+		if i > 0 {
+			data = append(data, textTerminator(enc)...)
+		}
+		switch enc {
+		case TextEncodingLatin1:
+			for _, r := range v {
+				data = append(data, byte(r))
+			}
+		case TextEncodingUTF16:
+			data = append(data, 0xff, 0xfe) // little endian BOM
+			for _, u := range utf16.Encode([]rune(v)) {
+				data = binary.LittleEndian.AppendUint16(data, u)
+			}
+		case TextEncodingUTF16BE:
+			for _, u := range utf16.Encode([]rune(v)) {
+				data = binary.BigEndian.AppendUint16(data, u)
+			}
+		default:
+			data = append(data, v...)
+		}
+	}
+	return data
+}
+
+// decodeText decodes a text frame body (encoding byte followed by text) into its null separated values.
+func decodeText(data []byte) []string {
+	if len(data) < 1 {
+		return nil
+	}
+	enc := TextEncoding(data[0])
+	return splitText(enc, data[1:])
+}
+
+// splitText splits encoded text at terminators and decodes each value.
+// A trailing terminator does not produce an empty value.
+func splitText(enc TextEncoding, data []byte) []string {
+	var values []string
+	for len(data) > 0 {
+		value, rest, found := cutText(enc, data)
+		values = append(values, decodeTextValue(enc, value))
+		if !found {
+			break
+		}
+		data = rest
+	}
+	return values
+}
+
+// cutText splits data at the first terminator of the given encoding.
+func cutText(enc TextEncoding, data []byte) (value []byte, rest []byte, found bool) {
+	if enc == TextEncodingUTF16 || enc == TextEncodingUTF16BE {
+		for i := 0; i+1 < len(data); i += 2 {
+			if data[i] == 0 && data[i+1] == 0 {
+				return data[:i], data[i+2:], true
+			}
+		}
+		return data, nil, false
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return data[:i], data[i+1:], true
+	}
+	return data, nil, false
+}
+
+func decodeTextValue(enc TextEncoding, data []byte) string {
+	switch enc {
+	case TextEncodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case TextEncodingUTF16, TextEncodingUTF16BE:
+		order := binary.ByteOrder(binary.BigEndian)
+		if enc == TextEncodingUTF16 && len(data) >= 2 {
+			if data[0] == 0xff && data[1] == 0xfe {
+				order = binary.LittleEndian
+				data = data[2:]
+			} else if data[0] == 0xfe && data[1] == 0xff {
+				data = data[2:]
+			}
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		return string(utf16.Decode(units))
+	default:
+		if !utf8.Valid(data) {
+			return string(bytes.ToValidUTF8(data, []byte("�")))
+		}
+		return string(data)
+	}
+}
+
+func textTerminator(enc TextEncoding) []byte {
+	if enc == TextEncodingUTF16 || enc == TextEncodingUTF16BE {
+		return []byte{0, 0}
+	}
+	return []byte{0}
+}
+
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// removeUnsync reverses the ID3v2 unsynchronization scheme by dropping every 0x00 that follows 0xFF.
+func removeUnsync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
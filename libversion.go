@@ -0,0 +1,57 @@
+//go:build cgo && !purego
+
+package mp3
+
+/*
+#ifdef MP3_SYSTEM_LIBS
+#include <mpg123.h>
+#include <lame/lame.h>
+#else
+#include "deps/include/mpg123.h"
+#include "deps/include/lame.h"
+#endif
+
+// mpg123_distversion is available since mpg123 1.32 (API version 48)
+static const char *mp3_mpg123_distversion(unsigned int *major, unsigned int *minor, unsigned int *patch) {
+#if MPG123_API_VERSION >= 48
+	return mpg123_distversion(major, minor, patch);
+#else
+	*major = *minor = *patch = 0;
+	return NULL;
+#endif
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LameVersion returns the version of the linked LAME library.
+func LameVersion() Version {
+	var v C.lame_version_t
+	C.get_lame_version_numerical(&v)
+	ver := Version{Major: int(v.major), Minor: int(v.minor)}
+	if v.alpha > 0 {
+		ver.Label = fmt.Sprintf("alpha%d", v.alpha)
+	} else if v.beta > 0 {
+		ver.Label = fmt.Sprintf("beta%d", v.beta)
+	}
+	return ver
+}
+
+// Mpg123Version returns the version of the linked mpg123 library.
+// It is zero for system libraries older than mpg123 1.32.
+func Mpg123Version() Version {
+	var major, minor, patch C.uint
+	s := C.mp3_mpg123_distversion(&major, &minor, &patch)
+	ver := Version{Major: int(major), Minor: int(minor), Patch: int(patch)}
+	if s != nil {
+		// The full version string looks like "1.2.3-beta4 (experimental)"
+		if _, label, ok := strings.Cut(C.GoString(s), "-"); ok {
+			ver.Label = label
+		}
+	}
+	return ver
+}
@@ -0,0 +1,13 @@
+//go:build !cgo || purego
+
+package mp3
+
+// LameVersion returns a zero Version as LAME is not linked in this build.
+func LameVersion() Version {
+	return Version{}
+}
+
+// Mpg123Version returns a zero Version as mpg123 is not linked in this build.
+func Mpg123Version() Version {
+	return Version{}
+}
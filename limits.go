@@ -0,0 +1,103 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	ErrorTooManyHandles = errors.New("too many open encoders and decoders")
+	ErrorInputTooLarge  = errors.New("input exceeds the per-call size limit")
+	ErrorOutputLimit    = errors.New("output exceeds the cumulative size limit")
+)
+
+// Limits are resource quotas enforced by all encoders and decoders, e.g. for multi-tenant services.
+// Zero values mean unlimited.
+type Limits struct {
+	// MaxHandles is the maximum number of open encoders and decoders together.
+	// NewEncoder and NewDecoder fail with ErrorTooManyHandles when it is reached.
+	MaxHandles int
+
+	// MaxInputBytes is the maximum input size of a single Encode or Decode call.
+	// Larger calls fail with ErrorInputTooLarge.
+	MaxInputBytes int
+
+	// MaxOutputBytes is the maximum output of a single encoder or decoder over its lifetime.
+	// The call that exceeds it fails with ErrorOutputLimit, and so do all later calls.
+	MaxOutputBytes int64
+}
+
+var (
+	limits    atomic.Pointer[Limits]
+	openTotal atomic.Int64
+	noLimits  = &Limits{}
+)
+
+// SetLimits sets the resource limits. Handle limits apply to new encoders and decoders,
+// size limits also to the ones already open.
+func SetLimits(l Limits) {
+	limits.Store(&l)
+}
+
+// GetLimits returns the current resource limits.
+func GetLimits() Limits {
+	return *currentLimits()
+}
+
+func currentLimits() *Limits {
+	if l := limits.Load(); l != nil {
+		return l
+	}
+	return noLimits
+}
+
+// acquireHandle reserves a handle slot and counts it in counter.
+func acquireHandle(counter *atomic.Int64) error {
+	maxHandles := int64(currentLimits().MaxHandles)
+	for {
+		n := openTotal.Load()
+		if maxHandles > 0 && n >= maxHandles {
+			return fmt.Errorf("%w: %d open", ErrorTooManyHandles, n)
+		}
+		if openTotal.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+	counter.Add(1)
+	reportOpenHandles()
+	return nil
+}
+
+func releaseHandle(counter *atomic.Int64) {
+	counter.Add(-1)
+	openTotal.Add(-1)
+	reportOpenHandles()
+}
+
+// quota tracks the output of one encoder or decoder against the limits.
+type quota struct {
+	inBytes  int64 // input accepted by checkInput
+	outBytes int64
+}
+
+func (q *quota) checkInput(n int) error {
+	l := currentLimits()
+	if l.MaxInputBytes > 0 && n > l.MaxInputBytes {
+		return fmt.Errorf("%w: %d > %d bytes", ErrorInputTooLarge, n, l.MaxInputBytes)
+	}
+	if l.MaxOutputBytes > 0 && q.outBytes > l.MaxOutputBytes {
+		return fmt.Errorf("%w: %d > %d bytes", ErrorOutputLimit, q.outBytes, l.MaxOutputBytes)
+	}
+	q.inBytes += int64(n)
+	return nil
+}
+
+func (q *quota) addOutput(n int) error {
+	q.outBytes += int64(n)
+	l := currentLimits()
+	if l.MaxOutputBytes > 0 && q.outBytes > l.MaxOutputBytes {
+		return fmt.Errorf("%w: %d > %d bytes", ErrorOutputLimit, q.outBytes, l.MaxOutputBytes)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package mp3_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestLimits(t *testing.T) {
+	requireNative(t)
+	t.Cleanup(func() { mp3.SetLimits(mp3.Limits{}) })
+	config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128}
+
+	t.Run("MaxHandles", func(t *testing.T) {
+		encoders, decoders := settleHandles()
+		mp3.SetLimits(mp3.Limits{MaxHandles: encoders + decoders + 1})
+		defer mp3.SetLimits(mp3.Limits{})
+
+		encoder, err := mp3.NewEncoder(config)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		if _, err := mp3.NewDecoder(); !errors.Is(err, mp3.ErrorTooManyHandles) {
+			t.Errorf("NewDecoder error = %v, want ErrorTooManyHandles", err)
+		}
+		encoder.Close()
+
+		decoder, err := mp3.NewDecoder()
+		if err != nil {
+			t.Fatalf("NewDecoder after Close failed: %v", err)
+		}
+		decoder.Close()
+	})
+
+	t.Run("MaxInputBytes", func(t *testing.T) {
+		mp3.SetLimits(mp3.Limits{MaxInputBytes: 4096})
+		defer mp3.SetLimits(mp3.Limits{})
+
+		encoder, err := mp3.NewEncoder(config)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		pcmData := generateSineWave(440, 44100, 2, 44100)
+		if _, err := encoder.EncodeAppend(nil, pcmData[:4096]); err != nil {
+			t.Errorf("Encode within limit failed: %v", err)
+		}
+		if _, err := encoder.EncodeAppend(nil, pcmData); !errors.Is(err, mp3.ErrorInputTooLarge) {
+			t.Errorf("Encode error = %v, want ErrorInputTooLarge", err)
+		}
+	})
+
+	t.Run("MaxOutputBytes", func(t *testing.T) {
+		mp3.SetLimits(mp3.Limits{MaxOutputBytes: 8000})
+		defer mp3.SetLimits(mp3.Limits{})
+
+		encoder, err := mp3.NewEncoder(config)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		pcmData := generateSineWave(440, 44100, 2, 44100) // ~16KB of mp3 data
+
+		var out []byte
+		for offset := 0; offset < len(pcmData); offset += 4096 {
+			out, err = encoder.EncodeAppend(out, pcmData[offset:min(offset+4096, len(pcmData))])
+			if err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, mp3.ErrorOutputLimit) {
+			t.Fatalf("Encode error = %v, want ErrorOutputLimit", err)
+		}
+		if len(out) > 8000 {
+			t.Errorf("Output %d bytes exceeds the limit", len(out))
+		}
+		if _, err := encoder.FlushAppend(nil); !errors.Is(err, mp3.ErrorOutputLimit) {
+			t.Errorf("Flush error = %v, want ErrorOutputLimit", err)
+		}
+	})
+
+	t.Run("MaxOutputBytes resumed", func(t *testing.T) {
+		encoder, err := mp3.NewEncoder(config)
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		pcmData := generateSineWave(440, 44100, 2, 44100*2)
+		if _, err := encoder.EncodeAppend(nil, pcmData[:len(pcmData)/2]); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		cp, err := encoder.Checkpoint()
+		if err != nil {
+			t.Fatalf("Checkpoint failed: %v", err)
+		}
+
+		// The output before the checkpoint does not count against the limit of the new encoder
+		mp3.SetLimits(mp3.Limits{MaxOutputBytes: cp.Bytes / 2})
+		defer mp3.SetLimits(mp3.Limits{})
+		resumed, err := mp3.ResumeEncoder(config, cp)
+		if err != nil {
+			t.Fatalf("ResumeEncoder failed: %v", err)
+		}
+		defer resumed.Close()
+		out, err := resumed.EncodeAppend(nil, pcmData[cp.Samples*4:cp.Samples*4+44100])
+		if err != nil {
+			t.Fatalf("Encode after resume failed: %v", err)
+		}
+		next, err := resumed.Checkpoint()
+		if err != nil {
+			t.Fatalf("Checkpoint after resume failed: %v", err)
+		}
+		if next.Bytes <= cp.Bytes || next.Bytes > cp.Bytes+int64(len(out)) {
+			t.Errorf("Checkpoint after resume at byte %d, want after %d", next.Bytes, cp.Bytes)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package mp3
+
+import "sync/atomic"
+
+// Op identifies the operation a metric belongs to.
+type Op string
+
+const (
+	OpEncode Op = "encode"
+	OpDecode Op = "decode"
+)
+
+// Metrics receives counters and gauges from all encoders and decoders, e.g. to export them to Prometheus.
+// Methods are called synchronously from Encode, Decode and Flush and must be cheap and safe for concurrent use.
+// Embed NopMetrics to implement only some of them.
+type Metrics interface {
+	// Frames counts mp3 frames encoded or decoded. Decoded frames are counted as their
+	// headers are passed to Decode, Xing/Info and VBRI frames are not counted.
+	Frames(op Op, n int)
+
+	// BytesIn counts input bytes: PCM for encoding, mp3 data for decoding.
+	BytesIn(op Op, n int)
+
+	// BytesOut counts output bytes: mp3 data for encoding, PCM for decoding.
+	BytesOut(op Op, n int)
+
+	// Error counts failed calls.
+	Error(op Op, err error)
+
+	// Resync counts skipped garbage where the bitstream had to be resynchronized,
+	// once per run of garbage in the input of Decode.
+	Resync()
+
+	// OpenHandles reports the number of open encoders and decoders when it changes.
+	OpenHandles(encoders, decoders int)
+}
+
+// NopMetrics ignores all metrics.
+type NopMetrics struct{}
+
+func (NopMetrics) Frames(op Op, n int)                {}
+func (NopMetrics) BytesIn(op Op, n int)               {}
+func (NopMetrics) BytesOut(op Op, n int)              {}
+func (NopMetrics) Error(op Op, err error)             {}
+func (NopMetrics) Resync()                            {}
+func (NopMetrics) OpenHandles(encoders, decoders int) {}
+
+type metricsHolder struct {
+	m Metrics
+}
+
+var metrics atomic.Pointer[metricsHolder]
+
+// SetMetrics installs m to receive metrics. nil disables metrics.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		metrics.Store(nil)
+		return
+	}
+	metrics.Store(&metricsHolder{m: m})
+}
+
+// currentMetrics returns the installed metrics, or nil if there are none.
+func currentMetrics() Metrics {
+	if h := metrics.Load(); h != nil {
+		return h.m
+	}
+	return nil
+}
+
+// meter reports the metrics of one encoder or decoder.
+type meter struct {
+	frames  int64 // frames already reported
+	resyncs int64 // resyncs already reported
+}
+
+// report reports a successful call. totalFrames is the number of frames processed so far.
+func (mt *meter) report(m Metrics, op Op, in, out int, totalFrames int64) {
+	if in > 0 {
+		m.BytesIn(op, in)
+	}
+	if out > 0 {
+		m.BytesOut(op, out)
+	}
+	if totalFrames > mt.frames {
+		m.Frames(op, int(totalFrames-mt.frames))
+		mt.frames = totalFrames
+	}
+}
+
+func (enc *Encoder) reportMetrics(in, out int, err error) {
+	m := currentMetrics()
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.Error(OpEncode, err)
+		return
+	}
+	frames, _ := enc.GetFrameNum()
+	enc.meter.report(m, OpEncode, in, out, int64(frames))
+}
+
+func (d *Decoder) reportMetrics(in, out int, err error) {
+	m := currentMetrics()
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.Error(OpDecode, err)
+		return
+	}
+	var frames int64
+	if l := d.frameLog; l != nil {
+		frames = l.audioFrames
+		for ; d.meter.resyncs < l.resyncs; d.meter.resyncs++ {
+			m.Resync()
+		}
+	}
+	d.meter.report(m, OpDecode, in, out, frames)
+}
+
+func reportOpenHandles() {
+	if m := currentMetrics(); m != nil {
+		m.OpenHandles(OpenHandles())
+	}
+}
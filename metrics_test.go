@@ -0,0 +1,187 @@
+package mp3_test
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+type countingMetrics struct {
+	mp3.NopMetrics
+	mu       sync.Mutex
+	frames   map[mp3.Op]int
+	bytesIn  map[mp3.Op]int
+	bytesOut map[mp3.Op]int
+	errors   map[mp3.Op]int
+	resyncs  int
+	handles  int
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{
+		frames:   map[mp3.Op]int{},
+		bytesIn:  map[mp3.Op]int{},
+		bytesOut: map[mp3.Op]int{},
+		errors:   map[mp3.Op]int{},
+	}
+}
+
+func (m *countingMetrics) Frames(op mp3.Op, n int) {
+	m.mu.Lock()
+	m.frames[op] += n
+	m.mu.Unlock()
+}
+
+func (m *countingMetrics) BytesIn(op mp3.Op, n int) {
+	m.mu.Lock()
+	m.bytesIn[op] += n
+	m.mu.Unlock()
+}
+
+func (m *countingMetrics) BytesOut(op mp3.Op, n int) {
+	m.mu.Lock()
+	m.bytesOut[op] += n
+	m.mu.Unlock()
+}
+
+func (m *countingMetrics) Error(op mp3.Op, err error) {
+	m.mu.Lock()
+	m.errors[op]++
+	m.mu.Unlock()
+}
+
+func (m *countingMetrics) Resync() {
+	m.mu.Lock()
+	m.resyncs++
+	m.mu.Unlock()
+}
+
+func (m *countingMetrics) OpenHandles(encoders, decoders int) {
+	m.mu.Lock()
+	m.handles = encoders + decoders
+	m.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	requireNative(t)
+	m := newCountingMetrics()
+	mp3.SetMetrics(m)
+	defer mp3.SetMetrics(nil)
+
+	pcmData := generateSineWave(440, 44100, 2, 44100)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	mp3Data, err := encoder.EncodeAppend(nil, pcmData)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	mp3Data, err = encoder.FlushAppend(mp3Data)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	encodedFrames, _ := encoder.GetFrameNum()
+	encoder.Encode(nil, nil) // counted as error
+	encoder.Close()
+
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if m.handles == 0 {
+		t.Error("Open handles not reported")
+	}
+	pcmBuf := make([]byte, 2*len(pcmData))
+	decoded, err := decoder.Decode(mp3Data, pcmBuf)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	decoder.Close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.bytesIn[mp3.OpEncode] != len(pcmData) || m.bytesOut[mp3.OpEncode] != len(mp3Data) {
+		t.Errorf("Encode bytes = %d in, %d out, want %d, %d",
+			m.bytesIn[mp3.OpEncode], m.bytesOut[mp3.OpEncode], len(pcmData), len(mp3Data))
+	}
+	if m.frames[mp3.OpEncode] != encodedFrames {
+		t.Errorf("Encoded frames = %d, want %d", m.frames[mp3.OpEncode], encodedFrames)
+	}
+	if m.errors[mp3.OpEncode] != 1 {
+		t.Errorf("Encode errors = %d, want 1", m.errors[mp3.OpEncode])
+	}
+	if m.bytesIn[mp3.OpDecode] != len(mp3Data) || m.bytesOut[mp3.OpDecode] != decoded {
+		t.Errorf("Decode bytes = %d in, %d out, want %d, %d",
+			m.bytesIn[mp3.OpDecode], m.bytesOut[mp3.OpDecode], len(mp3Data), decoded)
+	}
+	if m.frames[mp3.OpDecode] != encodedFrames {
+		t.Errorf("Decoded frames = %d, want %d", m.frames[mp3.OpDecode], encodedFrames)
+	}
+	if m.resyncs != 0 {
+		t.Errorf("Resyncs = %d, want 0", m.resyncs)
+	}
+	t.Logf("✓ Metrics: %d frames encoded, %d decoded", m.frames[mp3.OpEncode], m.frames[mp3.OpDecode])
+}
+
+// TestMetricsDecodeCorrupt tests the frame and resync counts of a decoder fed garbage
+func TestMetricsDecodeCorrupt(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, err := encoder.EncodeAppend(nil, generateSineWave(440, 44100, 2, 44100))
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	mp3Data, err = encoder.FlushAppend(mp3Data)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	encodedFrames, _ := encoder.GetFrameNum()
+
+	// Garbage before the first frame and between two frames in the middle
+	h, err := mp3.ParseFrameHeader(mp3Data)
+	if err != nil {
+		t.Fatalf("ParseFrameHeader failed: %v", err)
+	}
+	mid := 10 * h.Size
+	garbage := []byte("not a frame")
+	corrupt := append(append([]byte{}, garbage...), mp3Data[:mid]...)
+	corrupt = append(append(corrupt, garbage...), mp3Data[mid:]...)
+
+	m := newCountingMetrics()
+	mp3.SetMetrics(m)
+	defer mp3.SetMetrics(nil)
+	decoder, err := mp3.NewDecoder()
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+	if _, err := decoder.DecodeAppend(nil, corrupt); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// File functions resync without a Decoder and are not counted
+	if _, err := mp3.Probe(bytes.NewReader(corrupt), int64(len(corrupt))); err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if _, err := mp3.ApplyGain(bytes.NewReader(corrupt), int64(len(corrupt)), io.Discard, 1); err != nil {
+		t.Fatalf("ApplyGain failed: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.resyncs != 2 {
+		t.Errorf("Resyncs = %d, want 2", m.resyncs)
+	}
+	if m.frames[mp3.OpDecode] != encodedFrames {
+		t.Errorf("Decoded frames = %d, want %d", m.frames[mp3.OpDecode], encodedFrames)
+	}
+	t.Logf("✓ %d frames, %d resyncs", m.frames[mp3.OpDecode], m.resyncs)
+}
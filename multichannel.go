@@ -0,0 +1,135 @@
+package mp3
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Program is one mp3 output of EncodeMultichannelWav.
+type Program struct {
+	Index    int    // position in the programs, counted from 0
+	Channels []int  // WAV channels in the program, counted from 0
+	Name     string // e.g. "front", see SplitChannels
+}
+
+// FileName returns the output path of the program for the path of the source or of the
+// combined output, e.g. "movie.front.mp3" for "movie.wav".
+func (p Program) FileName(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + p.Name + ".mp3"
+}
+
+// Program names of the channel pairs in the default WAV channel order
+// (front left and right, center, LFE, back left and right, side left and right).
+var programNames = []string{"front", "center_lfe", "back", "side"}
+
+// SplitChannels returns the programs EncodeMultichannelWav encodes a WAV with numChannels
+// channels into: consecutive channel pairs, the last channel is mono if numChannels is odd.
+// Up to 8 channels the pairs are named after the default WAV channel order, so 5.1 is split
+// into "front", "center_lfe" and "back". Other programs are named after their channels,
+// e.g. "ch9_10", counted from 1.
+func SplitChannels(numChannels int) []Program {
+	var programs []Program
+	for first := 0; first < numChannels; first += 2 {
+		p := Program{Index: len(programs), Channels: []int{first}}
+		if first+1 < numChannels {
+			p.Channels = append(p.Channels, first+1)
+		}
+		switch {
+		case numChannels <= 8 && len(p.Channels) == 2:
+			p.Name = programNames[p.Index]
+		case len(p.Channels) == 2:
+			p.Name = fmt.Sprintf("ch%d_%d", first+1, first+2)
+		default:
+			p.Name = fmt.Sprintf("ch%d", first+1)
+		}
+		programs = append(programs, p)
+	}
+	return programs
+}
+
+// EncodeMultichannelWav encodes a WAV stream with any number of channels into one mp3 per
+// program of SplitChannels, since mp3 holds at most two channels. newWriter is called for
+// each program before encoding starts; writers implementing io.WriteSeeker get the
+// Xing/LAME tag and ReplayGain tag as with EncodeFromWav. The results are in program order.
+// Writers are not closed.
+func EncodeMultichannelWav(wavStream io.Reader, newWriter func(p Program) (io.Writer, error), config *EncoderConfig, opts *WavOptions) ([]*EncodeResult, error) {
+	in, err := readWavInput(wavStream)
+	if err != nil {
+		return nil, err
+	}
+	sampleRate, numChannels, format := in.sampleRate, in.numChannels, in.format
+	if numChannels < 1 {
+		return nil, fmt.Errorf("unsupported channel count: %d", numChannels)
+	}
+	wavStream = in.pcm
+
+	// Read whole sample frames, so every chunk splits evenly into the programs
+	sampleSize := format.BytesPerSample()
+	frameSize := numChannels * sampleSize
+	chunkSize := max(opts.chunkSize()/frameSize, 1) * frameSize
+
+	programs := SplitChannels(numChannels)
+	outputs := make([]*wavOutput, 0, len(programs))
+	defer func() {
+		for _, out := range outputs {
+			out.close()
+		}
+	}()
+	for _, p := range programs {
+		w, err := newWriter(p)
+		if err != nil {
+			return nil, err
+		}
+		out, err := newWavOutput(w, config, sampleRate, len(p.Channels), chunkSize)
+		if err != nil {
+			return nil, err
+		}
+		out.format = format
+		outputs = append(outputs, out)
+	}
+
+	inBuf := make([]byte, chunkSize)
+	pcm := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(wavStream, inBuf)
+		n -= n % frameSize
+		for i, p := range programs {
+			k := splitProgram(pcm, inBuf[:n], p.Channels, frameSize, sampleSize)
+			if k == 0 {
+				continue
+			}
+			if encErr := outputs[i].encode(pcm[:k]); encErr != nil {
+				return nil, encErr
+			}
+		}
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+	}
+
+	results := make([]*EncodeResult, len(outputs))
+	for i, out := range outputs {
+		if results[i], err = out.finish(); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// splitProgram copies the samples of sampleSize bytes of channels from the interleaved
+// frames in to dst and returns the number of bytes written.
+func splitProgram(dst, in []byte, channels []int, frameSize, sampleSize int) int {
+	k := 0
+	for pos := 0; pos+frameSize <= len(in); pos += frameSize {
+		for _, ch := range channels {
+			k += copy(dst[k:], in[pos+ch*sampleSize:pos+(ch+1)*sampleSize])
+		}
+	}
+	return k
+}
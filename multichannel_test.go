@@ -0,0 +1,141 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// generateMultichannelWav generates a WAVE_FORMAT_EXTENSIBLE file with a sine wave of a
+// different frequency on each channel, silent channels have frequency 0.
+func generateMultichannelWav(sampleRate int, freqs []int, numSamples int) []byte {
+	channels := len(freqs)
+	pcm := make([]byte, numSamples*channels*2)
+	for i := range numSamples {
+		for ch, freq := range freqs {
+			v := int16(32767 * 0.5 * math.Sin(2*math.Pi*float64(freq)*float64(i)/float64(sampleRate)))
+			binary.LittleEndian.PutUint16(pcm[(i*channels+ch)*2:], uint16(v))
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(4+8+40+8+len(pcm)))
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{
+		uint32(40), uint16(0xfffe), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * 2), uint16(channels * 2), uint16(16),
+		uint16(22), uint16(16), uint32(1<<channels - 1), // cbSize, valid bits, channel mask
+	} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	// KSDATAFORMAT_SUBTYPE_PCM
+	b.Write([]byte{1, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xaa, 0, 0x38, 0x9b, 0x71})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(pcm)))
+	b.Write(pcm)
+	return b.Bytes()
+}
+
+// TestEncodeMultichannelWav tests splitting multichannel WAVs into channel pair programs
+func TestEncodeMultichannelWav(t *testing.T) {
+	requireNative(t)
+	testCases := []struct {
+		name  string
+		freqs []int
+		names []string
+	}{
+		{"5.1", []int{440, 440, 0, 100, 660, 660}, []string{"front", "center_lfe", "back"}},
+		{"3 channels", []int{440, 440, 330}, []string{"front", "ch3"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			wav := generateMultichannelWav(44100, tc.freqs, 44100)
+			var files []*os.File
+			results, err := mp3.EncodeMultichannelWav(bytes.NewReader(wav), func(p mp3.Program) (io.Writer, error) {
+				f, err := os.Create(p.FileName(filepath.Join(dir, "movie.wav")))
+				files = append(files, f)
+				return f, err
+			}, &mp3.EncoderConfig{Bitrate: 128}, &mp3.WavOptions{ChunkSize: 1000})
+			for _, f := range files {
+				f.Close()
+			}
+			if err != nil {
+				t.Fatalf("EncodeMultichannelWav failed: %v", err)
+			}
+			if len(results) != len(tc.names) {
+				t.Fatalf("Got %d programs, want %d", len(results), len(tc.names))
+			}
+
+			for i, name := range tc.names {
+				data, err := os.ReadFile(filepath.Join(dir, "movie."+name+".mp3"))
+				if err != nil {
+					t.Fatalf("ReadFile failed: %v", err)
+				}
+				channels := min(2, len(tc.freqs)-2*i)
+				if results[i].NumChannels != channels {
+					t.Errorf("%s: NumChannels = %d, want %d", name, results[i].NumChannels, channels)
+				}
+				decoder, err := mp3.NewDecoder()
+				if err != nil {
+					t.Fatalf("NewDecoder failed: %v", err)
+				}
+				pcm, err := decoder.DecodeAppend(nil, data)
+				decodedChannels := decoder.NumChannels
+				decoder.Close()
+				if err != nil {
+					t.Fatalf("Decode failed: %v", err)
+				}
+				if decodedChannels != channels || len(pcm)/2/channels != 44100 {
+					t.Errorf("%s: decoded %d channels %d samples", name, decodedChannels, len(pcm)/2/channels)
+				}
+
+				// Silent source channels stay silent
+				for ch := range channels {
+					peak := 0
+					for pos := 2 * ch; pos+1 < len(pcm); pos += 2 * channels {
+						peak = max(peak, abs(int(int16(binary.LittleEndian.Uint16(pcm[pos:])))))
+					}
+					if silent := tc.freqs[2*i+ch] == 0; silent != (peak < 100) {
+						t.Errorf("%s channel %d: peak %d", name, ch, peak)
+					}
+				}
+			}
+
+			t.Logf("✓ %d channels split into %v", len(tc.freqs), tc.names)
+		})
+	}
+}
+
+// TestSplitChannels tests the program layout and names
+func TestSplitChannels(t *testing.T) {
+	programs := mp3.SplitChannels(9)
+	var names []string
+	for _, p := range programs {
+		names = append(names, p.Name)
+	}
+	want := []string{"ch1_2", "ch3_4", "ch5_6", "ch7_8", "ch9"}
+	if len(names) != len(want) {
+		t.Fatalf("Names = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Names = %v, want %v", names, want)
+			break
+		}
+	}
+	if p := programs[4]; len(p.Channels) != 1 || p.Channels[0] != 8 || p.Index != 4 {
+		t.Errorf("Last program = %+v", p)
+	}
+	if got := programs[0].FileName("/tmp/a.b/song.wav"); got != "/tmp/a.b/song.ch1_2.mp3" {
+		t.Errorf("FileName = %q", got)
+	}
+}
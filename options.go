@@ -0,0 +1,97 @@
+package mp3
+
+// EncoderOption sets a field of the EncoderConfig built by NewEncoderWithOptions.
+type EncoderOption func(c *EncoderConfig)
+
+// NewEncoderWithOptions creates an encoder from the defaults of NewEncoder changed by opts,
+// which are applied in order. Unlike a zero EncoderConfig field, an option can set a value
+// that is also a zero value, e.g. WithQuality(0); Quality defaults to 2.
+func NewEncoderWithOptions(opts ...EncoderOption) (*Encoder, error) {
+	c := EncoderConfig{Quality: 2}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return NewEncoder(&c)
+}
+
+// WithConfig starts from a copy of c instead of the defaults, options after it change the copy.
+func WithConfig(c *EncoderConfig) EncoderOption {
+	return func(dst *EncoderConfig) {
+		if c != nil {
+			*dst = *c
+		}
+	}
+}
+
+// WithSampleRate sets the input sample rate in Hz.
+func WithSampleRate(hz int) EncoderOption {
+	return func(c *EncoderConfig) { c.SampleRate = hz }
+}
+
+// WithChannels sets the number of input channels.
+func WithChannels(n int) EncoderOption {
+	return func(c *EncoderConfig) { c.NumChannels = n }
+}
+
+// WithBitrate selects CBR encoding at kbps.
+func WithBitrate(kbps int) EncoderOption {
+	return func(c *EncoderConfig) {
+		c.VbrMode = VbrModeOff
+		c.Bitrate = kbps
+	}
+}
+
+// WithVBR selects VBR encoding with the quality 0 (best) to 9, like lame -V.
+func WithVBR(quality int) EncoderOption {
+	return func(c *EncoderConfig) {
+		c.VbrMode = VbrModeMtrh
+		c.Quality = quality
+		c.VbrQuality = 0
+	}
+}
+
+// WithABR selects ABR encoding with a mean bitrate of kbps.
+func WithABR(kbps int) EncoderOption {
+	return func(c *EncoderConfig) {
+		c.VbrMode = VbrModeAbr
+		c.AbrMeanBitrate = kbps
+	}
+}
+
+// WithQuality sets the algorithm quality 0 (best, slowest) to 9.
+func WithQuality(quality int) EncoderOption {
+	return func(c *EncoderConfig) { c.Quality = quality }
+}
+
+// WithPreset selects a LAME preset.
+func WithPreset(p Preset) EncoderOption {
+	return func(c *EncoderConfig) { c.Preset = p }
+}
+
+// WithMpegMode sets the output channel mode.
+func WithMpegMode(mode MpegMode) EncoderOption {
+	return func(c *EncoderConfig) { c.MpegMode = mode }
+}
+
+// WithLowpass sets the lowpass filter frequency in Hz, -1 disables the filter.
+func WithLowpass(hz int) EncoderOption {
+	return func(c *EncoderConfig) { c.Lowpass = hz }
+}
+
+// WithVbrTag enables the Xing/Info tag frame.
+func WithVbrTag() EncoderOption {
+	return func(c *EncoderConfig) { c.IsWriteVbrTag = true }
+}
+
+// WithReplayGain enables ReplayGain analysis.
+func WithReplayGain() EncoderOption {
+	return func(c *EncoderConfig) { c.FindReplayGain = true }
+}
+
+// WithID3 sets the metadata written as ID3v2 tag, and as ID3v1 tag too if v1 is set.
+func WithID3(tags *TrackTags, v1 bool) EncoderOption {
+	return func(c *EncoderConfig) {
+		c.Tags = tags
+		c.WriteID3v1 = v1
+	}
+}
@@ -0,0 +1,70 @@
+package mp3_test
+
+import (
+	"bytes"
+	"testing"
+
+	mp3 "github.com/lizc2003/audio-mp3"
+)
+
+func TestNewEncoderWithOptions(t *testing.T) {
+	requireNative(t)
+	pcmData := generateNoise(1, 22050)
+	encode := func(t *testing.T, opts ...mp3.EncoderOption) []byte {
+		t.Helper()
+		encoder, err := mp3.NewEncoderWithOptions(opts...)
+		if err != nil {
+			t.Fatalf("NewEncoderWithOptions failed: %v", err)
+		}
+		defer encoder.Close()
+		out, err := encoder.EncodeAll(pcmData)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		return out
+	}
+	fromConfig := func(t *testing.T, c *mp3.EncoderConfig) []byte {
+		t.Helper()
+		encoder, err := mp3.NewEncoder(c)
+		if err != nil {
+			t.Fatalf("NewEncoder failed: %v", err)
+		}
+		defer encoder.Close()
+		out, err := encoder.EncodeAll(pcmData)
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		return out
+	}
+
+	// Options produce the same stream as the equivalent config
+	got := encode(t, mp3.WithSampleRate(22050), mp3.WithChannels(1), mp3.WithVBR(4), mp3.WithLowpass(8000), mp3.WithVbrTag())
+	want := fromConfig(t, &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, VbrMode: mp3.VbrModeMtrh, Quality: 4, Lowpass: 8000, IsWriteVbrTag: true})
+	if !bytes.Equal(got, want) {
+		t.Error("options differ from the equivalent config")
+	}
+
+	// Quality defaults to 2, WithQuality(0) selects 0
+	base := []mp3.EncoderOption{mp3.WithSampleRate(22050), mp3.WithChannels(1), mp3.WithBitrate(64)}
+	if !bytes.Equal(encode(t, base...), fromConfig(t, &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64, Quality: 2})) {
+		t.Error("default quality is not 2")
+	}
+	if !bytes.Equal(encode(t, append(base, mp3.WithQuality(0))...), fromConfig(t, &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64, Quality: 0})) {
+		t.Error("WithQuality(0) is not quality 0")
+	}
+
+	// Later options override WithConfig
+	config := &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 32}
+	if !bytes.Equal(encode(t, mp3.WithConfig(config), mp3.WithBitrate(64)), fromConfig(t, &mp3.EncoderConfig{SampleRate: 22050, NumChannels: 1, Bitrate: 64})) {
+		t.Error("WithBitrate after WithConfig not applied")
+	}
+	if config.Bitrate != 32 {
+		t.Error("WithConfig modified its config")
+	}
+
+	tagged := encode(t, mp3.WithSampleRate(22050), mp3.WithChannels(1), mp3.WithID3(&mp3.TrackTags{Title: "Test"}, true))
+	if !bytes.HasPrefix(tagged, []byte("ID3")) || !bytes.Equal(tagged[len(tagged)-mp3.ID3v1TagSize:][:3], []byte("TAG")) {
+		t.Error("WithID3 did not write the tags")
+	}
+	t.Logf("✓ NewEncoderWithOptions")
+}
@@ -0,0 +1,207 @@
+package mp3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// PictureType is the APIC picture type.
+type PictureType byte
+
+const (
+	PictureOther      PictureType = 0x00
+	PictureFileIcon   PictureType = 0x01
+	PictureCoverFront PictureType = 0x03
+	PictureCoverBack  PictureType = 0x04
+	PictureArtist     PictureType = 0x08
+)
+
+const (
+	defaultJPEGQuality = 85
+	minJPEGQuality     = 40
+)
+
+var (
+	ErrorUnsupportedImage = errors.New("unsupported image format (only JPEG and PNG supported)")
+	ErrorImageTooLarge    = errors.New("image too large")
+)
+
+// PictureOptions controls validation and normalization of embedded pictures.
+type PictureOptions struct {
+	// MaxDimension is the maximum width or height in pixels. Larger images are downscaled.
+	// 0 means no limit.
+	MaxDimension int
+
+	// MaxBytes is the maximum encoded image size. Larger images are re-encoded as JPEG
+	// with decreasing quality and size until they fit. 0 means no limit.
+	MaxBytes int
+
+	// JPEGQuality is the quality used when an image is re-encoded as JPEG.
+	// Default is 85.
+	JPEGQuality int
+}
+
+// PictureInfo describes a picture that was embedded.
+type PictureInfo struct {
+	MIMEType string
+	Width    int
+	Height   int
+	Size     int
+	Resized  bool // the image was downscaled or re-encoded
+}
+
+// SetPicture validates an image, normalizes it according to opts and stores it in an APIC frame,
+// replacing any existing picture of the same type.
+// Only JPEG and PNG images are accepted. opts may be nil to embed the image unchanged.
+func (t *ID3v2Tag) SetPicture(picType PictureType, description string, data []byte, opts *PictureOptions) (*PictureInfo, error) {
+	var o PictureOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.JPEGQuality <= 0 || o.JPEGQuality > 100 {
+		o.JPEGQuality = defaultJPEGQuality
+	}
+
+	data, info, err := normalizePicture(data, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	t.RemoveFrames(func(f *ID3Frame) bool {
+		return f.ID == "APIC" && apicPictureType(f.Data) == picType
+	})
+	desc := encodeText(t.Encoding, description)
+	body := []byte{desc[0]}
+	body = append(body, info.MIMEType...)
+	body = append(body, 0, byte(picType))
+	body = append(body, desc[1:]...)
+	body = append(body, textTerminator(TextEncoding(desc[0]))...)
+	t.AddFrame("APIC", append(body, data...))
+
+	return info, nil
+}
+
+func normalizePicture(data []byte, opts *PictureOptions) ([]byte, *PictureInfo, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, nil, ErrorUnsupportedImage
+	}
+	info := &PictureInfo{
+		MIMEType: "image/" + format,
+		Width:    cfg.Width,
+		Height:   cfg.Height,
+		Size:     len(data),
+	}
+
+	tooWide := opts.MaxDimension > 0 && max(cfg.Width, cfg.Height) > opts.MaxDimension
+	tooBig := opts.MaxBytes > 0 && len(data) > opts.MaxBytes
+	if !tooWide && !tooBig {
+		return data, info, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode image failed: %w", err)
+	}
+	if tooWide {
+		img = downscale(img, opts.MaxDimension)
+	}
+
+	// Keep PNG if it fits after resizing, otherwise fall back to JPEG
+	var buf bytes.Buffer
+	if format == "png" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, nil, err
+		}
+	}
+	if buf.Len() == 0 || (opts.MaxBytes > 0 && buf.Len() > opts.MaxBytes) {
+		info.MIMEType = "image/jpeg"
+		quality := opts.JPEGQuality
+		for {
+			buf.Reset()
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+				return nil, nil, err
+			}
+			if opts.MaxBytes <= 0 || buf.Len() <= opts.MaxBytes {
+				break
+			}
+			if quality > minJPEGQuality {
+				quality = max(quality-15, minJPEGQuality)
+				continue
+			}
+			b := img.Bounds()
+			if max(b.Dx(), b.Dy()) <= 16 {
+				return nil, nil, ErrorImageTooLarge
+			}
+			img = downscale(img, max(b.Dx(), b.Dy())*3/4)
+		}
+	}
+
+	b := img.Bounds()
+	info.Width = b.Dx()
+	info.Height = b.Dy()
+	info.Size = buf.Len()
+	info.Resized = true
+	return buf.Bytes(), info, nil
+}
+
+// downscale resizes img so that its longest side is maxDim, averaging source pixels (box filter).
+func downscale(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if max(w, h) <= maxDim {
+		return img
+	}
+	var dw, dh int
+	if w >= h {
+		dw, dh = maxDim, max(h*maxDim/w, 1)
+	} else {
+		dw, dh = max(w*maxDim/h, 1), maxDim
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[off])
+					g += int(src.Pix[off+1])
+					bl += int(src.Pix[off+2])
+					a += int(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(bl / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// apicPictureType returns the picture type of an APIC frame body.
+func apicPictureType(data []byte) PictureType {
+	if len(data) < 1 {
+		return PictureOther
+	}
+	_, rest, found := cutText(TextEncodingLatin1, data[1:]) // MIME type is always Latin-1
+	if !found || len(rest) < 1 {
+		return PictureOther
+	}
+	return PictureType(rest[0])
+}
@@ -0,0 +1,102 @@
+package mp3_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestSetPicture tests APIC embedding with validation and normalization
+func TestSetPicture(t *testing.T) {
+	pngData := generatePNG(t, 1200, 800)
+
+	t.Run("Unchanged", func(t *testing.T) {
+		tag := mp3.NewID3v2Tag()
+		info, err := tag.SetPicture(mp3.PictureCoverFront, "cover", pngData, nil)
+		if err != nil {
+			t.Fatalf("SetPicture failed: %v", err)
+		}
+		if info.Resized || info.MIMEType != "image/png" || info.Width != 1200 || info.Size != len(pngData) {
+			t.Errorf("Unexpected picture info: %+v", info)
+		}
+		f := tag.Frame("APIC")
+		if f == nil || !bytes.HasSuffix(f.Data, pngData) {
+			t.Fatal("APIC frame missing image data")
+		}
+		if !bytes.Contains(f.Data, []byte("image/png\x00\x03")) {
+			t.Error("APIC frame has wrong MIME type or picture type")
+		}
+
+		// Same picture type replaces the previous picture
+		tag.SetPicture(mp3.PictureCoverFront, "cover", pngData, nil)
+		tag.SetPicture(mp3.PictureCoverBack, "back", pngData, nil)
+		count := 0
+		for _, f := range tag.Frames {
+			if f.ID == "APIC" {
+				count++
+			}
+		}
+		if count != 2 {
+			t.Errorf("APIC frame count: got %d, want 2", count)
+		}
+	})
+
+	t.Run("MaxDimension", func(t *testing.T) {
+		tag := mp3.NewID3v2Tag()
+		info, err := tag.SetPicture(mp3.PictureCoverFront, "", pngData, &mp3.PictureOptions{MaxDimension: 300})
+		if err != nil {
+			t.Fatalf("SetPicture failed: %v", err)
+		}
+		if !info.Resized || info.Width != 300 || info.Height != 200 {
+			t.Errorf("Unexpected picture info: %+v", info)
+		}
+		t.Logf("✓ Downscaled: %+v", info)
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		tag := mp3.NewID3v2Tag()
+		info, err := tag.SetPicture(mp3.PictureCoverFront, "", pngData, &mp3.PictureOptions{MaxBytes: 20000})
+		if err != nil {
+			t.Fatalf("SetPicture failed: %v", err)
+		}
+		if !info.Resized || info.MIMEType != "image/jpeg" || info.Size > 20000 {
+			t.Errorf("Unexpected picture info: %+v", info)
+		}
+		if _, err := jpeg.DecodeConfig(bytes.NewReader(tag.Frame("APIC").Data[len("\x03image/jpeg\x00\x03\x00"):])); err != nil {
+			t.Errorf("Embedded image is not a valid JPEG: %v", err)
+		}
+		t.Logf("✓ Recompressed: %+v", info)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tag := mp3.NewID3v2Tag()
+		if _, err := tag.SetPicture(mp3.PictureCoverFront, "", []byte("GIF89a not supported"), nil); err != mp3.ErrorUnsupportedImage {
+			t.Errorf("Expected ErrorUnsupportedImage, got %v", err)
+		}
+		if len(tag.Frames) != 0 {
+			t.Error("Invalid image should not be embedded")
+		}
+	})
+}
+
+// generatePNG generates a noisy PNG image that does not compress well
+func generatePNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(rnd.Intn(256)), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
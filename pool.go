@@ -0,0 +1,52 @@
+package mp3
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minPooledBufBits = 12 // 4 KB
+	maxPooledBufBits = 24 // 16 MB
+)
+
+// bufPools holds one pool per power-of-two buffer size.
+var bufPools [maxPooledBufBits - minPooledBufBits + 1]sync.Pool
+
+// GetOutBuf returns a buffer of length size from a shared pool.
+// Size it with Encoder.EstimateOutBufBytes or Decoder.EstimateOutBufBytes,
+// and return it with PutOutBuf when done. The contents are not zeroed.
+func GetOutBuf(size int) []byte {
+	idx, ok := bufPoolIndex(size)
+	if !ok {
+		return make([]byte, size)
+	}
+	if p, _ := bufPools[idx].Get().(*[]byte); p != nil {
+		return (*p)[:size]
+	}
+	return make([]byte, size, 1<<(idx+minPooledBufBits))
+}
+
+// PutOutBuf returns a buffer obtained from GetOutBuf to the pool.
+// The buffer must not be used afterwards.
+func PutOutBuf(buf []byte) {
+	c := cap(buf)
+	idx, ok := bufPoolIndex(c)
+	if !ok || c != 1<<(idx+minPooledBufBits) {
+		return // not from GetOutBuf
+	}
+	buf = buf[:c]
+	bufPools[idx].Put(&buf)
+}
+
+// bufPoolIndex returns the pool index for a buffer of the given size.
+func bufPoolIndex(size int) (int, bool) {
+	if size <= 0 {
+		return 0, false
+	}
+	b := max(bits.Len(uint(size-1)), minPooledBufBits)
+	if b > maxPooledBufBits {
+		return 0, false
+	}
+	return b - minPooledBufBits, true
+}
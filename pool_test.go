@@ -0,0 +1,43 @@
+package mp3_test
+
+import (
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestOutBufPool tests pooled output buffers
+func TestOutBufPool(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(nil)
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+
+	pcmData := generateSineWave(440, 44100, 2, 4410)
+	size := encoder.EstimateOutBufBytes(len(pcmData))
+	for i := 0; i < 3; i++ {
+		buf := mp3.GetOutBuf(size)
+		if len(buf) != size {
+			t.Fatalf("Buffer length: got %d, want %d", len(buf), size)
+		}
+		if _, err := encoder.Encode(pcmData, buf); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		mp3.PutOutBuf(buf)
+	}
+
+	// Sizes outside the pooled range are still served
+	if buf := mp3.GetOutBuf(64 << 20); len(buf) != 64<<20 {
+		t.Errorf("Large buffer length: got %d", len(buf))
+	}
+	mp3.PutOutBuf(make([]byte, 100)) // foreign buffers are ignored
+
+	allocs := testing.AllocsPerRun(100, func() {
+		mp3.PutOutBuf(mp3.GetOutBuf(size))
+	})
+	if allocs > 1 {
+		t.Errorf("Pooled Get/Put allocates %.1f times per run", allocs)
+	}
+}
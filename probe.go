@@ -0,0 +1,145 @@
+package mp3
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// BitrateMode is the bitrate control of a stream as reported by Probe.
+type BitrateMode int
+
+const (
+	BitrateCBR BitrateMode = iota
+	BitrateVBR
+	BitrateABR
+)
+
+func (m BitrateMode) String() string {
+	switch m {
+	case BitrateCBR:
+		return "CBR"
+	case BitrateVBR:
+		return "VBR"
+	case BitrateABR:
+		return "ABR"
+	}
+	return fmt.Sprintf("BitrateMode(%d)", int(m))
+}
+
+// StreamInfo describes a mp3 stream as found by Probe.
+type StreamInfo struct {
+	// Header is the header of the first audio frame.
+	Header FrameHeader
+
+	// AudioOffset and AudioSize give the byte range of the audio frames,
+	// excluding tags and the Xing/Info/VBRI frame.
+	AudioOffset int64
+	AudioSize   int64
+
+	Frames   int
+	Duration time.Duration
+
+	// HasInfoFrame reports whether the stream starts with a Xing/Info/VBRI frame.
+	HasInfoFrame bool
+
+	// InfoFrameType is "Xing", "Info" or "VBRI", or "" if there is no info frame.
+	InfoFrameType string
+
+	// InfoFrames is the frame count stored in the info frame, -1 if it has none.
+	InfoFrames int
+
+	// BitrateMode is CBR if all audio frames have the same bitrate. Otherwise it is ABR if
+	// the LAME tag says so and VBR else.
+	BitrateMode BitrateMode
+
+	// TrailingTags lists the tags found at the end of the stream.
+	TrailingTags []TagLocation
+}
+
+// Probe inspects a mp3 stream of the given size without decoding it.
+// It walks all frame headers, so the frame count and duration are exact
+// even when the stream has no or a wrong info frame.
+func Probe(r io.ReaderAt, size int64) (*StreamInfo, error) {
+	start, end, err := audioRange(r, size)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := FindTrailingTags(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	start, head, info, err := firstAudioFrame(r, start, end)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ParseFrameHeader(head)
+	if err != nil {
+		return nil, err
+	}
+	frames, mixed, err := countFrames(r, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	infoFrames, ok := infoFrameCount(info)
+	if !ok {
+		infoFrames = -1
+	}
+	mode := BitrateCBR
+	if mixed {
+		mode = BitrateVBR
+		if lameMethod(info) == lameMethodABR {
+			mode = BitrateABR
+		}
+	}
+
+	return &StreamInfo{
+		Header:       h,
+		AudioOffset:  start,
+		AudioSize:    end - start,
+		Frames:       frames,
+		Duration:     time.Duration(float64(frames*h.Samples) / float64(h.SampleRate) * float64(time.Second)),
+		HasInfoFrame: info != nil,
+		TrailingTags: tags,
+
+		InfoFrameType: infoFrameType(info),
+		InfoFrames:    infoFrames,
+		BitrateMode:   mode,
+	}, nil
+}
+
+// InfoFrameValid reports whether the stream has an info frame whose frame count matches
+// the audio frames. Players use the count for the duration and seeking, a wrong count
+// points to a truncated or concatenated file.
+func (s *StreamInfo) InfoFrameValid() bool {
+	return s.HasInfoFrame && s.InfoFrames == s.Frames
+}
+
+// VBR methods of the LAME tag that are not VBR.
+const (
+	lameMethodCBR = 1
+	lameMethodABR = 2
+)
+
+// lameMethod returns the VBR method of the LAME tag in an Xing/Info frame, 0 if unknown.
+// Two-pass encodes are reported as their one-pass method.
+func lameMethod(frame []byte) int {
+	h, err := ParseFrameHeader(frame)
+	if err != nil || !IsInfoFrame(frame) {
+		return 0
+	}
+	ext := lameExtension(frame, h)
+	if ext == nil {
+		return 0
+	}
+	switch method := int(ext[lameExtMethod] & 0x0f); method {
+	case 8:
+		return lameMethodCBR
+	case 9:
+		return lameMethodABR
+	default:
+		return method
+	}
+}
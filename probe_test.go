@@ -0,0 +1,147 @@
+package mp3_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestProbe tests stream inspection without decoding
+func TestProbe(t *testing.T) {
+	requireNative(t)
+	tmpFile, err := os.CreateTemp("", "test_probe_*.mp3")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	result, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100)), tmpFile, &mp3.EncoderConfig{
+		Bitrate: 128,
+	}, nil)
+	tmpFile.Close()
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	totalFrames := result.Frames
+	encoded, err := os.ReadFile(tmpPath)
+	if err != nil {
+		t.Fatalf("Failed to read MP3 file: %v", err)
+	}
+
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Probe")
+	tagData := tag.Bytes()
+	src := append(append(tagData, encoded...), append([]byte("TAG"), make([]byte, 125)...)...)
+
+	info, err := mp3.Probe(bytes.NewReader(src), int64(len(src)))
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+
+	infoHdr, _ := mp3.ParseFrameHeader(encoded)
+	if !info.HasInfoFrame {
+		t.Error("Info frame not detected")
+	}
+	if want := int64(len(tagData) + infoHdr.Size); info.AudioOffset != want {
+		t.Errorf("AudioOffset = %d, want %d", info.AudioOffset, want)
+	}
+	if want := int64(len(encoded) - infoHdr.Size); info.AudioSize != want {
+		t.Errorf("AudioSize = %d, want %d", info.AudioSize, want)
+	}
+	if info.Frames != totalFrames {
+		t.Errorf("Frames = %d, want %d", info.Frames, totalFrames)
+	}
+	if info.Header.SampleRate != 44100 || info.Header.Bitrate != 128 {
+		t.Errorf("Header = %d Hz %d kbps, want 44100 Hz 128 kbps", info.Header.SampleRate, info.Header.Bitrate)
+	}
+	if info.Duration < time.Second || info.Duration > 1100*time.Millisecond {
+		t.Errorf("Duration = %v, want ~1s", info.Duration)
+	}
+	if len(info.TrailingTags) != 1 || info.TrailingTags[0].Kind != mp3.TagID3v1 {
+		t.Errorf("TrailingTags = %v, want one ID3v1 tag", info.TrailingTags)
+	}
+
+	t.Logf("✓ Probe: %d frames, %v", info.Frames, info.Duration)
+}
+
+// TestProbeBitrateMode tests bitrate mode classification and info frame checks
+func TestProbeBitrateMode(t *testing.T) {
+	requireNative(t)
+	wav := generateWavFile(44100, 2, 44100*2)
+	encode := func(t *testing.T, config *mp3.EncoderConfig, seekable bool) []byte {
+		t.Helper()
+		if !seekable {
+			var buf bytes.Buffer
+			if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &buf, config, nil); err != nil {
+				t.Fatalf("EncodeFromWav failed: %v", err)
+			}
+			return buf.Bytes()
+		}
+		path := t.TempDir() + "/probe.mp3"
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		_, err = mp3.EncodeFromWav(bytes.NewReader(wav), f, config, nil)
+		f.Close()
+		if err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		return data
+	}
+
+	testCases := []struct {
+		name     string
+		config   *mp3.EncoderConfig
+		seekable bool
+		mode     mp3.BitrateMode
+		infoType string
+	}{
+		{"CBR", &mp3.EncoderConfig{Bitrate: 128}, true, mp3.BitrateCBR, "Info"},
+		{"VBR", &mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 2}, true, mp3.BitrateVBR, "Xing"},
+		{"ABR", &mp3.EncoderConfig{VbrMode: mp3.VbrModeAbr, Bitrate: 128}, true, mp3.BitrateABR, "Xing"},
+		{"No info frame", &mp3.EncoderConfig{VbrMode: mp3.VbrModeMtrh, Quality: 2}, false, mp3.BitrateVBR, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := encode(t, tc.config, tc.seekable)
+			info, err := mp3.Probe(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				t.Fatalf("Probe failed: %v", err)
+			}
+			if info.BitrateMode != tc.mode {
+				t.Errorf("BitrateMode = %v, want %v", info.BitrateMode, tc.mode)
+			}
+			if info.InfoFrameType != tc.infoType {
+				t.Errorf("InfoFrameType = %q, want %q", info.InfoFrameType, tc.infoType)
+			}
+			if info.InfoFrameValid() != tc.seekable {
+				t.Errorf("InfoFrameValid = %v: %d frames, info frame %d", !tc.seekable, info.Frames, info.InfoFrames)
+			}
+			if !tc.seekable {
+				return
+			}
+
+			// Drop the last frames, the info frame count no longer matches
+			truncated := data[:len(data)-4*info.Header.Size]
+			info, err = mp3.Probe(bytes.NewReader(truncated), int64(len(truncated)))
+			if err != nil {
+				t.Fatalf("Probe failed: %v", err)
+			}
+			if info.InfoFrameValid() {
+				t.Errorf("Truncated stream has a valid info frame: %d frames, info frame %d", info.Frames, info.InfoFrames)
+			}
+
+			t.Logf("✓ %v, %s frame", info.BitrateMode, info.InfoFrameType)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrorUnknownProfile = errors.New("unknown encoder profile")
+	ErrorProfileExists  = errors.New("encoder profile already registered")
+)
+
+var (
+	profileMu sync.RWMutex
+	profiles  = map[string]EncoderConfig{}
+)
+
+// Names of the profiles of the package, tuned for common uses.
+const (
+	ProfileVoice      = "voice"           // speech: mono 32 kbps, lowpass 8 kHz
+	ProfilePodcast    = "podcast-mono-64" // spoken word with music: mono 64 kbps
+	ProfileMusic      = "music-v2"        // music: VBR quality 2
+	ProfileMusicHigh  = "music-cbr-320"   // music archive: joint stereo 320 kbps
+	ProfileLiveStream = "live-stream"     // internet radio: CBR 128 kbps without bit reservoir
+)
+
+func init() {
+	// Profiles of the package, applications register their own next to them
+	MustRegisterProfile(ProfileVoice, &EncoderConfig{Bitrate: 32, MpegMode: MpegMono, Lowpass: 8000, IsWriteVbrTag: true})
+	MustRegisterProfile(ProfilePodcast, &EncoderConfig{Bitrate: 64, MpegMode: MpegMono, IsWriteVbrTag: true})
+	MustRegisterProfile(ProfileMusic, &EncoderConfig{VbrMode: VbrModeMtrh, Quality: 2, IsWriteVbrTag: true})
+	MustRegisterProfile(ProfileMusicHigh, &EncoderConfig{Bitrate: 320, MpegMode: MpegJointStereo, IsWriteVbrTag: true})
+	// Streams are not seekable, so there is no tag frame to update
+	MustRegisterProfile(ProfileLiveStream, &EncoderConfig{Bitrate: 128, MpegMode: MpegJointStereo, DisableReservoir: true})
+}
+
+// RegisterProfile registers an encoder config under name, so it can be resolved by
+// Profile, e.g. from a service's configuration. Names are case-insensitive and must not
+// contain ',' or ':', so they cannot be mistaken for ParseConfig options.
+// The config is copied and validated; fields left at their zero value get the defaults
+// of NewEncoder. Registering a name twice fails with ErrorProfileExists.
+func RegisterProfile(name string, c *EncoderConfig) error {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" || strings.ContainsAny(key, ",:") {
+		return fmt.Errorf("%w: invalid profile name %q", ErrorInvalidConfig, name)
+	}
+	if c == nil {
+		c = &EncoderConfig{}
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	if _, ok := profiles[key]; ok {
+		return fmt.Errorf("%w: %q", ErrorProfileExists, name)
+	}
+	profiles[key] = *c
+	return nil
+}
+
+// MustRegisterProfile is like RegisterProfile but panics on error,
+// for registering fixed profiles in init functions.
+func MustRegisterProfile(name string, c *EncoderConfig) {
+	if err := RegisterProfile(name, c); err != nil {
+		panic(err)
+	}
+}
+
+// Profile returns a copy of the config registered under name.
+func Profile(name string) (*EncoderConfig, error) {
+	profileMu.RLock()
+	c, ok := profiles[strings.ToLower(strings.TrimSpace(name))]
+	profileMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrorUnknownProfile, name)
+	}
+	return &c, nil
+}
+
+// ProfileNames returns the names of the registered profiles in ascending order.
+func ProfileNames() []string {
+	profileMu.RLock()
+	defer profileMu.RUnlock()
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
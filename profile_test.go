@@ -0,0 +1,103 @@
+package mp3_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestProfileRegistry(t *testing.T) {
+	c, err := mp3.Profile("Music-V2")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if c.VbrMode != mp3.VbrModeMtrh || c.Quality != 2 {
+		t.Errorf("music-v2 = %+v", *c)
+	}
+
+	want := mp3.EncoderConfig{Bitrate: 96, SampleRate: 22050, NumChannels: 1, MpegMode: mp3.MpegMono}
+	if err := mp3.RegisterProfile("test-voice-96", &want); err != nil {
+		t.Fatalf("RegisterProfile failed: %v", err)
+	}
+	c, err = mp3.Profile("test-voice-96")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if *c != want {
+		t.Errorf("Profile = %+v, want %+v", *c, want)
+	}
+
+	// The registered config is a copy
+	c.Bitrate = 32
+	if c, _ := mp3.Profile("test-voice-96"); c.Bitrate != 96 {
+		t.Errorf("Registered profile was modified: %+v", *c)
+	}
+	if !slices.Contains(mp3.ProfileNames(), "test-voice-96") {
+		t.Errorf("ProfileNames = %v", mp3.ProfileNames())
+	}
+
+	if err := mp3.RegisterProfile("TEST-VOICE-96", &want); !errors.Is(err, mp3.ErrorProfileExists) {
+		t.Errorf("Duplicate RegisterProfile error = %v", err)
+	}
+	if _, err := mp3.Profile("no-such-profile"); !errors.Is(err, mp3.ErrorUnknownProfile) {
+		t.Errorf("Profile error = %v", err)
+	}
+
+	invalid := map[string]*mp3.EncoderConfig{
+		"":             {},
+		"cbr:128":      {},
+		"bad-bitrate":  {Bitrate: 100},
+		"bad-rate":     {SampleRate: 44000},
+		"bad-mpeg2":    {Bitrate: 320, SampleRate: 22050},
+		"bad-channels": {NumChannels: 6},
+		"bad-quality":  {Quality: 10},
+		"bad-abr":      {VbrMode: mp3.VbrModeAbr, AbrMeanBitrate: 500},
+		"bad-limits":   {VbrMode: mp3.VbrModeMtrh, VbrMinBitrate: 256, VbrMaxBitrate: 128},
+		"bad-lowpass":  {Lowpass: -2},
+		"bad-target":   {BitrateTarget: 7},
+	}
+	for name, c := range invalid {
+		if err := mp3.RegisterProfile(name, c); !errors.Is(err, mp3.ErrorInvalidConfig) {
+			t.Errorf("RegisterProfile(%q) error = %v, want ErrorInvalidConfig", name, err)
+		}
+	}
+	t.Logf("✓ Profiles: %v", mp3.ProfileNames())
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	requireNative(t)
+	for _, name := range []string{mp3.ProfileVoice, mp3.ProfilePodcast, mp3.ProfileMusic, mp3.ProfileMusicHigh, mp3.ProfileLiveStream} {
+		c, err := mp3.Profile(name)
+		if err != nil {
+			t.Fatalf("Profile(%q) failed: %v", name, err)
+		}
+		encoder, err := mp3.NewEncoder(c)
+		if err != nil {
+			t.Fatalf("NewEncoder(%q) failed: %v", name, err)
+		}
+		encoder.Close()
+	}
+
+	// Frames of the live stream profile do not depend on previous frames
+	c, _ := mp3.Profile(mp3.ProfileLiveStream)
+	c.NumChannels = 1
+	encoder, err := mp3.NewEncoder(c)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer encoder.Close()
+	frames, reservoir := 0, 0
+	encoder.SetFrameLogger(func(f *mp3.FrameInfo) {
+		frames++
+		reservoir += f.MainDataBegin
+	})
+	if _, err := encoder.EncodeAll(generateNoise(1, 44100)); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+	if frames == 0 || reservoir != 0 {
+		t.Errorf("%d frames use %d bytes of the bit reservoir", frames, reservoir)
+	}
+	t.Logf("✓ Built-in profiles, %d frames without bit reservoir", frames)
+}
@@ -0,0 +1,83 @@
+package mp3
+
+import (
+	"slices"
+)
+
+// SupportedSampleRates returns the sample rates defined by MPEG-1, MPEG-2 and MPEG-2.5 in ascending order.
+// Input at these rates is encoded without resampling; LAME resamples other rates
+// to the nearest of them.
+func SupportedSampleRates() []int {
+	rates := make([]int, 0, 9)
+	for _, v := range []MpegVersion{MpegVersion25, MpegVersion2, MpegVersion1} {
+		r := sampleRateTable[v]
+		rates = append(rates, r[2], r[0], r[1])
+	}
+	return rates
+}
+
+// Bitrates returns the legal layer III bitrates in kbps for the MPEG version in ascending order.
+// Free format is not included.
+func Bitrates(v MpegVersion) []int {
+	table := bitrateTableV2
+	if v == MpegVersion1 {
+		table = bitrateTableV1
+	}
+	return slices.Clone(table[1:15])
+}
+
+// MpegVersionForSampleRate returns the MPEG version used for the sample rate,
+// ok is false if it is not one of SupportedSampleRates.
+func MpegVersionForSampleRate(sampleRate int) (v MpegVersion, ok bool) {
+	for v, rates := range sampleRateTable {
+		if slices.Contains(rates[:], sampleRate) {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// BitratesForSampleRate returns the legal bitrates in kbps for the output sample rate,
+// or nil if it is not one of SupportedSampleRates.
+func BitratesForSampleRate(sampleRate int) []int {
+	v, ok := MpegVersionForSampleRate(sampleRate)
+	if !ok {
+		return nil
+	}
+	return Bitrates(v)
+}
+
+// AutoBitrate returns a CBR bitrate in kbps for input of sampleRate and channels at the
+// quality target, e.g. 24 kbps for 8 kHz mono and 192 kbps for 48 kHz stereo at
+// BitrateTargetStandard. The bitrate is legal for the MPEG version of sampleRate;
+// BitrateTargetNone returns 128.
+func AutoBitrate(sampleRate, channels int, target BitrateTarget) int {
+	if target == BitrateTargetNone {
+		return 128
+	}
+	// kbps per channel at BitrateTargetStandard
+	v, perChannel := MpegVersion1, 96
+	switch {
+	case sampleRate < 16000:
+		v, perChannel = MpegVersion25, 24
+	case sampleRate < 32000:
+		v, perChannel = MpegVersion2, 48
+	}
+	want := perChannel * max(channels, 1) * (int(target) + 1) / 3
+
+	bitrates := Bitrates(v)
+	best := bitrates[0]
+	for _, b := range bitrates {
+		if abs(b-want) <= abs(best-want) {
+			best = b
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,92 @@
+package mp3_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestSupportedSampleRates(t *testing.T) {
+	want := []int{8000, 11025, 12000, 16000, 22050, 24000, 32000, 44100, 48000}
+	if got := mp3.SupportedSampleRates(); !slices.Equal(got, want) {
+		t.Errorf("SupportedSampleRates() = %v, want %v", got, want)
+	}
+
+	testCases := []struct {
+		sampleRate int
+		version    mp3.MpegVersion
+		bitrates   []int
+	}{
+		{44100, mp3.MpegVersion1, []int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}},
+		{22050, mp3.MpegVersion2, []int{8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}},
+		{8000, mp3.MpegVersion25, []int{8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160}},
+	}
+	for _, tc := range testCases {
+		v, ok := mp3.MpegVersionForSampleRate(tc.sampleRate)
+		if !ok || v != tc.version {
+			t.Errorf("MpegVersionForSampleRate(%d) = %v, %v", tc.sampleRate, v, ok)
+		}
+		if got := mp3.BitratesForSampleRate(tc.sampleRate); !slices.Equal(got, tc.bitrates) {
+			t.Errorf("BitratesForSampleRate(%d) = %v, want %v", tc.sampleRate, got, tc.bitrates)
+		}
+	}
+
+	if _, ok := mp3.MpegVersionForSampleRate(96000); ok {
+		t.Error("96000 Hz reported as supported")
+	}
+	if got := mp3.BitratesForSampleRate(96000); got != nil {
+		t.Errorf("BitratesForSampleRate(96000) = %v, want nil", got)
+	}
+
+	// The returned tables are copies
+	mp3.Bitrates(mp3.MpegVersion1)[0] = 0
+	if mp3.Bitrates(mp3.MpegVersion1)[0] != 32 {
+		t.Error("Bitrates returned the internal table")
+	}
+}
+
+func TestAutoBitrate(t *testing.T) {
+	requireNative(t)
+	testCases := []struct {
+		sampleRate, channels int
+		target               mp3.BitrateTarget
+		want                 int
+	}{
+		{8000, 1, mp3.BitrateTargetStandard, 24},
+		{48000, 2, mp3.BitrateTargetStandard, 192},
+		{44100, 1, mp3.BitrateTargetLow, 64},
+		{44100, 2, mp3.BitrateTargetHigh, 256},
+		{22050, 2, mp3.BitrateTargetHigh, 128},
+		{11025, 2, mp3.BitrateTargetLow, 32},
+		{44100, 2, mp3.BitrateTargetNone, 128},
+	}
+	for _, tc := range testCases {
+		if got := mp3.AutoBitrate(tc.sampleRate, tc.channels, tc.target); got != tc.want {
+			t.Errorf("AutoBitrate(%d, %d, %v) = %d, want %d", tc.sampleRate, tc.channels, tc.target, got, tc.want)
+		}
+	}
+
+	// EncodeFromWav picks the bitrate for the format of each input
+	config := &mp3.EncoderConfig{BitrateTarget: mp3.BitrateTargetStandard}
+	for _, tc := range testCases[:2] {
+		var out mp3.SeekableBuffer
+		result, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(tc.sampleRate, tc.channels, tc.sampleRate/2)), &out, config, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		if result.Config.Bitrate != tc.want {
+			t.Errorf("%d Hz %d channels: Config.Bitrate = %d, want %d", tc.sampleRate, tc.channels, result.Config.Bitrate, tc.want)
+		}
+		data := out.Bytes()
+		pos, err := mp3.FindFrameSync(data, 0)
+		if err != nil {
+			t.Fatalf("FindFrameSync failed: %v", err)
+		}
+		if h, err := mp3.ParseFrameHeader(data[pos:]); err != nil || h.Bitrate != tc.want {
+			t.Errorf("%d Hz %d channels: frame bitrate %d (%v), want %d", tc.sampleRate, tc.channels, h.Bitrate, err, tc.want)
+		}
+	}
+	t.Logf("✓ AutoBitrate")
+}
@@ -0,0 +1,228 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/cmplx"
+)
+
+const (
+	spectrumWindow  = 4096 // FFT size in samples
+	spectrumSilence = 1e-6 // mean power (full scale = 1) below which a window is not analyzed
+
+	// Content counts as present where the average spectrum is this far above its floor
+	spectrumContentDB = 20
+)
+
+// SpectrumReport is the result of AnalyzeSpectrum.
+type SpectrumReport struct {
+	SampleRate int
+	Bitrate    int // average bitrate in kbps
+
+	// Cutoff is the highest frequency in Hz with content above the noise floor of the
+	// average spectrum. ExpectedCutoff is the lowpass LAME applies at Bitrate; a stream
+	// encoded from a lossless source has content close to it.
+	Cutoff         int
+	ExpectedCutoff int
+
+	// Confidence (0..1) that the stream was encoded from a lower quality source or is
+	// damaged: its content ends well below ExpectedCutoff at a hard edge, while the band
+	// below it is filled. Suspicious is set at 0.5 and above.
+	Confidence float64
+	Suspicious bool
+
+	Windows int // analyzed windows of 4096 samples, silent ones are skipped
+}
+
+// lameLowpass is the lowpass LAME picks for a bitrate, from its optimum_bandwidth table.
+var lameLowpass = []struct{ kbps, hz int }{
+	{8, 2000}, {16, 3700}, {24, 3900}, {32, 5500}, {40, 7000}, {48, 7500}, {56, 10000},
+	{64, 11000}, {80, 13500}, {96, 15100}, {112, 15600}, {128, 17000}, {160, 17500},
+	{192, 18600}, {224, 19400}, {256, 19700}, {320, 20500},
+}
+
+// expectedCutoff interpolates the LAME lowpass for a bitrate, limited by the Nyquist frequency.
+func expectedCutoff(kbps, sampleRate int) int {
+	hz := lameLowpass[len(lameLowpass)-1].hz
+	for i, e := range lameLowpass {
+		if kbps <= e.kbps {
+			hz = e.hz
+			if i > 0 {
+				prev := lameLowpass[i-1]
+				hz = prev.hz + (e.hz-prev.hz)*(kbps-prev.kbps)/(e.kbps-prev.kbps)
+			}
+			break
+		}
+	}
+	return min(hz, sampleRate/2)
+}
+
+// AnalyzeSpectrum decodes a mp3 stream and checks its average spectrum for signs of a
+// transcode from a lower bitrate, e.g. a hard 16 kHz cutoff in a file claimed as 320 kbps.
+// It is a heuristic for QA pipelines: music without high frequency content, such as speech
+// or a solo instrument, may be flagged too, and damage that does not change the spectrum
+// is not detected. Decoding errors are returned.
+func AnalyzeSpectrum(r io.Reader) (*SpectrumReport, error) {
+	decoder, err := NewDecoder()
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	decoder.tracker() // the bitrate is taken from all frames
+
+	var (
+		chunk   = make([]byte, 2048)
+		pcmBuf  = GetOutBuf(decoder.EstimateOutBufBytes(EstimateFrames))
+		window  = make([]float64, 0, spectrumWindow)
+		power   = make([]float64, spectrumWindow/2)
+		fftBuf  = make([]complex128, spectrumWindow)
+		hann    = make([]float64, spectrumWindow)
+		windows int
+	)
+	defer PutOutBuf(pcmBuf)
+	for i := range hann {
+		hann[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/spectrumWindow)
+	}
+
+	analyze := func() {
+		var mean float64
+		for _, v := range window {
+			mean += v * v
+		}
+		if mean/spectrumWindow < spectrumSilence {
+			return
+		}
+		for i, v := range window {
+			fftBuf[i] = complex(v*hann[i], 0)
+		}
+		fft(fftBuf)
+		for k := range power {
+			power[k] += real(fftBuf[k])*real(fftBuf[k]) + imag(fftBuf[k])*imag(fftBuf[k])
+		}
+		windows++
+	}
+
+	for {
+		n, readErr := r.Read(chunk)
+		if n > 0 {
+			decodedN, decErr := decoder.Decode(chunk[:n], pcmBuf)
+			if decErr != nil {
+				return nil, decErr
+			}
+			// Mix to mono, one sample frame at a time
+			channels := max(decoder.NumChannels, 1)
+			for pos := 0; pos+2*channels <= decodedN; pos += 2 * channels {
+				var v float64
+				for ch := range channels {
+					v += float64(int16(binary.LittleEndian.Uint16(pcmBuf[pos+2*ch:])))
+				}
+				window = append(window, v/float64(channels)/32768)
+				if len(window) == spectrumWindow {
+					analyze()
+					window = window[:0]
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+	if decoder.SampleRate == 0 {
+		return nil, errors.New("no audio frames decoded")
+	}
+
+	_, bitrate := decoder.Bitrate()
+	report := &SpectrumReport{
+		SampleRate:     decoder.SampleRate,
+		Bitrate:        bitrate,
+		ExpectedCutoff: expectedCutoff(bitrate, decoder.SampleRate),
+		Windows:        windows,
+	}
+	if windows == 0 {
+		return report, nil
+	}
+	report.Cutoff, report.Confidence = spectrumCutoff(power, decoder.SampleRate, report.ExpectedCutoff)
+	report.Suspicious = report.Confidence >= 0.5
+	return report, nil
+}
+
+// spectrumCutoff finds the cutoff frequency in the summed power spectrum and rates how
+// much it looks like the lowpass of an earlier, lower quality encode.
+func spectrumCutoff(power []float64, sampleRate, expected int) (cutoff int, confidence float64) {
+	binHz := float64(sampleRate) / spectrumWindow
+
+	// Levels in dB, smoothed over about 100 Hz
+	const smooth = 5
+	level := make([]float64, len(power))
+	for k := range power {
+		var sum float64
+		lo, hi := max(k-smooth, 0), min(k+smooth+1, len(power))
+		for _, p := range power[lo:hi] {
+			sum += p
+		}
+		level[k] = 10 * math.Log10(sum/float64(hi-lo)+1e-30)
+	}
+
+	// The floor is the quietest band above 1 kHz, rounding noise where the encoder cut off
+	first := int(1000 / binHz)
+	floor := math.Inf(1)
+	for _, l := range level[first:] {
+		floor = min(floor, l)
+	}
+	top := first
+	for k := len(level) - 1; k >= first; k-- {
+		if level[k] > floor+spectrumContentDB {
+			top = k
+			break
+		}
+	}
+	cutoff = int(float64(top+1) * binHz)
+
+	// A lowpass drops to the floor within a few hundred Hz
+	edge := min(top+int(500/binHz), len(level)-1)
+	hardness := min(max((level[top]-level[edge])/spectrumContentDB, 0), 1)
+
+	// Natural low pass content, like speech or a pure tone, leaves gaps below the cutoff
+	filled := 0
+	for _, l := range level[first : top+1] {
+		if l > floor+spectrumContentDB {
+			filled++
+		}
+	}
+	density := float64(filled) / float64(top+1-first)
+
+	// A gap of 3 kHz or more below the expected lowpass counts fully
+	gap := min(max(float64(expected-cutoff-500)/2500, 0), 1)
+	return cutoff, gap * hardness * density
+}
+
+// fft computes the discrete Fourier transform of x in place, len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
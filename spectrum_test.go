@@ -0,0 +1,80 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// generateNoise returns white noise at half full scale, which has content up to the Nyquist frequency
+func generateNoise(channels, numSamples int) []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	data := make([]byte, numSamples*channels*2)
+	for i := 0; i < len(data); i += 2 {
+		binary.LittleEndian.PutUint16(data[i:], uint16(int16(rng.IntN(32768)-16384)))
+	}
+	return data
+}
+
+func TestAnalyzeSpectrum(t *testing.T) {
+	requireNative(t)
+	encode := func(t *testing.T, pcm []byte, bitrate int) []byte {
+		t.Helper()
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: bitrate})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		data, err := encoder.EncodeAppend(nil, pcm)
+		if err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+		data, err = encoder.FlushAppend(data)
+		if err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		return data
+	}
+
+	noise := generateNoise(2, 44100*3)
+	original := encode(t, noise, 320)
+	transcoded := encode(t, decodeAll(t, encode(t, noise, 128)), 320)
+
+	testCases := []struct {
+		name       string
+		data       []byte
+		suspicious bool
+	}{
+		{"320 kbps from PCM", original, false},
+		{"320 kbps from 128 kbps", transcoded, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			report, err := mp3.AnalyzeSpectrum(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatalf("AnalyzeSpectrum failed: %v", err)
+			}
+			if report.Suspicious != tc.suspicious {
+				t.Errorf("Suspicious = %v, want %v: %+v", report.Suspicious, tc.suspicious, *report)
+			}
+			if report.Bitrate != 320 || report.ExpectedCutoff != 20500 || report.Windows == 0 {
+				t.Errorf("Report = %+v", *report)
+			}
+			t.Logf("✓ %s: cutoff %d Hz (expected %d Hz), confidence %.2f",
+				tc.name, report.Cutoff, report.ExpectedCutoff, report.Confidence)
+		})
+	}
+
+	// A pure tone has no high frequency content, but no lowpass edge in a filled band either
+	report, err := mp3.AnalyzeSpectrum(bytes.NewReader(encode(t, generateSineWave(440, 44100, 2, 44100*2), 320)))
+	if err != nil {
+		t.Fatalf("AnalyzeSpectrum failed: %v", err)
+	}
+	if report.Suspicious {
+		t.Errorf("Sine wave flagged: %+v", *report)
+	}
+	t.Logf("✓ Sine wave: cutoff %d Hz, confidence %.2f", report.Cutoff, report.Confidence)
+}
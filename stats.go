@@ -0,0 +1,31 @@
+package mp3
+
+import "time"
+
+// EncoderStats are the cumulative counters of an Encoder, see Encoder.Stats.
+type EncoderStats struct {
+	Samples  int64         // samples per channel passed to Encode
+	Duration time.Duration // play time of Samples
+	Bytes    int64         // mp3 bytes output by Encode and Flush, including the Xing/Info frame and the output before a ResumeEncoder checkpoint
+	Frames   int           // audio frames output, see GetFrameNum
+
+	// Bitrate is the average bitrate of the output in kbps, the real bitrate of a VBR stream.
+	Bitrate float64
+}
+
+// Stats returns the input and output counted since NewEncoder or Reset, so callers do not
+// need to keep their own counters around Encode and Flush.
+func (enc *Encoder) Stats() EncoderStats {
+	s := EncoderStats{
+		Samples: enc.TotalSamples(),
+		Bytes:   enc.streamBytes(),
+	}
+	if rate := enc.inSampleRate(); rate > 0 {
+		s.Duration = time.Duration(s.Samples * int64(time.Second) / int64(rate))
+	}
+	s.Frames, _ = enc.GetFrameNum()
+	if played := time.Duration(s.Frames) * enc.FrameDuration(); played > 0 {
+		s.Bitrate = float64(s.Bytes) * 8 / played.Seconds() / 1000
+	}
+	return s
+}
@@ -0,0 +1,229 @@
+package mp3
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncEncoder is an Encoder that is safe for concurrent use, e.g. a long-lived encoder
+// of a live stream shared by request handlers. Each method locks the encoder for the
+// duration of the call, so the calls of different goroutines are serialized; a sequence
+// like Encode followed by GetLameTagFrame is not atomic.
+// The methods are those of Encoder.
+type SyncEncoder struct {
+	mu  sync.Mutex
+	enc *Encoder
+}
+
+// NewSyncEncoder creates a SyncEncoder with the given configuration, see NewEncoder.
+func NewSyncEncoder(c *EncoderConfig) (*SyncEncoder, error) {
+	enc, err := NewEncoder(c)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncEncoder{enc: enc}, nil
+}
+
+func (e *SyncEncoder) Encode(in, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(in, out)
+}
+
+func (e *SyncEncoder) EncodeSamples(format SampleFormat, in, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeSamples(format, in, out)
+}
+
+func (e *SyncEncoder) EncodeInt16(in []int16, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeInt16(in, out)
+}
+
+func (e *SyncEncoder) EncodeStereoInt16(in [][2]int16, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeStereoInt16(in, out)
+}
+
+func (e *SyncEncoder) EncodePlanar(left, right, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodePlanar(left, right, out)
+}
+
+func (e *SyncEncoder) EncodeInt32(in []int32, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeInt32(in, out)
+}
+
+func (e *SyncEncoder) EncodeInt24(in []int32, out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeInt24(in, out)
+}
+
+func (e *SyncEncoder) EncodeAppend(dst, in []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeAppend(dst, in)
+}
+
+func (e *SyncEncoder) EncodeAll(in []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EncodeAll(in)
+}
+
+func (e *SyncEncoder) Flush(out []byte) (n int, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Flush(out)
+}
+
+func (e *SyncEncoder) FlushAppend(dst []byte) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.FlushAppend(dst)
+}
+
+func (e *SyncEncoder) FlushNoGap(out []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.FlushNoGap(out)
+}
+
+func (e *SyncEncoder) NextTrack() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.NextTrack()
+}
+
+func (e *SyncEncoder) SetNoGapTotal(total int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.SetNoGapTotal(total)
+}
+
+func (e *SyncEncoder) SetTotalSamples(n uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.SetTotalSamples(n)
+}
+
+func (e *SyncEncoder) EstimatedTotalFrames() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EstimatedTotalFrames()
+}
+
+func (e *SyncEncoder) EstimateOutBufBytes(inBytes int) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.EstimateOutBufBytes(inBytes)
+}
+
+func (e *SyncEncoder) MaxFrameBytes() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.MaxFrameBytes()
+}
+
+func (e *SyncEncoder) GetFrameNum() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.GetFrameNum()
+}
+
+func (e *SyncEncoder) TotalSamples() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.TotalSamples()
+}
+
+func (e *SyncEncoder) OutSampleRate() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.OutSampleRate()
+}
+
+func (e *SyncEncoder) FrameDuration() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.FrameDuration()
+}
+
+func (e *SyncEncoder) Delay() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Delay()
+}
+
+func (e *SyncEncoder) Padding() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Padding()
+}
+
+func (e *SyncEncoder) GetLameTagFrame() ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.GetLameTagFrame()
+}
+
+func (e *SyncEncoder) ReplayGain() (gainDB float64, peak float64, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.ReplayGain()
+}
+
+func (e *SyncEncoder) BitrateHistogram() ([]BitrateCount, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.BitrateHistogram()
+}
+
+func (e *SyncEncoder) StereoModeHistogram() (StereoModeCounts, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.StereoModeHistogram()
+}
+
+func (e *SyncEncoder) Stats() EncoderStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Stats()
+}
+
+func (e *SyncEncoder) SetFrameLogger(fn FrameLogger) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.SetFrameLogger(fn)
+}
+
+func (e *SyncEncoder) Reset(c *EncoderConfig) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Reset(c)
+}
+
+func (e *SyncEncoder) Reconfigure(c *EncoderConfig) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Reconfigure(c)
+}
+
+func (e *SyncEncoder) Checkpoint() (*EncoderCheckpoint, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Checkpoint()
+}
+
+func (e *SyncEncoder) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enc.Close()
+}
@@ -0,0 +1,59 @@
+package mp3_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestSyncEncoder(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewSyncEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2})
+	if err != nil {
+		t.Fatalf("NewSyncEncoder failed: %v", err)
+	}
+	defer encoder.Close()
+
+	const workers, chunks = 8, 20
+	chunk := generateNoise(2, 1152)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := make([]byte, encoder.EstimateOutBufBytes(len(chunk)))
+			for range chunks {
+				n, err := encoder.Encode(chunk, out)
+				if err != nil {
+					t.Errorf("Encode failed: %v", err)
+					return
+				}
+				mu.Lock()
+				total += n
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	out := make([]byte, encoder.EstimateOutBufBytes(0))
+	n, err := encoder.Flush(out)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	total += n
+
+	stats := encoder.Stats()
+	if want := int64(workers * chunks * 1152); stats.Samples != want {
+		t.Errorf("Stats().Samples = %d, want %d", stats.Samples, want)
+	}
+	if stats.Bytes != int64(total) {
+		t.Errorf("Stats().Bytes = %d, want %d", stats.Bytes, total)
+	}
+	t.Logf("✓ SyncEncoder: %d goroutines, %d bytes", workers, total)
+}
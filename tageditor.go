@@ -0,0 +1,139 @@
+package mp3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// DefaultTagPadding is the padding added when a tag has to be rewritten with the whole file,
+	// so later edits can be done in place.
+	DefaultTagPadding = 1024
+)
+
+// TagEditor edits the ID3v2 tag of a mp3 file.
+// Metadata-only changes are written into the existing tag area when they fit,
+// avoiding a rewrite of the audio data.
+type TagEditor struct {
+	path    string
+	file    *os.File
+	tagSize int64 // size of the existing tag, 0 if the file has none
+
+	// Tag is the tag to be saved. It is loaded from the file, or empty if the file has no tag.
+	Tag *ID3v2Tag
+
+	// Padding is used when the file must be rewritten. Default is DefaultTagPadding.
+	Padding int
+}
+
+// OpenTagEditor opens the mp3 file at path for tag editing.
+func OpenTagEditor(path string) (*TagEditor, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	tagSize, err := id3v2TagSize(f, 0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	tag := NewID3v2Tag()
+	if tagSize > 0 {
+		tag, err = ReadID3v2(io.NewSectionReader(f, 0, tagSize))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	return &TagEditor{
+		path:    path,
+		file:    f,
+		tagSize: tagSize,
+		Tag:     tag,
+		Padding: DefaultTagPadding,
+	}, nil
+}
+
+// Save writes the tag to the file. It returns inPlace = true if the tag fitted into the
+// existing tag area, otherwise the file was rewritten through a temporary file.
+func (e *TagEditor) Save() (inPlace bool, err error) {
+	if e.file == nil {
+		return false, errors.New("tag editor closed")
+	}
+
+	if e.tagSize > 0 {
+		data, err := e.Tag.BytesWithSize(int(e.tagSize))
+		if err == nil {
+			if _, err := e.file.WriteAt(data, 0); err != nil {
+				return false, err
+			}
+			return true, e.file.Sync()
+		}
+	}
+
+	return false, e.rewrite()
+}
+
+// Close releases the file.
+func (e *TagEditor) Close() error {
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// rewrite writes the tag followed by the audio data to a temporary file and replaces the original.
+func (e *TagEditor) rewrite() error {
+	stat, err := e.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(e.path), ".tagedit-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	padding := e.Tag.Padding
+	e.Tag.Padding = e.Padding
+	data := e.Tag.Bytes()
+	e.Tag.Padding = padding
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, io.NewSectionReader(e.file, e.tagSize, stat.Size()-e.tagSize)); err != nil {
+		return fmt.Errorf("copy audio data failed: %w", err)
+	}
+	// Some platforms (e.g. wasip1) cannot change permissions
+	if err := tmp.Chmod(stat.Mode()); err != nil && !errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, e.path); err != nil {
+		return err
+	}
+	e.file.Close()
+	e.file = tmp
+	tmp = nil
+	e.tagSize = int64(len(data))
+	return nil
+}
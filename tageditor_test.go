@@ -0,0 +1,84 @@
+package mp3_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestTagEditor tests in-place and rewriting tag edits
+func TestTagEditor(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 1000)
+	path := filepath.Join(t.TempDir(), "edit.mp3")
+	if err := os.WriteFile(path, audio, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// No tag yet, the file has to be rewritten
+	editor, err := mp3.OpenTagEditor(path)
+	if err != nil {
+		t.Fatalf("OpenTagEditor failed: %v", err)
+	}
+	editor.Tag.SetText("TIT2", "First")
+	inPlace, err := editor.Save()
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if inPlace {
+		t.Error("First save should rewrite the file")
+	}
+
+	// Small change fits into the padding
+	editor.Tag.SetText("TIT2", "Second title")
+	inPlace, err = editor.Save()
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if !inPlace {
+		t.Error("Second save should be done in place")
+	}
+	editor.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	tag, err := mp3.ReadID3v2(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	if got := tag.Text("TIT2"); got != "Second title" {
+		t.Errorf("TIT2 got %q", got)
+	}
+	if !bytes.Equal(data[tag.Size():], audio) {
+		t.Error("Audio data changed")
+	}
+
+	// A large change no longer fits and rewrites the file again
+	editor, err = mp3.OpenTagEditor(path)
+	if err != nil {
+		t.Fatalf("OpenTagEditor failed: %v", err)
+	}
+	defer editor.Close()
+	editor.Tag.AddFrame("PRIV", make([]byte, 4096))
+	if inPlace, err = editor.Save(); err != nil || inPlace {
+		t.Errorf("Large save: inPlace=%v, err=%v", inPlace, err)
+	}
+
+	data, _ = os.ReadFile(path)
+	tag, err = mp3.ReadID3v2(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	if tag.Text("TIT2") != "Second title" || tag.Frame("PRIV") == nil {
+		t.Error("Rewritten tag lost frames")
+	}
+	if !bytes.Equal(data[tag.Size():], audio) {
+		t.Error("Audio data changed")
+	}
+
+	t.Logf("✓ Tag editor: %d byte tag with %d bytes padding", tag.Size(), tag.Padding)
+}
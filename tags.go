@@ -0,0 +1,130 @@
+package mp3
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TrackTags is the metadata written as an ID3v2 tag in front of the encoded stream,
+// see EncoderConfig.Tags. Empty fields are left out.
+type TrackTags struct {
+	Title       string `json:"title,omitempty" yaml:"title,omitempty"`
+	Artist      string `json:"artist,omitempty" yaml:"artist,omitempty"`
+	Album       string `json:"album,omitempty" yaml:"album,omitempty"`
+	Year        int    `json:"year,omitempty" yaml:"year,omitempty"`
+	Genre       string `json:"genre,omitempty" yaml:"genre,omitempty"`
+	TrackNumber int    `json:"track_number,omitempty" yaml:"track_number,omitempty"`
+	TrackTotal  int    `json:"track_total,omitempty" yaml:"track_total,omitempty"`
+
+	// AlbumArt is a JPEG or PNG image embedded unchanged as the front cover.
+	AlbumArt []byte `json:"album_art,omitempty" yaml:"album_art,omitempty"`
+}
+
+// ID3v2Tag returns the ID3v2.4 tag holding the fields of m. A nil m returns an empty tag.
+func (m *TrackTags) ID3v2Tag() (*ID3v2Tag, error) {
+	tag := NewID3v2Tag()
+	if err := m.apply(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// apply sets the fields of m in tag, replacing frames of the same kind.
+func (m *TrackTags) apply(tag *ID3v2Tag) error {
+	if m == nil {
+		return nil
+	}
+	for _, f := range []struct{ id, text string }{
+		{"TIT2", m.Title},
+		{"TPE1", m.Artist},
+		{"TALB", m.Album},
+		{"TCON", m.Genre},
+	} {
+		if f.text != "" {
+			tag.SetText(f.id, f.text)
+		}
+	}
+	if m.Year > 0 {
+		tag.SetText("TDRC", strconv.Itoa(m.Year))
+	}
+	if m.TrackNumber > 0 {
+		track := strconv.Itoa(m.TrackNumber)
+		if m.TrackTotal > 0 {
+			track += "/" + strconv.Itoa(m.TrackTotal)
+		}
+		tag.SetText("TRCK", track)
+	}
+	if len(m.AlbumArt) > 0 {
+		if _, err := tag.SetPicture(PictureCoverFront, "", m.AlbumArt, nil); err != nil {
+			return fmt.Errorf("album art: %w", err)
+		}
+	}
+	return nil
+}
+
+// id3v1Genres are the genres of the ID3v1 specification with the Winamp extensions
+// up to 125, ID3v1 stores the index.
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz",
+	"Metal", "New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno",
+	"Industrial", "Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno",
+	"Ambient", "Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical", "Instrumental",
+	"Acid", "House", "Game", "Sound Clip", "Gospel", "Noise", "AlternRock", "Bass", "Soul", "Punk",
+	"Space", "Meditative", "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy",
+	"Cult", "Gangsta", "Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American",
+	"Cabaret", "New Wave", "Psychadelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock", "Folk",
+	"Folk-Rock", "National Folk", "Swing", "Fast Fusion", "Bebob", "Latin", "Revival", "Celtic",
+	"Bluegrass", "Avantgarde", "Gothic Rock", "Progressive Rock", "Psychedelic Rock",
+	"Symphonic Rock", "Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony", "Booty Bass", "Primus",
+	"Porn Groove", "Satire", "Slow Jam", "Club", "Tango", "Samba", "Folklore", "Ballad",
+	"Power Ballad", "Rhythmic Soul", "Freestyle", "Duet", "Punk Rock", "Drum Solo", "A capella",
+	"Euro-House", "Dance Hall",
+}
+
+// ID3v1Tag returns the 128 byte ID3v1.1 tag holding the fields of m. Text is cut to the
+// field sizes and characters outside Latin-1 are replaced by '?'. A genre that is not one
+// of the ID3v1 genres is stored as unknown (255). A nil m returns an empty tag.
+func (m *TrackTags) ID3v1Tag() []byte {
+	tag := make([]byte, ID3v1TagSize)
+	copy(tag, "TAG")
+	tag[127] = 255
+	if m == nil {
+		return tag
+	}
+	putLatin1(tag[3:33], m.Title)
+	putLatin1(tag[33:63], m.Artist)
+	putLatin1(tag[63:93], m.Album)
+	if m.Year > 0 && m.Year <= 9999 {
+		putLatin1(tag[93:97], strconv.Itoa(m.Year))
+	}
+	// ID3v1.1: a zero byte ends the comment and the track number follows
+	if m.TrackNumber > 0 && m.TrackNumber <= 255 {
+		tag[126] = byte(m.TrackNumber)
+	}
+	for i, name := range id3v1Genres {
+		if strings.EqualFold(name, m.Genre) {
+			tag[127] = byte(i)
+			break
+		}
+	}
+	return tag
+}
+
+// putLatin1 writes s as Latin-1 into the zero filled field b, cut to its size.
+func putLatin1(b []byte, s string) {
+	n := 0
+	for _, r := range s {
+		if n == len(b) {
+			break
+		}
+		if r > 0xff {
+			r = '?'
+		}
+		b[n] = byte(r)
+		n++
+	}
+}
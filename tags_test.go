@@ -0,0 +1,135 @@
+package mp3_test
+
+import (
+	"bytes"
+	"testing"
+
+	mp3 "github.com/lizc2003/audio-mp3"
+)
+
+func TestEncoderConfigTags(t *testing.T) {
+	requireNative(t)
+	cover := generatePNG(t, 16, 16)
+	tags := &mp3.TrackTags{
+		Title:       "Intro",
+		Artist:      "Band",
+		Album:       "Live",
+		Year:        2024,
+		Genre:       "Rock",
+		TrackNumber: 1,
+		TrackTotal:  12,
+		AlbumArt:    cover,
+	}
+	check := func(t *testing.T, data []byte, replayGain bool) {
+		t.Helper()
+		tag, err := mp3.ReadID3v2(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		for id, want := range map[string]string{"TIT2": "Intro", "TPE1": "Band", "TALB": "Live", "TDRC": "2024", "TCON": "Rock", "TRCK": "1/12"} {
+			if got := tag.Text(id); got != want {
+				t.Errorf("%s = %q, want %q", id, got, want)
+			}
+		}
+		if f := tag.Frame("APIC"); f == nil || !bytes.HasSuffix(f.Data, cover) {
+			t.Error("album art missing")
+		}
+		if _, _, ok := tag.ReplayGain(); ok != replayGain {
+			t.Errorf("ReplayGain present = %v, want %v", ok, replayGain)
+		}
+		// The Xing/LAME tag follows the ID3v2 tag
+		if audio := data[tag.Size():]; !mp3.IsInfoFrame(audio) {
+			t.Error("no Xing/Info frame after the ID3v2 tag")
+		}
+		if len(decodeAll(t, data)) == 0 {
+			t.Error("no audio decoded")
+		}
+	}
+
+	wav := generateWavFile(44100, 2, 44100)
+	t.Run("EncodeFromWav", func(t *testing.T) {
+		var out mp3.SeekableBuffer
+		result, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, &mp3.EncoderConfig{Tags: tags}, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		if result.TotalBytes != int64(out.Len()) {
+			t.Errorf("TotalBytes = %d, wrote %d", result.TotalBytes, out.Len())
+		}
+		check(t, out.Bytes(), false)
+	})
+	t.Run("ReplayGain", func(t *testing.T) {
+		var out mp3.SeekableBuffer
+		if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, &mp3.EncoderConfig{Tags: tags, FindReplayGain: true}, nil); err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		check(t, out.Bytes(), true)
+	})
+	t.Run("EncodeAll", func(t *testing.T) {
+		encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{Tags: tags, IsWriteVbrTag: true})
+		if err != nil {
+			t.Fatalf("Failed to create encoder: %v", err)
+		}
+		defer encoder.Close()
+		out, err := encoder.EncodeAll(wav[mp3.WavHeaderSize:])
+		if err != nil {
+			t.Fatalf("EncodeAll failed: %v", err)
+		}
+		check(t, out, false)
+	})
+
+	if _, err := (&mp3.TrackTags{AlbumArt: []byte("not an image")}).ID3v2Tag(); err == nil {
+		t.Error("invalid album art accepted")
+	}
+	t.Logf("✓ EncoderConfig.Tags written as ID3v2 tag")
+}
+
+func TestID3v1Tag(t *testing.T) {
+	requireNative(t)
+	tags := &mp3.TrackTags{
+		Title:       "A title that is longer than thirty bytes",
+		Artist:      "Café 東京",
+		Year:        1999,
+		Genre:       "hip-hop",
+		TrackNumber: 7,
+	}
+	tag := tags.ID3v1Tag()
+	if len(tag) != mp3.ID3v1TagSize || string(tag[:3]) != "TAG" {
+		t.Fatalf("invalid ID3v1 tag: %q", tag)
+	}
+	field := func(b []byte) string { return string(bytes.TrimRight(b, "\x00")) }
+	if got := field(tag[3:33]); got != "A title that is longer than th" {
+		t.Errorf("title = %q", got)
+	}
+	if got := tag[33:63]; !bytes.HasPrefix(got, []byte("Caf\xe9 ??\x00")) {
+		t.Errorf("artist = %q", field(got))
+	}
+	if got := field(tag[93:97]); got != "1999" {
+		t.Errorf("year = %q", got)
+	}
+	if tag[125] != 0 || tag[126] != 7 || tag[127] != 7 {
+		t.Errorf("track %d, genre %d, want 7 and 7", tag[126], tag[127])
+	}
+	if empty := (*mp3.TrackTags)(nil).ID3v1Tag(); empty[127] != 255 {
+		t.Errorf("genre of empty tag = %d, want 255", empty[127])
+	}
+
+	var out mp3.SeekableBuffer
+	config := &mp3.EncoderConfig{Tags: tags, WriteID3v1: true}
+	result, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100)), &out, config, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	data := out.Bytes()
+	if result.TotalBytes != int64(len(data)) || !bytes.Equal(data[len(data)-mp3.ID3v1TagSize:], tag) {
+		t.Error("ID3v1 tag not appended")
+	}
+	found, err := mp3.FindTrailingTags(bytes.NewReader(data), int64(len(data)))
+	if err != nil || len(found) != 1 || found[0].Kind != mp3.TagID3v1 {
+		t.Errorf("FindTrailingTags = %v, %v", found, err)
+	}
+	if len(decodeAll(t, data)) == 0 {
+		t.Error("no audio decoded")
+	}
+	t.Logf("✓ ID3v1 trailer appended")
+}
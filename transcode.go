@@ -0,0 +1,622 @@
+package mp3
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultCheckpointInterval = 30 * time.Second
+
+var ErrorTranscodeStopped = errors.New("transcode stopped at checkpoint")
+
+// TranscodeOptions controls metadata handling and checkpoints in Transcode.
+type TranscodeOptions struct {
+	// CopyMetadata copies the source ID3v2 and ID3v1 tags to the output.
+	CopyMetadata bool
+
+	// FrameFilter is called for every source ID3v2 frame when CopyMetadata is set.
+	// The frame may be modified in place (e.g. renamed); returning false drops it.
+	FrameFilter func(f *ID3Frame) bool
+
+	// ChunkSize is the number of mp3 bytes read from the input stream per call, as
+	// WavOptions.ChunkSize for DecodeToWav. Default is DefaultDecodeChunkSize.
+	ChunkSize int
+
+	// Checkpoint is called about every CheckpointInterval of audio with a position from which
+	// the transcode can be resumed, once the output up to it has been written. Returning false
+	// stops the transcode with ErrorTranscodeStopped, e.g. on a preemption notice.
+	// There are no checkpoints with resampling or ReplayGain analysis.
+	Checkpoint func(cp *TranscodeCheckpoint) bool
+
+	// CheckpointInterval is the audio duration between checkpoints.
+	// Default is DefaultCheckpointInterval.
+	CheckpointInterval time.Duration
+
+	// Resume continues a transcode at a checkpoint. inStream must be positioned at
+	// Resume.InputOffset and writer must hold the first Resume.OutputOffset bytes of the
+	// previous output, positioned at its end. config and the other options must be unchanged.
+	Resume *TranscodeCheckpoint
+}
+
+func (o *TranscodeOptions) chunkSize() int {
+	if o.ChunkSize <= 0 {
+		return DefaultDecodeChunkSize
+	}
+	return o.ChunkSize
+}
+
+// TranscodeCheckpoint is a position from which Transcode can be resumed.
+// The fields are exported for serialization and should not be modified.
+type TranscodeCheckpoint struct {
+	// InputOffset is the source offset from which decoding continues, at a frame boundary
+	// a few frames before the checkpoint to prime the decoder.
+	InputOffset int64 `json:"input_offset"`
+
+	// OutputOffset is the size of the output up to the checkpoint. Output written after it
+	// belongs to an incomplete frame and must be truncated before resuming.
+	OutputOffset int64 `json:"output_offset"`
+
+	// SkipSamples is the number of decoded samples per channel from InputOffset that
+	// precede Encoder.Samples.
+	SkipSamples int64 `json:"skip_samples"`
+
+	// TrimSamples is the number of decoded samples per channel to drop at the end of the
+	// stream. The decoder only removes the source padding itself if it has seen the Info frame.
+	TrimSamples int64 `json:"trim_samples"`
+
+	// TagSize is the size of the ID3v2 tag at the start of the output.
+	TagSize int `json:"tag_size"`
+
+	Encoder EncoderCheckpoint `json:"encoder"`
+}
+
+const (
+	// gaplessDecoderDelay is removed by mpg123 in addition to the encoder delay of the LAME tag.
+	gaplessDecoderDelay = 529
+
+	// itunesGaplessDesc is the description of the iTunes gapless comment. Its delay includes
+	// the decoder delay.
+	itunesGaplessDesc = "iTunSMPB"
+
+	// Source frames decoded and discarded before a resume position. They fill the
+	// synthesis filter bank and a bit reservoir of up to maxMainDataBegin bytes.
+	resumePrerollFrames = 3
+	maxMainDataBegin    = 511
+
+	// sourceFrameHistory is the number of source frames kept to find a resume position.
+	sourceFrameHistory = 256
+
+	// trailingTagWindow is the end of a source that can not seek which is held back from
+	// the decoder until EOF, to find APEv2, Lyrics3 and ID3v1 tags in it. Larger tags are
+	// decoded as junk.
+	trailingTagWindow = 64 << 10
+)
+
+// sourceFrame is the position of a frame passed to the decoder.
+type sourceFrame struct {
+	offset int64 // offset in the source stream
+	sample int64 // position of its first decoded sample
+	first  bool  // first audio frame of the stream, decoding from it needs no preroll
+}
+
+// resumePosition returns the source frame from which decoding must start to output
+// the sample at pos exactly, or false if it is no longer known.
+func resumePosition(frames []sourceFrame, pos int64) (sourceFrame, bool) {
+	g := len(frames) - 1
+	for g >= 0 && frames[g].sample > pos {
+		g--
+	}
+	for f := g; f >= 0; f-- {
+		if frames[f].first ||
+			(g-f >= resumePrerollFrames && frames[g].offset-frames[f].offset > 2*maxMainDataBegin) {
+			return frames[f], true
+		}
+	}
+	return sourceFrame{}, false
+}
+
+// parseITunesGapless parses the delay, padding and length in samples of an iTunSMPB comment.
+func parseITunesGapless(s string) (delay, padding, length int64, ok bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return 0, 0, 0, false
+	}
+	var values [3]int64
+	for i := range values {
+		v, err := strconv.ParseInt(fields[i+1], 16, 64)
+		if err != nil || v < 0 {
+			return 0, 0, 0, false
+		}
+		values[i] = v
+	}
+	return values[0], values[1], values[2], true
+}
+
+// formatITunesGapless formats an iTunSMPB comment. The fields have a fixed width, so a
+// comment rewritten in place keeps its size.
+func formatITunesGapless(delay, padding, length int64) string {
+	return fmt.Sprintf(" 00000000 %08X %08X %016X", delay, padding, length) +
+		strings.Repeat(" 00000000", 8)
+}
+
+// itunesGaplessFromLameTag derives the iTunSMPB values of a stream from its LAME tag.
+func itunesGaplessFromLameTag(lameTag []byte, frames int) (delay, padding, length int64, ok bool) {
+	h, err := ParseFrameHeader(lameTag)
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	d, p, ok := gaplessInfo(lameTag)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	length = int64(frames)*int64(h.Samples) - int64(d+p)
+	return int64(d + gaplessDecoderDelay), int64(max(p-gaplessDecoderDelay, 0)), length, true
+}
+
+// newTranscodeCheckpoint returns the position of the last complete frame written by encoder.
+func newTranscodeCheckpoint(encoder *Encoder, frames []sourceFrame, tagSize int, trimSamples int64) (*TranscodeCheckpoint, error) {
+	ecp, err := encoder.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	f, ok := resumePosition(frames, ecp.Samples)
+	if !ok {
+		return nil, ErrorNoCheckpoint
+	}
+	return &TranscodeCheckpoint{
+		InputOffset:  f.offset,
+		OutputOffset: int64(tagSize) + ecp.Bytes,
+		SkipSamples:  ecp.Samples - f.sample,
+		TrimSamples:  trimSamples,
+		TagSize:      tagSize,
+		Encoder:      *ecp,
+	}, nil
+}
+
+// Transcode decodes a mp3 stream and re-encodes it with the given config.
+// SampleRate and NumChannels are taken from the source stream and set in an internal copy of
+// config, the parameters actually used are returned in the EncodeResult.
+// If writer implements io.WriteSeeker, the Xing/LAME tag will be properly written after any copied ID3v2 tag.
+// With FindReplayGain the ReplayGain frames are added to the ID3v2 tag, which requires an
+// io.WriteSeeker.
+// Trailing APEv2, Lyrics3 and ID3v1 tags of the source are not decoded. They are located
+// with FindTrailingTags if inStream implements io.ReaderAt and io.Seeker, otherwise the
+// last 64 KiB of the stream are held back until EOF to find them.
+//
+// The output stays gapless: the encoder delay and padding of the source, read from its LAME tag
+// or else from an iTunes iTunSMPB comment, are removed before encoding, and the LAME tag of the
+// output carries the delay and padding of the new encoder. A copied iTunSMPB comment is updated
+// to the output, or dropped if writer does not implement io.WriteSeeker or checkpoints are enabled.
+// Long transcodes can be stopped and continued later, see TranscodeOptions.Checkpoint.
+// The EncodeResult describes the whole output, also of a resumed transcode.
+func Transcode(inStream io.Reader, writer io.Writer, config *EncoderConfig, opts *TranscodeOptions) (*EncodeResult, error) {
+	if opts == nil {
+		opts = &TranscodeOptions{}
+	}
+	resume := opts.Resume
+	// With a seekable source the trailing tags are located up front and not read,
+	// otherwise the end of the stream is held back until EOF shows where they start
+	srcID3v1, audioSize, err := sourceTrailingTags(inStream)
+	if err != nil {
+		return nil, err
+	}
+	holdTail := audioSize < 0
+	if !holdTail {
+		inStream = io.LimitReader(inStream, audioSize)
+	}
+	in := bufio.NewReader(inStream)
+
+	var srcTag *ID3v2Tag
+	inputOffset := int64(0) // source offset of the first byte passed to the decoder
+	if magic, _ := in.Peek(3); resume == nil && string(magic) == "ID3" {
+		hdr, _ := in.Peek(ID3v2HeaderSize)
+		inputOffset, _ = id3v2TagSize(bytes.NewReader(hdr), 0)
+		if srcTag, err = ReadID3v2(in); err != nil {
+			return nil, err
+		}
+	}
+
+	decoder, err := NewDecoder()
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+
+	// Decoded sample position of the first source frame, index of the first audio frame,
+	// the source padding the decoder does not remove once it has seen the LAME tag, and the
+	// decoded samples Transcode itself skips at the start and drops at the end
+	var sampleBase, trimSamples, skipSamples, dropSamples int64
+	firstAudio := 0
+	checkpoints := opts.Checkpoint != nil && (config == nil || !config.FindReplayGain)
+	if resume != nil {
+		inputOffset = resume.InputOffset
+		sampleBase = resume.Encoder.Samples - resume.SkipSamples
+		trimSamples = resume.TrimSamples
+		skipSamples, dropSamples = resume.SkipSamples, trimSamples
+		firstAudio = -1
+	} else {
+		head, _ := in.Peek(maxFrameSize)
+		h, hErr := ParseFrameHeader(head)
+		// Sample positions are only known if the audio starts right after the tag
+		checkpoints = checkpoints && hErr == nil
+		gapless := false
+		if IsInfoFrame(head) {
+			firstAudio = 1
+			sampleBase = -int64(h.Samples)
+			if delay, padding, ok := gaplessInfo(head); ok {
+				sampleBase -= int64(delay + gaplessDecoderDelay)
+				trimSamples = int64(max(padding-gaplessDecoderDelay, 0))
+				gapless = true
+			}
+		}
+		if !gapless && srcTag != nil {
+			// Without LAME tag the decoder outputs the delay and padding of an iTunes encode
+			smpb, _ := srcTag.Comment(itunesGaplessDesc)
+			if delay, padding, _, ok := parseITunesGapless(smpb); ok {
+				sampleBase -= delay
+				trimSamples = padding
+				skipSamples, dropSamples = delay, padding
+			}
+		}
+	}
+	var srcFrames []sourceFrame
+	if checkpoints {
+		decoder.SetFrameLogger(func(f *FrameInfo) {
+			if f.Index < firstAudio {
+				return
+			}
+			if len(srcFrames) == 2*sourceFrameHistory {
+				srcFrames = append(srcFrames[:0], srcFrames[sourceFrameHistory:]...)
+			}
+			srcFrames = append(srcFrames, sourceFrame{
+				offset: inputOffset + f.Offset,
+				sample: sampleBase + int64(f.Index)*int64(f.Header.Samples),
+				first:  f.Index == firstAudio,
+			})
+		})
+	}
+
+	config = populateEncConfig(config)
+	seeker, _ := writer.(io.WriteSeeker)
+	config.IsWriteVbrTag = seeker != nil
+	if config.FindReplayGain && seeker == nil {
+		return nil, errors.New("ReplayGain analysis requires a writer that implements io.WriteSeeker")
+	}
+	interval := opts.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+
+	var encoder *Encoder
+	defer func() {
+		if encoder != nil {
+			encoder.Close()
+		}
+	}()
+
+	tagSize := 0
+	var totalBytes, nextCheckpoint int64
+	var skipBytes, trimBytes int // decoded bytes to skip at the start and to hold back for the end
+	var outTag *ID3v2Tag
+	smpb := false // outTag has an iTunSMPB comment to update
+	rg := false   // outTag has ReplayGain frames to update
+	if resume != nil {
+		tagSize = resume.TagSize
+		totalBytes = resume.OutputOffset
+		nextCheckpoint = resume.Encoder.Samples
+	}
+	// The PCM buffer holds the frames of a whole chunk, see WavOptions.DecodeFrames
+	chunkSize := opts.chunkSize()
+	pcmBuf := GetOutBuf(decoder.EstimateOutBufBytes(EstimateFrames + chunkSize/minAppendFrameBytes))
+	defer PutOutBuf(pcmBuf)
+	var outBuf, pending []byte
+	defer func() {
+		if outBuf != nil {
+			PutOutBuf(outBuf)
+		}
+	}()
+	chunk := GetOutBuf(chunkSize)
+	defer PutOutBuf(chunk)
+	// decode decodes a chunk of source data and encodes the audio
+	decode := func(data []byte) error {
+		decodedN, decErr := decoder.Decode(data, pcmBuf)
+		if decErr != nil {
+			return decErr
+		}
+
+		if decodedN > 0 && encoder == nil {
+			if decoder.SampleBitDepth != SampleBitDepth {
+				return fmt.Errorf("unsupported decoded bit depth: %d", decoder.SampleBitDepth)
+			}
+			config.SampleRate = decoder.SampleRate
+			config.NumChannels = decoder.NumChannels
+			if resume != nil {
+				encoder, err = ResumeEncoder(config, &resume.Encoder)
+			} else {
+				encoder, err = NewEncoder(config)
+			}
+			if err != nil {
+				return err
+			}
+			bytesPerSample := decoder.NumChannels * decoder.SampleBitDepth / 8
+			skipBytes = int(skipSamples) * bytesPerSample
+			trimBytes = int(dropSamples) * bytesPerSample
+			outBuf = GetOutBuf(encoder.EstimateOutBufBytes(len(pcmBuf) + trimBytes))
+			nextCheckpoint += int64(interval) * int64(config.SampleRate) / int64(time.Second)
+
+			// A resumed output already holds the tag, its size comes from the checkpoint
+			rg = encoder.replayGainEnabled()
+			if resume == nil && ((opts.CopyMetadata && srcTag != nil) || config.Tags != nil || rg) {
+				outTag = NewID3v2Tag()
+				if opts.CopyMetadata && srcTag != nil {
+					outTag = filterID3v2(srcTag, opts.FrameFilter)
+				}
+				if err := config.Tags.apply(outTag); err != nil {
+					return err
+				}
+				if _, ok := outTag.Comment(itunesGaplessDesc); ok {
+					// The source values do not apply to the output, they are updated at the end
+					outTag.RemoveFrames(func(f *ID3Frame) bool { return isComment(f, itunesGaplessDesc) })
+					if seeker != nil && opts.Checkpoint == nil {
+						outTag.SetComment(itunesGaplessDesc, formatITunesGapless(0, 0, 0))
+						smpb = true
+					}
+				}
+				// Reserve space for the ReplayGain frames, the tag is rewritten once analysis completes
+				if rg {
+					outTag.SetReplayGain(0, 0)
+					outTag.Padding = max(outTag.Padding, replayGainTagPadding)
+				}
+				tagData := outTag.Bytes()
+				if _, wErr := writer.Write(tagData); wErr != nil {
+					return wErr
+				}
+				tagSize = len(tagData)
+				totalBytes += int64(tagSize)
+			}
+		}
+
+		pcm := pcmBuf[:decodedN]
+		if skipBytes > 0 {
+			k := min(skipBytes, len(pcm))
+			pcm = pcm[k:]
+			skipBytes -= k
+		}
+		held := 0
+		if trimBytes > 0 {
+			// Hold back the source padding until the end of the stream is known
+			pending = append(pending, pcm...)
+			held = min(len(pending), trimBytes)
+			pcm = pending[:len(pending)-held]
+		}
+
+		if len(pcm) > 0 {
+			encodedBytes, encErr := encoder.Encode(pcm, outBuf)
+			if encErr != nil {
+				return encErr
+			}
+			if encodedBytes > 0 {
+				totalBytes += int64(encodedBytes)
+				if _, wErr := writer.Write(outBuf[:encodedBytes]); wErr != nil {
+					return wErr
+				}
+			}
+		}
+		if trimBytes > 0 {
+			pending = append(pending[:0], pending[len(pending)-held:]...)
+		}
+
+		if checkpoints && encoder != nil && encoder.TotalSamples() >= nextCheckpoint {
+			cp, cpErr := newTranscodeCheckpoint(encoder, srcFrames, tagSize, trimSamples)
+			if cpErr == nil {
+				nextCheckpoint = encoder.TotalSamples() + int64(interval)*int64(config.SampleRate)/int64(time.Second)
+				if !opts.Checkpoint(cp) {
+					return ErrorTranscodeStopped
+				}
+			} else if !errors.Is(cpErr, ErrorNoCheckpoint) {
+				return cpErr
+			}
+		}
+		return nil
+	}
+	// decodeAll passes data to decode in chunks the decoder output buffer can hold
+	decodeAll := func(data []byte) error {
+		for len(data) > 0 {
+			k := min(len(data), len(chunk))
+			if err := decode(data[:k]); err != nil {
+				return err
+			}
+			data = data[k:]
+		}
+		return nil
+	}
+
+	var tail []byte // end of the source held back from the decoder
+	for {
+		n, readErr := in.Read(chunk)
+		if n > 0 && !holdTail {
+			if err := decode(chunk[:n]); err != nil {
+				return nil, err
+			}
+		} else if n > 0 {
+			// Decode all but the last trailingTagWindow bytes once twice as much is held
+			tail = append(tail, chunk[:n]...)
+			if k := len(tail) - trailingTagWindow; k >= trailingTagWindow {
+				if err := decodeAll(tail[:k]); err != nil {
+					return nil, err
+				}
+				tail = append(tail[:0], tail[k:]...)
+			}
+		}
+
+		if readErr != nil {
+			if readErr == io.EOF {
+				break
+			}
+			return nil, readErr
+		}
+	}
+	if holdTail {
+		tags, tagErr := FindTrailingTags(bytes.NewReader(tail), int64(len(tail)))
+		if tagErr != nil {
+			// A tag larger than the held back data can not be skipped any more
+			tags = nil
+		}
+		audioEnd := len(tail)
+		if len(tags) > 0 {
+			audioEnd = int(tags[0].Offset)
+			if last := tags[len(tags)-1]; last.Kind == TagID3v1 {
+				srcID3v1 = tail[last.Offset:]
+			}
+		}
+		if err := decodeAll(tail[:audioEnd]); err != nil {
+			return nil, err
+		}
+	}
+
+	if encoder == nil {
+		return nil, errors.New("no audio frames decoded")
+	}
+
+	encodedBytes, flushErr := encoder.Flush(outBuf)
+	if flushErr != nil {
+		return nil, flushErr
+	}
+	if encodedBytes > 0 {
+		totalBytes += int64(encodedBytes)
+		if _, wErr := writer.Write(outBuf[:encodedBytes]); wErr != nil {
+			return nil, wErr
+		}
+	}
+
+	var id3v1 []byte
+	if opts.CopyMetadata && srcID3v1 != nil {
+		id3v1 = srcID3v1
+	} else if config.WriteID3v1 {
+		id3v1 = config.Tags.ID3v1Tag()
+	}
+	if id3v1 != nil {
+		if _, wErr := writer.Write(id3v1); wErr != nil {
+			return nil, wErr
+		}
+		totalBytes += ID3v1TagSize
+	}
+
+	totalFrames, err := encoder.GetFrameNum()
+	if err != nil {
+		return nil, err
+	}
+
+	// Write Xing/LAME tag if writer supports seeking
+	infoBytes := 0 // size of the Xing/Info frame, not counted in totalFrames
+	if seeker != nil {
+		lameTag, tagErr := encoder.GetLameTagFrame()
+		if tagErr != nil {
+			return nil, fmt.Errorf("get LAME tag failed: %w", tagErr)
+		}
+
+		if len(lameTag) > 0 {
+			infoBytes = len(lameTag)
+			if _, seekErr := seeker.Seek(int64(tagSize), io.SeekStart); seekErr != nil {
+				return nil, fmt.Errorf("seek to write LAME tag failed: %w", seekErr)
+			}
+			if _, writeErr := seeker.Write(lameTag); writeErr != nil {
+				return nil, fmt.Errorf("write LAME tag failed: %w", writeErr)
+			}
+			if _, seekErr := seeker.Seek(0, io.SeekEnd); seekErr != nil {
+				return nil, fmt.Errorf("seek to end failed: %w", seekErr)
+			}
+		}
+
+		if smpb {
+			if delay, padding, length, ok := itunesGaplessFromLameTag(lameTag, totalFrames); ok {
+				outTag.SetComment(itunesGaplessDesc, formatITunesGapless(delay, padding, length))
+			} else {
+				outTag.RemoveFrames(func(f *ID3Frame) bool { return isComment(f, itunesGaplessDesc) })
+			}
+		}
+		if rg {
+			gain, peak, rgErr := encoder.ReplayGain()
+			if rgErr != nil {
+				return nil, rgErr
+			}
+			outTag.SetReplayGain(gain, peak)
+		}
+		if smpb || rg {
+			tagData, tagErr := outTag.BytesWithSize(tagSize)
+			if tagErr != nil {
+				return nil, tagErr
+			}
+			if err := writeAt(seeker, tagData, 0); err != nil {
+				return nil, fmt.Errorf("write ID3v2 tag failed: %w", err)
+			}
+		}
+	}
+
+	audioBytes := totalBytes - int64(tagSize+infoBytes)
+	if id3v1 != nil {
+		audioBytes -= ID3v1TagSize
+	}
+	result := newEncodeResult(encoder, config, totalFrames, audioBytes)
+	result.TotalBytes = totalBytes
+	return result, nil
+}
+
+// sourceTrailingTags returns the trailing ID3v1 tag of a source that implements io.ReaderAt
+// and io.Seeker, and the size of the stream from the current position up to its trailing
+// tags. audioSize is -1 if the source can not seek.
+func sourceTrailingTags(r io.Reader) (id3v1 []byte, audioSize int64, err error) {
+	ra, ok := r.(io.ReaderAt)
+	seeker, ok2 := r.(io.Seeker)
+	if !ok || !ok2 {
+		return nil, -1, nil
+	}
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, -1, nil
+	}
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := seeker.Seek(pos, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	tags, err := FindTrailingTags(ra, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	end := size
+	if len(tags) > 0 {
+		end = tags[0].Offset
+		if last := tags[len(tags)-1]; last.Kind == TagID3v1 {
+			id3v1 = make([]byte, ID3v1TagSize)
+			if _, err := ra.ReadAt(id3v1, last.Offset); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	return id3v1, max(end-pos, 0), nil
+}
+
+// filterID3v2 returns a copy of tag containing only the frames accepted by filter. The frames
+// of a tag read by ReadID3v2 hold plain data, so they are copied without format flags.
+func filterID3v2(tag *ID3v2Tag, filter func(f *ID3Frame) bool) *ID3v2Tag {
+	out := NewID3v2Tag()
+	out.Version = tag.Version
+	out.Padding = tag.Padding
+	for _, f := range tag.Frames {
+		f.Data = append([]byte(nil), f.Data...)
+		if filter != nil && !filter(&f) {
+			continue
+		}
+		out.Frames = append(out.Frames, f)
+	}
+	return out
+}
@@ -0,0 +1,449 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+// TestTranscodeMetadata tests that ID3 tags are copied during transcode
+func TestTranscodeMetadata(t *testing.T) {
+	requireNative(t)
+	var encoded bytes.Buffer
+	_, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100)), &encoded, &mp3.EncoderConfig{
+		Bitrate: 192,
+	}, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Source Title")
+	tag.SetText("TPE1", "Source Artist")
+	id3v1 := append([]byte("TAGSource Title"), make([]byte, 113)...)
+
+	var src []byte
+	src = append(src, tag.Bytes()...)
+	src = append(src, encoded.Bytes()...)
+	src = append(src, id3v1...)
+
+	t.Run("CopyAll", func(t *testing.T) {
+		var out bytes.Buffer
+		result, err := mp3.Transcode(bytes.NewReader(src), &out,
+			&mp3.EncoderConfig{Bitrate: 64}, &mp3.TranscodeOptions{CopyMetadata: true})
+		if err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+		if result.TotalBytes != int64(out.Len()) {
+			t.Errorf("Total bytes mismatch: got %d, want %d", result.TotalBytes, out.Len())
+		}
+		if result.SampleRate != 44100 || result.NumChannels != 2 || result.Config.Bitrate != 64 {
+			t.Errorf("Unexpected result %+v", result)
+		}
+		// The source has no LAME tag, so its encoder delay and padding are part of the audio
+		if result.Duration < time.Second || result.Duration > 1100*time.Millisecond || math.Abs(result.AverageBitrate-64) > 1 {
+			t.Errorf("Duration %v, average bitrate %.1f kbps, want about 1s at 64 kbps", result.Duration, result.AverageBitrate)
+		}
+
+		outTag, err := mp3.ReadID3v2(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		if f := outTag.Frame("TIT2"); f == nil || !bytes.Contains(f.Data, []byte("Source Title")) {
+			t.Error("Output tag missing TIT2")
+		}
+		if !bytes.Equal(out.Bytes()[out.Len()-128:], id3v1) {
+			t.Error("Output missing ID3v1 tag")
+		}
+		if out.Len() >= len(src) {
+			t.Errorf("Transcoded output not smaller: got %d, source %d", out.Len(), len(src))
+		}
+
+		t.Logf("✓ Transcoded: %d -> %d bytes, %d frames", len(src), result.TotalBytes, result.Frames)
+	})
+
+	t.Run("FilterFrames", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := mp3.Transcode(bytes.NewReader(src), &out,
+			&mp3.EncoderConfig{Bitrate: 64}, &mp3.TranscodeOptions{
+				CopyMetadata: true,
+				FrameFilter: func(f *mp3.ID3Frame) bool {
+					if f.ID == "TPE1" {
+						f.ID = "TPE2"
+					}
+					return f.ID != "TIT2"
+				},
+			})
+		if err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+
+		outTag, err := mp3.ReadID3v2(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		if outTag.Frame("TIT2") != nil {
+			t.Error("TIT2 should have been filtered")
+		}
+		if outTag.Frame("TPE2") == nil || outTag.Frame("TPE1") != nil {
+			t.Error("TPE1 should have been remapped to TPE2")
+		}
+	})
+
+	t.Run("ReplayGain", func(t *testing.T) {
+		config := &mp3.EncoderConfig{Bitrate: 64, FindReplayGain: true}
+		var out mp3.SeekableBuffer
+		result, err := mp3.Transcode(bytes.NewReader(src), &out, config, &mp3.TranscodeOptions{CopyMetadata: true})
+		if err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+		if result.TotalBytes != int64(out.Len()) {
+			t.Errorf("Total bytes mismatch: got %d, want %d", result.TotalBytes, out.Len())
+		}
+		outTag, err := mp3.ReadID3v2(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		gain, peak, ok := outTag.ReplayGain()
+		if !ok || gain == 0 || peak <= 0 || peak > 1 {
+			t.Errorf("ReplayGain %.2f dB peak %.4f (%v)", gain, peak, ok)
+		}
+		if f := outTag.Frame("TIT2"); f == nil || !bytes.Contains(f.Data, []byte("Source Title")) {
+			t.Error("Output tag missing TIT2")
+		}
+		// The Xing/LAME tag follows the rewritten ID3v2 tag
+		if !mp3.IsInfoFrame(out.Bytes()[outTag.Size():]) {
+			t.Error("No Info frame after the ID3v2 tag")
+		}
+
+		// Without seeking the tag can not be updated
+		var stream bytes.Buffer
+		if _, err := mp3.Transcode(bytes.NewReader(src), &stream, config, nil); err == nil || stream.Len() != 0 {
+			t.Errorf("Transcode to a stream with ReplayGain: %v, %d bytes written", err, stream.Len())
+		}
+		t.Logf("✓ ReplayGain %.2f dB peak %.4f", gain, peak)
+	})
+
+	t.Run("ChunkSize", func(t *testing.T) {
+		var want bytes.Buffer
+		if _, err := mp3.Transcode(bytes.NewReader(src), &want, &mp3.EncoderConfig{Bitrate: 64}, nil); err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+		for _, size := range []int{100, 1 << 20} {
+			var out bytes.Buffer
+			if _, err := mp3.Transcode(bytes.NewReader(src), &out, &mp3.EncoderConfig{Bitrate: 64},
+				&mp3.TranscodeOptions{ChunkSize: size}); err != nil {
+				t.Fatalf("Transcode with %d byte chunks failed: %v", size, err)
+			}
+			if !bytes.Equal(out.Bytes(), want.Bytes()) {
+				t.Errorf("Output with %d byte chunks differs: %d vs %d bytes", size, out.Len(), want.Len())
+			}
+		}
+	})
+
+	t.Run("NoMetadata", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := mp3.Transcode(bytes.NewReader(src), &out, &mp3.EncoderConfig{Bitrate: 64}, nil)
+		if err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+		if bytes.HasPrefix(out.Bytes(), []byte("ID3")) {
+			t.Error("Output should not have an ID3v2 tag")
+		}
+	})
+}
+
+// TestTranscodeTrailingTags tests that APEv2, Lyrics3 and ID3v1 tags after the audio are
+// not decoded, from seekable sources and streams
+func TestTranscodeTrailingTags(t *testing.T) {
+	var encoded bytes.Buffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100)), &encoded, &mp3.EncoderConfig{
+		Bitrate: 128,
+	}, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	audio := encoded.Bytes()
+	id3v1 := append([]byte("TAGSource Title"), make([]byte, 113)...)
+	clean := append(append([]byte(nil), audio...), id3v1...)
+	// Frames in the tags are decoded as audio if the tags are not found
+	frames := audio[len(audio)/2 : len(audio)/2+4000]
+	var src []byte
+	src = append(src, audio...)
+	src = append(src, makeAPEv2Tag(frames)...)
+	src = append(src, makeLyrics3v2Tag(string(frames))...)
+	src = append(src, id3v1...)
+
+	transcode := func(t *testing.T, in io.Reader) []byte {
+		t.Helper()
+		var out bytes.Buffer
+		if _, err := mp3.Transcode(in, &out, &mp3.EncoderConfig{Bitrate: 64}, &mp3.TranscodeOptions{CopyMetadata: true}); err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+		return out.Bytes()
+	}
+	want := transcode(t, bytes.NewReader(clean))
+	if !bytes.HasSuffix(want, id3v1) {
+		t.Fatal("Output missing ID3v1 tag")
+	}
+	for _, tc := range []struct {
+		name string
+		in   io.Reader
+	}{
+		{"Seekable", bytes.NewReader(src)},
+		{"Stream", struct{ io.Reader }{bytes.NewReader(src)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := transcode(t, tc.in); !bytes.Equal(got, want) {
+				t.Errorf("Output differs from the source without tags: %d vs %d bytes", len(got), len(want))
+			}
+		})
+	}
+	t.Logf("✓ Trailing tags skipped: %d bytes", len(want))
+}
+
+// TestTranscodeResume tests that a stopped transcode continues from a checkpoint
+func TestTranscodeResume(t *testing.T) {
+	requireNative(t)
+	dir := t.TempDir()
+	srcFile, err := os.Create(filepath.Join(dir, "src.mp3"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	_, err = mp3.EncodeFromWav(bytes.NewReader(generateWavFile(44100, 2, 44100*10)), srcFile, &mp3.EncoderConfig{
+		Bitrate:       192,
+		IsWriteVbrTag: true,
+	}, nil)
+	srcFile.Close()
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	encoded, err := os.ReadFile(srcFile.Name())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	tag := mp3.NewID3v2Tag()
+	tag.SetText("TIT2", "Source Title")
+	src := append(tag.Bytes(), encoded...)
+
+	config := &mp3.EncoderConfig{Bitrate: 128}
+	transcode := func(t *testing.T, name string, in []byte, opts mp3.TranscodeOptions, truncate int64) ([]byte, int, error) {
+		t.Helper()
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		defer f.Close()
+		if err := f.Truncate(truncate); err != nil {
+			t.Fatalf("Truncate failed: %v", err)
+		}
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			t.Fatalf("Seek failed: %v", err)
+		}
+		opts.CopyMetadata = true
+		result, err := mp3.Transcode(bytes.NewReader(in), f, config, &opts)
+		out, readErr := os.ReadFile(f.Name())
+		if readErr != nil {
+			t.Fatalf("ReadFile failed: %v", readErr)
+		}
+		if err != nil {
+			return out, 0, err
+		}
+		if result.TotalBytes != int64(len(out)) {
+			t.Errorf("Total bytes mismatch: got %d, want %d", result.TotalBytes, len(out))
+		}
+		return out, result.Frames, nil
+	}
+
+	reference, refFrames, err := transcode(t, "reference.mp3", src, mp3.TranscodeOptions{}, 0)
+	if err != nil {
+		t.Fatalf("Transcode failed: %v", err)
+	}
+	refPCM := decodeAll(t, reference)
+
+	for _, stopAt := range []int{1, 3} {
+		t.Run(fmt.Sprintf("Checkpoint %d", stopAt), func(t *testing.T) {
+			name := fmt.Sprintf("resumed%d.mp3", stopAt)
+			var saved []byte
+			count := 0
+			_, _, err := transcode(t, name, src, mp3.TranscodeOptions{
+				CheckpointInterval: 2 * time.Second,
+				Checkpoint: func(cp *mp3.TranscodeCheckpoint) bool {
+					count++
+					if count < stopAt {
+						return true
+					}
+					saved, _ = json.Marshal(cp)
+					return false
+				},
+			}, 0)
+			if !errors.Is(err, mp3.ErrorTranscodeStopped) {
+				t.Fatalf("Expected ErrorTranscodeStopped, got %v", err)
+			}
+
+			var cp mp3.TranscodeCheckpoint
+			if err := json.Unmarshal(saved, &cp); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			resumed, frames, err := transcode(t, name, src[cp.InputOffset:], mp3.TranscodeOptions{Resume: &cp}, cp.OutputOffset)
+			if err != nil {
+				t.Fatalf("Resumed transcode failed: %v", err)
+			}
+			if frames != refFrames {
+				t.Errorf("Frame count mismatch: got %d, want %d", frames, refFrames)
+			}
+			info, err := mp3.ParseFrameHeader(reference[cp.TagSize:])
+			if err != nil {
+				t.Fatalf("No Info frame after the ID3v2 tag: %v", err)
+			}
+			tagEnd := int64(cp.TagSize + info.Size)
+			if !bytes.Equal(resumed[tagEnd:cp.OutputOffset], reference[tagEnd:cp.OutputOffset]) {
+				t.Error("Output before the checkpoint differs from reference")
+			}
+			if _, err := mp3.ReadID3v2(bytes.NewReader(resumed)); err != nil {
+				t.Errorf("ReadID3v2 failed: %v", err)
+			}
+
+			// The decoded audio must follow the reference without a gap at the resume point
+			resumedPCM := decodeAll(t, resumed)
+			if len(refPCM) != len(resumedPCM) {
+				t.Fatalf("Decoded length differs: reference %d, resumed %d", len(refPCM), len(resumedPCM))
+			}
+			maxDiff := 0
+			for i := 0; i+1 < len(refPCM); i += 2 {
+				a := int(int16(uint16(refPCM[i]) | uint16(refPCM[i+1])<<8))
+				b := int(int16(uint16(resumedPCM[i]) | uint16(resumedPCM[i+1])<<8))
+				maxDiff = max(maxDiff, abs(a-b))
+			}
+			if maxDiff > 2000 {
+				t.Errorf("Decoded audio deviates from reference by %d", maxDiff)
+			}
+
+			t.Logf("✓ Resumed at input %d, output %d: %d frames, max deviation %d",
+				cp.InputOffset, cp.OutputOffset, frames, maxDiff)
+		})
+	}
+
+	t.Run("Tags", func(t *testing.T) {
+		config = &mp3.EncoderConfig{Bitrate: 128, Tags: &mp3.TrackTags{Title: "Output Title"}}
+		var cp mp3.TranscodeCheckpoint
+		_, _, err := transcode(t, "tags.mp3", src, mp3.TranscodeOptions{
+			CheckpointInterval: 2 * time.Second,
+			Checkpoint: func(c *mp3.TranscodeCheckpoint) bool {
+				cp = *c
+				return false
+			},
+		}, 0)
+		if !errors.Is(err, mp3.ErrorTranscodeStopped) {
+			t.Fatalf("Expected ErrorTranscodeStopped, got %v", err)
+		}
+		resumed, _, err := transcode(t, "tags.mp3", src[cp.InputOffset:], mp3.TranscodeOptions{Resume: &cp}, cp.OutputOffset)
+		if err != nil {
+			t.Fatalf("Resumed transcode failed: %v", err)
+		}
+		if n := bytes.Count(resumed, []byte("ID3\x04\x00")); n != 1 {
+			t.Errorf("Expected one ID3v2 header, got %d", n)
+		}
+		outTag, err := mp3.ReadID3v2(bytes.NewReader(resumed))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		if outTag.Size() != cp.TagSize {
+			t.Errorf("Tag size mismatch: got %d, want %d", outTag.Size(), cp.TagSize)
+		}
+	})
+}
+
+// TestTranscodeGapless tests that the source delay and padding are removed and the output
+// gapless info is updated
+func TestTranscodeGapless(t *testing.T) {
+	requireNative(t)
+	const numSamples = 100000
+	wav := generateWavFile(44100, 2, numSamples)
+	dir := t.TempDir()
+
+	transcode := func(t *testing.T, src []byte) []byte {
+		t.Helper()
+		f, err := os.Create(filepath.Join(dir, "out.mp3"))
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		defer f.Close()
+		_, err = mp3.Transcode(bytes.NewReader(src), f, &mp3.EncoderConfig{Bitrate: 128},
+			&mp3.TranscodeOptions{CopyMetadata: true})
+		if err != nil {
+			t.Fatalf("Transcode failed: %v", err)
+		}
+		out, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		return out
+	}
+	check := func(t *testing.T, out []byte) {
+		t.Helper()
+		if got := len(decodeAll(t, out)) / 4; got != numSamples {
+			t.Errorf("Decoded samples: got %d, want %d", got, numSamples)
+		}
+		tag, err := mp3.ReadID3v2(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("ReadID3v2 failed: %v", err)
+		}
+		smpb, ok := tag.Comment("iTunSMPB")
+		if !ok {
+			t.Fatal("Output missing iTunSMPB comment")
+		}
+		var delay, padding, length int64
+		if _, err := fmt.Sscanf(smpb, " 00000000 %X %X %X", &delay, &padding, &length); err != nil {
+			t.Fatalf("Invalid iTunSMPB %q: %v", smpb, err)
+		}
+		if length != numSamples || delay < 529 {
+			t.Errorf("iTunSMPB not updated: delay %d, padding %d, length %d", delay, padding, length)
+		}
+	}
+
+	t.Run("LAME tag", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(dir, "src.mp3"))
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		_, err = mp3.EncodeFromWav(bytes.NewReader(wav), f, &mp3.EncoderConfig{Bitrate: 192}, nil)
+		f.Close()
+		if err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		encoded, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+		// A stale comment of a previous encode must not survive
+		tag := mp3.NewID3v2Tag()
+		tag.SetComment("iTunSMPB", " 00000000 00000840 000001E0 0000000000000001")
+		out := transcode(t, append(tag.Bytes(), encoded...))
+		check(t, out)
+	})
+
+	t.Run("iTunSMPB", func(t *testing.T) {
+		// Without seeking there is no LAME tag, the gapless info comes from the comment
+		var encoded bytes.Buffer
+		_, err := mp3.EncodeFromWav(bytes.NewReader(wav), &encoded, &mp3.EncoderConfig{Bitrate: 192}, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromWav failed: %v", err)
+		}
+		frames := len(decodeAll(t, encoded.Bytes())) / 4 / 1152
+		delay := 576 + 529
+		tag := mp3.NewID3v2Tag()
+		tag.SetComment("iTunSMPB", fmt.Sprintf(" 00000000 %08X %08X %016X",
+			delay, frames*1152-delay-numSamples, numSamples))
+		out := transcode(t, append(tag.Bytes(), encoded.Bytes()...))
+		check(t, out)
+	})
+}
@@ -0,0 +1,112 @@
+package mp3
+
+import "encoding/binary"
+
+const (
+	vbriOffset     = 36 // VBRI is always located 32 bytes after the side information start
+	vbriHeaderSize = 26 // id, version, delay, quality, bytes, frames and the seek table layout
+	vbriMaxEntries = 100
+)
+
+// vbriTable collects the seek table of a VBRI frame from the encoded stream. Each entry is
+// the size of framesPerEntry frames; when the table is full adjacent entries are merged and
+// framesPerEntry doubles, so it stays small for any stream length.
+type vbriTable struct {
+	log            *frameLog
+	skip           int // leading frames that are not audio, i.e. the tag placeholder
+	entries        []int64
+	framesPerEntry int
+	frames         int // audio frames seen
+}
+
+func newVBRITable(skip int) *vbriTable {
+	t := &vbriTable{skip: skip, framesPerEntry: 1}
+	t.log = &frameLog{fn: t.add}
+	return t
+}
+
+// scan tracks the frames in the next chunk of the stream, it does nothing on a nil table.
+func (t *vbriTable) scan(b []byte) {
+	if t != nil {
+		t.log.scan(b)
+	}
+}
+
+func (t *vbriTable) add(f *FrameInfo) {
+	if f.Index < t.skip {
+		return
+	}
+	if t.frames%t.framesPerEntry == 0 {
+		if len(t.entries) == vbriMaxEntries {
+			t.entries = mergeVBRIEntries(t.entries)
+			t.framesPerEntry *= 2
+		}
+		if t.frames%t.framesPerEntry == 0 {
+			t.entries = append(t.entries, 0)
+		}
+	}
+	t.entries[len(t.entries)-1] += int64(f.Header.Size)
+	t.frames++
+}
+
+// mergeVBRIEntries sums adjacent pairs of entries in place.
+func mergeVBRIEntries(entries []int64) []int64 {
+	n := 0
+	for i := 0; i < len(entries); i += 2 {
+		entries[n] = entries[i]
+		if i+1 < len(entries) {
+			entries[n] += entries[i+1]
+		}
+		n++
+	}
+	return entries[:n]
+}
+
+// buildVBRIFrame replaces the Xing/Info header of the tag frame with a VBRI header of the
+// same frame size. bytes is the size of the stream including the tag frame. The seek table
+// is left out if t does not cover all frames or does not fit into the frame.
+func buildVBRIFrame(tag []byte, frames int, bytes int64, delay, quality int, t *vbriTable) []byte {
+	frame := make([]byte, len(tag))
+	copy(frame, tag[:FrameHeaderSize])
+	if len(frame) < vbriOffset+vbriHeaderSize {
+		return frame
+	}
+
+	h := frame[vbriOffset:]
+	copy(h, "VBRI")
+	binary.BigEndian.PutUint16(h[4:], 1) // version
+	binary.BigEndian.PutUint16(h[6:], uint16(delay))
+	binary.BigEndian.PutUint16(h[8:], uint16(quality))
+	binary.BigEndian.PutUint32(h[10:], uint32(bytes))
+	binary.BigEndian.PutUint32(h[14:], uint32(frames))
+
+	if t == nil || t.frames != frames || len(t.entries) == 0 {
+		return frame
+	}
+	entries := append([]int64(nil), t.entries...)
+	framesPerEntry := t.framesPerEntry
+	for len(entries)*2 > len(h)-vbriHeaderSize {
+		entries = mergeVBRIEntries(entries)
+		framesPerEntry *= 2
+	}
+	if framesPerEntry > 0xffff {
+		return frame
+	}
+
+	// Entries are stored divided by the scale factor to fit 16 bits
+	scale := int64(1)
+	for _, e := range entries {
+		scale = max(scale, (e+0xfffe)/0xffff)
+	}
+	if scale > 0xffff {
+		return frame
+	}
+	binary.BigEndian.PutUint16(h[18:], uint16(len(entries)))
+	binary.BigEndian.PutUint16(h[20:], uint16(scale))
+	binary.BigEndian.PutUint16(h[22:], 2) // bytes per entry
+	binary.BigEndian.PutUint16(h[24:], uint16(framesPerEntry))
+	for i, e := range entries {
+		binary.BigEndian.PutUint16(h[vbriHeaderSize+2*i:], uint16((e+scale-1)/scale))
+	}
+	return frame
+}
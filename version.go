@@ -0,0 +1,56 @@
+package mp3
+
+import (
+	"fmt"
+	"strings"
+)
+
+// packageVersion is the version of this package, updated with each release.
+var packageVersion = Version{Major: 0, Minor: 1, Patch: 0}
+
+// Version is a library version number.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+
+	// Label is the pre-release suffix, e.g. "beta4", empty for releases.
+	Label string
+}
+
+// PackageVersion returns the semantic version of this package.
+func PackageVersion() Version {
+	return packageVersion
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Label != "" {
+		s += "-" + v.Label
+	}
+	return s
+}
+
+// Compare returns -1, 0 or +1 depending on whether v is lower, equal or higher than o.
+// As in semantic versioning, a version with a label is lower than the release without.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return max(min(d, 1), -1)
+		}
+	}
+	switch {
+	case v.Label == o.Label:
+		return 0
+	case v.Label == "":
+		return 1
+	case o.Label == "":
+		return -1
+	}
+	return strings.Compare(v.Label, o.Label)
+}
+
+// AtLeast reports whether v is major.minor.patch or later.
+func (v Version) AtLeast(major, minor, patch int) bool {
+	return v.Compare(Version{Major: major, Minor: minor, Patch: patch}) >= 0
+}
@@ -0,0 +1,54 @@
+package mp3_test
+
+import (
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestVersionCompare(t *testing.T) {
+	testCases := []struct {
+		a, b mp3.Version
+		want int
+	}{
+		{mp3.Version{Major: 1, Minor: 2, Patch: 3}, mp3.Version{Major: 1, Minor: 2, Patch: 3}, 0},
+		{mp3.Version{Major: 1, Minor: 2, Patch: 3}, mp3.Version{Major: 1, Minor: 10}, -1},
+		{mp3.Version{Major: 2}, mp3.Version{Major: 1, Minor: 99, Patch: 99}, 1},
+		{mp3.Version{Major: 1, Label: "beta1"}, mp3.Version{Major: 1}, -1},
+		{mp3.Version{Major: 1, Label: "beta2"}, mp3.Version{Major: 1, Label: "beta1"}, 1},
+	}
+	for _, tc := range testCases {
+		if got := tc.a.Compare(tc.b); got != tc.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := tc.b.Compare(tc.a); got != -tc.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+
+	v := mp3.Version{Major: 1, Minor: 32, Patch: 3, Label: "rc1"}
+	if v.String() != "1.32.3-rc1" {
+		t.Errorf("String() = %q", v.String())
+	}
+	if !v.AtLeast(1, 32, 0) || v.AtLeast(1, 32, 3) {
+		t.Errorf("AtLeast wrong for %v", v)
+	}
+}
+
+func TestLibraryVersions(t *testing.T) {
+	if v := mp3.PackageVersion(); v.String() == "0.0.0" {
+		t.Errorf("PackageVersion not set: %v", v)
+	}
+	if mp3.ActiveBackend() != mp3.BackendNative {
+		t.Skip("libraries not linked")
+	}
+	lame := mp3.LameVersion()
+	if !lame.AtLeast(3, 99, 0) {
+		t.Errorf("Unexpected LAME version %v", lame)
+	}
+	mpg123 := mp3.Mpg123Version()
+	if !mpg123.AtLeast(1, 0, 0) {
+		t.Errorf("Unexpected mpg123 version %v", mpg123)
+	}
+	t.Logf("✓ Versions: package %v, LAME %v, mpg123 %v", mp3.PackageVersion(), lame, mpg123)
+}
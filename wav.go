@@ -1,149 +1,641 @@
 package mp3
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"os"
+	"time"
 )
 
 const (
 	WavHeaderSize = 44
+
+	// RF64HeaderSize is the size of the header written by GenerateRF64Header.
+	RF64HeaderSize = 80
+
+	// replayGainTagPadding is the extra space reserved in the placeholder
+	// ReplayGain tag so the final values always fit when rewritten.
+	replayGainTagPadding = 64
+
+	// wavFormatExtensible is the WAVE_FORMAT_EXTENSIBLE format code.
+	wavFormatExtensible = 0xfffe
+
+	// DefaultChunkSize is the number of PCM bytes EncodeFromWav reads per call by default,
+	// about 0.37 seconds of 44.1 kHz stereo audio.
+	DefaultChunkSize = 64 * 1024
+
+	// DefaultDecodeChunkSize is the number of mp3 bytes DecodeToWav reads per call by default,
+	// about a second of 128 kbps audio. The PCM buffer grows with the chunk, see DecodeFrames.
+	DefaultDecodeChunkSize = 16 * 1024
+
+	// DefaultSegmentDuration is the length of the segments encoded in parallel by
+	// EncodeFromWav if WavOptions.Workers is set.
+	DefaultSegmentDuration = time.Minute
 )
 
+var ErrorWavTooLarge = errors.New("WAV data exceeds 4 GB")
+
+// WavOptions controls buffering in EncodeFromWav and DecodeToWav.
+type WavOptions struct {
+	// ChunkSize is the number of bytes read from the input stream per call.
+	// Batch jobs can use large chunks (e.g. 1 MB) to reduce the number of cgo calls,
+	// low-latency paths small ones. Default is DefaultChunkSize, or DefaultDecodeChunkSize
+	// for DecodeToWav.
+	ChunkSize int
+
+	// DecodeFrames is the size of the DecodeToWav output buffer in decoded frames.
+	// The default, EstimateFrames plus the number of small frames a chunk can hold,
+	// lets a whole chunk be decoded in one call; smaller values are raised to it.
+	DecodeFrames int
+
+	// RF64 makes DecodeToWav reserve room for a ds64 chunk, so output of more than 4 GB is
+	// written as RF64 (EBU Tech 3306). Smaller output stays a RIFF file with a JUNK chunk
+	// in place of the ds64 chunk. Without RF64, DecodeToWav fails with ErrorWavTooLarge
+	// if the writer is an io.WriteSeeker.
+	RF64 bool
+
+	// FinalizeInterval makes DecodeToWav update the WAV header about every FinalizeInterval
+	// of decoded audio instead of only at the end, so a crash leaves a playable file with
+	// the audio up to the last update. If the writer has a Sync method (like *os.File) it is
+	// called after each update. Default is 0, the header is written once at the end.
+	FinalizeInterval time.Duration
+
+	// Progress is called by EncodeFromWav and DecodeToWav after each chunk, e.g. to show
+	// the progress of long files. It runs on the converting goroutine, so it should be cheap.
+	Progress func(p Progress)
+
+	// InputSize is the size of the mp3 input of DecodeToWav for Progress.Percent. If it is
+	// 0, the size is taken from a Size or Stat method of the input, like those of
+	// *bytes.Reader and *os.File. EncodeFromWav uses the size in the WAV header.
+	InputSize int64
+
+	// Workers makes EncodeFromWav and EncodeFromPCM split the input into segments of
+	// SegmentDuration that are encoded on up to Workers goroutines, each with its own LAME
+	// handle, e.g. for multi-hour recordings. The segments are stitched at frame boundaries
+	// like Encoder.Reconfigure does, so the output plays gapless as one stream with one
+	// Xing/Info frame. Segments after the first are encoded without bit reservoir, which
+	// costs a little quality at low CBR bitrates. Up to Workers segments of PCM are held in
+	// memory. Without LAME, with resampling or with FindReplayGain the input is encoded on
+	// the calling goroutine. Default is 0, no parallel encoding.
+	Workers int
+
+	// SegmentDuration is the length of the segments of Workers. Default is DefaultSegmentDuration.
+	SegmentDuration time.Duration
+
+	// CopyMetadata makes EncodeFromWav write the LIST/INFO metadata of the input, see
+	// WavInfo.TrackTags, as ID3v2 tag. Fields set in EncoderConfig.Tags take precedence.
+	CopyMetadata bool
+
+	// OutputFormat is the sample format of the WAV written by DecodeToWav. S24LE, S32LE and
+	// F32 keep the precision of the mp3 synthesis, e.g. for mastering or further processing;
+	// the default S16LE rounds it to 16 bits. Only mpg123 supports other formats.
+	OutputFormat SampleFormat
+
+	// Tags is written by DecodeToWav as a LIST/INFO chunk in front of the samples, so
+	// players and editors show the title and artist of the output.
+	Tags *TrackTags
+}
+
+// Progress describes how far EncodeFromWav or DecodeToWav got.
+type Progress struct {
+	InputBytes  int64   // bytes read from the input: PCM data for EncodeFromWav, the mp3 stream for DecodeToWav
+	InputSize   int64   // total input bytes, 0 if unknown
+	OutputBytes int64   // bytes written, including headers and tags
+	Samples     int64   // samples per channel encoded or decoded
+	Percent     float64 // estimated completion from 0 to 100, -1 if InputSize is unknown
+}
+
+// report calls the Progress callback, if any.
+func (o *WavOptions) report(p Progress) {
+	if o == nil || o.Progress == nil {
+		return
+	}
+	p.Percent = -1
+	if p.InputSize > 0 {
+		p.Percent = min(float64(p.InputBytes)*100/float64(p.InputSize), 100)
+	}
+	o.Progress(p)
+}
+
+// inputSize returns the size of the DecodeToWav input, 0 if unknown.
+func (o *WavOptions) inputSize(r io.Reader) int64 {
+	if o == nil || o.Progress == nil {
+		return 0
+	}
+	if o.InputSize > 0 {
+		return o.InputSize
+	}
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return r.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		if fi, err := r.Stat(); err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	}
+	return 0
+}
+
+func (o *WavOptions) chunkSize() int {
+	if o == nil || o.ChunkSize <= 0 {
+		return DefaultChunkSize
+	}
+	return o.ChunkSize
+}
+
+// decodeChunkSize is chunkSize for mp3 input.
+func (o *WavOptions) decodeChunkSize() int {
+	if o == nil || o.ChunkSize <= 0 {
+		return DefaultDecodeChunkSize
+	}
+	return o.ChunkSize
+}
+
+func (o *WavOptions) decodeFrames() int {
+	n := EstimateFrames + o.decodeChunkSize()/minAppendFrameBytes
+	if o != nil {
+		n = max(n, o.DecodeFrames)
+	}
+	return n
+}
+
+func (o *WavOptions) workers() int {
+	if o == nil {
+		return 0
+	}
+	return o.Workers
+}
+
+// segmentFrames returns the number of frames of a Workers segment.
+func (o *WavOptions) segmentFrames(sampleRate, frameLength int) int {
+	d := DefaultSegmentDuration
+	if o != nil && o.SegmentDuration > 0 {
+		d = o.SegmentDuration
+	}
+	return max(int(int64(d)*int64(sampleRate)/int64(time.Second)/int64(frameLength)), 1)
+}
+
+func (o *WavOptions) finalizeInterval() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.FinalizeInterval
+}
+
+func (o *WavOptions) rf64() bool {
+	return o != nil && o.RF64
+}
+
+func (o *WavOptions) outputFormat() SampleFormat {
+	if o == nil {
+		return S16LE
+	}
+	return o.OutputFormat
+}
+
+// EncodeResult describes the output of EncodeFromWav and Transcode.
+type EncodeResult struct {
+	TotalBytes  int64 // bytes written, including tags
+	Frames      int   // mp3 frames
+	SampleRate  int   // input sample rate taken from the WAV header or the source stream
+	NumChannels int   // input channels taken from the WAV header or the source stream
+	Delay       int   // encoder delay in samples per channel, see Encoder.Delay
+	Padding     int   // padding of the last frame in samples per channel, see Encoder.Padding
+
+	// Duration is the play time of the audio without encoder delay and padding.
+	Duration time.Duration
+	// AverageBitrate is the bitrate of the mp3 frames in kbps, without ID3 tags.
+	AverageBitrate float64
+
+	// Config is the encoder configuration actually used, with defaults filled in.
+	Config EncoderConfig
+}
+
+// newEncodeResult describes the totalFrames frames encoded by encoder with config,
+// audioBytes is their size without tags and Xing/Info frame. TotalBytes is left to the caller.
+func newEncodeResult(encoder *Encoder, config *EncoderConfig, totalFrames int, audioBytes int64) *EncodeResult {
+	result := &EncodeResult{
+		Frames:      totalFrames,
+		SampleRate:  config.SampleRate,
+		NumChannels: config.NumChannels,
+		Delay:       encoder.Delay(),
+		Padding:     encoder.Padding(),
+		Config:      *config,
+	}
+	if played := time.Duration(totalFrames) * encoder.FrameDuration(); played > 0 {
+		result.AverageBitrate = float64(audioBytes) * 8 / played.Seconds() / 1000
+		samples := int64(totalFrames*encoder.FrameLength - result.Delay - result.Padding)
+		result.Duration = time.Duration(max(samples, 0) * int64(time.Second) / int64(encoder.OutSampleRate()))
+	}
+	return result
+}
+
 // EncodeFromWav encodes a WAV audio stream into mp3 format.
-// This function parses the WAV header to extract SampleRate and MaxChannels, overriding the values in config.
+// SampleRate and NumChannels are taken from the WAV header and set in an internal copy of config.
+// 16, 24 and 32-bit PCM and 32-bit float samples are supported; LAME encodes samples of more
+// than 16 bits at full precision.
+// G.711 µ-law and A-law samples, as recorded by telephony systems, are expanded to 16 bits.
+// wavStream may be a WavReader, also after its header was read to inspect the format.
+// The parameters actually used are returned in the EncodeResult.
+// A streaming WAV without data size, as written by arecord or ffmpeg to a pipe, is read until EOF.
 // If writer implements io.WriteSeeker, the Xing/LAME tag will be properly written at the beginning.
-func EncodeFromWav(wavStream io.Reader, writer io.Writer, config *EncoderConfig) (totalBytes int, totalFrames int, sampleRate int, err error) {
-	pcmSize, sampleRate, numChannels, bitsPerSample, err := ParseWavHeader(wavStream)
+// If config.FindReplayGain is set and writer implements io.WriteSeeker, an ID3v2 tag carrying
+// the ReplayGain track gain and peak is written in front of the audio.
+// opts may be nil to use the default buffering.
+func EncodeFromWav(wavStream io.Reader, writer io.Writer, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	return EncodeFromWavContext(context.Background(), wavStream, writer, config, opts)
+}
+
+// EncodeFromWavContext is EncodeFromWav that stops with the error of ctx when ctx is done.
+// ctx is checked before each chunk of opts.ChunkSize bytes is read; the partial output is
+// left in writer without tags.
+func EncodeFromWavContext(ctx context.Context, wavStream io.Reader, writer io.Writer, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	in, err := readWavInput(wavStream)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
 	}
-	if bitsPerSample != SampleBitDepth {
-		return 0, 0, 0, fmt.Errorf("unsupported bits per sample: %d (only 16-bit supported)", bitsPerSample)
+	if in.numChannels > 2 {
+		return nil, fmt.Errorf("unsupported channel count: %d (use EncodeMultichannelWav to split it)", in.numChannels)
 	}
+	return encodeWavInput(ctx, in, writer, config, opts)
+}
 
-	seeker, _ := writer.(io.WriteSeeker)
-	if seeker != nil {
-		config.IsWriteVbrTag = true
-	} else {
-		config.IsWriteVbrTag = false
+// encodeWavInput encodes the samples of in, read by readWavInput or readAiffInput.
+func encodeWavInput(ctx context.Context, in *wavInput, writer io.Writer, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	if opts != nil && opts.CopyMetadata {
+		if tags := in.tags; tags != nil {
+			cc := populateEncConfig(config)
+			cc.Tags = mergeTrackTags(tags, cc.Tags)
+			config = cc
+		}
+	}
+
+	chunkSize := opts.chunkSize()
+	out, err := newWavOutput(writer, config, in.sampleRate, in.numChannels, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	defer out.close()
+	out.format = in.format
+	// Streaming WAV files have a placeholder size
+	pcmSize := in.pcmSize
+	if pcmSize > 0 && pcmSize < math.MaxUint32 {
+		if err := out.encoder.SetTotalSamples(uint64(pcmSize) / uint64(in.numChannels*in.format.BytesPerSample())); err != nil {
+			return nil, err
+		}
+	}
+
+	inputSize := int64(0)
+	if pcmSize < math.MaxUint32 {
+		inputSize = pcmSize
+	}
+	if err := out.readFrom(ctx, in.pcm, inputSize, opts); err != nil {
+		return nil, err
+	}
+	return out.finish()
+}
+
+// wavInput is the PCM data of a WAV stream for the encoder.
+type wavInput struct {
+	pcm         io.Reader // the data, G.711 expanded to 16-bit samples
+	pcmSize     int64     // size of pcm, 0 or math.MaxUint32 for a streaming WAV
+	sampleRate  int
+	numChannels int
+	format      SampleFormat // of pcm
+	tags        *TrackTags   // of the LIST/INFO chunk, nil if none
+}
+
+// readWavInput reads the header of a WAV stream of PCM, float or G.711 samples.
+// r may be a WavReader whose header was already read.
+func readWavInput(r io.Reader) (*wavInput, error) {
+	wr, ok := r.(*WavReader)
+	if !ok {
+		wr = NewWavReader(r)
+	}
+	info, err := wr.Info()
+	if err != nil {
+		return nil, err
+	}
+	in := &wavInput{
+		pcm:         wr,
+		pcmSize:     info.DataSize,
+		sampleRate:  info.SampleRate,
+		numChannels: info.Channels,
+		tags:        info.TrackTags(),
+	}
+	switch info.Format {
+	case WavFormatPCM:
+		in.format, err = wavSampleFormat(info.BitsPerSample)
+	case WavFormatFloat:
+		if info.BitsPerSample != 32 {
+			return nil, fmt.Errorf("unsupported bits per sample: %d (only 32-bit float supported)", info.BitsPerSample)
+		}
+		in.format = F32
+	case WavFormatALaw, WavFormatMuLaw:
+		if info.BitsPerSample != 8 {
+			return nil, fmt.Errorf("unsupported bits per sample: %d (G.711 has 8)", info.BitsPerSample)
+		}
+		in.pcm = newG711Reader(in.pcm, info.Format == WavFormatALaw)
+		if !info.Streaming() {
+			in.pcmSize *= 2
+		}
+	default:
+		err = fmt.Errorf("unsupported audio format: %d (only PCM, float and G.711 supported)", info.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// wavSampleFormat returns the format of integer PCM samples of a WAV file.
+func wavSampleFormat(bitsPerSample int) (SampleFormat, error) {
+	switch bitsPerSample {
+	case 16:
+		return S16LE, nil
+	case 24:
+		return S24LE, nil
+	case 32:
+		return S32LE, nil
+	}
+	return 0, fmt.Errorf("unsupported bits per sample: %d (16, 24 and 32-bit supported)", bitsPerSample)
+}
+
+// EncodeFromPCM encodes raw interleaved PCM of the given format read from r until EOF,
+// e.g. s16le from a capture device or an ffmpeg pipe. The sample rate and channels are
+// taken from config; otherwise it works like EncodeFromWav.
+func EncodeFromPCM(r io.Reader, writer io.Writer, format SampleFormat, config *EncoderConfig, opts *WavOptions) (*EncodeResult, error) {
+	if _, ok := sampleFormatNames[format]; !ok {
+		return nil, fmt.Errorf("unsupported sample format: %d", int(format))
+	}
+	config = populateEncConfig(config)
+	out, err := newWavOutput(writer, config, config.SampleRate, config.NumChannels, opts.chunkSize())
+	if err != nil {
+		return nil, err
+	}
+	defer out.close()
+	out.format = format
+
+	if err := out.readFrom(context.Background(), r, opts.inputSize(r), opts); err != nil {
+		return nil, err
 	}
+	return out.finish()
+}
+
+// wavOutput encodes PCM into one mp3 output of EncodeFromWav or EncodeMultichannelWav.
+type wavOutput struct {
+	encoder    *Encoder
+	format     SampleFormat // of the PCM passed to encode
+	config     *EncoderConfig
+	writer     io.Writer
+	seeker     io.WriteSeeker
+	outBuf     []byte
+	rgTag      *ID3v2Tag // ID3v2 tag to rewrite with the ReplayGain results
+	tagSize    int
+	totalBytes int64
+}
 
+// newWavOutput creates the encoder and writes the placeholder ReplayGain tag.
+// chunkSize is the largest PCM chunk passed to encode.
+func newWavOutput(writer io.Writer, config *EncoderConfig, sampleRate, numChannels, chunkSize int) (*wavOutput, error) {
+	config = populateEncConfig(config)
+	seeker, _ := writer.(io.WriteSeeker)
+	config.IsWriteVbrTag = seeker != nil
 	config.SampleRate = sampleRate
 	config.NumChannels = numChannels
-	// Limit the reader to the data size to avoid reading trailing metadata as audio.
-	wavStream = io.LimitReader(wavStream, int64(pcmSize))
+	config.Bitrate = config.bitrate()
+
+	var tag *ID3v2Tag
+	if config.Tags != nil {
+		var err error
+		if tag, err = config.Tags.ID3v2Tag(); err != nil {
+			return nil, err
+		}
+	}
 
 	encoder, err := NewEncoder(config)
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
+	}
+	o := &wavOutput{
+		encoder: encoder,
+		config:  config,
+		writer:  writer,
+		seeker:  seeker,
+		outBuf:  GetOutBuf(encoder.EstimateOutBufBytes(chunkSize)),
+	}
+
+	// Reserve space for the ReplayGain frames, the tag is rewritten once analysis completes
+	if seeker != nil && config.FindReplayGain {
+		if tag == nil {
+			tag = NewID3v2Tag()
+		}
+		o.rgTag = tag
+		o.rgTag.SetReplayGain(0, 0)
+		o.rgTag.Padding = replayGainTagPadding
 	}
-	defer encoder.Close()
+	if tag != nil {
+		placeholder := tag.Bytes()
+		if _, wErr := writer.Write(placeholder); wErr != nil {
+			o.close()
+			return nil, wErr
+		}
+		o.tagSize = len(placeholder)
+		o.totalBytes += int64(o.tagSize)
+	}
+	return o, nil
+}
 
-	// Buffer for reading input PCM data
-	chunkSize := 2048
-	inBuf := make([]byte, chunkSize)
-	outBuf := make([]byte, encoder.EstimateOutBufBytes(chunkSize))
+func (o *wavOutput) close() {
+	o.encoder.Close()
+	if o.outBuf != nil {
+		PutOutBuf(o.outBuf)
+		o.outBuf = nil
+	}
+}
 
+// readFrom encodes PCM read from r until EOF in chunks of opts.ChunkSize bytes.
+// inputSize is the size of the input reported as progress, 0 if unknown.
+func (o *wavOutput) readFrom(ctx context.Context, r io.Reader, inputSize int64, opts *WavOptions) error {
+	if opts.workers() > 1 && o.canSplit() {
+		return o.readSegments(ctx, r, inputSize, opts)
+	}
+	progress := Progress{InputSize: inputSize}
+	inBuf := make([]byte, opts.chunkSize())
 	for {
-		n, err := wavStream.Read(inBuf)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(inBuf)
 		if n > 0 {
-			encodedBytes, encErr := encoder.Encode(inBuf[:n], outBuf)
-			if encErr != nil {
-				return 0, 0, 0, encErr
-			}
-			if encodedBytes > 0 {
-				totalBytes += encodedBytes
-				if _, wErr := writer.Write(outBuf[:encodedBytes]); wErr != nil {
-					return 0, 0, 0, wErr
-				}
+			if encErr := o.encode(inBuf[:n]); encErr != nil {
+				return encErr
 			}
+			progress.InputBytes += int64(n)
+			progress.OutputBytes = o.totalBytes
+			progress.Samples = o.encoder.TotalSamples()
+			opts.report(progress)
+		}
+		if err == io.EOF {
+			return nil
 		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return 0, 0, 0, err
+			return err
 		}
 	}
+}
+
+func (o *wavOutput) encode(pcm []byte) error {
+	encodedBytes, err := o.encoder.EncodeSamples(o.format, pcm, o.outBuf)
+	if err != nil {
+		return err
+	}
+	return o.write(encodedBytes)
+}
+
+func (o *wavOutput) write(encodedBytes int) error {
+	if encodedBytes == 0 {
+		return nil
+	}
+	o.totalBytes += int64(encodedBytes)
+	_, err := o.writer.Write(o.outBuf[:encodedBytes])
+	return err
+}
+
+// finish flushes the encoder and rewrites the ReplayGain and Xing/LAME tags.
+func (o *wavOutput) finish() (*EncodeResult, error) {
+	return o.finishWith(o.encoder.Flush)
+}
 
-	encodedBytes, flushErr := encoder.Flush(outBuf)
+// finishWith is finish with the flush function of the encoder, i.e. Flush or FlushNoGap.
+func (o *wavOutput) finishWith(flush func(out []byte) (int, error)) (*EncodeResult, error) {
+	encoder, seeker := o.encoder, o.seeker
+	encodedBytes, flushErr := flush(o.outBuf)
 	if flushErr != nil {
-		return 0, 0, 0, flushErr
+		return nil, flushErr
 	}
-	if encodedBytes > 0 {
-		totalBytes += encodedBytes
-		if _, wErr := writer.Write(outBuf[:encodedBytes]); wErr != nil {
-			return 0, 0, 0, wErr
-		}
+	if err := o.write(encodedBytes); err != nil {
+		return nil, err
 	}
 
-	totalFrames, err = encoder.GetFrameNum()
+	totalFrames, err := encoder.GetFrameNum()
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
+	}
+
+	// Write ReplayGain tag if space was reserved
+	if o.rgTag != nil {
+		gain, peak, rgErr := encoder.ReplayGain()
+		if rgErr != nil {
+			return nil, rgErr
+		}
+		o.rgTag.SetReplayGain(gain, peak)
+		tagData, tagErr := o.rgTag.BytesWithSize(o.tagSize)
+		if tagErr != nil {
+			return nil, tagErr
+		}
+		if _, seekErr := seeker.Seek(0, io.SeekStart); seekErr != nil {
+			return nil, fmt.Errorf("seek to write ReplayGain tag failed: %w", seekErr)
+		}
+		if _, writeErr := seeker.Write(tagData); writeErr != nil {
+			return nil, fmt.Errorf("write ReplayGain tag failed: %w", writeErr)
+		}
+		if _, seekErr := seeker.Seek(0, io.SeekEnd); seekErr != nil {
+			return nil, fmt.Errorf("seek to end failed: %w", seekErr)
+		}
 	}
 
 	// Write Xing/LAME tag if writer supports seeking
+	infoBytes := 0 // size of the Xing/Info frame, not counted in totalFrames
 	if seeker != nil {
 		lameTag, tagErr := encoder.GetLameTagFrame()
 		if tagErr != nil {
-			return 0, 0, 0, fmt.Errorf("get LAME tag failed: %w", tagErr)
+			return nil, fmt.Errorf("get LAME tag failed: %w", tagErr)
 		}
 
 		if len(lameTag) > 0 {
-			if _, seekErr := seeker.Seek(0, io.SeekStart); seekErr != nil {
-				return 0, 0, 0, fmt.Errorf("seek to write LAME tag failed: %w", seekErr)
+			infoBytes = len(lameTag)
+			if _, seekErr := seeker.Seek(int64(o.tagSize), io.SeekStart); seekErr != nil {
+				return nil, fmt.Errorf("seek to write LAME tag failed: %w", seekErr)
 			}
 
 			// Write the LAME tag frame (replaces placeholder)
 			if _, writeErr := seeker.Write(lameTag); writeErr != nil {
-				return 0, 0, 0, fmt.Errorf("write LAME tag failed: %w", writeErr)
+				return nil, fmt.Errorf("write LAME tag failed: %w", writeErr)
 			}
 
 			// Seek back to end
 			if _, seekErr := seeker.Seek(0, io.SeekEnd); seekErr != nil {
-				return 0, 0, 0, fmt.Errorf("seek to end failed: %w", seekErr)
+				return nil, fmt.Errorf("seek to end failed: %w", seekErr)
 			}
 		}
 	}
 
-	return totalBytes, totalFrames, sampleRate, nil
+	result := newEncodeResult(encoder, o.config, totalFrames, o.totalBytes-int64(o.tagSize+infoBytes))
+
+	if o.config.WriteID3v1 {
+		if _, err := o.writer.Write(o.config.Tags.ID3v1Tag()); err != nil {
+			return nil, err
+		}
+		o.totalBytes += ID3v1TagSize
+	}
+	result.TotalBytes = o.totalBytes
+	return result, nil
 }
 
-// DecodeToWav decodes a mp3 stream to WAV format and writes it to the output writer.
-func DecodeToWav(inStream io.Reader, writer io.WriteSeeker) (totalBytes int, totalSamples int, sampleRate int, err error) {
+// DecodeToWav decodes a mp3 stream to WAV format and writes it to the output writer with a
+// WavWriter: the sizes in the header are patched at the end if writer is an io.WriteSeeker,
+// otherwise they are left at the streaming value, so the output can be piped.
+// opts may be nil to use the default buffering; set opts.RF64 for output that may exceed 4 GB.
+func DecodeToWav(inStream io.Reader, writer io.Writer, opts *WavOptions) (totalBytes int64, totalSamples int64, sampleRate int, err error) {
 	decoder, err := NewDecoder()
 	if err != nil {
 		return 0, 0, 0, err
 	}
 	defer decoder.Close()
+	outputFormat := opts.outputFormat()
+	if err := decoder.SetOutputFormat(outputFormat); err != nil {
+		return 0, 0, 0, err
+	}
 
-	pcmBuf := make([]byte, decoder.EstimateOutBufBytes(EstimateFrames))
-	chunk := make([]byte, 2048)
+	pcmBuf := GetOutBuf(decoder.EstimateOutBufBytes(opts.decodeFrames()))
+	defer PutOutBuf(pcmBuf)
+	chunk := make([]byte, opts.decodeChunkSize())
+	var wav *WavWriter
+	progress := Progress{InputSize: opts.inputSize(inStream)}
 
 	for {
 		n, readErr := inStream.Read(chunk)
 		if n > 0 {
+			progress.InputBytes += int64(n)
 			decodedN, decErr := decoder.Decode(chunk[:n], pcmBuf)
 			if decErr != nil {
 				return 0, 0, 0, decErr
 			}
 
 			if decodedN > 0 {
-				if totalBytes == 0 {
-					// Write placeholder WAV header
-					headerBuf := make([]byte, WavHeaderSize)
-					if _, err := writer.Write(headerBuf); err != nil {
-						return 0, 0, 0, fmt.Errorf("write placeholder header failed: %w", err)
+				if wav == nil {
+					wav = NewWavWriter(writer, decoder.SampleRate, decoder.NumChannels, decoder.SampleBitDepth)
+					wav.RF64 = opts.rf64()
+					wav.FinalizeInterval = opts.finalizeInterval()
+					if outputFormat == F32 {
+						wav.Format = WavFormatFloat
+					}
+					if opts != nil {
+						wav.Tags = opts.Tags
 					}
 				}
-
-				if _, wErr := writer.Write(pcmBuf[:decodedN]); wErr != nil {
+				if _, wErr := wav.Write(pcmBuf[:decodedN]); wErr != nil {
 					return 0, 0, 0, wErr
 				}
-				totalBytes += decodedN
+				progress.OutputBytes = int64(wav.HeaderSize()) + wav.Size()
 			}
+			progress.Samples = decoder.TotalSamples()
+			opts.report(progress)
 		}
 
 		if readErr != nil {
@@ -154,28 +646,20 @@ func DecodeToWav(inStream io.Reader, writer io.WriteSeeker) (totalBytes int, tot
 		}
 	}
 
-	if totalBytes == 0 {
+	if wav == nil {
 		return 0, 0, 0, errors.New("no audio frames decoded")
 	}
-
-	// Update WAV header
-	if _, err := writer.Seek(0, io.SeekStart); err != nil {
-		// If we can't seek, the file will have invalid header.
-		return 0, 0, 0, fmt.Errorf("seek to start failed: %w", err)
-	}
-
-	header := GenerateWavHeader(totalBytes, decoder.SampleRate, decoder.NumChannels, decoder.SampleBitDepth)
-	if _, err := writer.Write(header); err != nil {
-		return 0, 0, 0, fmt.Errorf("write real header failed: %w", err)
+	if err := wav.Close(); err != nil {
+		return 0, 0, 0, err
 	}
 
-	// Not strictly necessary but good practice.
-	writer.Seek(0, io.SeekEnd)
-
-	totalSamples = totalBytes / (decoder.NumChannels * decoder.SampleBitDepth / 8)
-	return totalBytes + WavHeaderSize, totalSamples, decoder.SampleRate, nil
+	totalBytes = wav.Size()
+	totalSamples = totalBytes / int64(decoder.NumChannels*decoder.SampleBitDepth/8)
+	return totalBytes + int64(wav.HeaderSize()), totalSamples, decoder.SampleRate, nil
 }
 
+// GenerateWavHeader returns a WavHeaderSize byte header for pcmSize bytes of PCM data, with
+// the plain fmt chunk for any bits per sample. See GenerateWavHeaderFormat for other formats.
 func GenerateWavHeader(pcmSize int, sampleRate int, numChannels int, bitsPerSample int) []byte {
 	header := make([]byte, WavHeaderSize)
 	byteRate := sampleRate * numChannels * bitsPerSample / 8
@@ -203,60 +687,24 @@ func GenerateWavHeader(pcmSize int, sampleRate int, numChannels int, bitsPerSamp
 	return header
 }
 
-func ParseWavHeader(wavStream io.Reader) (pcmSize int, sampleRate int, numChannels int, bitsPerSample int, err error) {
-	var (
-		riffHeader    [12]byte
-		chunkHeader   [8]byte
-		fmtChunkFound bool
-	)
+// GenerateRF64Header returns a RF64HeaderSize byte header for pcmSize bytes of PCM data.
+// If the data fits a plain WAV file, the header is a RIFF header with a JUNK chunk reserving
+// the space of the ds64 chunk, otherwise a RF64 header with the sizes in the ds64 chunk.
+func GenerateRF64Header(pcmSize int64, sampleRate int, numChannels int, bitsPerSample int) []byte {
+	return wavHeader(WavFormatPCM, pcmSize, sampleRate, numChannels, bitsPerSample, true, nil)
+}
 
-	// Read RIFF header
-	if _, err := io.ReadFull(wavStream, riffHeader[:]); err != nil {
-		return 0, 0, 0, 0, fmt.Errorf("read RIFF header failed: %w", err)
-	}
-	if string(riffHeader[0:4]) != "RIFF" || string(riffHeader[8:12]) != "WAVE" {
-		return 0, 0, 0, 0, errors.New("invalid WAV header: missing RIFF/WAVE")
+// ParseWavHeader reads the header of a WAV or RF64 stream up to the start of the PCM data.
+// Writers that stream to a pipe, like arecord or ffmpeg, can not fill in the data size and
+// leave 0 or math.MaxUint32; the data of such a stream runs until EOF, unless a fact chunk
+// holds the number of sample frames. See ParseWav for the other fields of the header.
+func ParseWavHeader(wavStream io.Reader) (pcmSize int64, sampleRate int, numChannels int, bitsPerSample int, err error) {
+	info, _, err := ParseWav(wavStream)
+	if err != nil {
+		return 0, 0, 0, 0, err
 	}
-
-	// Loop chunks
-	for {
-		if _, err := io.ReadFull(wavStream, chunkHeader[:]); err != nil {
-			return 0, 0, 0, 0, fmt.Errorf("read chunk header failed: %w", err)
-		}
-		chunkID := string(chunkHeader[0:4])
-		chunkSize := binary.LittleEndian.Uint32(chunkHeader[4:8])
-
-		if chunkID == "fmt " {
-			if chunkSize < 16 {
-				return 0, 0, 0, 0, fmt.Errorf("invalid fmt chunk size: %d", chunkSize)
-			}
-			fmtData := make([]byte, chunkSize)
-			if _, err := io.ReadFull(wavStream, fmtData); err != nil {
-				return 0, 0, 0, 0, fmt.Errorf("read fmt chunk failed: %w", err)
-			}
-
-			audioFormat := binary.LittleEndian.Uint16(fmtData[0:2])
-			numChannels = int(binary.LittleEndian.Uint16(fmtData[2:4]))
-			sampleRate = int(binary.LittleEndian.Uint32(fmtData[4:8]))
-			bitsPerSample = int(binary.LittleEndian.Uint16(fmtData[14:16]))
-
-			if audioFormat != 1 {
-				return 0, 0, 0, 0, fmt.Errorf("unsupported audio format: %d (only PCM supported)", audioFormat)
-			}
-			fmtChunkFound = true
-		} else if chunkID == "data" {
-			if !fmtChunkFound {
-				return 0, 0, 0, 0, errors.New("data chunk found before fmt chunk")
-			}
-			// We found data chunk, stop parsing.
-			pcmSize = int(chunkSize)
-			break
-		} else {
-			// Skip other chunks
-			if _, err := io.CopyN(io.Discard, wavStream, int64(chunkSize)); err != nil {
-				return 0, 0, 0, 0, fmt.Errorf("skip chunk %s failed: %w", chunkID, err)
-			}
-		}
+	if info.Format != WavFormatPCM {
+		return 0, 0, 0, 0, fmt.Errorf("unsupported audio format: %d (only PCM supported)", info.Format)
 	}
-	return pcmSize, sampleRate, numChannels, bitsPerSample, nil
+	return info.DataSize, info.SampleRate, info.Channels, info.BitsPerSample, nil
 }
@@ -0,0 +1,184 @@
+//go:build cgo && !purego
+
+package mp3
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// wavSegment is a part of the input of WavOptions.Workers encoded by its own encoder.
+// Frame k*S of the output, S being the segment length in frames, is the first frame of
+// segment k. Segments after the first are resumed at that frame (see ResumeEncoder), so
+// their input starts switchDropFrames frames before it. All but the last segment are fed
+// switchDropFrames frames more than they keep, flushed and cut at the next segment's first
+// frame. The last segment is left unflushed, its encoder finishes the stream.
+type wavSegment struct {
+	enc     *Encoder
+	pcm     []byte
+	stop    int  // frame of the output of enc at which the next segment starts
+	last    bool // enc is not flushed
+	samples int64
+	out     []byte
+	err     error
+	done    chan struct{}
+}
+
+// canSplit reports whether readSegments can encode the output in parallel.
+func (o *wavOutput) canSplit() bool {
+	return o.encoder.outRate == o.encoder.inRate && !o.config.FindReplayGain
+}
+
+// readSegments is readFrom for WavOptions.Workers. On success o.encoder is the encoder of
+// the last segment, with the byte count of the whole stream for the Xing/Info frame.
+func (o *wavOutput) readSegments(ctx context.Context, r io.Reader, inputSize int64, opts *WavOptions) error {
+	frameLength := o.encoder.FrameLength
+	blockAlign := int64(o.config.NumChannels * o.format.BytesPerSample())
+	segFrames := opts.segmentFrames(o.config.SampleRate, frameLength)
+	chunkSize := opts.chunkSize()
+
+	var (
+		queue     []*wavSegment
+		pending   []byte // input from the start of the next segment
+		readBytes int64
+		prefix    int64 // output bytes of the written segments, without tags
+	)
+	defer func() {
+		for _, seg := range queue {
+			<-seg.done
+			if seg.enc != o.encoder {
+				seg.enc.Close()
+			}
+		}
+	}()
+	write := func() error {
+		seg := queue[0]
+		queue = queue[1:]
+		<-seg.done
+		if seg.err != nil {
+			if seg.enc != o.encoder {
+				seg.enc.Close()
+			}
+			return seg.err
+		}
+		if len(seg.out) > 0 {
+			if _, err := o.writer.Write(seg.out); err != nil {
+				if seg.enc != o.encoder {
+					seg.enc.Close()
+				}
+				return err
+			}
+		}
+		o.totalBytes += int64(len(seg.out))
+		progress := Progress{InputSize: inputSize, InputBytes: seg.samples * blockAlign, OutputBytes: o.totalBytes, Samples: seg.samples}
+		if seg.last {
+			if seg.enc != o.encoder {
+				o.encoder.Close()
+				o.encoder = seg.enc
+				o.encoder.resumeBytes += prefix
+			}
+			progress.InputBytes = readBytes
+			progress.Samples = o.encoder.TotalSamples()
+		} else {
+			prefix += int64(len(seg.out))
+			if seg.enc != o.encoder {
+				seg.enc.Close()
+			}
+		}
+		opts.report(progress)
+		return nil
+	}
+
+	for k := 0; ; k++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if len(queue) == opts.workers() {
+			if err := write(); err != nil {
+				return err
+			}
+		}
+		start := int64(0)
+		if k > 0 {
+			start = int64(k*segFrames-switchDropFrames) * int64(frameLength)
+		}
+		end := int64((k+1)*segFrames+switchDropFrames) * int64(frameLength)
+		buf := make([]byte, (end-start)*blockAlign)
+		copy(buf, pending)
+		n, err := io.ReadFull(r, buf[len(pending):])
+		readBytes += int64(n)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		buf = buf[:len(pending)+n]
+		next := int64((k+1)*segFrames) * int64(frameLength)
+		if !last {
+			pending = buf[(next-int64(switchDropFrames)*int64(frameLength)-start)*blockAlign:]
+		}
+
+		seg := &wavSegment{
+			enc:     o.encoder,
+			pcm:     buf,
+			stop:    segFrames,
+			last:    last,
+			samples: next,
+			done:    make(chan struct{}),
+		}
+		if k == 0 {
+			seg.stop += o.encoder.infoFrames
+		} else {
+			cp := &EncoderCheckpoint{Frames: k * segFrames, Samples: start}
+			if seg.enc, err = ResumeEncoder(o.config, cp); err != nil {
+				return err
+			}
+		}
+		queue = append(queue, seg)
+		go func() {
+			defer close(seg.done)
+			seg.err = encodeSegment(seg, o.format, chunkSize)
+		}()
+		if last {
+			break
+		}
+	}
+	for len(queue) > 0 {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeSegment encodes the PCM of seg into seg.out.
+func encodeSegment(seg *wavSegment, format SampleFormat, chunkSize int) error {
+	buf := GetOutBuf(seg.enc.EstimateOutBufBytes(chunkSize))
+	defer PutOutBuf(buf)
+	for pcm := seg.pcm; len(pcm) > 0; {
+		n := min(chunkSize, len(pcm))
+		encoded, err := seg.enc.EncodeSamples(format, pcm[:n], buf)
+		if err != nil {
+			return err
+		}
+		seg.out = append(seg.out, buf[:encoded]...)
+		pcm = pcm[n:]
+	}
+	seg.pcm = nil
+	if seg.last {
+		return nil
+	}
+
+	encoded, err := seg.enc.Flush(buf)
+	if err != nil {
+		return err
+	}
+	seg.out = append(seg.out, buf[:encoded]...)
+	var tracker frameTracker
+	cut := tracker.split(seg.out, seg.stop)
+	if cut < 0 {
+		return fmt.Errorf("segment output ends before frame %d", seg.stop)
+	}
+	seg.out = seg.out[:cut]
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !cgo || purego
+
+package mp3
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// canSplit reports whether readSegments can encode the output in parallel, which needs
+// ResumeEncoder of the LAME build.
+func (o *wavOutput) canSplit() bool {
+	return false
+}
+
+func (o *wavOutput) readSegments(ctx context.Context, r io.Reader, inputSize int64, opts *WavOptions) error {
+	return errors.New("parallel encoding is not supported by encoder backend")
+}
@@ -0,0 +1,342 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WavFormat is the format code of the samples of a WAV stream.
+type WavFormat uint16
+
+const (
+	WavFormatPCM   WavFormat = 1 // integer PCM
+	WavFormatFloat WavFormat = 3 // IEEE float
+	WavFormatALaw  WavFormat = 6 // G.711 A-law
+	WavFormatMuLaw WavFormat = 7 // G.711 µ-law
+)
+
+func (f WavFormat) String() string {
+	switch f {
+	case WavFormatPCM:
+		return "PCM"
+	case WavFormatFloat:
+		return "float"
+	case WavFormatALaw:
+		return "A-law"
+	case WavFormatMuLaw:
+		return "µ-law"
+	}
+	return fmt.Sprintf("WavFormat(%#04x)", uint16(f))
+}
+
+// WavInfo describes a WAV or RF64 stream as read by ParseWav.
+type WavInfo struct {
+	// Format is the format code of the fmt chunk, the sub format for WAVE_FORMAT_EXTENSIBLE.
+	Format        WavFormat
+	Channels      int
+	SampleRate    int
+	BitsPerSample int
+
+	// RF64 is set for a RF64 stream, its data size is taken from the ds64 chunk.
+	RF64 bool
+
+	// DataSize is the size of the data chunk. Writers that stream to a pipe, like arecord or
+	// ffmpeg, can not fill it in and leave 0 or math.MaxUint32, see Streaming. If the fact
+	// chunk holds the number of sample frames, the size is computed from it instead.
+	DataSize int64
+	// DataOffset is the offset of the samples from the start of the stream.
+	DataOffset int64
+
+	// SampleFrames is the number of sample frames per channel of the fact chunk, which
+	// non-PCM formats like float or G.711 have. It is 0 without a fact chunk.
+	SampleFrames int64
+
+	// Sampler holds the loops and root note of a smpl chunk before the data chunk, e.g. of
+	// an instrument sample. It is nil without a smpl chunk.
+	Sampler *WavSampler
+
+	// Chunks lists the chunks before the data chunk except fmt and ds64, e.g. LIST or bext.
+	Chunks []WavChunk
+
+	// Metadata holds the text of a LIST/INFO chunk before the data chunk by sub chunk ID,
+	// e.g. INAM for the title or IART for the artist, see TrackTags. Empty fields are left
+	// out. It is nil without a LIST/INFO chunk.
+	Metadata map[string]string
+}
+
+// WavChunk is the position of a chunk of a WAV stream.
+type WavChunk struct {
+	ID     string // four character chunk ID
+	Offset int64  // offset of the chunk data from the start of the stream
+	Size   int64  // size of the chunk data
+}
+
+// WavSampler is the content of a smpl chunk. It has JSON and YAML tags, so it can be stored
+// in a sidecar file next to the mp3 made from the WAV.
+type WavSampler struct {
+	// RootNote is the MIDI note played by the sample at its sample rate, 60 is middle C.
+	RootNote int `json:"root_note" yaml:"root_note"`
+	// PitchFraction raises the root note by PitchFraction/2^32 semitones.
+	PitchFraction uint32 `json:"pitch_fraction,omitempty" yaml:"pitch_fraction,omitempty"`
+
+	Loops []WavLoop `json:"loops,omitempty" yaml:"loops,omitempty"`
+}
+
+// WavLoop is a loop of a smpl chunk. Start and End are sample frames of the WAV data; an
+// mp3 encoded from it starts EncodeResult.Delay samples later, which players that honor
+// the gapless info skip.
+type WavLoop struct {
+	ID        uint32 `json:"id" yaml:"id"`
+	Type      int    `json:"type" yaml:"type"`                                 // 0 forward, 1 alternating, 2 backward
+	Start     int64  `json:"start" yaml:"start"`                               // first sample frame
+	End       int64  `json:"end" yaml:"end"`                                   // last sample frame, played too
+	PlayCount int    `json:"play_count,omitempty" yaml:"play_count,omitempty"` // 0 loops forever
+}
+
+// parseSmpl returns the content of a smpl chunk, nil if it is too short.
+func parseSmpl(data []byte) *WavSampler {
+	if len(data) < 36 {
+		return nil
+	}
+	s := &WavSampler{
+		RootNote:      int(binary.LittleEndian.Uint32(data[12:16])),
+		PitchFraction: binary.LittleEndian.Uint32(data[16:20]),
+	}
+	n := int(binary.LittleEndian.Uint32(data[28:32]))
+	for p := 36; n > 0 && p+24 <= len(data); p += 24 {
+		s.Loops = append(s.Loops, WavLoop{
+			ID:        binary.LittleEndian.Uint32(data[p:]),
+			Type:      int(binary.LittleEndian.Uint32(data[p+4:])),
+			Start:     int64(binary.LittleEndian.Uint32(data[p+8:])),
+			End:       int64(binary.LittleEndian.Uint32(data[p+12:])),
+			PlayCount: int(binary.LittleEndian.Uint32(data[p+20:])),
+		})
+		n--
+	}
+	return s
+}
+
+// Streaming reports whether the data size is a placeholder, so the data runs until EOF.
+func (info *WavInfo) Streaming() bool {
+	return info.DataSize == 0 || info.DataSize == math.MaxUint32
+}
+
+// ParseWav reads the header of a WAV or RF64 stream up to the start of the samples. It
+// returns the format and a reader of the data chunk, which reads a streaming WAV until EOF.
+// Unlike ParseWavHeader any format code is accepted.
+func ParseWav(r io.Reader) (*WavInfo, io.Reader, error) {
+	var (
+		info          WavInfo
+		riffHeader    [12]byte
+		chunkHeader   [8]byte
+		fmtChunkFound bool
+		ds64DataSize  int64 = -1
+		ds64Frames    int64
+		pos           int64 = 12 // offset of the next chunk
+	)
+
+	// Read RIFF header
+	if _, err := io.ReadFull(r, riffHeader[:]); err != nil {
+		return nil, nil, fmt.Errorf("read RIFF header failed: %w", err)
+	}
+	info.RF64 = string(riffHeader[0:4]) == "RF64"
+	if (string(riffHeader[0:4]) != "RIFF" && !info.RF64) || string(riffHeader[8:12]) != "WAVE" {
+		return nil, nil, errors.New("invalid WAV header: missing RIFF/WAVE")
+	}
+
+	// Loop chunks
+	for {
+		if _, err := io.ReadFull(r, chunkHeader[:]); err != nil {
+			return nil, nil, fmt.Errorf("read chunk header failed: %w", err)
+		}
+		chunkID := string(chunkHeader[0:4])
+		chunkSize := binary.LittleEndian.Uint32(chunkHeader[4:8])
+		pos += 8
+
+		if chunkID == "fmt " {
+			if chunkSize < 16 {
+				return nil, nil, fmt.Errorf("invalid fmt chunk size: %d", chunkSize)
+			}
+			// Only the first 16 bytes and the WAVE_FORMAT_EXTENSIBLE sub format are used,
+			// skip anything else without allocating chunkSize
+			var fmtData [40]byte
+			n := min(int(chunkSize), len(fmtData))
+			if _, err := io.ReadFull(r, fmtData[:n]); err != nil {
+				return nil, nil, fmt.Errorf("read fmt chunk failed: %w", err)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(chunkSize)-int64(n)); err != nil {
+				return nil, nil, fmt.Errorf("read fmt chunk failed: %w", err)
+			}
+
+			info.Format = WavFormat(binary.LittleEndian.Uint16(fmtData[0:2]))
+			info.Channels = int(binary.LittleEndian.Uint16(fmtData[2:4]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(fmtData[4:8]))
+			info.BitsPerSample = int(binary.LittleEndian.Uint16(fmtData[14:16]))
+			if info.Format == wavFormatExtensible && n == len(fmtData) {
+				// Multichannel files use the extensible format, the sub format GUID starts
+				// with the format code
+				info.Format = WavFormat(binary.LittleEndian.Uint16(fmtData[24:26]))
+			}
+			fmtChunkFound = true
+		} else if chunkID == "ds64" && info.RF64 {
+			if chunkSize < 28 {
+				return nil, nil, fmt.Errorf("invalid ds64 chunk size: %d", chunkSize)
+			}
+			var ds64Data [28]byte
+			if _, err := io.ReadFull(r, ds64Data[:]); err != nil {
+				return nil, nil, fmt.Errorf("read ds64 chunk failed: %w", err)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(chunkSize)-28); err != nil {
+				return nil, nil, fmt.Errorf("read ds64 chunk failed: %w", err)
+			}
+			dataSize := binary.LittleEndian.Uint64(ds64Data[8:16])
+			if dataSize > math.MaxInt64 {
+				return nil, nil, fmt.Errorf("invalid ds64 data size: %d", dataSize)
+			}
+			ds64DataSize = int64(dataSize)
+			ds64Frames = int64(min(binary.LittleEndian.Uint64(ds64Data[16:24]), math.MaxInt64))
+		} else if chunkID == "data" {
+			if !fmtChunkFound {
+				return nil, nil, errors.New("data chunk found before fmt chunk")
+			}
+			// We found data chunk, stop parsing.
+			info.DataSize = int64(chunkSize)
+			if info.RF64 && chunkSize == math.MaxUint32 {
+				if ds64DataSize < 0 {
+					return nil, nil, errors.New("RF64 data chunk without ds64 chunk")
+				}
+				info.DataSize = ds64DataSize
+			}
+			if info.RF64 && info.SampleFrames == math.MaxUint32 {
+				info.SampleFrames = ds64Frames
+			}
+			// A placeholder size with a valid fact chunk, e.g. from a writer that could not
+			// seek back to the data chunk
+			blockAlign := int64(info.Channels * ((info.BitsPerSample + 7) / 8))
+			if info.Streaming() && info.SampleFrames > 0 && info.SampleFrames < math.MaxUint32 {
+				info.DataSize = info.SampleFrames * blockAlign
+			}
+			info.DataOffset = pos
+			break
+		} else if chunkID == "fact" && chunkSize >= 4 {
+			var factData [4]byte
+			if _, err := io.ReadFull(r, factData[:]); err != nil {
+				return nil, nil, fmt.Errorf("read fact chunk failed: %w", err)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(chunkSize)-4); err != nil {
+				return nil, nil, fmt.Errorf("read fact chunk failed: %w", err)
+			}
+			info.SampleFrames = int64(binary.LittleEndian.Uint32(factData[:]))
+			info.Chunks = append(info.Chunks, WavChunk{ID: chunkID, Offset: pos, Size: int64(chunkSize)})
+		} else if chunkID == "smpl" && chunkSize <= maxMetaChunkSize {
+			smpl := make([]byte, chunkSize)
+			if _, err := io.ReadFull(r, smpl); err != nil {
+				return nil, nil, fmt.Errorf("read smpl chunk failed: %w", err)
+			}
+			info.Sampler = parseSmpl(smpl)
+			info.Chunks = append(info.Chunks, WavChunk{ID: chunkID, Offset: pos, Size: int64(chunkSize)})
+		} else if chunkID == "LIST" && chunkSize <= maxMetaChunkSize {
+			list := make([]byte, chunkSize)
+			if _, err := io.ReadFull(r, list); err != nil {
+				return nil, nil, fmt.Errorf("read LIST chunk failed: %w", err)
+			}
+			for id, text := range parseInfoList(list) {
+				if info.Metadata == nil {
+					info.Metadata = make(map[string]string)
+				}
+				info.Metadata[id] = text
+			}
+			info.Chunks = append(info.Chunks, WavChunk{ID: chunkID, Offset: pos, Size: int64(chunkSize)})
+		} else {
+			// Skip other chunks
+			if _, err := io.CopyN(io.Discard, r, int64(chunkSize)); err != nil {
+				return nil, nil, fmt.Errorf("skip chunk %s failed: %w", chunkID, err)
+			}
+			info.Chunks = append(info.Chunks, WavChunk{ID: chunkID, Offset: pos, Size: int64(chunkSize)})
+		}
+		pos += int64(chunkSize)
+
+		// Chunks start at even offsets, odd sized chunks are followed by a pad byte
+		if chunkSize%2 == 1 {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return nil, nil, fmt.Errorf("skip chunk %s failed: %w", chunkID, err)
+			}
+			pos++
+		}
+	}
+
+	// Limit the reader to the data size to avoid reading trailing metadata as audio
+	data := r
+	if !info.Streaming() {
+		data = io.LimitReader(r, info.DataSize)
+	}
+	return &info, data, nil
+}
+
+// WavReader reads the samples of a WAV or RF64 stream. The header is parsed by the first
+// call of a method, so a WavReader can be created before the stream has data, e.g. for a
+// pipe. Read returns the bytes of the data chunk only, without the chunks around it.
+// The format methods return zero values if the header is invalid, see Info for the error.
+type WavReader struct {
+	r    io.Reader
+	info *WavInfo
+	data io.Reader
+	err  error
+}
+
+// NewWavReader creates a WavReader for the stream r.
+func NewWavReader(r io.Reader) *WavReader {
+	return &WavReader{r: r}
+}
+
+// Info parses the header if needed and returns it.
+func (w *WavReader) Info() (*WavInfo, error) {
+	if w.info == nil && w.err == nil {
+		w.info, w.data, w.err = ParseWav(w.r)
+	}
+	return w.info, w.err
+}
+
+// Format returns the format code of the samples.
+func (w *WavReader) Format() WavFormat {
+	if info, err := w.Info(); err == nil {
+		return info.Format
+	}
+	return 0
+}
+
+// SampleRate returns the sample rate in Hz.
+func (w *WavReader) SampleRate() int {
+	if info, err := w.Info(); err == nil {
+		return info.SampleRate
+	}
+	return 0
+}
+
+// Channels returns the number of channels.
+func (w *WavReader) Channels() int {
+	if info, err := w.Info(); err == nil {
+		return info.Channels
+	}
+	return 0
+}
+
+// BitsPerSample returns the size of a sample in bits.
+func (w *WavReader) BitsPerSample() int {
+	if info, err := w.Info(); err == nil {
+		return info.BitsPerSample
+	}
+	return 0
+}
+
+// Read reads interleaved samples as stored in the data chunk. It returns io.EOF at the end
+// of the data chunk, or the error of parsing the header.
+func (w *WavReader) Read(p []byte) (int, error) {
+	if _, err := w.Info(); err != nil {
+		return 0, err
+	}
+	return w.data.Read(p)
+}
@@ -0,0 +1,233 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestParseWav(t *testing.T) {
+	// A WAV file with a LIST chunk between fmt and data and trailing metadata
+	pcm := generateSineWave(440, 22050, 1, 1000)
+	header := mp3.GenerateWavHeader(len(pcm), 22050, 1, 16)
+	list := []byte("LIST\x0c\x00\x00\x00INFOISFT\x00\x00\x00\x00")
+	var b bytes.Buffer
+	b.Write(header[:36])
+	b.Write(list)
+	b.Write(header[36:])
+	b.Write(pcm)
+	b.WriteString("id3 \x04\x00\x00\x00ID3\x00")
+
+	info, data, err := mp3.ParseWav(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ParseWav failed: %v", err)
+	}
+	want := mp3.WavInfo{
+		Format:        mp3.WavFormatPCM,
+		Channels:      1,
+		SampleRate:    22050,
+		BitsPerSample: 16,
+		DataSize:      int64(len(pcm)),
+		DataOffset:    int64(mp3.WavHeaderSize + len(list)),
+		Chunks:        []mp3.WavChunk{{ID: "LIST", Offset: 44, Size: 12}},
+	}
+	if !reflect.DeepEqual(*info, want) {
+		t.Errorf("ParseWav = %+v, want %+v", info, want)
+	}
+	if got, _ := io.ReadAll(data); !bytes.Equal(got, pcm) {
+		t.Errorf("Data reader returned %d bytes, want the %d bytes of PCM", len(got), len(pcm))
+	}
+	if !bytes.Equal(b.Bytes()[info.DataOffset:info.DataOffset+info.DataSize], pcm) {
+		t.Error("DataOffset does not point at the PCM data")
+	}
+	t.Logf("✓ %v %d Hz, data at %d, chunks %+v", info.Format, info.SampleRate, info.DataOffset, info.Chunks)
+
+	// RF64 headers hold a ds64 or a JUNK chunk, streaming WAVs have no data size
+	info, _, err = mp3.ParseWav(bytes.NewReader(mp3.GenerateRF64Header(5<<30, 44100, 2, 16)))
+	if err != nil || !info.RF64 || info.DataSize != 5<<30 || info.DataOffset != mp3.RF64HeaderSize {
+		t.Errorf("ParseWav(RF64) = %+v, %v", info, err)
+	}
+	streaming := mp3.GenerateWavHeader(0, 8000, 1, 8)
+	binary.LittleEndian.PutUint16(streaming[20:], uint16(mp3.WavFormatMuLaw))
+	binary.LittleEndian.PutUint32(streaming[40:], math.MaxUint32)
+	info, data, err = mp3.ParseWav(io.MultiReader(bytes.NewReader(streaming), bytes.NewReader(make([]byte, 5000))))
+	if err != nil || info.Format != mp3.WavFormatMuLaw || !info.Streaming() {
+		t.Fatalf("ParseWav(streaming) = %+v, %v", info, err)
+	}
+	if n, _ := io.Copy(io.Discard, data); n != 5000 {
+		t.Errorf("Streaming data reader returned %d bytes, want 5000", n)
+	}
+	if s := info.Format.String(); s != "µ-law" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestWavReader(t *testing.T) {
+	requireNative(t)
+	// An odd sized chunk is followed by a pad byte
+	pcm := generateSineWave(440, 44100, 2, 4410)
+	header := mp3.GenerateWavHeader(len(pcm), 44100, 2, 16)
+	var b bytes.Buffer
+	b.Write(header[:36])
+	b.WriteString("junk\x03\x00\x00\x00abc\x00")
+	b.Write(header[36:])
+	b.Write(pcm)
+	b.WriteString("\x00LIST")
+
+	r := mp3.NewWavReader(bytes.NewReader(b.Bytes()))
+	if r.Format() != mp3.WavFormatPCM || r.SampleRate() != 44100 || r.Channels() != 2 || r.BitsPerSample() != 16 {
+		t.Fatalf("Unexpected format %v %d Hz %d channels %d bits", r.Format(), r.SampleRate(), r.Channels(), r.BitsPerSample())
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, pcm) {
+		t.Fatalf("ReadAll = %d bytes, %v, want %d bytes of PCM", len(got), err, len(pcm))
+	}
+
+	// EncodeFromWav continues a WavReader after its header
+	want, err := mp3.EncodeFromWav(bytes.NewReader(b.Bytes()), io.Discard, nil, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	r = mp3.NewWavReader(bytes.NewReader(b.Bytes()))
+	if r.Channels() != 2 {
+		t.Fatal("Header not parsed")
+	}
+	result, err := mp3.EncodeFromWav(r, io.Discard, nil, nil)
+	if err != nil || result.Frames != want.Frames {
+		t.Errorf("EncodeFromWav(WavReader) = %+v, %v, want %d frames", result, err, want.Frames)
+	}
+
+	r = mp3.NewWavReader(bytes.NewReader([]byte("RIFF")))
+	if _, err := r.Read(make([]byte, 10)); err == nil || r.SampleRate() != 0 {
+		t.Errorf("Read of a truncated header = %v, sample rate %d", err, r.SampleRate())
+	}
+	t.Logf("✓ WavReader read %d bytes of PCM", len(got))
+}
+
+func TestWavMetadata(t *testing.T) {
+	requireNative(t)
+	tags := &mp3.TrackTags{Title: "Morning", Artist: "Field Recorder", Album: "Birds", Year: 2024, Genre: "Ambient", TrackNumber: 3, TrackTotal: 12}
+	pcm := generateSineWave(440, 44100, 2, 44100)
+
+	// WavWriter writes the tags as LIST/INFO chunk, ParseWav reads them back
+	var file mp3.SeekableBuffer
+	w := mp3.NewWavWriter(&file, 44100, 2, 16)
+	w.Tags = tags
+	if _, err := w.Write(pcm); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	info, data, err := mp3.ParseWav(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatalf("ParseWav failed: %v", err)
+	}
+	if info.Metadata["INAM"] != "Morning" || info.Metadata["ICRD"] != "2024" || info.Metadata["ITRK"] != "3/12" {
+		t.Errorf("Metadata = %v", info.Metadata)
+	}
+	if got := info.TrackTags(); !reflect.DeepEqual(got, tags) {
+		t.Errorf("TrackTags = %+v, want %+v", got, tags)
+	}
+	if got, _ := io.ReadAll(data); !bytes.Equal(got, pcm) || int(info.DataOffset) != w.HeaderSize() {
+		t.Errorf("Data at %d, header of %d bytes", info.DataOffset, w.HeaderSize())
+	}
+
+	// EncodeFromWav copies them into the ID3v2 tag, EncoderConfig.Tags takes precedence
+	var out mp3.SeekableBuffer
+	config := &mp3.EncoderConfig{Bitrate: 128, Tags: &mp3.TrackTags{Artist: "Someone Else"}}
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(file.Bytes()), &out, config, &mp3.WavOptions{CopyMetadata: true}); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+	tag, err := mp3.ReadID3v2(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	if tag.Text("TIT2") != "Morning" || tag.Text("TPE1") != "Someone Else" || tag.Text("TRCK") != "3/12" {
+		t.Errorf("ID3v2 title %q artist %q track %q", tag.Text("TIT2"), tag.Text("TPE1"), tag.Text("TRCK"))
+	}
+	if config.Tags.Title != "" {
+		t.Error("EncodeFromWav modified config.Tags")
+	}
+
+	// DecodeToWav writes opts.Tags
+	var wav mp3.SeekableBuffer
+	if _, _, _, err := mp3.DecodeToWav(bytes.NewReader(out.Bytes()), &wav, &mp3.WavOptions{Tags: tags}); err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	if info, _, err = mp3.ParseWav(bytes.NewReader(wav.Bytes())); err != nil || info.Metadata["IART"] != "Field Recorder" {
+		t.Errorf("ParseWav(DecodeToWav) = %+v, %v", info, err)
+	}
+	t.Logf("✓ LIST/INFO metadata %v", info.Metadata)
+}
+
+func TestParseWavFact(t *testing.T) {
+	// A float header of a writer that could not patch the data size, followed by trailing chunks
+	f32 := make([]byte, 4*2*1000)
+	header := mp3.GenerateWavHeaderFormat(mp3.WavFormatFloat, int64(len(f32)), 44100, 2, 32)
+	binary.LittleEndian.PutUint32(header[len(header)-4:], math.MaxUint32)
+	wav := append(append(header, f32...), "LIST\x04\x00\x00\x00INFO"...)
+	info, data, err := mp3.ParseWav(bytes.NewReader(wav))
+	if err != nil || info.SampleFrames != 1000 || info.DataSize != int64(len(f32)) || info.Streaming() {
+		t.Fatalf("ParseWav = %+v, %v", info, err)
+	}
+	if n, _ := io.Copy(io.Discard, data); n != int64(len(f32)) {
+		t.Errorf("Data reader returned %d bytes, want %d", n, len(f32))
+	}
+
+	// ParseWavHeader uses the fact chunk of PCM too
+	pcm := generateSineWave(440, 8000, 1, 800)
+	header = mp3.GenerateWavHeader(0, 8000, 1, 16)
+	var b bytes.Buffer
+	b.Write(header[:36])
+	b.WriteString("fact\x04\x00\x00\x00\x20\x03\x00\x00")
+	b.Write(header[36:])
+	b.Write(pcm)
+	pcmSize, _, _, _, err := mp3.ParseWavHeader(bytes.NewReader(b.Bytes()))
+	if err != nil || pcmSize != int64(len(pcm)) {
+		t.Errorf("ParseWavHeader = %d, %v, want %d", pcmSize, err, len(pcm))
+	}
+
+	// A fact chunk of 0 frames is a placeholder too
+	header = mp3.GenerateWavHeaderFormat(mp3.WavFormatFloat, 0, 44100, 2, 32)
+	binary.LittleEndian.PutUint32(header[len(header)-4:], math.MaxUint32)
+	if info, _, err = mp3.ParseWav(bytes.NewReader(header)); err != nil || !info.Streaming() {
+		t.Errorf("ParseWav(streaming) = %+v, %v", info, err)
+	}
+	t.Logf("✓ fact chunk of %d frames", info.SampleFrames)
+}
+
+func TestParseWavSmpl(t *testing.T) {
+	// A smpl chunk with root note 69 (A4) and one forward loop over frames 100 to 899
+	smpl := make([]byte, 60)
+	binary.LittleEndian.PutUint32(smpl[12:], 69)
+	binary.LittleEndian.PutUint32(smpl[28:], 1)
+	binary.LittleEndian.PutUint32(smpl[44:], 100)
+	binary.LittleEndian.PutUint32(smpl[48:], 899)
+	pcm := generateSineWave(440, 44100, 1, 1000)
+	header := mp3.GenerateWavHeader(len(pcm), 44100, 1, 16)
+	var b bytes.Buffer
+	b.Write(header[:36])
+	b.WriteString("smpl\x3c\x00\x00\x00")
+	b.Write(smpl)
+	b.Write(header[36:])
+	b.Write(pcm)
+
+	info, _, err := mp3.ParseWav(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatalf("ParseWav failed: %v", err)
+	}
+	want := &mp3.WavSampler{RootNote: 69, Loops: []mp3.WavLoop{{Start: 100, End: 899}}}
+	if !reflect.DeepEqual(info.Sampler, want) {
+		t.Errorf("Sampler = %+v, want %+v", info.Sampler, want)
+	}
+	if info, _, _ = mp3.ParseWav(bytes.NewReader(header)); info.Sampler != nil {
+		t.Errorf("Sampler without smpl chunk = %+v", info.Sampler)
+	}
+	t.Logf("✓ smpl root note %d, loops %+v", want.RootNote, want.Loops)
+}
@@ -0,0 +1,143 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// maxMetaChunkSize is the largest LIST/INFO or smpl chunk ParseWav reads into WavInfo,
+// larger chunks are skipped like other chunks.
+const maxMetaChunkSize = 1 << 20
+
+// parseInfoList returns the text of the sub chunks of a LIST/INFO chunk by ID, without
+// the NUL terminator. Empty values are left out. data starts with the list type.
+func parseInfoList(data []byte) map[string]string {
+	if len(data) < 4 || string(data[0:4]) != "INFO" {
+		return nil
+	}
+	var m map[string]string
+	for p := 4; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		size := int(binary.LittleEndian.Uint32(data[p+4:]))
+		p += 8
+		if size > len(data)-p {
+			break
+		}
+		text := data[p : p+size]
+		if i := bytes.IndexByte(text, 0); i >= 0 {
+			text = text[:i]
+		}
+		if s := strings.TrimSpace(string(text)); s != "" {
+			if m == nil {
+				m = make(map[string]string)
+			}
+			m[id] = s
+		}
+		p += size + size%2
+	}
+	return m
+}
+
+// TrackTags returns the fields of Metadata that TrackTags holds: INAM, IART, IPRD, ICRD,
+// IGNR and ITRK. It returns nil if there are none.
+func (info *WavInfo) TrackTags() *TrackTags {
+	m := info.Metadata
+	tags := TrackTags{
+		Title:  m["INAM"],
+		Artist: m["IART"],
+		Album:  m["IPRD"],
+		Genre:  m["IGNR"],
+	}
+	// ICRD is a date like 2006-01-02, the year comes first
+	if d := m["ICRD"]; len(d) >= 4 {
+		tags.Year, _ = strconv.Atoi(d[:4])
+	}
+	if t := m["ITRK"]; t != "" {
+		number, total, _ := strings.Cut(t, "/")
+		tags.TrackNumber, _ = strconv.Atoi(number)
+		tags.TrackTotal, _ = strconv.Atoi(total)
+	}
+	if tags.Title+tags.Artist+tags.Album+tags.Genre == "" && tags.Year == 0 && tags.TrackNumber == 0 {
+		return nil
+	}
+	return &tags
+}
+
+// mergeTrackTags returns the tags of base with the set fields of m replacing them.
+func mergeTrackTags(base, m *TrackTags) *TrackTags {
+	if base == nil {
+		return m
+	}
+	if m == nil {
+		return base
+	}
+	merged := *base
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.Title, m.Title},
+		{&merged.Artist, m.Artist},
+		{&merged.Album, m.Album},
+		{&merged.Genre, m.Genre},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	if m.Year > 0 {
+		merged.Year = m.Year
+	}
+	if m.TrackNumber > 0 {
+		merged.TrackNumber, merged.TrackTotal = m.TrackNumber, m.TrackTotal
+	}
+	if len(m.AlbumArt) > 0 {
+		merged.AlbumArt = m.AlbumArt
+	}
+	return &merged
+}
+
+// infoListChunk returns the LIST/INFO chunk holding the text fields of m, nil if it has
+// none. AlbumArt can not be stored in a WAV file and is left out.
+func infoListChunk(m *TrackTags) []byte {
+	if m == nil {
+		return nil
+	}
+	var year, track string
+	if m.Year > 0 {
+		year = strconv.Itoa(m.Year)
+	}
+	if m.TrackNumber > 0 {
+		track = strconv.Itoa(m.TrackNumber)
+		if m.TrackTotal > 0 {
+			track += "/" + strconv.Itoa(m.TrackTotal)
+		}
+	}
+
+	list := []byte("LIST\x00\x00\x00\x00INFO")
+	for _, f := range []struct{ id, text string }{
+		{"INAM", m.Title},
+		{"IART", m.Artist},
+		{"IPRD", m.Album},
+		{"ICRD", year},
+		{"IGNR", m.Genre},
+		{"ITRK", track},
+	} {
+		if f.text == "" {
+			continue
+		}
+		// The text is NUL terminated and padded to an even size
+		size := len(f.text) + 1
+		list = append(list, f.id...)
+		list = binary.LittleEndian.AppendUint32(list, uint32(size))
+		list = append(list, f.text...)
+		list = append(list, make([]byte, 1+size%2)...)
+	}
+	if len(list) == 12 {
+		return nil
+	}
+	binary.LittleEndian.PutUint32(list[4:8], uint32(len(list)-8))
+	return list
+}
@@ -0,0 +1,240 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// WavWriter writes PCM samples as a WAV stream, e.g. the output of a Decoder. The header is
+// written with the first samples. If the destination is an io.WriteSeeker, like a file,
+// Close patches the sizes into the header. Otherwise the header holds the streaming sizes
+// math.MaxUint32, which ParseWav and most players read until EOF, so the output can be
+// piped to stdout or an HTTP response.
+type WavWriter struct {
+	// RF64 reserves room for a ds64 chunk, so output of more than 4 GB to an io.WriteSeeker
+	// is written as RF64, see WavOptions.RF64. Without it, Write fails with ErrorWavTooLarge.
+	// Set it before the first Write.
+	RF64 bool
+
+	// Format is the format code of the samples, 0 is WavFormatPCM. The header is made by
+	// GenerateWavHeaderFormat. Set it before the first Write.
+	Format WavFormat
+
+	// Tags is written as a LIST/INFO chunk in front of the samples, see WavOptions.Tags.
+	// Set it before the first Write.
+	Tags *TrackTags
+
+	// FinalizeInterval makes Write update the header of an io.WriteSeeker about every
+	// FinalizeInterval of audio, see WavOptions.FinalizeInterval. Set it before the first Write.
+	FinalizeInterval time.Duration
+
+	w             io.Writer
+	seeker        io.WriteSeeker
+	sampleRate    int
+	numChannels   int
+	bitsPerSample int
+	size          int64 // PCM bytes written
+	started       bool  // the header was written
+	finalizeBytes int64 // PCM bytes between header updates, 0 if disabled
+	nextFinalize  int64
+}
+
+// NewWavWriter creates a WavWriter for samples of the given format. It does not write
+// anything before the first Write or Close.
+func NewWavWriter(w io.Writer, sampleRate, numChannels, bitsPerSample int) *WavWriter {
+	seeker, _ := w.(io.WriteSeeker)
+	return &WavWriter{
+		w:             w,
+		seeker:        seeker,
+		sampleRate:    sampleRate,
+		numChannels:   numChannels,
+		bitsPerSample: bitsPerSample,
+	}
+}
+
+// Write writes interleaved samples in the format of the WavWriter.
+func (w *WavWriter) Write(p []byte) (int, error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	if w.seeker != nil && !w.RF64 && int64(w.HeaderSize()-8)+w.size+int64(len(p)) > math.MaxUint32 {
+		return 0, fmt.Errorf("%w, use RF64", ErrorWavTooLarge)
+	}
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.finalizeBytes > 0 && w.size >= w.nextFinalize {
+		if err := updateWavHeader(w.seeker, w.header(w.size), true); err != nil {
+			return n, err
+		}
+		w.nextFinalize = w.size + w.finalizeBytes
+	}
+	return n, nil
+}
+
+// Close writes the final header, or the header of an empty WAV if nothing was written.
+// It does not close the destination.
+func (w *WavWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	if w.seeker == nil {
+		return nil
+	}
+	return updateWavHeader(w.seeker, w.header(w.size), false)
+}
+
+// Size returns the number of PCM bytes written.
+func (w *WavWriter) Size() int64 {
+	return w.size
+}
+
+// HeaderSize returns the size of the header, e.g. WavHeaderSize for 16-bit PCM or
+// RF64HeaderSize with RF64.
+func (w *WavWriter) HeaderSize() int {
+	return len(w.header(0))
+}
+
+// start writes the placeholder header if it was not written yet.
+func (w *WavWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	var header []byte
+	switch {
+	case w.seeker == nil:
+		header = w.header(0)
+		binary.LittleEndian.PutUint32(header[4:8], math.MaxUint32)
+		binary.LittleEndian.PutUint32(header[len(header)-4:], math.MaxUint32)
+	case w.FinalizeInterval > 0:
+		// A valid empty header, it is updated on the way
+		bytesPerSecond := int64(w.sampleRate * w.numChannels * w.bitsPerSample / 8)
+		w.finalizeBytes = max(int64(w.FinalizeInterval)*bytesPerSecond/int64(time.Second), 1)
+		w.nextFinalize = w.finalizeBytes
+		header = w.header(0)
+	default:
+		header = make([]byte, w.HeaderSize())
+	}
+	if _, err := w.w.Write(header); err != nil {
+		return fmt.Errorf("write placeholder header failed: %w", err)
+	}
+	return nil
+}
+
+func (w *WavWriter) header(pcmSize int64) []byte {
+	format := w.Format
+	if format == 0 {
+		format = WavFormatPCM
+	}
+	return wavHeader(format, pcmSize, w.sampleRate, w.numChannels, w.bitsPerSample, w.RF64, infoListChunk(w.Tags))
+}
+
+// GenerateWavHeaderFormat returns the header for pcmSize bytes of samples of format.
+// 16-bit PCM of up to two channels gets the header of GenerateWavHeader. Other PCM is
+// described with WAVE_FORMAT_EXTENSIBLE, as recommended for more than 16 bits or two
+// channels. Other formats, e.g. WavFormatFloat, have the fact chunk with the number of
+// sample frames that non-PCM formats require.
+func GenerateWavHeaderFormat(format WavFormat, pcmSize int64, sampleRate, numChannels, bitsPerSample int) []byte {
+	return wavHeader(format, pcmSize, sampleRate, numChannels, bitsPerSample, false, nil)
+}
+
+// wavHeader is GenerateWavHeaderFormat, with rf64 set it reserves the space of a ds64 chunk
+// like GenerateRF64Header. chunks, e.g. a LIST chunk, are put in front of the data chunk.
+func wavHeader(format WavFormat, pcmSize int64, sampleRate, numChannels, bitsPerSample int, rf64 bool, chunks []byte) []byte {
+	blockAlign := numChannels * ((bitsPerSample + 7) / 8)
+	frames := int64(0)
+	if blockAlign > 0 {
+		frames = pcmSize / int64(blockAlign)
+	}
+	extensible := numChannels > 2 || (format == WavFormatPCM && bitsPerSample > 16)
+	fmtSize := 16
+	if extensible {
+		fmtSize = 40
+	} else if format != WavFormatPCM {
+		fmtSize = 18
+	}
+
+	h := make([]byte, 0, RF64HeaderSize+40+len(chunks))
+	h = append(h, "RIFF\x00\x00\x00\x00WAVE"...)
+	if rf64 {
+		h = append(h, "JUNK\x1c\x00\x00\x00"...)
+		h = append(h, make([]byte, 28)...)
+	}
+
+	h = append(h, "fmt "...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(fmtSize))
+	code := uint16(format)
+	if extensible {
+		code = wavFormatExtensible
+	}
+	h = binary.LittleEndian.AppendUint16(h, code)
+	h = binary.LittleEndian.AppendUint16(h, uint16(numChannels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(sampleRate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(sampleRate*blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(blockAlign))
+	h = binary.LittleEndian.AppendUint16(h, uint16(bitsPerSample))
+	if fmtSize > 16 {
+		h = binary.LittleEndian.AppendUint16(h, uint16(fmtSize-18)) // cbSize
+	}
+	if extensible {
+		mask := uint32(1)<<numChannels - 1
+		if numChannels == 1 {
+			mask = 0x4 // front center
+		}
+		h = binary.LittleEndian.AppendUint16(h, uint16(bitsPerSample)) // valid bits
+		h = binary.LittleEndian.AppendUint32(h, mask)
+		// The sub format GUID is the format code followed by the KSDATAFORMAT_SUBTYPE suffix
+		h = binary.LittleEndian.AppendUint32(h, uint32(format))
+		h = append(h, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71)
+	}
+
+	if format != WavFormatPCM {
+		h = append(h, "fact\x04\x00\x00\x00"...)
+		h = binary.LittleEndian.AppendUint32(h, uint32(min(frames, math.MaxUint32)))
+	}
+	h = append(h, chunks...)
+	h = append(h, "data\x00\x00\x00\x00"...)
+
+	riffSize := int64(len(h)) - 8 + pcmSize
+	if rf64 && riffSize > math.MaxUint32 {
+		copy(h[0:4], "RF64")
+		binary.LittleEndian.PutUint32(h[4:8], math.MaxUint32)
+		copy(h[12:16], "ds64")
+		binary.LittleEndian.PutUint64(h[20:28], uint64(riffSize))
+		binary.LittleEndian.PutUint64(h[28:36], uint64(pcmSize))
+		binary.LittleEndian.PutUint64(h[36:44], uint64(frames))
+		// h[44:48] is the empty chunk size table
+		binary.LittleEndian.PutUint32(h[len(h)-4:], math.MaxUint32)
+	} else {
+		binary.LittleEndian.PutUint32(h[4:8], uint32(riffSize))
+		binary.LittleEndian.PutUint32(h[len(h)-4:], uint32(pcmSize))
+	}
+	return h
+}
+
+// updateWavHeader rewrites the header of a WAV file being written, with sync set it is
+// synced to storage if the writer has a Sync method.
+func updateWavHeader(writer io.WriteSeeker, header []byte, sync bool) error {
+	if _, err := writer.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek to start failed: %w", err)
+	}
+	if _, err := writer.Write(header); err != nil {
+		return fmt.Errorf("update header failed: %w", err)
+	}
+	if _, err := writer.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("seek to end failed: %w", err)
+	}
+	if s, ok := writer.(interface{ Sync() error }); ok && sync {
+		if err := s.Sync(); err != nil {
+			return fmt.Errorf("sync failed: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package mp3_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestWavWriter(t *testing.T) {
+	pcm := generateSineWave(440, 22050, 2, 2205)
+
+	// A seekable destination gets the sizes on Close
+	var file mp3.SeekableBuffer
+	w := mp3.NewWavWriter(&file, 22050, 2, 16)
+	for pos := 0; pos < len(pcm); pos += 1000 {
+		if _, err := w.Write(pcm[pos:min(pos+1000, len(pcm))]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	want := append(mp3.GenerateWavHeader(len(pcm), 22050, 2, 16), pcm...)
+	if !bytes.Equal(file.Bytes(), want) {
+		t.Errorf("Seekable output differs from GenerateWavHeader and the PCM")
+	}
+
+	// A pipe gets the streaming sizes
+	var pipe bytes.Buffer
+	w = mp3.NewWavWriter(&pipe, 22050, 2, 16)
+	if _, err := w.Write(pcm); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if size := binary.LittleEndian.Uint32(pipe.Bytes()[40:]); size != math.MaxUint32 {
+		t.Errorf("Streaming data size = %#x", size)
+	}
+	info, data, err := mp3.ParseWav(bytes.NewReader(pipe.Bytes()))
+	if err != nil || !info.Streaming() {
+		t.Fatalf("ParseWav(streaming) = %+v, %v", info, err)
+	}
+	if got, _ := io.ReadAll(data); !bytes.Equal(got, pcm) {
+		t.Errorf("Streaming output holds %d bytes of PCM, want %d", len(got), len(pcm))
+	}
+
+	// Close without samples writes an empty WAV
+	var empty mp3.SeekableBuffer
+	w = mp3.NewWavWriter(&empty, 8000, 1, 16)
+	w.RF64 = true
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !bytes.Equal(empty.Bytes(), mp3.GenerateRF64Header(0, 8000, 1, 16)) {
+		t.Error("Empty output is not the RF64 header of no data")
+	}
+	t.Logf("✓ WavWriter wrote %d bytes seekable, %d bytes streaming", file.Len(), pipe.Len())
+}
+
+func TestDecodeToWavPipe(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, _ := encoder.EncodeAppend(nil, generateSineWave(440, 44100, 2, 44100))
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	var file mp3.SeekableBuffer
+	if _, _, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), &file, nil); err != nil {
+		t.Fatalf("DecodeToWav(file) failed: %v", err)
+	}
+	var pipe bytes.Buffer
+	totalBytes, totalSamples, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), &pipe, nil)
+	if err != nil {
+		t.Fatalf("DecodeToWav(pipe) failed: %v", err)
+	}
+	if totalBytes != int64(pipe.Len()) || !bytes.Equal(pipe.Bytes()[mp3.WavHeaderSize:], file.Bytes()[mp3.WavHeaderSize:]) {
+		t.Errorf("Piped output differs: %d bytes reported, %d written", totalBytes, pipe.Len())
+	}
+	t.Logf("✓ Decoded %d samples to a pipe", totalSamples)
+}
+
+func TestGenerateWavHeaderFormat(t *testing.T) {
+	requireNative(t)
+	pcm16 := generateSineWave(440, 44100, 2, 44100)
+	var want mp3.SeekableBuffer
+	wantResult, err := mp3.EncodeFromWav(bytes.NewReader(append(mp3.GenerateWavHeader(len(pcm16), 44100, 2, 16), pcm16...)), &want, nil, nil)
+	if err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	pcm24 := make([]byte, 0, len(pcm16)/2*3)
+	f32 := make([]byte, 0, len(pcm16)*2)
+	for i := 0; i+1 < len(pcm16); i += 2 {
+		v := int16(binary.LittleEndian.Uint16(pcm16[i:]))
+		pcm24 = append(pcm24, 0, pcm16[i], pcm16[i+1])
+		f32 = binary.LittleEndian.AppendUint32(f32, math.Float32bits(float32(v)/32768))
+	}
+
+	testCases := []struct {
+		format     mp3.WavFormat
+		bits       int
+		pcm        []byte
+		headerSize int
+		chunks     int // chunks listed by ParseWav
+	}{
+		{mp3.WavFormatPCM, 16, pcm16, mp3.WavHeaderSize, 0},
+		{mp3.WavFormatPCM, 24, pcm24, 68, 0},
+		{mp3.WavFormatFloat, 32, f32, 58, 1},
+	}
+	for _, tc := range testCases {
+		header := mp3.GenerateWavHeaderFormat(tc.format, int64(len(tc.pcm)), 44100, 2, tc.bits)
+		if len(header) != tc.headerSize {
+			t.Errorf("%v %d-bit header has %d bytes, want %d", tc.format, tc.bits, len(header), tc.headerSize)
+		}
+		wav := append(header, tc.pcm...)
+		info, _, err := mp3.ParseWav(bytes.NewReader(wav))
+		if err != nil || info.Format != tc.format || info.BitsPerSample != tc.bits || info.DataSize != int64(len(tc.pcm)) ||
+			len(info.Chunks) != tc.chunks || binary.LittleEndian.Uint32(wav[4:]) != uint32(len(wav)-8) {
+			t.Fatalf("ParseWav(%v %d-bit) = %+v, %v", tc.format, tc.bits, info, err)
+		}
+
+		var out mp3.SeekableBuffer
+		result, err := mp3.EncodeFromWav(bytes.NewReader(wav), &out, nil, nil)
+		if err != nil {
+			t.Fatalf("EncodeFromWav(%v %d-bit) failed: %v", tc.format, tc.bits, err)
+		}
+		if result.Frames != wantResult.Frames || (tc.format == mp3.WavFormatPCM && !bytes.Equal(out.Bytes(), want.Bytes())) {
+			t.Errorf("EncodeFromWav(%v %d-bit) output differs from 16-bit input", tc.format, tc.bits)
+		}
+		t.Logf("✓ %v %d-bit: %d byte header", tc.format, tc.bits, len(header))
+	}
+
+	// The fact chunk holds the sample frames
+	header := mp3.GenerateWavHeaderFormat(mp3.WavFormatFloat, 8000, 8000, 1, 32)
+	if frames := binary.LittleEndian.Uint32(header[46:]); string(header[38:42]) != "fact" || frames != 2000 {
+		t.Errorf("fact chunk %q holds %d frames, want 2000", header[38:42], frames)
+	}
+}
+
+func TestDecodeToWavOutputFormat(t *testing.T) {
+	requireNative(t)
+	encoder, err := mp3.NewEncoder(&mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 192})
+	if err != nil {
+		t.Fatalf("Failed to create encoder: %v", err)
+	}
+	defer encoder.Close()
+	mp3Data, _ := encoder.EncodeAppend(nil, generateSineWave(440, 44100, 2, 44100))
+	mp3Data, _ = encoder.FlushAppend(mp3Data)
+
+	var ref mp3.SeekableBuffer
+	_, wantSamples, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), &ref, nil)
+	if err != nil {
+		t.Fatalf("DecodeToWav failed: %v", err)
+	}
+	_, data, _ := mp3.ParseWav(bytes.NewReader(ref.Bytes()))
+	want, _ := io.ReadAll(data)
+
+	testCases := []struct {
+		format mp3.SampleFormat
+		wav    mp3.WavFormat
+		bits   int
+	}{
+		{mp3.S24LE, mp3.WavFormatPCM, 24},
+		{mp3.S32LE, mp3.WavFormatPCM, 32},
+		{mp3.F32, mp3.WavFormatFloat, 32},
+	}
+	for _, tc := range testCases {
+		var out mp3.SeekableBuffer
+		_, totalSamples, _, err := mp3.DecodeToWav(bytes.NewReader(mp3Data), &out, &mp3.WavOptions{OutputFormat: tc.format})
+		if err != nil {
+			t.Fatalf("DecodeToWav(%v) failed: %v", tc.format, err)
+		}
+		info, data, err := mp3.ParseWav(bytes.NewReader(out.Bytes()))
+		if err != nil || info.Format != tc.wav || info.BitsPerSample != tc.bits || totalSamples != wantSamples {
+			t.Fatalf("DecodeToWav(%v) = %+v, %d samples, %v", tc.format, info, totalSamples, err)
+		}
+		pcm, _ := io.ReadAll(data)
+
+		// The samples round to the 16-bit output
+		size := tc.bits / 8
+		maxDiff := 0
+		for i := 0; i < len(pcm)/size && 2*i+1 < len(want); i++ {
+			var v float64
+			switch tc.format {
+			case mp3.S24LE:
+				v = float64(int32(uint32(pcm[3*i])<<8|uint32(pcm[3*i+1])<<16|uint32(pcm[3*i+2])<<24)) / 65536
+			case mp3.S32LE:
+				v = float64(int32(binary.LittleEndian.Uint32(pcm[4*i:]))) / 65536
+			case mp3.F32:
+				v = float64(math.Float32frombits(binary.LittleEndian.Uint32(pcm[4*i:]))) * 32768
+			}
+			maxDiff = max(maxDiff, abs(int(math.Round(v))-int(int16(binary.LittleEndian.Uint16(want[2*i:])))))
+		}
+		if maxDiff > 1 {
+			t.Errorf("%v samples differ from 16-bit output by up to %d", tc.format, maxDiff)
+		}
+		t.Logf("✓ %v: %d-bit %v, max difference %d", tc.format, info.BitsPerSample, info.Format, maxDiff)
+	}
+}
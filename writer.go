@@ -0,0 +1,136 @@
+package mp3
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// writerChunkSize is the largest amount of PCM a Writer passes to the encoder per call.
+const writerChunkSize = 64 * 1024
+
+var ErrorWriterClosed = errors.New("mp3 writer closed")
+
+// Writer is an io.WriteCloser that encodes the PCM written to it, see NewWriter.
+// Like Encoder it is not safe for concurrent use.
+type Writer struct {
+	ctx    context.Context
+	out    *wavOutput
+	result *EncodeResult
+	err    error  // first error, returned by all later calls
+	buf    []byte // read buffer of ReadFrom
+}
+
+// NewWriter returns a Writer that encodes interleaved 16-bit PCM in the sample rate and
+// channels of config to w. Writes may split sample frames anywhere. Close flushes the
+// encoder and, if w is an io.WriteSeeker, writes the Xing/LAME tag and the ReplayGain tag
+// at the start of the stream as EncodeFromWav does. Close does not close w.
+func NewWriter(w io.Writer, config *EncoderConfig) (*Writer, error) {
+	return NewWriterContext(context.Background(), w, config)
+}
+
+// NewWriterContext is NewWriter for a Writer that fails with the error of ctx once ctx is
+// done: Write and ReadFrom check ctx before each chunk they encode, and Close releases the
+// encoder without finishing the stream.
+func NewWriterContext(ctx context.Context, w io.Writer, config *EncoderConfig) (*Writer, error) {
+	config = populateEncConfig(config)
+	out, err := newWavOutput(w, config, config.SampleRate, config.NumChannels, writerChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{ctx: ctx, out: out}, nil
+}
+
+// Write encodes p and writes the mp3 data available so far to the underlying writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for written := 0; written < len(p); {
+		if err := w.checkContext(); err != nil {
+			return written, err
+		}
+		n := min(len(p)-written, writerChunkSize)
+		if err := w.out.encode(p[written : written+n]); err != nil {
+			w.fail(err)
+			return written, err
+		}
+		written += n
+	}
+	return len(p), nil
+}
+
+// ReadFrom encodes PCM read from r until EOF, e.g. from a capture device or a pipe.
+// It makes io.Copy read straight into the encoder's chunks. Short reads and sample frames
+// split across reads are handled; the encoder is flushed by Close, so ReadFrom can be
+// called again. Encoder.ReadFrom encodes a whole stream in one call.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.buf == nil {
+		w.buf = make([]byte, writerChunkSize)
+	}
+	var total int64
+	for {
+		if err := w.checkContext(); err != nil {
+			return total, err
+		}
+		n, readErr := r.Read(w.buf)
+		if n > 0 {
+			if err := w.out.encode(w.buf[:n]); err != nil {
+				w.fail(err)
+				return total, err
+			}
+			total += int64(n)
+		}
+		if readErr == io.EOF {
+			return total, nil
+		}
+		if readErr != nil {
+			return total, readErr
+		}
+	}
+}
+
+// Close flushes the encoder, finishes the tags and releases the encoder.
+// Calling Close again returns the result of the first call.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		if w.err == ErrorWriterClosed {
+			return nil
+		}
+		return w.err
+	}
+	if err := w.checkContext(); err != nil {
+		return err
+	}
+	result, err := w.out.finish()
+	if err != nil {
+		w.fail(err)
+		return err
+	}
+	w.result = result
+	w.fail(ErrorWriterClosed)
+	return nil
+}
+
+// Result describes the encoded stream, it is nil until Close has succeeded.
+func (w *Writer) Result() *EncodeResult {
+	return w.result
+}
+
+// fail records the first error and releases the encoder.
+func (w *Writer) fail(err error) {
+	w.err = err
+	w.out.close()
+}
+
+// checkContext fails the writer if its context is done.
+func (w *Writer) checkContext() error {
+	if err := w.ctx.Err(); err != nil {
+		w.fail(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package mp3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/lizc2003/audio-mp3"
+)
+
+func TestWriter(t *testing.T) {
+	requireNative(t)
+	config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128, FindReplayGain: true}
+	wav := generateWavFile(44100, 2, 44100*2)
+
+	var want mp3.SeekableBuffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &want, config, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	var got mp3.SeekableBuffer
+	w, err := mp3.NewWriter(&got, config)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	// Writes of odd sizes split sample frames
+	for chunk := range slicesChunk(wav[mp3.WavHeaderSize:], 1001) {
+		if n, err := w.Write(chunk); err != nil || n != len(chunk) {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("Writer output differs from EncodeFromWav: %d vs %d bytes", got.Len(), want.Len())
+	}
+	if r := w.Result(); r == nil || r.TotalBytes != int64(got.Len()) {
+		t.Errorf("Result = %+v, want %d bytes", r, got.Len())
+	}
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Second Close failed: %v", err)
+	}
+	if _, err := w.Write(wav); !errors.Is(err, mp3.ErrorWriterClosed) {
+		t.Errorf("Write after Close error = %v", err)
+	}
+	t.Logf("✓ Writer: %d bytes", got.Len())
+}
+
+// shortReader returns at most n bytes per Read
+type shortReader struct {
+	r io.Reader
+	n int
+}
+
+func (s *shortReader) Read(p []byte) (int, error) {
+	return s.r.Read(p[:min(len(p), s.n)])
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	requireNative(t)
+	config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128}
+	wav := generateWavFile(44100, 2, 44100)
+	pcm := wav[mp3.WavHeaderSize:]
+
+	var want mp3.SeekableBuffer
+	if _, err := mp3.EncodeFromWav(bytes.NewReader(wav), &want, config, nil); err != nil {
+		t.Fatalf("EncodeFromWav failed: %v", err)
+	}
+
+	var got mp3.SeekableBuffer
+	w, err := mp3.NewWriter(&got, config)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	// io.Copy uses ReadFrom, the short reads split sample frames
+	n, err := io.Copy(w, &shortReader{bytes.NewReader(pcm), 999})
+	if err != nil || n != int64(len(pcm)) {
+		t.Fatalf("io.Copy = %d, %v", n, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("ReadFrom output differs from EncodeFromWav: %d vs %d bytes", got.Len(), want.Len())
+	}
+	t.Logf("✓ ReadFrom: %d PCM bytes, %d mp3 bytes", n, got.Len())
+}
+
+func TestEncoderReadFrom(t *testing.T) {
+	requireNative(t)
+	config := &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2, Bitrate: 128, IsWriteVbrTag: true,
+		Tags: &mp3.TrackTags{Title: "Capture"}, WriteID3v1: true, FindReplayGain: true}
+	pcm := generateSineWave(440, 44100, 2, 44100)
+
+	ref, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer ref.Close()
+	want, err := ref.EncodeAll(pcm)
+	if err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	enc, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer enc.Close()
+	if _, err := enc.ReadFrom(bytes.NewReader(pcm)); err == nil {
+		t.Error("Expected an error without output")
+	}
+	var got mp3.SeekableBuffer
+	enc.SetOutput(&got)
+	// The short reads split sample frames
+	n, err := enc.ReadFrom(&shortReader{bytes.NewReader(pcm), 999})
+	if err != nil || n != int64(len(pcm)) {
+		t.Fatalf("ReadFrom = %d, %v", n, err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("ReadFrom output differs from EncodeAll: %d vs %d bytes", got.Len(), len(want))
+	}
+	tag, err := mp3.ReadID3v2(bytes.NewReader(got.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	gain, peak, ok := tag.ReplayGain()
+	wantGain, wantPeak, _ := enc.ReplayGain()
+	if !ok || math.Abs(gain-wantGain) > 0.01 || math.Abs(peak-wantPeak) > 1e-4 {
+		t.Errorf("ReplayGain %.2f dB peak %.4f (%v), want %.2f dB peak %.4f", gain, peak, ok, wantGain, wantPeak)
+	}
+
+	// Without seeking there is no ReplayGain tag to update
+	plain, err := mp3.NewEncoder(config)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer plain.Close()
+	var stream bytes.Buffer
+	plain.SetOutput(&stream)
+	if _, err := plain.ReadFrom(bytes.NewReader(pcm)); err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	tag, err = mp3.ReadID3v2(bytes.NewReader(stream.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadID3v2 failed: %v", err)
+	}
+	if _, _, ok := tag.ReplayGain(); ok || tag.Text("TIT2") != "Capture" {
+		t.Errorf("Unexpected tag of unseekable output: title %q, ReplayGain %v", tag.Text("TIT2"), ok)
+	}
+	t.Logf("✓ Encoder.ReadFrom: %d PCM bytes, %d mp3 bytes, ReplayGain %.2f dB", n, got.Len(), gain)
+}
+
+func TestWriterContext(t *testing.T) {
+	requireNative(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	w, err := mp3.NewWriterContext(ctx, &out, &mp3.EncoderConfig{SampleRate: 44100, NumChannels: 2})
+	if err != nil {
+		t.Fatalf("NewWriterContext failed: %v", err)
+	}
+	pcm := generateSineWave(440, 44100, 2, 4410)
+	if _, err := w.Write(pcm); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	cancel()
+	if n, err := w.Write(pcm); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Write after cancel = %d, %v", n, err)
+	}
+	if _, err := w.ReadFrom(bytes.NewReader(pcm)); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadFrom after cancel = %v", err)
+	}
+	if err := w.Close(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Close after cancel = %v", err)
+	}
+	if w.Result() != nil {
+		t.Error("Result of a cancelled writer")
+	}
+	t.Logf("✓ Writer cancelled after %d bytes", out.Len())
+}